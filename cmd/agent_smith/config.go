@@ -13,30 +13,147 @@ import (
 
 	"github.com/RewstApp/agent-smith-go/internal/agent"
 	"github.com/RewstApp/agent-smith-go/internal/service"
+	"github.com/RewstApp/agent-smith-go/internal/syslog"
 	"github.com/RewstApp/agent-smith-go/internal/utils"
 	"github.com/RewstApp/agent-smith-go/internal/version"
+	"github.com/hashicorp/go-hclog"
 )
 
 type fetchConfigurationResponse struct {
 	Configuration agent.Device `json:"configuration"`
 }
 
+// missingRequiredFields lists the required config fields that are empty, in
+// the order validateConfiguration reports them.
+func missingRequiredFields(device agent.Device) []string {
+	required := []struct {
+		field string
+		value string
+	}{
+		{"device_id", device.DeviceId},
+		{"rewst_engine_host", device.RewstEngineHost},
+		{"shared_access_key", device.SharedAccessKey},
+		{"azure_iot_hub_host", device.AzureIotHubHost},
+	}
+
+	var missing []string
+	for _, r := range required {
+		if r.value == "" {
+			missing = append(missing, r.field)
+		}
+	}
+	return missing
+}
+
 func validateConfiguration(device agent.Device) error {
-	if device.DeviceId == "" {
-		return fmt.Errorf("missing required field: device_id")
+	if missing := missingRequiredFields(device); len(missing) > 0 {
+		return fmt.Errorf("missing required field: %s", missing[0])
 	}
-	if device.RewstEngineHost == "" {
-		return fmt.Errorf("missing required field: rewst_engine_host")
+	return nil
+}
+
+// validateSyslogSettings rejects a native syslog configuration the service
+// would be unable to start with: an unknown transport, format or facility, or a
+// network transport without a collector address. An empty transport selects the
+// platform writer, which needs no further settings.
+func validateSyslogSettings(device agent.Device) error {
+	if device.SyslogTransport == "" {
+		return nil
+	}
+	transport, err := syslog.ParseTransport(device.SyslogTransport)
+	if err != nil {
+		return err
+	}
+	if transport != syslog.TransportLocal && device.SyslogAddress == "" {
+		return fmt.Errorf("syslog_transport %s requires syslog_address", transport)
 	}
-	if device.SharedAccessKey == "" {
-		return fmt.Errorf("missing required field: shared_access_key")
+	if _, err := syslog.ParseFormat(device.SyslogFormat, transport); err != nil {
+		return err
 	}
-	if device.AzureIotHubHost == "" {
-		return fmt.Errorf("missing required field: azure_iot_hub_host")
+	if _, err := syslog.ParseFacility(device.SyslogFacility); err != nil {
+		return err
 	}
 	return nil
 }
 
+// tuningRange is the accepted range of an optional numeric config field.
+type tuningRange struct {
+	field    string
+	value    *int
+	min, max int
+}
+
+// tuningRanges lists every optional tuning field with the range the agent
+// accepts. A non-positive value is silently replaced by the default at
+// runtime, so anything below min is reported as well. The upper bounds are
+// deliberately generous; they catch typos (seconds given as milliseconds, an
+// extra zero) rather than unusual but working setups.
+func tuningRanges(device agent.Device) []tuningRange {
+	var qos *int
+	if device.MqttQos != nil {
+		v := int(*device.MqttQos)
+		qos = &v
+	}
+
+	return []tuningRange{
+		{"mqtt_qos", qos, 0, 1},
+		{"mqtt_connect_timeout_seconds", device.MqttConnectTimeoutSeconds, 1, 300},
+		{"mqtt_subscribe_timeout_seconds", device.MqttSubscribeTimeoutSeconds, 1, 300},
+		{"worker_count", device.WorkerCount, 1, 256},
+		{"message_queue_size", device.MessageQueueSize, 1, 100_000},
+		{"postback_max_attempts", device.PostbackMaxAttempts, 1, 20},
+		{"postback_base_retry_backoff_seconds", device.PostbackBaseRetryBackoffSeconds, 1, 64},
+		{"command_timeout_seconds", device.CommandTimeoutSeconds, 1, 7 * 24 * 60 * 60},
+		{"max_output_bytes", device.MaxOutputBytes, 1024, 1 << 30},
+		{"sas_token_lifetime_hours", device.SasTokenLifetimeHours, 1, 365 * 24},
+		{"syslog_buffer_size", device.SyslogBufferSize, 1, 1_000_000},
+		{"spool_max_entries", device.SpoolMaxEntries, 1, 100_000},
+		{"spool_max_age_hours", device.SpoolMaxAgeHours, 1, 90 * 24},
+		{"spool_max_bytes", device.SpoolMaxBytes, 1 << 20, 1 << 36},
+		{"spool_drain_concurrency", device.SpoolDrainConcurrency, 1, 16},
+		{"spool_drain_rate_per_minute", device.SpoolDrainRatePerMinute, 1, 6000},
+		{"postback_breaker_threshold", device.PostbackBreakerThreshold, 1, 100},
+		{"postback_breaker_cooldown_seconds", device.PostbackBreakerCooldownSeconds, 1, 3600},
+		{"postback_compression_min_bytes", device.PostbackCompressionMinBytes, 1, 1 << 30},
+		{"output_spill_max_bytes", device.OutputSpillMaxBytes, 1 << 20, 1 << 36},
+	}
+}
+
+// validateTuningRanges returns one error per tuning field set outside its
+// accepted range, or to an unknown spool eviction policy, postback compression
+// or output overflow mode, an invalid engine alternate host or postback path
+// template. Unset fields use their defaults and are always valid.
+func validateTuningRanges(device agent.Device) []error {
+	var errs []error
+	if _, err := agent.ParseSpoolEvictionPolicy(device.SpoolEvictionPolicy); err != nil {
+		errs = append(errs, fmt.Errorf("spool_eviction_policy: %w", err))
+	}
+	if _, err := agent.ParsePostbackCompression(device.PostbackCompression); err != nil {
+		errs = append(errs, fmt.Errorf("postback_compression: %w", err))
+	}
+	if _, err := agent.ParseOutputOverflow(device.OutputOverflow); err != nil {
+		errs = append(errs, fmt.Errorf("output_overflow: %w", err))
+	}
+	if err := device.ValidateEngineAlternateHosts(); err != nil {
+		errs = append(errs, fmt.Errorf("rewst_engine_alternate_hosts: %w", err))
+	}
+	if _, err := agent.ParsePostbackPathTemplate(device.PostbackPathTemplate); err != nil {
+		errs = append(errs, fmt.Errorf("postback_path_template: %w", err))
+	}
+	for _, r := range tuningRanges(device) {
+		if r.value == nil {
+			continue
+		}
+		if *r.value < r.min || *r.value > r.max {
+			errs = append(errs, fmt.Errorf(
+				"%s must be between %d and %d; got %d",
+				r.field, r.min, r.max, *r.value,
+			))
+		}
+	}
+	return errs
+}
+
 func runConfig(params *configContext) error {
 	logger := utils.ConfigureLogger("agent_smith", os.Stdout, utils.Default)
 
@@ -108,6 +225,7 @@ func runConfig(params *configContext) error {
 
 	response.Configuration.LoggingLevel = utils.LoggingLevel(params.LoggingLevel)
 	response.Configuration.UseSyslog = params.UseSyslog
+	response.Configuration.UseJournald = params.UseJournald
 	response.Configuration.DisableAgentPostback = params.DisableAgentPostback
 	response.Configuration.DisableAutoUpdates = params.NoAutoUpdates
 	response.Configuration.GithubToken = params.GithubToken
@@ -135,28 +253,103 @@ func runConfig(params *configContext) error {
 	response.Configuration.CommandTimeoutSeconds = tuningPtr(params.Tuning.CommandTimeoutSeconds)
 	response.Configuration.SasTokenLifetimeHours = tuningPtr(params.Tuning.SasTokenLifetimeHours)
 	response.Configuration.MaxOutputBytes = tuningPtr(params.Tuning.MaxOutputBytes)
+	response.Configuration.SyslogBufferSize = tuningPtr(params.Tuning.SyslogBufferSize)
+	response.Configuration.SpoolMaxEntries = tuningPtr(params.Tuning.SpoolMaxEntries)
+	response.Configuration.SpoolMaxAgeHours = tuningPtr(params.Tuning.SpoolMaxAgeHours)
+	response.Configuration.SpoolMaxBytes = tuningPtr(params.Tuning.SpoolMaxBytes)
+	response.Configuration.SpoolEvictionPolicy = params.Tuning.spoolEvictionPolicy()
+	response.Configuration.SpoolDrainConcurrency = tuningPtr(params.Tuning.SpoolDrainConcurrency)
+	response.Configuration.SpoolDrainRatePerMinute = tuningPtr(
+		params.Tuning.SpoolDrainRatePerMinute,
+	)
+	response.Configuration.PostbackBreakerThreshold = tuningPtr(
+		params.Tuning.PostbackBreakerThreshold,
+	)
+	response.Configuration.PostbackBreakerCooldownSeconds = tuningPtr(
+		params.Tuning.PostbackBreakerCooldownSeconds,
+	)
+	response.Configuration.PostbackCompression = params.Tuning.postbackCompression()
+	response.Configuration.PostbackCompressionMinBytes = tuningPtr(
+		params.Tuning.PostbackCompressionMinBytes,
+	)
+	response.Configuration.OutputOverflow = params.Tuning.outputOverflow()
+	response.Configuration.OutputSpillMaxBytes = tuningPtr(params.Tuning.OutputSpillMaxBytes)
+	params.Tuning.applyEngineSettings(&response.Configuration)
+	params.Syslog.applyTo(&response.Configuration)
+
+	return installConfiguration(params, response.Configuration, logger)
+}
+
+// configRedacted replaces secret config values in logs and support bundles.
+const configRedacted = "REDACTED"
+
+// configSecretFields are the config.json keys whose values are never logged
+// and never leave the host in a support bundle.
+var configSecretFields = []string{"shared_access_key", "github_token"}
+
+// redactConfig returns the config JSON in data, indented, with every secret
+// field replaced by a placeholder. Unknown fields are kept.
+func redactConfig(data []byte) ([]byte, error) {
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+
+	for _, field := range configSecretFields {
+		if _, ok := config[field]; ok {
+			config[field] = configRedacted
+		}
+	}
+
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// installConfiguration saves device as the config of params.OrgId, installs
+// the agent executable and re-registers and starts the service. Config and
+// import modes share it so an imported config is installed exactly like a
+// fetched one.
+func installConfiguration(params *configContext, device agent.Device, logger hclog.Logger) error {
+	if err := validateSyslogSettings(device); err != nil {
+		return fmt.Errorf("invalid syslog settings: %w", err)
+	}
 
 	// Create the data directory
 	dataDir := agent.GetDataDirectory(params.OrgId)
-	err = params.FS.MkdirAll(dataDir)
+	err := params.FS.MkdirAll(dataDir)
 	if err != nil {
 		return fmt.Errorf("failed to create data directory: %w", err)
 	}
 
+	// Record the service account so repair can register the service under it
+	device.ServiceUsername = params.ServiceUsername
+
 	// Save the configuration file
 	configFilePath := agent.GetConfigFilePath(params.OrgId)
-	configBytes, err := json.MarshalIndent(response.Configuration, "", "  ")
+	configBytes, err := json.MarshalIndent(device, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to print config file: %w", err)
 	}
 
-	// Got configuration
-	logger.Info("Received configuration", "configuration", string(configBytes))
+	// Got configuration. The secrets are left out of the log, which an
+	// imported bundle was encrypted to protect.
+	redacted, err := redactConfig(configBytes)
+	if err != nil {
+		return fmt.Errorf("failed to print config file: %w", err)
+	}
+	logger.Info("Received configuration", "configuration", string(redacted))
 
-	err = params.FS.WriteFile(configFilePath, configBytes, utils.DefaultFileMod)
+	err = agent.WriteConfigFile(params.FS, configFilePath, device)
 	if err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
+	err = grantServiceAccount(configFilePath, device.ServiceUsername)
+	if err != nil {
+		logger.Warn(
+			"Failed to give the service account the config file",
+			"account", device.ServiceUsername,
+			"error", err,
+		)
+	}
 
 	name := agent.GetServiceName(params.OrgId)
 
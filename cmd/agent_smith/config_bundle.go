@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+	"github.com/RewstApp/agent-smith-go/internal/version"
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	// configBundleFormat identifies a config bundle written by --export-config.
+	configBundleFormat = "rewst-agent-config"
+	// configBundleVersion is the bundle layout this binary writes and reads.
+	configBundleVersion = 1
+	// configBundleFileMod keeps a bundle private to its owner even though its
+	// secrets, if any, are encrypted.
+	configBundleFileMod os.FileMode = 0o600
+
+	bundleKdf           = "pbkdf2-sha256"
+	bundleCipher        = "aes-256-gcm"
+	bundleKdfIterations = 600_000
+	// bundleMaxKdfIterations bounds the work an imported bundle can ask for.
+	bundleMaxKdfIterations = 10_000_000
+	bundleKeySize          = 32
+	bundleSaltSize         = 16
+)
+
+// configBundle is the portable form of an agent config. The secrets are never
+// in Configuration: they are either left out or encrypted into Secrets.
+type configBundle struct {
+	Format        string          `json:"format"`
+	Version       int             `json:"version"`
+	ExportedAt    time.Time       `json:"exported_at"`
+	AgentVersion  string          `json:"agent_version"`
+	Configuration json.RawMessage `json:"configuration"`
+	Secrets       *bundleSecrets  `json:"secrets,omitempty"`
+}
+
+// configSecrets are the config fields a bundle never carries in clear text.
+type configSecrets struct {
+	SharedAccessKey string `json:"shared_access_key,omitempty"`
+	GithubToken     string `json:"github_token,omitempty"`
+}
+
+// bundleSecrets holds the configSecrets encrypted with a key derived from the
+// operator's passphrase.
+type bundleSecrets struct {
+	Kdf        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Cipher     string `json:"cipher"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// takeSecrets returns the secrets of device and clears them from it.
+func takeSecrets(device *agent.Device) configSecrets {
+	secrets := configSecrets{
+		SharedAccessKey: device.SharedAccessKey,
+		GithubToken:     device.GithubToken,
+	}
+	device.SharedAccessKey = ""
+	device.GithubToken = ""
+	return secrets
+}
+
+func (s configSecrets) applyTo(device *agent.Device) {
+	device.SharedAccessKey = s.SharedAccessKey
+	device.GithubToken = s.GithubToken
+}
+
+// readPassphrase reads a passphrase file, ignoring a trailing line break.
+func readPassphrase(fsys utils.FileSystem, path string) ([]byte, error) {
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase file %s is empty", path)
+	}
+	return []byte(passphrase), nil
+}
+
+func bundleKey(passphrase []byte, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, iterations, bundleKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptSecrets(secrets configSecrets, passphrase []byte) (*bundleSecrets, error) {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, bundleSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := bundleKey(passphrase, salt, bundleKdfIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &bundleSecrets{
+		Kdf:        bundleKdf,
+		Iterations: bundleKdfIterations,
+		Cipher:     bundleCipher,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	}, nil
+}
+
+func decryptSecrets(sealed *bundleSecrets, passphrase []byte) (configSecrets, error) {
+	var secrets configSecrets
+
+	if sealed.Kdf != bundleKdf || sealed.Cipher != bundleCipher {
+		return secrets, fmt.Errorf("unsupported encryption %s/%s", sealed.Kdf, sealed.Cipher)
+	}
+	if sealed.Iterations < 1 || sealed.Iterations > bundleMaxKdfIterations {
+		return secrets, fmt.Errorf("unsupported iteration count %d", sealed.Iterations)
+	}
+
+	aead, err := bundleKey(passphrase, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return secrets, err
+	}
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return secrets, fmt.Errorf("invalid nonce")
+	}
+	plaintext, err := aead.Open(nil, sealed.Nonce, sealed.Ciphertext, nil)
+	if err != nil {
+		return secrets, fmt.Errorf("wrong passphrase or corrupted bundle")
+	}
+
+	err = json.Unmarshal(plaintext, &secrets)
+	return secrets, err
+}
+
+// runExportConfig writes the installed config of params.OrgId to a bundle.
+// The secrets are left out unless a passphrase is given to encrypt them with.
+func runExportConfig(params *exportConfigContext) error {
+	logger := utils.ConfigureLogger("agent_smith", os.Stdout, utils.Default)
+
+	// Show header
+	logger.Info("Agent Smith started", "version", version.Version, "os", runtime.GOOS)
+
+	return exportConfig(params, logger)
+}
+
+func exportConfig(params *exportConfigContext, logger hclog.Logger) error {
+	configFilePath := agent.GetConfigFilePath(params.OrgId)
+	configBytes, err := params.FS.ReadFile(configFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	device, _, err := agent.ParseConfig(configBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", configFilePath, err)
+	}
+	secrets := takeSecrets(&device)
+
+	bundle := configBundle{
+		Format:       configBundleFormat,
+		Version:      configBundleVersion,
+		ExportedAt:   time.Now().UTC(),
+		AgentVersion: version.Version,
+	}
+
+	device.SchemaVersion = max(device.SchemaVersion, agent.CurrentSchemaVersion)
+	bundle.Configuration, err = json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	if params.PassphraseFile != "" {
+		passphrase, err := readPassphrase(params.FS, params.PassphraseFile)
+		if err != nil {
+			return err
+		}
+		bundle.Secrets, err = encryptSecrets(secrets, passphrase)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt secrets: %w", err)
+		}
+		logger.Info("Secrets encrypted with the passphrase")
+	} else {
+		logger.Warn("Secrets omitted; the importing host must already have them or " +
+			"the bundle must be exported with --passphrase-file")
+	}
+
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode bundle: %w", err)
+	}
+	err = params.FS.WriteFile(params.ExportConfig, data, configBundleFileMod)
+	if err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	logger.Info("Config exported", "path", params.ExportConfig)
+	return nil
+}
+
+// runImportConfig installs the agent of params.OrgId with the config in a
+// bundle, through the same path as config mode.
+func runImportConfig(params *importConfigContext) error {
+	logger := utils.ConfigureLogger("agent_smith", os.Stdout, utils.Default)
+
+	// Show header
+	logger.Info("Agent Smith started", "version", version.Version, "os", runtime.GOOS)
+
+	device, err := readConfigBundle(params, logger)
+	if err != nil {
+		return err
+	}
+
+	serviceUsername := params.ServiceUsername
+	if serviceUsername == "" {
+		serviceUsername = device.ServiceUsername
+	}
+
+	return installConfiguration(&configContext{
+		OrgId:           params.OrgId,
+		ServiceUsername: serviceUsername,
+		ServicePassword: params.ServicePassword,
+		FS:              params.FS,
+		ServiceManager:  params.ServiceManager,
+	}, device, logger)
+}
+
+// readConfigBundle reads and validates the config in a bundle. Secrets come
+// from the bundle when it has them, otherwise from the config already installed
+// for the same device. The bundle must belong to params.OrgId. The source
+// host's service account and the fields this release does not know are
+// dropped unless params.KeepSourceFields is set.
+func readConfigBundle(params *importConfigContext, logger hclog.Logger) (agent.Device, error) {
+	var device agent.Device
+
+	data, err := params.FS.ReadFile(params.ImportConfig)
+	if err != nil {
+		return device, fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	var bundle configBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return device, fmt.Errorf("failed to parse bundle: %w", err)
+	}
+	if bundle.Format != configBundleFormat {
+		return device, fmt.Errorf("%s is not a config bundle", params.ImportConfig)
+	}
+	if bundle.Version != configBundleVersion {
+		return device, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+
+	device, _, err = agent.ParseConfig(bundle.Configuration)
+	if err != nil {
+		return device, fmt.Errorf("failed to parse bundle config: %w", err)
+	}
+	if device.RewstOrgId == "" {
+		return device, fmt.Errorf("the bundle config has no rewst_org_id")
+	}
+	if device.RewstOrgId != params.OrgId {
+		return device, fmt.Errorf(
+			"the bundle is for org %q, not %q; import it with --org-id %s",
+			device.RewstOrgId, params.OrgId, device.RewstOrgId,
+		)
+	}
+	if !params.KeepSourceFields {
+		if device.ServiceUsername != "" || device.Unknown != nil {
+			logger.Info("Dropping the source host's service account and unknown fields")
+		}
+		device.ServiceUsername = ""
+		device.Unknown = nil
+		device.SchemaVersion = min(device.SchemaVersion, agent.CurrentSchemaVersion)
+	}
+
+	if bundle.Secrets != nil {
+		if params.PassphraseFile == "" {
+			return device, fmt.Errorf("the bundle secrets are encrypted; pass --passphrase-file")
+		}
+		passphrase, err := readPassphrase(params.FS, params.PassphraseFile)
+		if err != nil {
+			return device, err
+		}
+		secrets, err := decryptSecrets(bundle.Secrets, passphrase)
+		if err != nil {
+			return device, fmt.Errorf("failed to decrypt secrets: %w", err)
+		}
+		secrets.applyTo(&device)
+	} else if installed, ok := installedSecrets(params, device.DeviceId); ok {
+		logger.Info("Keeping the secrets of the installed config")
+		installed.applyTo(&device)
+	}
+
+	var errs []error
+	if err := validateConfiguration(device); err != nil {
+		errs = append(errs, err)
+	}
+	if !allowedLoggingLevels[string(device.LoggingLevel)] {
+		errs = append(errs, fmt.Errorf("invalid logging_level %q", device.LoggingLevel))
+	}
+	errs = append(errs, validateTuningRanges(device)...)
+	if err := errors.Join(errs...); err != nil {
+		return device, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return device, nil
+}
+
+// installedSecrets returns the secrets of the config installed for the org if
+// it belongs to the same device.
+func installedSecrets(params *importConfigContext, deviceId string) (configSecrets, bool) {
+	configBytes, err := params.FS.ReadFile(agent.GetConfigFilePath(params.OrgId))
+	if err != nil {
+		return configSecrets{}, false
+	}
+	installed, _, err := agent.ParseConfig(configBytes)
+	if err != nil || installed.DeviceId != deviceId {
+		return configSecrets{}, false
+	}
+	return takeSecrets(&installed), true
+}
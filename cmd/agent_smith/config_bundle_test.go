@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/hashicorp/go-hclog"
+)
+
+const bundleTestConfig = `{
+  "device_id": "dev-1",
+  "rewst_org_id": "test-org",
+  "rewst_engine_host": "engine.example.com",
+  "shared_access_key": "s3cret-key",
+  "azure_iot_hub_host": "hub.example.net",
+  "logging_level": "info",
+  "github_token": "ghp_token",
+  "worker_count": 8,
+  "plugins": [{"name": "notify", "executable_path": "/opt/notify"}]
+}`
+
+// newBundleTestFS returns a file system backed by files, which WriteFile
+// updates.
+func newBundleTestFS(files map[string][]byte) *mockFileSystem {
+	return &mockFileSystem{
+		readFileFunc: func(name string) ([]byte, error) {
+			data, ok := files[name]
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			return data, nil
+		},
+		writeFileFunc: func(name string, data []byte, _ os.FileMode) error {
+			files[name] = data
+			return nil
+		},
+	}
+}
+
+func exportTestBundle(t *testing.T, passphrase string) []byte {
+	t.Helper()
+	files := map[string][]byte{
+		agent.GetConfigFilePath("test-org"): []byte(bundleTestConfig),
+	}
+	params := &exportConfigContext{
+		OrgId:        "test-org",
+		ExportConfig: "bundle.json",
+		FS:           newBundleTestFS(files),
+	}
+	if passphrase != "" {
+		files["pass.txt"] = []byte(passphrase + "\n")
+		params.PassphraseFile = "pass.txt"
+	}
+
+	if err := exportConfig(params, hclog.NewNullLogger()); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	return files["bundle.json"]
+}
+
+func TestExportConfig_OmitsSecrets(t *testing.T) {
+	data := exportTestBundle(t, "")
+
+	if strings.Contains(string(data), "s3cret-key") || strings.Contains(string(data), "ghp_token") {
+		t.Fatalf("expected no secrets in the bundle:\n%s", data)
+	}
+
+	var bundle configBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatalf("parse bundle: %v", err)
+	}
+	if bundle.Format != configBundleFormat || bundle.Secrets != nil {
+		t.Errorf("unexpected bundle header: %+v", bundle)
+	}
+
+	var device agent.Device
+	if err := json.Unmarshal(bundle.Configuration, &device); err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	if device.DeviceId != "dev-1" || *device.WorkerCount != 8 || len(device.Plugins) != 1 {
+		t.Errorf("expected the settings to be kept, got %+v", device)
+	}
+}
+
+func TestExportConfig_EncryptsSecrets(t *testing.T) {
+	data := exportTestBundle(t, "correct horse")
+
+	if strings.Contains(string(data), "s3cret-key") || strings.Contains(string(data), "ghp_token") {
+		t.Fatalf("expected no clear text secrets in the bundle:\n%s", data)
+	}
+
+	var bundle configBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatalf("parse bundle: %v", err)
+	}
+	if bundle.Secrets == nil || bundle.Secrets.Kdf != bundleKdf {
+		t.Errorf("expected encrypted secrets, got %+v", bundle.Secrets)
+	}
+}
+
+func TestExportConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string][]byte
+		pass    string
+		message string
+	}{
+		{"no config", map[string][]byte{}, "", "failed to read config"},
+		{
+			"empty passphrase",
+			map[string][]byte{
+				agent.GetConfigFilePath("test-org"): []byte(bundleTestConfig),
+				"pass.txt":                          []byte("\n"),
+			},
+			"pass.txt",
+			"is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &exportConfigContext{
+				OrgId:          "test-org",
+				ExportConfig:   "bundle.json",
+				PassphraseFile: tt.pass,
+				FS:             newBundleTestFS(tt.files),
+			}
+			err := exportConfig(params, hclog.NewNullLogger())
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected error %s, got %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestReadConfigBundle_Encrypted(t *testing.T) {
+	files := map[string][]byte{
+		"bundle.json": exportTestBundle(t, "correct horse"),
+		"pass.txt":    []byte("correct horse"),
+		"wrong.txt":   []byte("battery staple"),
+	}
+
+	params := &importConfigContext{
+		OrgId:          "test-org",
+		ImportConfig:   "bundle.json",
+		PassphraseFile: "pass.txt",
+		FS:             newBundleTestFS(files),
+	}
+	device, err := readConfigBundle(params, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if device.SharedAccessKey != "s3cret-key" || device.GithubToken != "ghp_token" {
+		t.Errorf("expected the secrets restored, got %+v", device)
+	}
+	if *device.WorkerCount != 8 {
+		t.Errorf("expected the settings kept, got %+v", device)
+	}
+
+	params.PassphraseFile = "wrong.txt"
+	_, err = readConfigBundle(params, hclog.NewNullLogger())
+	if err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("expected wrong passphrase error, got %v", err)
+	}
+
+	params.PassphraseFile = ""
+	_, err = readConfigBundle(params, hclog.NewNullLogger())
+	if err == nil || !strings.Contains(err.Error(), "--passphrase-file") {
+		t.Errorf("expected passphrase required error, got %v", err)
+	}
+}
+
+func TestReadConfigBundle_SecretsFromInstalledConfig(t *testing.T) {
+	bundle := exportTestBundle(t, "")
+
+	// The installed config of the same device provides the secrets
+	files := map[string][]byte{
+		"bundle.json":                       bundle,
+		agent.GetConfigFilePath("test-org"): []byte(bundleTestConfig),
+	}
+	params := &importConfigContext{
+		OrgId:        "test-org",
+		ImportConfig: "bundle.json",
+		FS:           newBundleTestFS(files),
+	}
+	device, err := readConfigBundle(params, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if device.SharedAccessKey != "s3cret-key" {
+		t.Errorf("expected the installed secrets, got %+v", device)
+	}
+
+	// Without an installed config the bundle fails validation
+	delete(files, agent.GetConfigFilePath("test-org"))
+	_, err = readConfigBundle(params, hclog.NewNullLogger())
+	if err == nil || !strings.Contains(err.Error(), "missing required field: shared_access_key") {
+		t.Errorf("expected missing shared_access_key, got %v", err)
+	}
+}
+
+func TestReadConfigBundle_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		bundle  string
+		message string
+	}{
+		{"not json", "{", "failed to parse bundle"},
+		{"not a bundle", `{"format":"other"}`, "is not a config bundle"},
+		{
+			"newer bundle",
+			`{"format":"rewst-agent-config","version":2}`,
+			"unsupported bundle version 2",
+		},
+		{
+			"bad tuning",
+			`{"format":"rewst-agent-config","version":1,"configuration":{` +
+				`"device_id":"d","rewst_org_id":"test-org","rewst_engine_host":"e",` +
+				`"shared_access_key":"k",` +
+				`"azure_iot_hub_host":"h","worker_count":0,"logging_level":"loud"}}`,
+			"worker_count must be between",
+		},
+		{
+			"other org",
+			`{"format":"rewst-agent-config","version":1,` +
+				`"configuration":{"device_id":"d","rewst_org_id":"other-org"}}`,
+			`the bundle is for org "other-org", not "test-org"`,
+		},
+		{
+			"no org",
+			`{"format":"rewst-agent-config","version":1,"configuration":{"device_id":"d"}}`,
+			"has no rewst_org_id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &importConfigContext{
+				OrgId:        "test-org",
+				ImportConfig: "bundle.json",
+				FS:           newBundleTestFS(map[string][]byte{"bundle.json": []byte(tt.bundle)}),
+			}
+			_, err := readConfigBundle(params, hclog.NewNullLogger())
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected error %s, got %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestReadConfigBundle_SourceFields(t *testing.T) {
+	bundle := `{"format":"rewst-agent-config","version":1,"configuration":{` +
+		`"device_id":"dev-1","rewst_org_id":"test-org","rewst_engine_host":"e",` +
+		`"shared_access_key":"k","azure_iot_hub_host":"h","logging_level":"info",` +
+		`"service_username":"source-svc","schema_version":99,"future_field":true}}`
+	params := &importConfigContext{
+		OrgId:        "test-org",
+		ImportConfig: "bundle.json",
+		FS:           newBundleTestFS(map[string][]byte{"bundle.json": []byte(bundle)}),
+	}
+
+	device, err := readConfigBundle(params, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if device.ServiceUsername != "" || device.Unknown != nil {
+		t.Errorf("expected the source host's fields dropped, got %+v", device)
+	}
+	if device.SchemaVersion != agent.CurrentSchemaVersion {
+		t.Errorf("expected schema_version %d, got %d",
+			agent.CurrentSchemaVersion, device.SchemaVersion)
+	}
+
+	params.KeepSourceFields = true
+	device, err = readConfigBundle(params, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if device.ServiceUsername != "source-svc" || device.Unknown["future_field"] == nil {
+		t.Errorf("expected the source host's fields kept, got %+v", device)
+	}
+	if device.SchemaVersion != 99 {
+		t.Errorf("expected schema_version 99, got %d", device.SchemaVersion)
+	}
+}
+
+func TestRunImportConfig_InstallsAndRegistersService(t *testing.T) {
+	files := map[string][]byte{
+		"bundle.json": exportTestBundle(t, "correct horse"),
+		"pass.txt":    []byte("correct horse"),
+		"/exe":        []byte("binary"),
+	}
+	fs := newBundleTestFS(files)
+	fs.executableFunc = func() (string, error) { return "/exe", nil }
+	fs.mkdirAllFunc = func(string) error { return nil }
+	svcMgr := &mockServiceManager{
+		openErr:       errors.New("not found"),
+		createService: &mockService{},
+	}
+	params := &importConfigContext{
+		OrgId:           "test-org",
+		ImportConfig:    "bundle.json",
+		PassphraseFile:  "pass.txt",
+		ServiceUsername: "rewst",
+		ServiceManager:  svcMgr,
+		FS:              fs,
+	}
+
+	if err := runImportConfig(params); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	device, _, err := agent.ParseConfig(files[agent.GetConfigFilePath("test-org")])
+	if err != nil {
+		t.Fatalf("parse installed config: %v", err)
+	}
+	if device.SharedAccessKey != "s3cret-key" || *device.WorkerCount != 8 {
+		t.Errorf("expected the bundle config installed, got %+v", device)
+	}
+	if device.ServiceUsername != "rewst" {
+		t.Errorf("expected the service account recorded, got %q", device.ServiceUsername)
+	}
+
+	if len(svcMgr.createCalls) != 1 {
+		t.Fatalf("expected the service registered once, got %d", len(svcMgr.createCalls))
+	}
+	call := svcMgr.createCalls[0]
+	if call.OrgId != "test-org" || call.ServiceUsername != "rewst" {
+		t.Errorf("unexpected service registration %+v", call)
+	}
+}
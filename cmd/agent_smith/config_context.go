@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/RewstApp/agent-smith-go/internal/agent"
 	"github.com/RewstApp/agent-smith-go/internal/service"
+	"github.com/RewstApp/agent-smith-go/internal/syslog"
 	"github.com/RewstApp/agent-smith-go/internal/utils"
 )
 
@@ -33,6 +35,25 @@ type tuningFlags struct {
 	CommandTimeoutSeconds           int
 	SasTokenLifetimeHours           int
 	MaxOutputBytes                  int
+	SyslogBufferSize                int
+	SpoolMaxEntries                 int
+	SpoolMaxAgeHours                int
+	SpoolMaxBytes                   int
+	SpoolDrainConcurrency           int
+	SpoolDrainRatePerMinute         int
+	PostbackBreakerThreshold        int
+	PostbackBreakerCooldownSeconds  int
+	PostbackCompressionMinBytes     int
+	OutputSpillMaxBytes             int
+	// SpoolEvictionPolicy, PostbackCompression and OutputOverflow are empty
+	// when their flags are omitted.
+	SpoolEvictionPolicy string
+	PostbackCompression string
+	OutputOverflow      string
+	// EngineAlternateHosts and PostbackPathTemplate apply only when their flags
+	// are provided; an empty value then clears the setting.
+	EngineAlternateHosts string
+	PostbackPathTemplate string
 	// provided records which tuning flag names the operator explicitly set. It is
 	// populated from flag.FlagSet.Visit after parsing so validation can flag an
 	// explicitly-provided non-positive value (e.g. --worker-count -1) even when it
@@ -52,6 +73,21 @@ var tuningFlagNames = []string{
 	"command-timeout-seconds",
 	"sas-token-lifetime-hours",
 	"max-output-bytes",
+	"syslog-buffer-size",
+	"spool-max-entries",
+	"spool-max-age-hours",
+	"spool-max-bytes",
+	"spool-eviction-policy",
+	"spool-drain-concurrency",
+	"spool-drain-rate-per-minute",
+	"postback-breaker-threshold",
+	"postback-breaker-cooldown-seconds",
+	"postback-compression",
+	"postback-compression-min-bytes",
+	"output-overflow",
+	"output-spill-max-bytes",
+	"engine-alternate-hosts",
+	"postback-path-template",
 }
 
 // captureProvided records which tuning flags were explicitly set on fs so that
@@ -127,6 +163,96 @@ func bindTuningFlags(fs *flag.FlagSet, t *tuningFlags) {
 		tuningFlagUnset,
 		"Maximum bytes of command output kept per stream before truncation (positive integer)",
 	)
+	fs.IntVar(
+		&t.SyslogBufferSize,
+		"syslog-buffer-size",
+		tuningFlagUnset,
+		"Messages queued for the native syslog collector before dropping (positive integer)",
+	)
+	fs.IntVar(
+		&t.SpoolMaxEntries,
+		"spool-max-entries",
+		tuningFlagUnset,
+		"Undelivered postbacks kept in the spool before eviction (positive integer)",
+	)
+	fs.IntVar(
+		&t.SpoolMaxAgeHours,
+		"spool-max-age-hours",
+		tuningFlagUnset,
+		"Hours an undelivered postback is kept in the spool (positive integer)",
+	)
+	fs.IntVar(
+		&t.SpoolMaxBytes,
+		"spool-max-bytes",
+		tuningFlagUnset,
+		"Total bytes the postback spool may use on disk (positive integer)",
+	)
+	fs.StringVar(
+		&t.SpoolEvictionPolicy,
+		"spool-eviction-policy",
+		"",
+		"Spool entries evicted first when over a limit: oldest or largest",
+	)
+	fs.IntVar(
+		&t.SpoolDrainConcurrency,
+		"spool-drain-concurrency",
+		tuningFlagUnset,
+		"Spooled postbacks delivered at once by the background drainer (positive integer)",
+	)
+	fs.IntVar(
+		&t.SpoolDrainRatePerMinute,
+		"spool-drain-rate-per-minute",
+		tuningFlagUnset,
+		"Spooled postbacks the background drainer delivers per minute (positive integer)",
+	)
+	fs.IntVar(
+		&t.PostbackBreakerThreshold,
+		"postback-breaker-threshold",
+		tuningFlagUnset,
+		"Consecutive postback failures that open the circuit breaker (positive integer)",
+	)
+	fs.IntVar(
+		&t.PostbackBreakerCooldownSeconds,
+		"postback-breaker-cooldown-seconds",
+		tuningFlagUnset,
+		"Seconds an open postback circuit breaker waits before probing (positive integer)",
+	)
+	fs.StringVar(
+		&t.PostbackCompression,
+		"postback-compression",
+		"",
+		"Content-Encoding for large postback bodies: none, gzip or zstd",
+	)
+	fs.IntVar(
+		&t.PostbackCompressionMinBytes,
+		"postback-compression-min-bytes",
+		tuningFlagUnset,
+		"Postback body size from which it is compressed (positive integer)",
+	)
+	fs.StringVar(
+		&t.OutputOverflow,
+		"output-overflow",
+		"",
+		"Command output past max-output-bytes: truncate, or upload it to the engine",
+	)
+	fs.IntVar(
+		&t.OutputSpillMaxBytes,
+		"output-spill-max-bytes",
+		tuningFlagUnset,
+		"Total bytes overflowing output may spill to disk before upload (positive integer)",
+	)
+	fs.StringVar(
+		&t.EngineAlternateHosts,
+		"engine-alternate-hosts",
+		"",
+		"Comma-separated engine hosts postbacks fail over to, in order (empty clears)",
+	)
+	fs.StringVar(
+		&t.PostbackPathTemplate,
+		"postback-path-template",
+		"",
+		"Postback path on the engine host, containing {post_id} (empty restores the default)",
+	)
 }
 
 // validate rejects any tuning flag that was explicitly provided with a
@@ -146,15 +272,94 @@ func (t tuningFlags) validate() error {
 		{"command-timeout-seconds", t.CommandTimeoutSeconds},
 		{"sas-token-lifetime-hours", t.SasTokenLifetimeHours},
 		{"max-output-bytes", t.MaxOutputBytes},
+		{"syslog-buffer-size", t.SyslogBufferSize},
+		{"spool-max-entries", t.SpoolMaxEntries},
+		{"spool-max-age-hours", t.SpoolMaxAgeHours},
+		{"spool-max-bytes", t.SpoolMaxBytes},
+		{"spool-drain-concurrency", t.SpoolDrainConcurrency},
+		{"spool-drain-rate-per-minute", t.SpoolDrainRatePerMinute},
+		{"postback-breaker-threshold", t.PostbackBreakerThreshold},
+		{"postback-breaker-cooldown-seconds", t.PostbackBreakerCooldownSeconds},
+		{"postback-compression-min-bytes", t.PostbackCompressionMinBytes},
+		{"output-spill-max-bytes", t.OutputSpillMaxBytes},
 	}
 	for _, c := range checks {
 		if t.provided[c.name] && c.value <= 0 {
 			return fmt.Errorf("invalid %s: must be a positive integer", c.name)
 		}
 	}
+	if t.provided["spool-eviction-policy"] {
+		_, err := agent.ParseSpoolEvictionPolicy(t.SpoolEvictionPolicy)
+		if err != nil || t.SpoolEvictionPolicy == "" {
+			return fmt.Errorf("invalid spool-eviction-policy: must be oldest or largest")
+		}
+	}
+	if t.provided["postback-compression"] {
+		_, err := agent.ParsePostbackCompression(t.PostbackCompression)
+		if err != nil || t.PostbackCompression == "" {
+			return fmt.Errorf("invalid postback-compression: must be none, gzip or zstd")
+		}
+	}
+	if t.provided["output-overflow"] {
+		_, err := agent.ParseOutputOverflow(t.OutputOverflow)
+		if err != nil || t.OutputOverflow == "" {
+			return fmt.Errorf("invalid output-overflow: must be truncate or upload")
+		}
+	}
+	if t.provided["engine-alternate-hosts"] {
+		if _, err := agent.ParseEngineHosts(t.EngineAlternateHosts); err != nil {
+			return fmt.Errorf("invalid engine-alternate-hosts: %w", err)
+		}
+	}
+	if t.provided["postback-path-template"] {
+		if _, err := agent.ParsePostbackPathTemplate(t.PostbackPathTemplate); err != nil {
+			return fmt.Errorf("invalid postback-path-template: %w", err)
+		}
+	}
 	return nil
 }
 
+// applyEngineSettings sets the engine alternate hosts and postback path
+// template on device from the flags that were provided.
+func (t tuningFlags) applyEngineSettings(device *agent.Device) {
+	if t.provided["engine-alternate-hosts"] {
+		device.RewstEngineAlternateHosts, _ = agent.ParseEngineHosts(t.EngineAlternateHosts)
+	}
+	if t.provided["postback-path-template"] {
+		device.PostbackPathTemplate = t.PostbackPathTemplate
+	}
+}
+
+// spoolEvictionPolicy returns the normalized --spool-eviction-policy, or empty
+// when it was not provided.
+func (t tuningFlags) spoolEvictionPolicy() string {
+	if t.SpoolEvictionPolicy == "" {
+		return ""
+	}
+	policy, _ := agent.ParseSpoolEvictionPolicy(t.SpoolEvictionPolicy)
+	return policy
+}
+
+// postbackCompression returns the normalized --postback-compression, or empty
+// when it was not provided.
+func (t tuningFlags) postbackCompression() string {
+	if t.PostbackCompression == "" {
+		return ""
+	}
+	compression, _ := agent.ParsePostbackCompression(t.PostbackCompression)
+	return compression
+}
+
+// outputOverflow returns the normalized --output-overflow, or empty when it was
+// not provided.
+func (t tuningFlags) outputOverflow() string {
+	if t.OutputOverflow == "" {
+		return ""
+	}
+	mode, _ := agent.ParseOutputOverflow(t.OutputOverflow)
+	return mode
+}
+
 // tuningPtr returns a pointer to value when the flag was explicitly provided, or
 // nil when it was left at the unset sentinel (fall back to default).
 func tuningPtr(value int) *int {
@@ -165,12 +370,95 @@ func tuningPtr(value int) *int {
 	return &v
 }
 
+// syslogFlags groups the native syslog options shared by config and update
+// modes. An empty value means the flag was not provided and leaves the
+// corresponding configuration field alone.
+type syslogFlags struct {
+	Transport string
+	Address   string
+	Format    string
+	Facility  string
+	AppName   string
+}
+
+// bindSyslogFlags registers the shared native syslog flags on fs.
+func bindSyslogFlags(fs *flag.FlagSet, s *syslogFlags) {
+	fs.StringVar(
+		&s.Transport,
+		"syslog-transport",
+		"",
+		"Native syslog transport for --syslog: local, udp, tcp or tls (default: platform logger)",
+	)
+	fs.StringVar(
+		&s.Address,
+		"syslog-address",
+		"",
+		"Syslog collector host:port for the udp, tcp and tls transports",
+	)
+	fs.StringVar(&s.Format, "syslog-format", "", "Syslog message format: rfc5424 or rfc3164")
+	fs.StringVar(&s.Facility, "syslog-facility", "", "Syslog facility (e.g. daemon, local0)")
+	fs.StringVar(&s.AppName, "syslog-app-name", "", "Syslog app name (default: service name)")
+}
+
+// validate rejects syslog flag values that can never be valid, regardless of
+// what the rest of the configuration holds.
+func (s syslogFlags) validate() error {
+	transport := syslog.Transport("")
+	if s.Transport != "" {
+		t, err := syslog.ParseTransport(s.Transport)
+		if err != nil {
+			return fmt.Errorf("invalid syslog-transport: %w", err)
+		}
+		transport = t
+	}
+	if _, err := syslog.ParseFormat(s.Format, transport); err != nil {
+		return fmt.Errorf("invalid syslog-format: %w", err)
+	}
+	if _, err := syslog.ParseFacility(s.Facility); err != nil {
+		return fmt.Errorf("invalid syslog-facility: %w", err)
+	}
+	return nil
+}
+
+// journaldSupported reports whether --journald is accepted on this platform.
+// It is a variable so tests can exercise other platforms.
+var journaldSupported = syslog.JournalSupported
+
+// validateJournald rejects --journald on platforms without journald, where the
+// service could never log to it.
+func validateJournald(useJournald bool) error {
+	if useJournald && !journaldSupported {
+		return fmt.Errorf("invalid journald: only supported on Linux")
+	}
+	return nil
+}
+
+// applyTo copies every provided syslog flag onto device.
+func (s syslogFlags) applyTo(device *agent.Device) {
+	if s.Transport != "" {
+		device.SyslogTransport = strings.ToLower(s.Transport)
+	}
+	if s.Address != "" {
+		device.SyslogAddress = s.Address
+	}
+	if s.Format != "" {
+		device.SyslogFormat = strings.ToLower(s.Format)
+	}
+	if s.Facility != "" {
+		device.SyslogFacility = strings.ToLower(s.Facility)
+	}
+	if s.AppName != "" {
+		device.SyslogAppName = s.AppName
+	}
+}
+
 type configContext struct {
 	OrgId                string
 	ConfigUrl            string
 	ConfigSecret         string
 	LoggingLevel         string
 	UseSyslog            bool
+	UseJournald          bool
 	DisableAgentPostback bool
 	NoAutoUpdates        bool
 	GithubToken          string
@@ -178,6 +466,7 @@ type configContext struct {
 	ServiceUsername      string
 	ServicePassword      string
 	Tuning               tuningFlags
+	Syslog               syslogFlags
 
 	Sys    agent.SystemInfoProvider
 	Domain agent.DomainInfoProvider
@@ -202,6 +491,13 @@ func newConfigFlagSet(params *configContext) *flag.FlagSet {
 		fmt.Sprintf("Logging level: %s", getAllowedConfigLevelsString(", ")),
 	)
 	fs.BoolVar(&params.UseSyslog, "syslog", false, "Write log messages to system log")
+	bindSyslogFlags(fs, &params.Syslog)
+	fs.BoolVar(
+		&params.UseJournald,
+		"journald",
+		false,
+		"Write structured log entries to systemd-journald (Linux only)",
+	)
 	fs.BoolVar(
 		&params.DisableAgentPostback,
 		"disable-agent-postback",
@@ -270,6 +566,14 @@ func newConfigContext(
 		return nil, err
 	}
 
+	if err := params.Syslog.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := validateJournald(params.UseJournald); err != nil {
+		return nil, err
+	}
+
 	if params.ServicePassword != "" && params.ServiceUsername == "" {
 		return nil, fmt.Errorf("service-password requires service-username")
 	}
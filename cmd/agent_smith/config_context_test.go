@@ -277,6 +277,114 @@ func TestNewConfigContext(t *testing.T) {
 			},
 			"invalid command-timeout-seconds: must be a positive integer",
 		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--syslog-transport", "carrier-pigeon",
+			},
+			"invalid syslog-transport",
+		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--syslog-facility", "local9",
+			},
+			"invalid syslog-facility",
+		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--syslog-buffer-size", "0",
+			},
+			"invalid syslog-buffer-size: must be a positive integer",
+		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--spool-max-bytes", "0",
+			},
+			"invalid spool-max-bytes: must be a positive integer",
+		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--spool-eviction-policy", "newest",
+			},
+			"invalid spool-eviction-policy: must be oldest or largest",
+		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--postback-compression", "brotli",
+			},
+			"invalid postback-compression: must be none, gzip or zstd",
+		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--output-overflow", "stream",
+			},
+			"invalid output-overflow: must be truncate or upload",
+		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--output-spill-max-bytes", "0",
+			},
+			"invalid output-spill-max-bytes: must be a positive integer",
+		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--spool-drain-concurrency", "-2",
+			},
+			"invalid spool-drain-concurrency: must be a positive integer",
+		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--postback-breaker-threshold", "0",
+			},
+			"invalid postback-breaker-threshold: must be a positive integer",
+		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--engine-alternate-hosts", "eu.example.com,https://bad.example.com",
+			},
+			"invalid engine-alternate-hosts",
+		},
+		{
+			[]string{
+				"--org-id", orgId,
+				"--config-url", configUrl,
+				"--config-secret", configSecret,
+				"--postback-path-template", "/webhooks/custom/action",
+			},
+			"invalid postback-path-template",
+		},
 	}
 
 	for _, errorTest := range errorTests {
@@ -287,3 +395,25 @@ func TestNewConfigContext(t *testing.T) {
 		}
 	}
 }
+
+func TestNewConfigContext_JournaldPlatform(t *testing.T) {
+	args := []string{
+		"--org-id", "test123",
+		"--config-url", "http://localhost",
+		"--config-secret", "secret",
+		"--journald",
+	}
+	defer func(supported bool) { journaldSupported = supported }(journaldSupported)
+
+	journaldSupported = true
+	params, err := newConfigContext(args, nil, nil, nil, nil)
+	if err != nil || !params.UseJournald {
+		t.Errorf("expected --journald accepted on Linux, got %v", err)
+	}
+
+	journaldSupported = false
+	_, err = newConfigContext(args, nil, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid journald") {
+		t.Errorf("expected --journald rejected off Linux, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/RewstApp/agent-smith-go/internal/agent"
 	"github.com/RewstApp/agent-smith-go/internal/utils"
+	"github.com/hashicorp/go-hclog"
 )
 
 // ── helpers ──────────────────────────────────────────────────────────────────
@@ -91,6 +93,169 @@ func TestValidateConfiguration_Valid(t *testing.T) {
 	}
 }
 
+func TestValidateSyslogSettings(t *testing.T) {
+	tests := []struct {
+		name      string
+		device    agent.Device
+		expectErr bool
+	}{
+		{"platform writer needs nothing", agent.Device{}, false},
+		{"local without address", agent.Device{SyslogTransport: "local"}, false},
+		{
+			"tcp with address",
+			agent.Device{SyslogTransport: "tcp", SyslogAddress: "logs:514"},
+			false,
+		},
+		{"udp without address", agent.Device{SyslogTransport: "udp"}, true},
+		{"unknown transport", agent.Device{SyslogTransport: "smtp"}, true},
+		{
+			"unknown format",
+			agent.Device{SyslogTransport: "local", SyslogFormat: "rfc1"},
+			true,
+		},
+		{
+			"unknown facility",
+			agent.Device{SyslogTransport: "local", SyslogFacility: "local9"},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSyslogSettings(tt.device)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("validateSyslogSettings() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateTuningRanges(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+	qos := byte(2)
+
+	tests := []struct {
+		name     string
+		device   agent.Device
+		wantErrs []string
+	}{
+		{"unset fields use defaults", agent.Device{}, nil},
+		{
+			"values in range",
+			agent.Device{WorkerCount: intPtr(16), MaxOutputBytes: intPtr(1 << 20)},
+			nil,
+		},
+		{
+			"non-positive is reported",
+			agent.Device{WorkerCount: intPtr(0), PostbackMaxAttempts: intPtr(-1)},
+			[]string{"worker_count", "postback_max_attempts"},
+		},
+		{
+			"too large",
+			agent.Device{MqttConnectTimeoutSeconds: intPtr(30_000), MqttQos: &qos},
+			[]string{"mqtt_qos", "mqtt_connect_timeout_seconds"},
+		},
+		{
+			"spool limits",
+			agent.Device{
+				SpoolMaxBytes:       intPtr(1024),
+				SpoolEvictionPolicy: "newest",
+			},
+			[]string{"spool_eviction_policy", "spool_max_bytes"},
+		},
+		{
+			"postback compression",
+			agent.Device{PostbackCompression: "brotli", PostbackCompressionMinBytes: intPtr(0)},
+			[]string{"postback_compression", "postback_compression_min_bytes"},
+		},
+		{
+			"spool drain",
+			agent.Device{SpoolDrainConcurrency: intPtr(64), SpoolDrainRatePerMinute: intPtr(0)},
+			[]string{"spool_drain_concurrency", "spool_drain_rate_per_minute"},
+		},
+		{
+			"postback breaker",
+			agent.Device{
+				PostbackBreakerThreshold:       intPtr(500),
+				PostbackBreakerCooldownSeconds: intPtr(0),
+			},
+			[]string{"postback_breaker_threshold", "postback_breaker_cooldown_seconds"},
+		},
+		{
+			"output overflow",
+			agent.Device{OutputOverflow: "stream", OutputSpillMaxBytes: intPtr(1024)},
+			[]string{"output_overflow", "output_spill_max_bytes"},
+		},
+		{
+			"engine endpoints",
+			agent.Device{
+				RewstEngineAlternateHosts: []string{"eu.example.com", "https://bad.example.com"},
+				PostbackPathTemplate:      "/webhooks/custom/action",
+			},
+			[]string{"rewst_engine_alternate_hosts", "postback_path_template"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateTuningRanges(tt.device)
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("expected %d errors, got %v", len(tt.wantErrs), errs)
+			}
+			for i, field := range tt.wantErrs {
+				if !strings.Contains(errs[i].Error(), field) {
+					t.Errorf("error %d = %v, want it to name %s", i, errs[i], field)
+				}
+			}
+		})
+	}
+}
+
+func TestRunConfig_AppliesSyslogFlags(t *testing.T) {
+	server := newConfigServer(t, http.StatusOK, validConfigResponseBody("test-org"))
+	defer server.Close()
+
+	var saved agent.Device
+	params := newBaseConfigParams(server.URL)
+	params.UseSyslog = true
+	params.UseJournald = true
+	params.Syslog = syslogFlags{
+		Transport: "TLS",
+		Address:   "logs.example.com:6514",
+		Facility:  "local3",
+	}
+	params.FS.(*mockFileSystem).writeFileFunc = func(name string, data []byte, _ os.FileMode) error {
+		if strings.HasSuffix(name, "config.json") {
+			_ = json.Unmarshal(data, &saved)
+		}
+		return nil
+	}
+
+	if err := runConfig(params); err != nil {
+		t.Fatalf("runConfig: %v", err)
+	}
+	if saved.SyslogTransport != "tls" || saved.SyslogAddress != "logs.example.com:6514" ||
+		saved.SyslogFacility != "local3" {
+		t.Errorf("syslog flags not persisted: %+v", saved)
+	}
+	if !saved.UseJournald {
+		t.Error("expected journald flag to be persisted")
+	}
+}
+
+func TestRunConfig_RejectsIncompleteSyslogSettings(t *testing.T) {
+	server := newConfigServer(t, http.StatusOK, validConfigResponseBody("test-org"))
+	defer server.Close()
+
+	params := newBaseConfigParams(server.URL)
+	params.Syslog = syslogFlags{Transport: "udp"}
+
+	err := runConfig(params)
+	if err == nil || !strings.Contains(err.Error(), "syslog_address") {
+		t.Errorf("expected syslog_address error, got %v", err)
+	}
+}
+
 func TestValidateConfiguration_MissingFields(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -474,6 +639,36 @@ func TestRunConfig_PasswordNotPersistedToDisk(t *testing.T) {
 	}
 }
 
+// TestInstallConfiguration_RedactsSecretsInLog verifies that the config is
+// logged without its secrets, which an imported bundle is encrypted to protect.
+func TestInstallConfiguration_RedactsSecretsInLog(t *testing.T) {
+	device := agent.Device{
+		DeviceId:        "device-123",
+		RewstOrgId:      "test-org",
+		RewstEngineHost: "engine.example.com",
+		SharedAccessKey: "c2hhcmVkLWFjY2Vzcy1rZXk=",
+		AzureIotHubHost: "hub.example.net",
+		GithubToken:     "ghp_secret-token",
+	}
+	var logs bytes.Buffer
+	logger := hclog.New(&hclog.LoggerOptions{Output: &logs})
+
+	err := installConfiguration(newBaseConfigParams(""), device, logger)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, secret := range []string{device.SharedAccessKey, device.GithubToken} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("secret %q leaked into the log:\n%s", secret, logs.String())
+		}
+	}
+	if !strings.Contains(logs.String(), configRedacted) ||
+		!strings.Contains(logs.String(), "device-123") {
+		t.Errorf("expected the redacted config in the log:\n%s", logs.String())
+	}
+}
+
 // findWrittenConfig returns the bytes written to the config file (identified by
 // its JSON device_id field) among all files captured by a writeFileFunc mock.
 func findWrittenConfig(t *testing.T, writes map[string][]byte) agent.Device {
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/service"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+	"github.com/RewstApp/agent-smith-go/internal/version"
+	"github.com/hashicorp/go-hclog"
+)
+
+// runControl starts, stops or restarts the agent service of one org, or of
+// every installed org with --all. A failure for one org does not stop the
+// others; the failures are returned together.
+func runControl(params *controlContext) error {
+	logger := utils.ConfigureLogger("agent_smith", os.Stdout, utils.Default)
+
+	// Show header
+	logger.Info("Agent Smith started", "version", version.Version, "os", runtime.GOOS)
+
+	return runControlWith(params, selectOrgIds(params.OrgId, params.All), logger)
+}
+
+func runControlWith(params *controlContext, orgIds []string, logger hclog.Logger) error {
+	if len(orgIds) == 0 {
+		logger.Info("No installed agents found")
+		return nil
+	}
+
+	var errs []error
+	for _, orgId := range orgIds {
+		err := controlAgent(params, orgId, logger)
+		if err != nil {
+			logger.Error("Failed to control agent", "org_id", orgId, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", orgId, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func controlAgent(params *controlContext, orgId string, logger hclog.Logger) error {
+	name := agent.GetServiceName(orgId)
+
+	svc, err := params.ServiceManager.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open service %s: %w", name, err)
+	}
+	defer func() {
+		err := svc.Close()
+		if err != nil {
+			logger.Error("Failed to close service handle", "error", err)
+		}
+	}()
+
+	if params.Stop || params.Restart {
+		err = stopAgentService(params, svc, orgId, logger)
+		if err != nil {
+			return err
+		}
+	}
+
+	if params.Start || params.Restart {
+		if svc.IsActive() {
+			logger.Info("Service already running", "service", name)
+			return nil
+		}
+
+		logger.Info("Starting service", "service", name)
+		err = svc.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start service: %w", err)
+		}
+		logger.Info("Service started", "service", name)
+	}
+
+	return nil
+}
+
+// stopAgentService stops the service if it is running and waits for the agent
+// process to exit, so a restart does not overlap the old process.
+func stopAgentService(
+	params *controlContext,
+	svc service.Service,
+	orgId string,
+	logger hclog.Logger,
+) error {
+	name := agent.GetServiceName(orgId)
+
+	if !svc.IsActive() {
+		logger.Info("Service not running", "service", name)
+	} else {
+		logger.Info("Stopping service", "service", name)
+		err := svc.Stop()
+		if err != nil {
+			return fmt.Errorf("failed to stop service: %w", err)
+		}
+	}
+
+	err := waitForAgentExit(svc, orgId, params.ProcessRunning, params.ExitTimeout, logger)
+	if err != nil {
+		return err
+	}
+	logger.Info("Service stopped", "service", name)
+	return nil
+}
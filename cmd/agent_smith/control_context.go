@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/service"
+)
+
+type controlContext struct {
+	OrgId   string
+	All     bool
+	Start   bool
+	Stop    bool
+	Restart bool
+
+	// ProcessRunning reports whether an agent executable is still running.
+	// When nil agentProcessRunning is used.
+	ProcessRunning func(path string) (bool, error)
+	// ExitTimeout bounds the wait for a stopped agent to exit. When zero
+	// agentExitTimeout is used.
+	ExitTimeout time.Duration
+
+	ServiceManager service.ServiceManager
+}
+
+// newControlFlagSet builds the flag set for control mode, binding flags to the
+// provided params. It is shared between argument parsing and usage rendering so
+// that the per-flag descriptions stay in a single place.
+func newControlFlagSet(params *controlContext) *flag.FlagSet {
+	fs := flag.NewFlagSet("control", flag.ContinueOnError)
+	fs.StringVar(&params.OrgId, "org-id", "", "Organization ID")
+	fs.BoolVar(&params.All, "all", false, "Act on every agent installed on this host")
+	fs.BoolVar(&params.Start, "start", false, "Start the agent service")
+	fs.BoolVar(&params.Stop, "stop", false, "Stop the agent service and wait for it to exit")
+	fs.BoolVar(&params.Restart, "restart", false, "Stop the agent service, then start it")
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func newControlContext(
+	args []string,
+	svcMgr service.ServiceManager,
+) (*controlContext, error) {
+	var params controlContext
+
+	fs := newControlFlagSet(&params)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := 0
+	for _, set := range []bool{params.Start, params.Stop, params.Restart} {
+		if set {
+			actions++
+		}
+	}
+	if actions == 0 {
+		return nil, fmt.Errorf("missing start, stop or restart")
+	}
+	if actions > 1 {
+		return nil, fmt.Errorf("only one of start, stop or restart may be given")
+	}
+
+	if params.All && params.OrgId != "" {
+		return nil, fmt.Errorf("all cannot be combined with org-id")
+	}
+
+	if params.OrgId == "" && !params.All {
+		return nil, fmt.Errorf("missing org-id")
+	}
+
+	params.ProcessRunning = agentProcessRunning
+	params.ServiceManager = svcMgr
+
+	return &params, nil
+}
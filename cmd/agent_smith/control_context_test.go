@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewControlContext(t *testing.T) {
+	orgId := "test123"
+	result, _ := newControlContext([]string{"--org-id", orgId, "--restart"}, nil)
+
+	if result.OrgId != orgId {
+		t.Errorf("expected %v, got %v", orgId, result.OrgId)
+	}
+
+	if !result.Restart || result.Start || result.Stop {
+		t.Errorf("expected only restart to be set, got %+v", result)
+	}
+
+	if result.ProcessRunning == nil {
+		t.Error("expected default process check")
+	}
+
+	result, _ = newControlContext([]string{"--all", "--stop"}, nil)
+	if !result.All || !result.Stop {
+		t.Errorf("expected all and stop to be set, got %+v", result)
+	}
+
+	errorTests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"--org-id", orgId}, "missing start, stop or restart"},
+		{[]string{"--org-id", orgId, "--start", "--stop"}, "only one of start, stop or restart"},
+		{[]string{"--start"}, "missing org-id"},
+		{[]string{"--all", "--org-id", orgId, "--start"}, "all cannot be combined with org-id"},
+		{[]string{"--=start"}, "bad flag syntax"},
+	}
+
+	for _, errorTest := range errorTests {
+		_, err := newControlContext(errorTest.args, nil)
+
+		if err == nil || !strings.Contains(err.Error(), errorTest.message) {
+			t.Errorf("expected error %s, got %v", errorTest.message, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func newControlTestParams(svc *mockService) *controlContext {
+	return &controlContext{
+		ProcessRunning: func(string) (bool, error) { return false, nil },
+		ServiceManager: &mockServiceManager{openService: svc},
+	}
+}
+
+func TestControlAgent_Start(t *testing.T) {
+	svc := &mockService{isActive: false}
+	params := newControlTestParams(svc)
+	params.Start = true
+
+	if err := controlAgent(params, "test-org", hclog.NewNullLogger()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc.startCalls != 1 || svc.stopCalls != 0 {
+		t.Errorf("expected one start and no stop, got %+v", svc)
+	}
+}
+
+func TestControlAgent_StartAlreadyRunning(t *testing.T) {
+	svc := &mockService{isActive: true}
+	params := newControlTestParams(svc)
+	params.Start = true
+
+	if err := controlAgent(params, "test-org", hclog.NewNullLogger()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc.startCalls != 0 {
+		t.Errorf("expected a running service not to be started, got %d starts", svc.startCalls)
+	}
+}
+
+func TestControlAgent_Stop(t *testing.T) {
+	svc := &mockService{isActive: true}
+	params := newControlTestParams(svc)
+	params.Stop = true
+
+	if err := controlAgent(params, "test-org", hclog.NewNullLogger()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc.stopCalls != 1 || svc.startCalls != 0 || svc.isActive {
+		t.Errorf("expected the service stopped, got %+v", svc)
+	}
+}
+
+func TestControlAgent_RestartWaitsForExit(t *testing.T) {
+	svc := &mockService{isActive: true}
+	params := newControlTestParams(svc)
+	params.Restart = true
+	checks := 0
+	params.ProcessRunning = func(string) (bool, error) {
+		if svc.startCalls != 0 {
+			t.Error("service started before the old process exited")
+		}
+		checks++
+		return checks < 2, nil
+	}
+
+	if err := controlAgent(params, "test-org", hclog.NewNullLogger()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc.stopCalls != 1 || svc.startCalls != 1 || !svc.isActive {
+		t.Errorf("expected one stop then one start, got %+v", svc)
+	}
+}
+
+func TestControlAgent_RestartProcessNeverExits(t *testing.T) {
+	svc := &mockService{isActive: true}
+	params := newControlTestParams(svc)
+	params.Restart = true
+	params.ProcessRunning = func(string) (bool, error) { return true, nil }
+	params.ExitTimeout = time.Millisecond
+
+	err := controlAgent(params, "test-org", hclog.NewNullLogger())
+	if err == nil || !strings.Contains(err.Error(), "still running") {
+		t.Errorf("expected still running error, got %v", err)
+	}
+	if svc.startCalls != 0 {
+		t.Errorf("expected no start, got %d", svc.startCalls)
+	}
+}
+
+func TestControlAgent_RestartFromInstalledBinary(t *testing.T) {
+	// Run from the installed binary, the process check sees the caller
+	// itself running the target path; it must not wait for its own exit
+	path, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &mockService{isActive: true}
+	params := newControlTestParams(svc)
+	params.Restart = true
+	params.ProcessRunning = func(string) (bool, error) { return agentProcessRunning(path) }
+	params.ExitTimeout = time.Second
+
+	if err := controlAgent(params, "test-org", hclog.NewNullLogger()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc.stopCalls != 1 || svc.startCalls != 1 {
+		t.Errorf("expected one stop then one start, got %+v", svc)
+	}
+}
+
+func TestControlAgent_Failures(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  *controlContext
+		message string
+	}{
+		{
+			"open",
+			&controlContext{
+				Start:          true,
+				ServiceManager: &mockServiceManager{openErr: errors.New("not found")},
+			},
+			"failed to open service",
+		},
+		{
+			"stop",
+			&controlContext{
+				Stop: true,
+				ServiceManager: &mockServiceManager{
+					openService: &mockService{isActive: true, stopErr: errors.New("denied")},
+				},
+			},
+			"failed to stop service",
+		},
+		{
+			"start",
+			&controlContext{
+				Start: true,
+				ServiceManager: &mockServiceManager{
+					openService: &mockService{startErr: errors.New("denied")},
+				},
+			},
+			"failed to start service",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := controlAgent(tt.params, "test-org", hclog.NewNullLogger())
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected error %s, got %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestRunControlWith_ContinuesPastFailures(t *testing.T) {
+	svc := &mockService{isActive: false, startErr: errors.New("denied")}
+	params := newControlTestParams(svc)
+	params.Start = true
+
+	err := runControlWith(params, []string{"org-a", "org-b"}, hclog.NewNullLogger())
+	if err == nil || !strings.Contains(err.Error(), "org-a") ||
+		!strings.Contains(err.Error(), "org-b") {
+		t.Errorf("expected errors for both orgs, got %v", err)
+	}
+	if svc.startCalls != 2 {
+		t.Errorf("expected both orgs attempted, got %d starts", svc.startCalls)
+	}
+}
+
+func TestRunControlWith_NoAgents(t *testing.T) {
+	params := newControlTestParams(&mockService{})
+	params.Start = true
+
+	if err := runControlWith(params, nil, hclog.NewNullLogger()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -17,6 +18,8 @@ import (
 	"time"
 
 	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/mqtt"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
 	"github.com/RewstApp/agent-smith-go/internal/version"
 	"github.com/hashicorp/go-hclog"
 )
@@ -32,6 +35,42 @@ func (d *defaultTLSDialer) Dial(host, port string) bool {
 	return testTLSConnection(host, port)
 }
 
+// mqttHandshaker runs a short-lived MQTT session as the device over one
+// transport (a broker URL scheme) so tests can inject fakes.
+type mqttHandshaker interface {
+	Handshake(device agent.Device, scheme string) []mqtt.ProbeStage
+}
+
+type defaultMqttHandshaker struct{}
+
+func (h *defaultMqttHandshaker) Handshake(device agent.Device, scheme string) []mqtt.ProbeStage {
+	opts, err := mqtt.NewClientOptions(device)
+	if err != nil {
+		return []mqtt.ProbeStage{{Name: mqtt.ProbeConnect, Err: err}}
+	}
+
+	var servers []*url.URL
+	for _, server := range opts.Servers {
+		if server.Scheme == scheme {
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 {
+		return []mqtt.ProbeStage{{
+			Name: mqtt.ProbeConnect,
+			Err:  fmt.Errorf("no %s broker configured", scheme),
+		}}
+	}
+	opts.Servers = servers
+
+	return mqtt.Probe(
+		opts,
+		deviceboundTopic(device.DeviceId),
+		subscribeQos(device),
+		device.MqttConnectTimeout()+utils.MqttConnectWaitMargin,
+	)
+}
+
 // logFileOpener abstracts os.Open so tests can inject an in-memory reader.
 type logFileOpener interface {
 	Open(name string) (io.ReadCloser, error)
@@ -136,15 +175,19 @@ selectLoop:
 			case "2":
 				runCommandTest()
 			case "3":
-				runConnectivityTestWith(target, dialer)
+				runConnectivityTestWith(confirmHandshake(reader, params, target), target, dialer)
 			case "4":
 				runTempDirTest(target)
 			case "5":
 				runLiveLogsWith(ctx, target, opener)
 			case "6":
-				runAllChecksWith(ctx, params, target, dialer)
+				runAllChecksWith(ctx, confirmHandshake(reader, params, target), target, dialer)
 			case "7":
 				runHostInfo(ctx, params, target)
+			case "8":
+				runEngineChecks(ctx, params, target)
+			case "9":
+				runConfigChecks(target)
 			case "0", "q", "quit", "exit":
 				if hasMultiple {
 					continue selectLoop
@@ -183,6 +226,8 @@ func printMenu(target agentInfo, hasMultiple bool) {
 	fmt.Println("  │  [5] View live log data                          │")
 	fmt.Println("  │  [6] Run all checks                              │")
 	fmt.Println("  │  [7] Show host information                       │")
+	fmt.Println("  │  [8] Test Rewst engine reachability and clock    │")
+	fmt.Println("  │  [9] Validate configuration and permissions      │")
 	fmt.Println(lastOption)
 	fmt.Println("  └──────────────────────────────────────────────────┘")
 	fmt.Printf("  Current agent: %s\n", target.OrgId)
@@ -278,94 +323,275 @@ func scanAgentsFrom(root string) []agentInfo {
 
 func runCheckServiceStatus(params *diagnosticContext, target agentInfo) {
 	printSection("Service Status")
+	printCheck(checkServiceStatus(params, target))
+}
 
+func checkServiceStatus(params *diagnosticContext, target agentInfo) checkResult {
 	svc, err := params.ServiceManager.Open(target.ServiceName)
 	if err != nil {
-		printResult(false, fmt.Sprintf("Service not found (%s)", target.ServiceName))
-		return
+		return newCheckResult(
+			"service_status",
+			checkFail,
+			fmt.Sprintf("Service not found (%s)", target.ServiceName),
+		)
 	}
 	running := svc.IsActive()
 	_ = svc.Close()
 
-	status := "STOPPED"
-	if running {
-		status = "RUNNING"
+	if !running {
+		return newCheckResult(
+			"service_status",
+			checkFail,
+			fmt.Sprintf("%s - STOPPED (%s)", target.OrgId, target.ServiceName),
+		)
 	}
-	printResult(running, fmt.Sprintf("%s - %s (%s)", target.OrgId, status, target.ServiceName))
+	return newCheckResult(
+		"service_status",
+		checkPass,
+		fmt.Sprintf("%s - RUNNING (%s)", target.OrgId, target.ServiceName),
+	)
 }
 
 // ── Check 2: Command execution test ──
 
 func runCommandTest() {
 	printSection("Command Execution Test")
+	printCheck(checkCommandExecution())
+}
 
+func checkCommandExecution() checkResult {
 	shell, args := getTestCommand()
-	fmt.Printf("    Shell: %s\n", shell)
-	fmt.Printf("    Command: %s %s\n", shell, strings.Join(args, " "))
 
 	start := time.Now()
 	cmd := exec.Command(shell, args...) // #nosec G204 - diagnostic tool uses known shell commands
 	output, err := cmd.CombinedOutput()
 	elapsed := time.Since(start)
 
+	var result checkResult
 	if err != nil {
-		printResult(false, fmt.Sprintf("Command execution failed: %v", err))
-		if len(output) > 0 {
-			fmt.Printf("    Output: %s\n", strings.TrimSpace(string(output)))
-		}
-		return
+		result = newCheckResult(
+			"command_execution",
+			checkFail,
+			fmt.Sprintf("Command execution failed: %v", err),
+		)
+	} else {
+		result = newCheckResult(
+			"command_execution",
+			checkPass,
+			fmt.Sprintf("Command executed successfully (%s)", elapsed),
+		)
 	}
 
-	printResult(true, fmt.Sprintf("Command executed successfully (%s)", elapsed))
-	fmt.Printf("    Output: %s\n", strings.TrimSpace(string(output)))
+	result.addDetail("Shell", shell)
+	result.addDetail("Command", shell+" "+strings.Join(args, " "))
+	if len(output) > 0 {
+		result.addDetail("Output", strings.TrimSpace(string(output)))
+	}
+	return result
 }
 
 // ── Check 3: MQTT/WebSocket connectivity ──
 
-func runConnectivityTestWith(target agentInfo, dialer tlsDialer) {
+// mqttTransports are the broker transports the agent connects over, in the
+// order it tries them.
+var mqttTransports = []struct {
+	check  string
+	label  string
+	port   string
+	scheme string
+}{
+	{"mqtt_tls", "MQTT over TLS", "8883", "tls"},
+	{"mqtt_websocket", "MQTT over WebSocket", "443", "wss"},
+}
+
+func runConnectivityTestWith(params *diagnosticContext, target agentInfo, dialer tlsDialer) {
 	printSection("MQTT/WebSocket Connectivity")
 
+	results := checkConnectivity(params, target, dialer)
+	for _, result := range results {
+		printCheck(result)
+	}
+
 	if target.Device == nil {
-		printResult(false, "No config loaded - cannot determine MQTT host")
 		fmt.Println("    Ensure the agent has been configured and config.json exists.")
 		return
 	}
 
+	allFailed := len(results) > 0
+	for _, result := range results {
+		if result.Status != checkFail {
+			allFailed = false
+		}
+	}
+	if allFailed && target.Device.AzureIotHubHost != "" {
+		host := target.Device.AzureIotHubHost
+		fmt.Println()
+		fmt.Println("    Troubleshooting tips:")
+		fmt.Println("    - Check firewall rules for outbound ports 8883 and 443")
+		fmt.Println("    - Verify DNS resolution for", host)
+		fmt.Println("    - Check proxy/VPN settings that may block connections")
+		fmt.Println("    - A refused CONNECT usually means a wrong key or a disabled device")
+	}
+}
+
+// checkConnectivity tests the IoT hub on the MQTT TLS port and on the
+// WebSocket port the agent falls back to: the TLS handshake and, when allowed
+// (see planHandshake), a full MQTT session as the device. Losing only one of
+// the two transports is a warning since the agent can still connect over the
+// other.
+func checkConnectivity(
+	params *diagnosticContext,
+	target agentInfo,
+	dialer tlsDialer,
+) []checkResult {
+	if target.Device == nil {
+		return []checkResult{newCheckResult(
+			"mqtt_connectivity",
+			checkFail,
+			"No config loaded - cannot determine MQTT host",
+		)}
+	}
+
+	if target.Device.AzureIotHubHost == "" {
+		return []checkResult{newCheckResult(
+			"mqtt_connectivity",
+			checkFail,
+			"Azure IoT Hub host not configured",
+		)}
+	}
+
 	host := target.Device.AzureIotHubHost
-	if host == "" {
-		printResult(false, "Azure IoT Hub host not configured")
-		return
+	handshake, skipReason := planHandshake(params, target)
+
+	results := make([]checkResult, 0, len(mqttTransports))
+	reachable := false
+	for _, transport := range mqttTransports {
+		result := newCheckResult(
+			transport.check,
+			checkPass,
+			fmt.Sprintf("%s to %s:%s", transport.label, host, transport.port),
+		)
+		result.addDetail("Host", host)
+
+		if failed := probeTransport(
+			&result, params, *target.Device, dialer, transport.port, transport.scheme, handshake,
+		); failed != "" {
+			result.Status = checkFail
+			result.Message += ": " + failed
+		} else {
+			reachable = true
+			if !handshake && skipReason != "" {
+				result.addDetail("MQTT session", "skipped - "+skipReason)
+			}
+		}
+		results = append(results, result)
 	}
 
-	fmt.Printf("    Host: %s\n", host)
+	if reachable {
+		for i := range results {
+			if results[i].Status == checkFail {
+				results[i].Status = checkWarn
+			}
+		}
+	}
 
-	// Test MQTT port (8883)
-	fmt.Printf("    Testing MQTT (TLS port 8883)... ")
-	mqttOk := dialer.Dial(host, "8883")
-	if mqttOk {
-		fmt.Println("OK")
-	} else {
-		fmt.Println("FAILED")
+	return results
+}
+
+// probeTransport dials one transport and, when handshake is set, runs an MQTT
+// session over it, adding each stage's latency to result. It returns a
+// description of the first failing stage, or "" when every stage passed.
+func probeTransport(
+	result *checkResult,
+	params *diagnosticContext,
+	device agent.Device,
+	dialer tlsDialer,
+	port, scheme string,
+	handshake bool,
+) string {
+	started := time.Now()
+	if !dialer.Dial(device.AzureIotHubHost, port) {
+		result.addDetail("TLS handshake", "failed after "+formatLatency(time.Since(started)))
+		return "TLS handshake failed"
 	}
-	printResult(mqttOk, fmt.Sprintf("MQTT TLS connection to %s:8883", host))
+	result.addDetail("TLS handshake", "ok ("+formatLatency(time.Since(started))+")")
 
-	// Test WebSocket port (443)
-	fmt.Printf("    Testing WebSocket (port 443)... ")
-	wsOk := dialer.Dial(host, "443")
-	if wsOk {
-		fmt.Println("OK")
-	} else {
-		fmt.Println("FAILED")
+	if !handshake {
+		return ""
 	}
-	printResult(wsOk, fmt.Sprintf("WebSocket connection to %s:443", host))
 
-	if !mqttOk && !wsOk {
-		fmt.Println()
-		fmt.Println("    Troubleshooting tips:")
-		fmt.Println("    - Check firewall rules for outbound ports 8883 and 443")
-		fmt.Println("    - Verify DNS resolution for", host)
-		fmt.Println("    - Check proxy/VPN settings that may block connections")
+	for _, stage := range params.MQTT.Handshake(device, scheme) {
+		name := strings.ToUpper(stage.Name)
+		if stage.Err != nil {
+			result.addDetail(
+				name,
+				fmt.Sprintf("failed after %s: %v", formatLatency(stage.Latency), stage.Err),
+			)
+			return fmt.Sprintf("%s failed: %v", name, stage.Err)
+		}
+		result.addDetail(name, "ok ("+formatLatency(stage.Latency)+")")
 	}
+	return ""
+}
+
+func formatLatency(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+// planHandshake decides whether the connectivity check may run an MQTT session.
+// IoT Hub only accepts the device id as the client id and drops the older of
+// two sessions for the same device, so a session opened while the service is
+// connected knocks the service offline until it reconnects. Unless the
+// operator allowed that, the session is skipped for a running service and the
+// returned reason says why.
+func planHandshake(params *diagnosticContext, target agentInfo) (bool, string) {
+	if params == nil || params.MQTT == nil {
+		return false, ""
+	}
+	if params.AllowDisconnect || !serviceRunning(params, target) {
+		return true, ""
+	}
+	return false, "the running service holds this device's session; " +
+		"--allow-disconnect tests it at the cost of a brief reconnect"
+}
+
+// confirmHandshake asks before the MQTT session test would disconnect the
+// running service, returning params with AllowDisconnect set when the operator
+// agrees.
+func confirmHandshake(
+	reader *bufio.Reader,
+	params *diagnosticContext,
+	target agentInfo,
+) *diagnosticContext {
+	if params.MQTT == nil || params.AllowDisconnect || !serviceRunning(params, target) {
+		return params
+	}
+
+	fmt.Println()
+	fmt.Println("  The agent service is connected as this device. The MQTT session test")
+	fmt.Println("  connects with the same identity, which briefly disconnects the service.")
+	answer := prompt(reader, "  Run the full session test anyway? [y/N]: ")
+	if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+		return params
+	}
+
+	allowed := *params
+	allowed.AllowDisconnect = true
+	return &allowed
+}
+
+// serviceRunning reports whether the target's service is active.
+func serviceRunning(params *diagnosticContext, target agentInfo) bool {
+	if params.ServiceManager == nil {
+		return target.IsRunning
+	}
+
+	svc, err := params.ServiceManager.Open(target.ServiceName)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = svc.Close() }()
+	return svc.IsActive()
 }
 
 func testTLSConnection(host, port string) bool {
@@ -388,37 +614,64 @@ func testTLSConnection(host, port string) bool {
 
 func runTempDirTest(target agentInfo) {
 	printSection("Temp Directory Write Test")
+	for _, result := range checkTempDir(target) {
+		printCheck(result)
+	}
+}
+
+func checkTempDir(target agentInfo) []checkResult {
+	var results []checkResult
 
 	scriptsDir := agent.GetScriptsDirectory(target.OrgId)
 
 	// Test creating the scripts directory
-	fmt.Printf("    Scripts directory: %s\n", scriptsDir)
-
 	err := os.MkdirAll(scriptsDir, 0o755)
 	if err != nil {
-		printResult(false, fmt.Sprintf("Cannot create scripts directory: %v", err))
-		return
+		result := newCheckResult(
+			"scripts_directory",
+			checkFail,
+			fmt.Sprintf("Cannot create scripts directory: %v", err),
+		)
+		result.addDetail("Path", scriptsDir)
+		return append(results, result)
 	}
-	printResult(true, "Scripts directory created/exists")
+	result := newCheckResult("scripts_directory", checkPass, "Scripts directory created/exists")
+	result.addDetail("Path", scriptsDir)
+	results = append(results, result)
 
 	// Test writing a temp file
 	testFile := filepath.Join(scriptsDir, "diagnostic-test.tmp")
 	testContent := []byte("agent_smith diagnostic test")
 	err = os.WriteFile(testFile, testContent, 0o644)
 	if err != nil {
-		printResult(false, fmt.Sprintf("Cannot write to scripts directory: %v", err))
-		return
+		return append(results, newCheckResult(
+			"scripts_write",
+			checkFail,
+			fmt.Sprintf("Cannot write to scripts directory: %v", err),
+		))
 	}
-	printResult(true, "File write successful")
+	results = append(results, newCheckResult("scripts_write", checkPass, "File write successful"))
 
 	// Test reading it back
 	readBack, err := os.ReadFile(testFile)
 	if err != nil {
-		printResult(false, fmt.Sprintf("Cannot read back test file: %v", err))
+		results = append(results, newCheckResult(
+			"scripts_read_back",
+			checkFail,
+			fmt.Sprintf("Cannot read back test file: %v", err),
+		))
 	} else if string(readBack) != string(testContent) {
-		printResult(false, "File content mismatch after read-back")
+		results = append(results, newCheckResult(
+			"scripts_read_back",
+			checkFail,
+			"File content mismatch after read-back",
+		))
 	} else {
-		printResult(true, "File read-back verified")
+		results = append(results, newCheckResult(
+			"scripts_read_back",
+			checkPass,
+			"File read-back verified",
+		))
 	}
 
 	// Clean up
@@ -426,14 +679,23 @@ func runTempDirTest(target agentInfo) {
 
 	// Also check the data directory
 	dataDir := agent.GetDataDirectory(target.OrgId)
-	fmt.Printf("    Data directory: %s\n", dataDir)
 	if info, err := os.Stat(dataDir); err != nil {
-		printResult(false, fmt.Sprintf("Data directory does not exist: %v", err))
+		result = newCheckResult(
+			"data_directory",
+			checkFail,
+			fmt.Sprintf("Data directory does not exist: %v", err),
+		)
 	} else if !info.IsDir() {
-		printResult(false, "Data path exists but is not a directory")
+		result = newCheckResult(
+			"data_directory",
+			checkFail,
+			"Data path exists but is not a directory",
+		)
 	} else {
-		printResult(true, "Data directory exists")
+		result = newCheckResult("data_directory", checkPass, "Data directory exists")
 	}
+	result.addDetail("Path", dataDir)
+	return append(results, result)
 }
 
 // ── Check 5: Live log viewer ──
@@ -496,19 +758,43 @@ func runAllChecksWith(
 ) {
 	runCheckServiceStatus(params, target)
 	runCommandTest()
-	runConnectivityTestWith(target, dialer)
+	runConnectivityTestWith(params, target, dialer)
 	runTempDirTest(target)
+	runEngineChecks(ctx, params, target)
+	runConfigChecks(target)
 	runHostInfo(ctx, params, target)
 }
 
+// collectAllChecks runs the same checks as runAllChecksWith and returns their
+// results instead of printing them.
+func collectAllChecks(
+	ctx context.Context,
+	params *diagnosticContext,
+	target agentInfo,
+	dialer tlsDialer,
+) []checkResult {
+	var results []checkResult
+	results = append(results, checkServiceStatus(params, target))
+	results = append(results, checkCommandExecution())
+	results = append(results, checkConnectivity(params, target, dialer)...)
+	results = append(results, checkTempDir(target)...)
+	results = append(results, checkEngine(ctx, params, target)...)
+	results = append(results, checkConfiguration(target))
+	results = append(results, checkServicePaths(target)...)
+	results = append(results, checkHostInfo(ctx, params, target))
+	return results
+}
+
 // ── Check 7: Host information ──
 
 func runHostInfo(ctx context.Context, params *diagnosticContext, target agentInfo) {
 	printSection("Host Information")
+	printCheck(checkHostInfo(ctx, params, target))
+}
 
+func checkHostInfo(ctx context.Context, params *diagnosticContext, target agentInfo) checkResult {
 	if params.Sys == nil || params.Domain == nil {
-		printResult(false, "System or domain provider not available")
-		return
+		return newCheckResult("host_info", checkFail, "System or domain provider not available")
 	}
 
 	info, err := agent.NewHostInfo(
@@ -519,24 +805,28 @@ func runHostInfo(ctx context.Context, params *diagnosticContext, target agentInf
 		params.Domain,
 	)
 	if err != nil {
-		printResult(false, fmt.Sprintf("Failed to gather host information: %v", err))
-		return
+		return newCheckResult(
+			"host_info",
+			checkFail,
+			fmt.Sprintf("Failed to gather host information: %v", err),
+		)
 	}
 
-	printResult(true, "Host information collected")
-	fmt.Printf("      Hostname:                 %s\n", strOrNA(info.HostName))
-	fmt.Printf("      MAC Address:              %s\n", ptrOrNA(info.MacAddress))
-	fmt.Printf("      Operating System:         %s\n", strOrNA(info.OperatingSystem))
-	fmt.Printf("      CPU Model:                %s\n", strOrNA(info.CpuModel))
-	fmt.Printf("      RAM (GB):                 %s\n", strOrNA(info.RamGb))
-	fmt.Printf("      Agent Version:            %s\n", strOrNA(info.AgentVersion))
-	fmt.Printf("      Agent Executable Path:    %s\n", strOrNA(info.AgentExecutablePath))
-	fmt.Printf("      Service Executable Path:  %s\n", strOrNA(info.ServiceExecutablePath))
-	fmt.Printf("      AD Domain:                %s\n", ptrOrNA(info.AdDomain))
-	fmt.Printf("      AD Domain Controller:     %v\n", info.IsAdDomainController)
-	fmt.Printf("      Entra Connect Server:     %v\n", info.IsEntraConnectServer)
-	fmt.Printf("      Entra Domain:             %s\n", ptrOrNA(info.EntraDomain))
-	fmt.Printf("      Org ID:                   %s\n", strOrNA(info.OrgId))
+	result := newCheckResult("host_info", checkPass, "Host information collected")
+	result.addDetail("Hostname", strOrNA(info.HostName))
+	result.addDetail("MAC Address", ptrOrNA(info.MacAddress))
+	result.addDetail("Operating System", strOrNA(info.OperatingSystem))
+	result.addDetail("CPU Model", strOrNA(info.CpuModel))
+	result.addDetail("RAM (GB)", strOrNA(info.RamGb))
+	result.addDetail("Agent Version", strOrNA(info.AgentVersion))
+	result.addDetail("Agent Executable Path", strOrNA(info.AgentExecutablePath))
+	result.addDetail("Service Executable Path", strOrNA(info.ServiceExecutablePath))
+	result.addDetail("AD Domain", ptrOrNA(info.AdDomain))
+	result.addDetail("AD Domain Controller", fmt.Sprint(info.IsAdDomainController))
+	result.addDetail("Entra Connect Server", fmt.Sprint(info.IsEntraConnectServer))
+	result.addDetail("Entra Domain", ptrOrNA(info.EntraDomain))
+	result.addDetail("Org ID", strOrNA(info.OrgId))
+	return result
 }
 
 func strOrNA(s string) string {
@@ -568,3 +858,15 @@ func printResult(pass bool, message string) {
 		fmt.Printf("    [FAIL] %s\n", message)
 	}
 }
+
+// printCheck prints a check result in the same layout as printResult, followed
+// by its details.
+func printCheck(result checkResult) {
+	fmt.Printf("    [%s] %s\n", strings.ToUpper(string(result.Status)), result.Message)
+	for _, detail := range result.Details {
+		fmt.Printf("      %-26s %s\n", detail.Name+":", detail.Value)
+	}
+	if result.Remediation != "" {
+		fmt.Printf("      %-26s %s\n", "Fix:", result.Remediation)
+	}
+}
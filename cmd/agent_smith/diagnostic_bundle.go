@@ -0,0 +1,321 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/version"
+)
+
+// defaultBundleLogMB is how much of the end of each agent log a support bundle
+// includes unless --bundle-log-mb says otherwise.
+const defaultBundleLogMB = 10
+
+// bundleManifestName is the manifest file at the root of a support bundle.
+const bundleManifestName = "manifest.json"
+
+// bundleFile is the manifest record of one file in a support bundle.
+type bundleFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+// bundleManifest lists every file in a support bundle with its hash, plus the
+// pieces that could not be collected, so a truncated or tampered bundle is
+// detectable and missing data is explained.
+type bundleManifest struct {
+	GeneratedAt time.Time    `json:"generated_at"`
+	Version     string       `json:"version"`
+	Files       []bundleFile `json:"files"`
+	Errors      []string     `json:"errors,omitempty"`
+}
+
+// bundleSystem describes the host and binary that produced a support bundle.
+type bundleSystem struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Version     string    `json:"version"`
+	GoVersion   string    `json:"go_version"`
+	OS          string    `json:"os"`
+	Arch        string    `json:"arch"`
+	Hostname    string    `json:"hostname,omitempty"`
+}
+
+// bundleWriter adds files to a zip archive and records each in the manifest.
+type bundleWriter struct {
+	zip      *zip.Writer
+	manifest bundleManifest
+}
+
+func (w *bundleWriter) add(name string, data []byte) error {
+	f, err := w.zip.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: w.manifest.GeneratedAt,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	w.manifest.Files = append(w.manifest.Files, bundleFile{
+		Path:   name,
+		Size:   int64(len(data)),
+		Sha256: hex.EncodeToString(sum[:]),
+	})
+	return nil
+}
+
+func (w *bundleWriter) addJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return w.add(name, data)
+}
+
+// skip records a piece of the bundle that could not be collected.
+func (w *bundleWriter) skip(name string, err error) {
+	w.manifest.Errors = append(w.manifest.Errors, fmt.Sprintf("%s: %v", name, err))
+}
+
+// runDiagnosticBundle collects a support bundle for the selected agents (or
+// every installed agent) and writes it to params.Bundle.
+func runDiagnosticBundle(params *diagnosticContext, out io.Writer) error {
+	targets := resolveDiagnosticTargets(params, getAgentDataRoot(), fallbackScanAgents)
+	if len(targets) == 0 {
+		return fmt.Errorf("no installed agents found; use --org-id <ORG_ID> to select one")
+	}
+
+	err := writeSupportBundle(
+		context.Background(),
+		params,
+		targets,
+		&defaultTLSDialer{},
+		readServiceDefinition,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(out, "Support bundle written to %s\n", params.Bundle)
+	return nil
+}
+
+// writeSupportBundle writes a zip archive to params.Bundle holding, for each
+// target, its diagnostic check results, redacted config, log tail, status
+// file, service definition, and spool and scripts directory listings. A
+// missing piece is recorded in the manifest rather than failing the bundle.
+func writeSupportBundle(
+	ctx context.Context,
+	params *diagnosticContext,
+	targets []agentInfo,
+	dialer tlsDialer,
+	serviceDefinition func(string) (string, []byte, error),
+) error {
+	file, err := os.OpenFile( // #nosec G304 - path is chosen by the operator
+		params.Bundle,
+		os.O_CREATE|os.O_WRONLY|os.O_TRUNC,
+		0o600,
+	)
+	if err != nil {
+		return fmt.Errorf("create bundle: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	w := &bundleWriter{
+		zip: zip.NewWriter(file),
+		manifest: bundleManifest{
+			GeneratedAt: time.Now(),
+			Version:     version.Version,
+			Files:       []bundleFile{},
+		},
+	}
+
+	system := bundleSystem{
+		GeneratedAt: w.manifest.GeneratedAt,
+		Version:     version.Version,
+		GoVersion:   runtime.Version(),
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+	}
+	system.Hostname, _ = os.Hostname()
+	if err := w.addJSON("system.json", system); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+
+	logBytes := int64(params.BundleLogMB) * 1024 * 1024
+	for _, target := range targets {
+		if err := addAgentToBundle(
+			ctx, w, params, target, dialer, serviceDefinition, logBytes,
+		); err != nil {
+			return fmt.Errorf("write bundle: %w", err)
+		}
+	}
+
+	if err := w.addJSON(bundleManifestName, w.manifest); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+	if err := w.zip.Close(); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+	return file.Close()
+}
+
+func addAgentToBundle(
+	ctx context.Context,
+	w *bundleWriter,
+	params *diagnosticContext,
+	target agentInfo,
+	dialer tlsDialer,
+	serviceDefinition func(string) (string, []byte, error),
+	logBytes int64,
+) error {
+	dir := target.OrgId
+
+	checks := collectAllChecks(ctx, params, target, dialer)
+	report := agentReport{OrgId: target.OrgId, Status: worstStatus(checks), Checks: checks}
+	if err := w.addJSON(path.Join(dir, "checks.json"), report); err != nil {
+		return err
+	}
+
+	if data, err := readRedactedConfig(target.ConfigFile); err != nil {
+		w.skip(path.Join(dir, "config.json"), err)
+	} else if err := w.add(path.Join(dir, "config.json"), data); err != nil {
+		return err
+	}
+
+	logName := path.Join(dir, filepath.Base(target.LogFile))
+	if data, err := readLogTail(target.LogFile, logBytes); err != nil {
+		w.skip(logName, err)
+	} else if err := w.add(logName, data); err != nil {
+		return err
+	}
+
+	dataDir := filepath.Dir(target.ConfigFile)
+	statusFile := filepath.Join(dataDir, statusFileName)
+	if data, err := os.ReadFile(statusFile); err != nil { // #nosec G304
+		w.skip(path.Join(dir, statusFileName), err)
+	} else if err := w.add(path.Join(dir, statusFileName), data); err != nil {
+		return err
+	}
+
+	if serviceDefinition != nil {
+		name, data, err := serviceDefinition(target.ServiceName)
+		if err != nil {
+			w.skip(path.Join(dir, "service", name), err)
+		} else if err := w.add(path.Join(dir, "service", name), data); err != nil {
+			return err
+		}
+	}
+
+	listings := []struct {
+		name string
+		path string
+	}{
+		{"spool.txt", filepath.Join(dataDir, postbackSpoolDirName)},
+		{"scripts.txt", agent.GetScriptsDirectory(target.OrgId)},
+	}
+	for _, listing := range listings {
+		if data, err := listDirectory(listing.path); err != nil {
+			w.skip(path.Join(dir, listing.name), err)
+		} else if err := w.add(path.Join(dir, listing.name), data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readRedactedConfig returns the config file with every secret field replaced
+// by a placeholder. Unknown fields are kept so the bundle shows the config as
+// the agent sees it.
+func readRedactedConfig(name string) ([]byte, error) {
+	data, err := os.ReadFile(name) // #nosec G304 - path comes from internal config
+	if err != nil {
+		return nil, err
+	}
+	return redactConfig(data)
+}
+
+// readLogTail returns at most the last limit bytes of a log file. When the
+// file is cut, the partial first line is dropped so the tail starts cleanly.
+func readLogTail(name string, limit int64) ([]byte, error) {
+	file, err := os.Open(name) // #nosec G304 - path comes from internal config
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset := info.Size() - limit
+	if offset <= 0 {
+		return io.ReadAll(file)
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	return data, nil
+}
+
+// listDirectory renders one line per entry of dir with its size and
+// modification time. File contents are never read.
+func listDirectory(dir string) ([]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", dir)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			fmt.Fprintf(&b, "  %s (%v)\n", entry.Name(), err)
+			continue
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintf(
+			&b,
+			"  %-50s %12d  %s\n",
+			name,
+			info.Size(),
+			info.ModTime().UTC().Format(time.RFC3339),
+		)
+	}
+	return []byte(b.String()), nil
+}
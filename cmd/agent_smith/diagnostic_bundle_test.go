@@ -0,0 +1,320 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+)
+
+func TestReadRedactedConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	data := `{"rewst_org_id":"org","shared_access_key":"secret-key",` +
+		`"github_token":"secret-token","custom_field":"kept"}`
+	if err := os.WriteFile(configFile, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readRedactedConfig(configFile)
+	if err != nil {
+		t.Fatalf("readRedactedConfig: %v", err)
+	}
+
+	if strings.Contains(string(got), "secret") {
+		t.Errorf("expected secrets to be redacted, got %s", got)
+	}
+
+	var config map[string]any
+	if err := json.Unmarshal(got, &config); err != nil {
+		t.Fatalf("redacted config is not JSON: %v", err)
+	}
+	if config["shared_access_key"] != configRedacted || config["github_token"] != configRedacted {
+		t.Errorf("expected secret fields to be %q, got %v", configRedacted, config)
+	}
+	if config["rewst_org_id"] != "org" || config["custom_field"] != "kept" {
+		t.Errorf("expected other fields to be kept, got %v", config)
+	}
+}
+
+func TestReadRedactedConfig_Invalid(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configFile, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readRedactedConfig(configFile); err == nil {
+		t.Fatal("expected error for invalid config, got nil")
+	}
+}
+
+func TestReadLogTail(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "agent.log")
+	if err := os.WriteFile(logFile, []byte("first line\nsecond line\nthird\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readLogTail(logFile, 1024)
+	if err != nil {
+		t.Fatalf("readLogTail: %v", err)
+	}
+	if string(got) != "first line\nsecond line\nthird\n" {
+		t.Errorf("expected the whole log, got %q", got)
+	}
+
+	// Cutting into the second line drops its partial start.
+	got, err = readLogTail(logFile, 15)
+	if err != nil {
+		t.Fatalf("readLogTail: %v", err)
+	}
+	if string(got) != "third\n" {
+		t.Errorf("expected only complete lines, got %q", got)
+	}
+}
+
+func TestListDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "b.json"), []byte("12345"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := listDirectory(dir)
+	if err != nil {
+		t.Fatalf("listDirectory: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and two entries, got %q", got)
+	}
+	if !strings.Contains(lines[1], "a/") || !strings.Contains(lines[2], "b.json") ||
+		!strings.Contains(lines[2], " 5 ") {
+		t.Errorf("unexpected listing %q", got)
+	}
+
+	if _, err := listDirectory(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for a missing directory, got nil")
+	}
+}
+
+func TestWriteSupportBundle(t *testing.T) {
+	orgId := "6a0f7f64-3f0e-4f43-9d3c-5d2b7e1c9a10"
+	dataDir := t.TempDir()
+	configFile := filepath.Join(dataDir, "config.json")
+	logFile := filepath.Join(dataDir, "rewst_agent.log")
+
+	config, _ := json.Marshal(agent.Device{
+		RewstOrgId:      orgId,
+		AzureIotHubHost: "hub.example.com",
+		SharedAccessKey: "secret-key",
+	})
+	files := map[string]string{
+		configFile:                             string(config),
+		logFile:                                "log line\n",
+		filepath.Join(dataDir, statusFileName): `{"connection_state":"connected"}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spoolDir := filepath.Join(dataDir, postbackSpoolDirName)
+	if err := os.Mkdir(spoolDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(spoolDir, "1.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	params := &diagnosticContext{
+		Diagnostic:     true,
+		Bundle:         filepath.Join(t.TempDir(), "bundle.zip"),
+		BundleLogMB:    defaultBundleLogMB,
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: true}},
+		Sys:            &mockSystemInfoProvider{hostname: "host", hostPlatform: "linux"},
+		Domain:         &mockDomainInfoProvider{},
+	}
+	defer func() { _ = os.RemoveAll(agent.GetScriptsDirectory(orgId)) }()
+
+	targets := []agentInfo{{
+		OrgId:       orgId,
+		ConfigFile:  configFile,
+		LogFile:     logFile,
+		ServiceName: "agent-service",
+	}}
+	serviceDefinition := func(name string) (string, []byte, error) {
+		return name + ".service", []byte("[Unit]\n"), nil
+	}
+
+	err := writeSupportBundle(
+		context.Background(),
+		params,
+		targets,
+		&mockTLSDialer{result: true},
+		serviceDefinition,
+	)
+	if err != nil {
+		t.Fatalf("writeSupportBundle: %v", err)
+	}
+
+	info, err := os.Stat(params.Bundle)
+	if err != nil {
+		t.Fatalf("bundle not written: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		t.Errorf("expected bundle to be private, got mode %v", info.Mode())
+	}
+
+	contents := readBundle(t, params.Bundle)
+
+	for _, name := range []string{
+		"system.json",
+		bundleManifestName,
+		orgId + "/checks.json",
+		orgId + "/config.json",
+		orgId + "/rewst_agent.log",
+		orgId + "/" + statusFileName,
+		orgId + "/service/agent-service.service",
+		orgId + "/spool.txt",
+		orgId + "/scripts.txt",
+	} {
+		if _, ok := contents[name]; !ok {
+			t.Errorf("expected %s in bundle", name)
+		}
+	}
+
+	if strings.Contains(contents[orgId+"/config.json"], "secret-key") {
+		t.Error("expected shared access key to be redacted in bundle")
+	}
+	if !strings.Contains(contents[orgId+"/spool.txt"], "1.json") {
+		t.Errorf("expected spool listing to name entries, got %q", contents[orgId+"/spool.txt"])
+	}
+
+	var report agentReport
+	if err := json.Unmarshal([]byte(contents[orgId+"/checks.json"]), &report); err != nil {
+		t.Fatalf("checks.json is not JSON: %v", err)
+	}
+	if report.OrgId != orgId || len(report.Checks) == 0 {
+		t.Errorf("unexpected checks %+v", report)
+	}
+
+	var manifest bundleManifest
+	if err := json.Unmarshal([]byte(contents[bundleManifestName]), &manifest); err != nil {
+		t.Fatalf("manifest is not JSON: %v", err)
+	}
+	if len(manifest.Files) != len(contents)-1 {
+		t.Errorf("expected manifest to list %d files, got %d", len(contents)-1, len(manifest.Files))
+	}
+	for _, file := range manifest.Files {
+		data, ok := contents[file.Path]
+		if !ok {
+			t.Errorf("manifest lists %s, which is not in the bundle", file.Path)
+			continue
+		}
+		sum := sha256.Sum256([]byte(data))
+		if file.Sha256 != hex.EncodeToString(sum[:]) || file.Size != int64(len(data)) {
+			t.Errorf("manifest entry for %s does not match its contents", file.Path)
+		}
+	}
+}
+
+func TestWriteSupportBundle_RecordsMissingPieces(t *testing.T) {
+	orgId := "6a0f7f64-3f0e-4f43-9d3c-5d2b7e1c9a10"
+	dataDir := t.TempDir()
+
+	params := &diagnosticContext{
+		Diagnostic:     true,
+		Bundle:         filepath.Join(t.TempDir(), "bundle.zip"),
+		BundleLogMB:    defaultBundleLogMB,
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: false}},
+		Sys:            &mockSystemInfoProvider{},
+		Domain:         &mockDomainInfoProvider{},
+	}
+	defer func() { _ = os.RemoveAll(agent.GetScriptsDirectory(orgId)) }()
+
+	targets := []agentInfo{{
+		OrgId:      orgId,
+		ConfigFile: filepath.Join(dataDir, "config.json"),
+		LogFile:    filepath.Join(dataDir, "rewst_agent.log"),
+	}}
+	serviceDefinition := func(string) (string, []byte, error) {
+		return "unit.service", nil, errors.New("not installed")
+	}
+
+	err := writeSupportBundle(
+		context.Background(),
+		params,
+		targets,
+		&mockTLSDialer{},
+		serviceDefinition,
+	)
+	if err != nil {
+		t.Fatalf("writeSupportBundle: %v", err)
+	}
+
+	contents := readBundle(t, params.Bundle)
+	if _, ok := contents[orgId+"/checks.json"]; !ok {
+		t.Error("expected check results even when agent files are missing")
+	}
+
+	var manifest bundleManifest
+	if err := json.Unmarshal([]byte(contents[bundleManifestName]), &manifest); err != nil {
+		t.Fatalf("manifest is not JSON: %v", err)
+	}
+	errs := strings.Join(manifest.Errors, "\n")
+	for _, name := range []string{"config.json", "rewst_agent.log", "unit.service", "spool.txt"} {
+		if !strings.Contains(errs, name) {
+			t.Errorf("expected manifest errors to mention %s, got %q", name, errs)
+		}
+	}
+}
+
+func TestWriteSupportBundle_InvalidPath(t *testing.T) {
+	params := &diagnosticContext{
+		Bundle:      filepath.Join(t.TempDir(), "missing", "bundle.zip"),
+		BundleLogMB: defaultBundleLogMB,
+	}
+
+	err := writeSupportBundle(context.Background(), params, nil, &mockTLSDialer{}, nil)
+	if err == nil {
+		t.Fatal("expected error for an unwritable bundle path, got nil")
+	}
+}
+
+// readBundle returns the contents of every file in a bundle keyed by path.
+func readBundle(t *testing.T, name string) map[string]string {
+	t.Helper()
+
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		t.Fatalf("open bundle: %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	contents := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		contents[f.Name] = string(data)
+	}
+	return contents
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+)
+
+// ── Check 9: Configuration and file permissions ──
+
+func runConfigChecks(target agentInfo) {
+	printSection("Configuration and File Permissions")
+	printCheck(checkConfiguration(target))
+	for _, result := range checkServicePaths(target) {
+		printCheck(result)
+	}
+}
+
+// serviceOwnerUid returns the uid the service runs as, and so should own its
+// files, on Linux and macOS: the account the config records as
+// service_username, or root when there is none.
+func serviceOwnerUid(device *agent.Device) (uint32, error) {
+	if runtime.GOOS == "windows" || device == nil || device.ServiceUsername == "" {
+		return 0, nil
+	}
+	account, err := user.Lookup(device.ServiceUsername)
+	if err != nil {
+		return 0, err
+	}
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(uid), nil
+}
+
+// checkServicePaths checks the agent's paths against the service account the
+// config records.
+func checkServicePaths(target agentInfo) []checkResult {
+	uid, err := serviceOwnerUid(target.Device)
+	if err != nil {
+		result := newCheckResult(
+			"service_account",
+			checkFail,
+			fmt.Sprintf("Cannot look up service account %s: %v",
+				target.Device.ServiceUsername, err),
+		)
+		result.Remediation = "Create the account, or register the service under another " +
+			"with --update --service-username"
+		return []checkResult{result}
+	}
+	return checkPathPermissions(target, uid)
+}
+
+// checkConfiguration applies the validation the config and service modes use
+// to the installed config.json, plus range checks on every tuning field, and
+// lists every problem found.
+func checkConfiguration(target agentInfo) checkResult {
+	data, err := os.ReadFile(target.ConfigFile) // #nosec G304 - path comes from internal config
+	if err != nil {
+		result := newCheckResult(
+			"config_valid",
+			checkFail,
+			fmt.Sprintf("Cannot read %s: %v", target.ConfigFile, err),
+		)
+		result.Remediation = "Reinstall the agent with --config-url and --config-secret"
+		return result
+	}
+
+	var device agent.Device
+	if err := json.Unmarshal(data, &device); err != nil {
+		result := newCheckResult(
+			"config_valid",
+			checkFail,
+			fmt.Sprintf("%s is not valid JSON: %v", target.ConfigFile, err),
+		)
+		result.Remediation = "Restore config.json from a backup or reinstall the agent"
+		return result
+	}
+
+	var problems []error
+	if err := validateConfiguration(device); err != nil {
+		problems = append(problems, err)
+	}
+	if err := validateSyslogSettings(device); err != nil {
+		problems = append(problems, err)
+	}
+	problems = append(problems, validateTuningRanges(device)...)
+
+	if len(problems) == 0 {
+		return newCheckResult("config_valid", checkPass, "config.json is valid")
+	}
+
+	result := newCheckResult(
+		"config_valid",
+		checkFail,
+		fmt.Sprintf("config.json has %d problem(s)", len(problems)),
+	)
+	for _, problem := range problems {
+		result.addDetail("Problem", problem.Error())
+	}
+	result.Remediation = "Correct the listed fields with --update (e.g. --worker-count), " +
+		"or reinstall the agent to fetch a fresh configuration"
+	return result
+}
+
+// agentPath is a file or directory whose permissions are checked.
+type agentPath struct {
+	check string
+	label string
+	path  string
+	dir   bool
+	// required paths must exist; the others are created on demand.
+	required bool
+	// secret paths hold credentials.
+	secret bool
+}
+
+// checkPathPermissions checks that the config file, log file and spool
+// directory exist as the expected kind of file, are owned by ownerUid and
+// are not writable by other users. Ownership and mode bits are not checked on
+// Windows, where ACLs govern access.
+func checkPathPermissions(target agentInfo, ownerUid uint32) []checkResult {
+	paths := []agentPath{
+		{
+			check:    "config_permissions",
+			label:    "Config file",
+			path:     target.ConfigFile,
+			required: true,
+			secret:   true,
+		},
+		{check: "log_permissions", label: "Log file", path: target.LogFile},
+		{
+			check: "spool_permissions",
+			label: "Postback spool",
+			path:  filepath.Join(filepath.Dir(target.ConfigFile), postbackSpoolDirName),
+			dir:   true,
+		},
+	}
+
+	results := make([]checkResult, 0, len(paths))
+	for _, p := range paths {
+		results = append(results, checkPath(p, ownerUid))
+	}
+	return results
+}
+
+func checkPath(p agentPath, ownerUid uint32) checkResult {
+	info, err := os.Stat(p.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if !p.required {
+			return newCheckResult(
+				p.check,
+				checkPass,
+				fmt.Sprintf("%s not created yet (%s)", p.label, p.path),
+			)
+		}
+		result := newCheckResult(
+			p.check,
+			checkFail,
+			fmt.Sprintf("%s missing (%s)", p.label, p.path),
+		)
+		result.Remediation = "Reinstall the agent with --config-url and --config-secret"
+		return result
+	}
+	if err != nil {
+		result := newCheckResult(
+			p.check,
+			checkFail,
+			fmt.Sprintf("Cannot inspect %s: %v", p.path, err),
+		)
+		result.Remediation = "Run the diagnostic as root or Administrator"
+		return result
+	}
+
+	result := newCheckResult(p.check, checkPass, fmt.Sprintf("%s %s", p.label, p.path))
+	result.addDetail("Mode", info.Mode().String())
+
+	if info.IsDir() != p.dir {
+		result.Status = checkFail
+		kind := "a file"
+		if p.dir {
+			kind = "a directory"
+		}
+		result.Message = fmt.Sprintf("%s %s is not %s", p.label, p.path, kind)
+		result.Remediation = fmt.Sprintf("Move %s aside so the agent can recreate it", p.path)
+		return result
+	}
+
+	if runtime.GOOS == "windows" {
+		return result
+	}
+
+	if uid, ok := fileOwner(info); ok {
+		result.addDetail("Owner UID", fmt.Sprint(uid))
+		if uid != ownerUid {
+			result.Status = checkFail
+			result.Message = fmt.Sprintf(
+				"%s %s is owned by uid %d, not %d",
+				p.label, p.path, uid, ownerUid,
+			)
+			result.Remediation = fmt.Sprintf("chown %d %s", ownerUid, p.path)
+			return result
+		}
+	}
+
+	if info.Mode().Perm()&0o002 != 0 {
+		result.Status = checkFail
+		result.Message = fmt.Sprintf("%s %s is writable by every user", p.label, p.path)
+		result.Remediation = fmt.Sprintf("chmod o-w %s", p.path)
+		return result
+	}
+
+	if p.secret && info.Mode().Perm()&0o044 != 0 {
+		result.addDetail("Note", "readable by other users; it holds the shared access key")
+	}
+
+	return result
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+)
+
+func writeTestConfig(t *testing.T, device any) agentInfo {
+	t.Helper()
+
+	dir := t.TempDir()
+	data, err := json.Marshal(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return agentInfo{
+		OrgId:      "org-1",
+		ConfigFile: configFile,
+		LogFile:    filepath.Join(dir, "rewst_agent.log"),
+	}
+}
+
+func TestCheckConfiguration_Valid(t *testing.T) {
+	target := writeTestConfig(t, agent.Device{
+		DeviceId:        "device-123",
+		RewstEngineHost: "engine.example.com",
+		SharedAccessKey: "key123",
+		AzureIotHubHost: "hub.example.com",
+	})
+
+	if result := checkConfiguration(target); result.Status != checkPass {
+		t.Errorf("expected pass, got %+v", result)
+	}
+}
+
+func TestCheckConfiguration_Problems(t *testing.T) {
+	workers := 0
+	target := writeTestConfig(t, agent.Device{
+		DeviceId:        "device-123",
+		SharedAccessKey: "key123",
+		AzureIotHubHost: "hub.example.com",
+		SyslogTransport: "udp",
+		WorkerCount:     &workers,
+	})
+
+	result := checkConfiguration(target)
+	if result.Status != checkFail || result.Remediation == "" {
+		t.Fatalf("expected failure with remediation, got %+v", result)
+	}
+
+	var problems []string
+	for _, detail := range result.Details {
+		problems = append(problems, detail.Value)
+	}
+	joined := strings.Join(problems, "\n")
+	for _, want := range []string{"rewst_engine_host", "syslog_address", "worker_count"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected a problem naming %s, got %q", want, joined)
+		}
+	}
+}
+
+func TestCheckConfiguration_Unreadable(t *testing.T) {
+	target := agentInfo{ConfigFile: filepath.Join(t.TempDir(), "missing.json")}
+	if result := checkConfiguration(target); result.Status != checkFail {
+		t.Errorf("expected failure for a missing config, got %+v", result)
+	}
+
+	target = writeTestConfig(t, "not an object")
+	if result := checkConfiguration(target); result.Status != checkFail {
+		t.Errorf("expected failure for an invalid config, got %+v", result)
+	}
+}
+
+func TestCheckPathPermissions(t *testing.T) {
+	target := writeTestConfig(t, agent.Device{})
+	owner := uint32(os.Geteuid())
+
+	results := checkPathPermissions(target, owner)
+	if len(results) != 3 {
+		t.Fatalf("expected config, log and spool results, got %+v", results)
+	}
+	for _, result := range results {
+		if result.Status != checkPass {
+			t.Errorf("%s: expected pass, got %+v", result.Name, result)
+		}
+	}
+	if !strings.Contains(results[1].Message, "not created yet") {
+		t.Errorf("expected a missing log to be reported as not created, got %q", results[1].Message)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	// A world-writable spool directory fails.
+	spoolDir := filepath.Join(filepath.Dir(target.ConfigFile), postbackSpoolDirName)
+	if err := os.Mkdir(spoolDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(spoolDir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	results = checkPathPermissions(target, owner)
+	if results[2].Status != checkFail || !strings.Contains(results[2].Remediation, "chmod") {
+		t.Errorf("expected world-writable spool to fail, got %+v", results[2])
+	}
+
+	// A file owned by someone else fails.
+	results = checkPathPermissions(target, owner+1)
+	if results[0].Status != checkFail || !strings.Contains(results[0].Remediation, "chown") {
+		t.Errorf("expected foreign owner to fail, got %+v", results[0])
+	}
+}
+
+func TestCheckServicePaths_ServiceAccount(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ownership is not checked on Windows")
+	}
+
+	// Run as root, the files are handed to an unprivileged account the way
+	// an agent installed with --service-username keeps them.
+	account, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Geteuid() == 0 {
+		account, err = user.Lookup("nobody")
+		if err != nil {
+			t.Skip("no unprivileged account to own the files")
+		}
+	}
+	uid, err := strconv.Atoi(account.Uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := agent.Device{ServiceUsername: account.Username}
+	target := writeTestConfig(t, device)
+	target.Device = &device
+	if os.Geteuid() == 0 {
+		if err := os.Chown(target.ConfigFile, uid, -1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := checkServicePaths(target)
+	if len(results) != 3 || results[0].Status != checkPass {
+		t.Fatalf("expected a config owned by the service account to pass, got %+v", results)
+	}
+
+	// Without an account the service runs as root, which does not own it.
+	target.Device = &agent.Device{}
+	results = checkServicePaths(target)
+	if uid != 0 && results[0].Status != checkFail {
+		t.Errorf("expected a config not owned by root to fail, got %+v", results[0])
+	}
+
+	// An account that does not exist is reported rather than assumed.
+	target.Device = &agent.Device{ServiceUsername: "agent-smith-missing-account"}
+	results = checkServicePaths(target)
+	if len(results) != 1 || results[0].Status != checkFail {
+		t.Errorf("expected a missing service account to fail, got %+v", results)
+	}
+}
+
+func TestCheckPathPermissions_MissingConfig(t *testing.T) {
+	dir := t.TempDir()
+	target := agentInfo{
+		ConfigFile: filepath.Join(dir, "config.json"),
+		LogFile:    filepath.Join(dir, "rewst_agent.log"),
+	}
+
+	results := checkPathPermissions(target, uint32(os.Geteuid()))
+	if results[0].Status != checkFail {
+		t.Errorf("expected a missing config to fail, got %+v", results[0])
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"net/http"
 
 	"github.com/RewstApp/agent-smith-go/internal/agent"
 	"github.com/RewstApp/agent-smith-go/internal/service"
@@ -11,11 +12,23 @@ import (
 )
 
 type diagnosticContext struct {
-	OrgId      string
-	Diagnostic bool
+	OrgId           string
+	Diagnostic      bool
+	NonInteractive  bool
+	Json            bool
+	Bundle          string
+	BundleLogMB     int
+	AllowDisconnect bool
 
 	Sys    agent.SystemInfoProvider
 	Domain agent.DomainInfoProvider
+	MQTT   mqttHandshaker
+
+	// Resolver and HTTPClient reach the Rewst engine in the engine checks.
+	// When nil the system resolver and a client with engineCheckTimeout are
+	// used.
+	Resolver   hostResolver
+	HTTPClient *http.Client
 
 	ServiceManager service.ServiceManager
 	FS             utils.FileSystem
@@ -28,6 +41,26 @@ func newDiagnosticFlagSet(params *diagnosticContext) *flag.FlagSet {
 	fs := flag.NewFlagSet("diagnostic", flag.ContinueOnError)
 	fs.StringVar(&params.OrgId, "org-id", "", "Organization ID")
 	fs.BoolVar(&params.Diagnostic, "diagnostic", false, "Run diagnostic mode")
+	fs.BoolVar(
+		&params.NonInteractive,
+		"non-interactive",
+		false,
+		"Run every check without prompting and exit with a status code",
+	)
+	fs.BoolVar(&params.Json, "json", false, "Print the non-interactive report as JSON")
+	fs.StringVar(&params.Bundle, "bundle", "", "Write a support bundle archive to this path")
+	fs.IntVar(
+		&params.BundleLogMB,
+		"bundle-log-mb",
+		defaultBundleLogMB,
+		"Megabytes of each agent log to include in the support bundle",
+	)
+	fs.BoolVar(
+		&params.AllowDisconnect,
+		"allow-disconnect",
+		false,
+		"Test the full MQTT session even if it briefly disconnects the running service",
+	)
 	fs.SetOutput(io.Discard)
 	return fs
 }
@@ -52,8 +85,17 @@ func newDiagnosticContext(
 		return nil, fmt.Errorf("missing diagnostic")
 	}
 
+	if params.Json && !params.NonInteractive {
+		return nil, fmt.Errorf("json requires non-interactive")
+	}
+
+	if params.BundleLogMB <= 0 {
+		return nil, fmt.Errorf("bundle-log-mb must be greater than 0")
+	}
+
 	params.Sys = sys
 	params.Domain = domain
+	params.MQTT = &defaultMqttHandshaker{}
 	params.ServiceManager = svcMgr
 	params.FS = fsys
 
@@ -71,3 +71,96 @@ func TestNewDiagnosticContext_UnknownFlag(t *testing.T) {
 		t.Fatal("expected error for unknown flag, got nil")
 	}
 }
+
+func TestNewDiagnosticContext_NonInteractiveJson(t *testing.T) {
+	ctx, err := newDiagnosticContext(
+		[]string{"--diagnostic", "--non-interactive", "--json"},
+		&mockSystemInfoProvider{},
+		&mockDomainInfoProvider{},
+		&mockServiceManager{},
+		&mockFileSystem{},
+	)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if !ctx.NonInteractive || !ctx.Json {
+		t.Errorf("expected non-interactive json mode, got %+v", ctx)
+	}
+}
+
+func TestNewDiagnosticContext_JsonRequiresNonInteractive(t *testing.T) {
+	_, err := newDiagnosticContext(
+		[]string{"--diagnostic", "--json"},
+		&mockSystemInfoProvider{},
+		&mockDomainInfoProvider{},
+		&mockServiceManager{},
+		&mockFileSystem{},
+	)
+	if err == nil {
+		t.Fatal("expected error for --json without --non-interactive, got nil")
+	}
+}
+
+func TestNewDiagnosticContext_Bundle(t *testing.T) {
+	ctx, err := newDiagnosticContext(
+		[]string{"--diagnostic", "--bundle", "bundle.zip", "--bundle-log-mb", "2"},
+		&mockSystemInfoProvider{},
+		&mockDomainInfoProvider{},
+		&mockServiceManager{},
+		&mockFileSystem{},
+	)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if ctx.Bundle != "bundle.zip" || ctx.BundleLogMB != 2 {
+		t.Errorf("expected bundle.zip with 2 MB of log, got %+v", ctx)
+	}
+}
+
+func TestNewDiagnosticContext_BundleLogMBDefault(t *testing.T) {
+	ctx, err := newDiagnosticContext(
+		[]string{"--diagnostic"},
+		&mockSystemInfoProvider{},
+		&mockDomainInfoProvider{},
+		&mockServiceManager{},
+		&mockFileSystem{},
+	)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if ctx.BundleLogMB != defaultBundleLogMB {
+		t.Errorf("expected default bundle-log-mb %d, got %d", defaultBundleLogMB, ctx.BundleLogMB)
+	}
+}
+
+func TestNewDiagnosticContext_InvalidBundleLogMB(t *testing.T) {
+	_, err := newDiagnosticContext(
+		[]string{"--diagnostic", "--bundle", "bundle.zip", "--bundle-log-mb", "0"},
+		&mockSystemInfoProvider{},
+		&mockDomainInfoProvider{},
+		&mockServiceManager{},
+		&mockFileSystem{},
+	)
+	if err == nil {
+		t.Fatal("expected error for --bundle-log-mb 0, got nil")
+	}
+}
+
+func TestNewDiagnosticContext_AllowDisconnect(t *testing.T) {
+	ctx, err := newDiagnosticContext(
+		[]string{"--diagnostic", "--non-interactive", "--allow-disconnect"},
+		&mockSystemInfoProvider{},
+		&mockDomainInfoProvider{},
+		&mockServiceManager{},
+		&mockFileSystem{},
+	)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if !ctx.AllowDisconnect {
+		t.Error("expected allow-disconnect to be set")
+	}
+	if ctx.MQTT == nil {
+		t.Error("expected the MQTT handshaker to be set")
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+const (
+	// engineCheckTimeout bounds each request the engine checks make.
+	engineCheckTimeout = 10 * time.Second
+	// clockSkewWarn and clockSkewFail are the clock offsets, against the
+	// engine's Date header, at which the clock check warns and fails. IoT Hub
+	// validates SAS token expiry and TLS validates certificate lifetimes against
+	// the local clock, so a clock several minutes off breaks connections.
+	clockSkewWarn = 1 * time.Minute
+	clockSkewFail = 5 * time.Minute
+)
+
+// hostResolver resolves host names so tests can avoid real DNS; *net.Resolver
+// satisfies it.
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// ── Check 8: Engine reachability ──
+
+func runEngineChecks(ctx context.Context, params *diagnosticContext, target agentInfo) {
+	printSection("Rewst Engine Reachability")
+	for _, result := range checkEngine(ctx, params, target) {
+		printCheck(result)
+	}
+}
+
+// checkEngine resolves the engine host every result is posted to, sends it a
+// harmless HTTPS request and compares the local clock with the response's Date
+// header. The alternate hosts postbacks fail over to get the same DNS and HTTPS
+// checks; one that cannot be reached is a warning, since postbacks only need
+// one host to answer.
+func checkEngine(ctx context.Context, params *diagnosticContext, target agentInfo) []checkResult {
+	if target.Device == nil || target.Device.RewstEngineHost == "" {
+		result := newCheckResult("engine_https", checkFail, "Rewst engine host not configured")
+		result.Remediation = "Reconfigure the agent with --config-url and --config-secret"
+		return []checkResult{result}
+	}
+
+	results := checkEngineHost(ctx, params, target.Device.RewstEngineHost, true)
+	for _, host := range target.Device.RewstEngineAlternateHosts {
+		for _, result := range checkEngineHost(ctx, params, host, false) {
+			result.Name = strings.Replace(result.Name, "engine_", "engine_alternate_", 1)
+			if result.Status == checkFail {
+				result.Status = checkWarn
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// checkEngineHost runs the DNS and HTTPS checks on one engine host, plus the
+// clock check when withClock is set. A host that does not resolve gets the DNS
+// result alone.
+func checkEngineHost(
+	ctx context.Context,
+	params *diagnosticContext,
+	host string,
+	withClock bool,
+) []checkResult {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	dns := checkEngineDNS(ctx, params, hostname)
+	if dns.Status == checkFail {
+		return []checkResult{dns}
+	}
+
+	https, clock := checkEngineHTTPS(ctx, params, host)
+	if !withClock {
+		return []checkResult{dns, https}
+	}
+	return []checkResult{dns, https, clock}
+}
+
+func checkEngineDNS(ctx context.Context, params *diagnosticContext, hostname string) checkResult {
+	var resolver hostResolver = net.DefaultResolver
+	if params.Resolver != nil {
+		resolver = params.Resolver
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, engineCheckTimeout)
+	defer cancel()
+
+	started := time.Now()
+	addrs, err := resolver.LookupHost(ctx, hostname)
+	if err != nil {
+		result := newCheckResult(
+			"engine_dns",
+			checkFail,
+			fmt.Sprintf("DNS resolution of %s failed: %v", hostname, err),
+		)
+		result.Remediation = fmt.Sprintf(
+			"Check that the DNS servers configured on this host can resolve %s",
+			hostname,
+		)
+		return result
+	}
+
+	result := newCheckResult("engine_dns", checkPass, fmt.Sprintf("DNS resolution of %s", hostname))
+	result.addDetail("Addresses", strings.Join(addrs, ", "))
+	result.addDetail("Latency", formatLatency(time.Since(started)))
+	return result
+}
+
+// checkEngineHTTPS sends GET / to the engine and returns the reachability and
+// clock skew results. Any HTTP response proves the engine is reachable; a
+// server error is a warning since postbacks would likely fail too.
+func checkEngineHTTPS(
+	ctx context.Context,
+	params *diagnosticContext,
+	host string,
+) (checkResult, checkResult) {
+	client := params.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: engineCheckTimeout}
+	}
+
+	url := fmt.Sprintf("https://%s/", host)
+	clock := newCheckResult(
+		"clock_skew",
+		checkWarn,
+		"Clock skew not measured: the engine did not respond",
+	)
+	clock.Remediation = "Fix engine reachability first, then rerun this check"
+
+	req, err := utils.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		result := newCheckResult(
+			"engine_https",
+			checkFail,
+			fmt.Sprintf("Invalid engine URL: %v", err),
+		)
+		result.Remediation = "Check rewst_engine_host in config.json"
+		return result, clock
+	}
+
+	sent := time.Now()
+	resp, err := client.Do(req)
+	received := time.Now()
+	if err != nil {
+		result := newCheckResult(
+			"engine_https",
+			checkFail,
+			fmt.Sprintf("HTTPS request to %s failed: %v", url, err),
+		)
+		result.Remediation = fmt.Sprintf(
+			"Allow outbound HTTPS (port 443) to %s and check proxy or TLS inspection settings",
+			host,
+		)
+		return result, clock
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	_ = resp.Body.Close()
+
+	result := newCheckResult(
+		"engine_https",
+		checkPass,
+		fmt.Sprintf("HTTPS request to %s answered %s", url, resp.Status),
+	)
+	result.addDetail("Status Code", fmt.Sprint(resp.StatusCode))
+	result.addDetail("Latency", formatLatency(received.Sub(sent)))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		result.Status = checkWarn
+		result.Remediation = "The engine is reachable but failing; " +
+			"postbacks will be retried and spooled until it recovers"
+	}
+
+	// The Date header is stamped somewhere between sending and receiving, so
+	// compare it with the midpoint.
+	return result, checkClockSkew(resp.Header.Get("Date"), sent.Add(received.Sub(sent)/2))
+}
+
+// checkClockSkew compares the local time with an HTTP Date header.
+func checkClockSkew(date string, local time.Time) checkResult {
+	remote, err := http.ParseTime(date)
+	if err != nil {
+		return newCheckResult(
+			"clock_skew",
+			checkWarn,
+			"Clock skew not measured: the engine response has no valid Date header",
+		)
+	}
+
+	// Date has one-second resolution, so smaller offsets are noise.
+	skew := local.Sub(remote).Truncate(time.Second)
+
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+	}
+
+	result := newCheckResult("clock_skew", checkPass, "System clock matches the engine")
+	if abs > 0 {
+		result.Message = fmt.Sprintf("System clock is %s %s the engine", abs, direction)
+	}
+	result.addDetail("Local Time", local.UTC().Format(time.RFC3339))
+	result.addDetail("Engine Time", remote.UTC().Format(time.RFC3339))
+	result.addDetail("Skew", skew.String())
+
+	switch {
+	case abs > clockSkewFail:
+		result.Status = checkFail
+	case abs > clockSkewWarn:
+		result.Status = checkWarn
+	}
+	if result.Status != checkPass {
+		result.Remediation = "Synchronize the system clock with NTP (w32time on Windows); " +
+			"IoT Hub rejects SAS tokens and TLS rejects certificates when the clock is off"
+	}
+	return result
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+)
+
+// failingResolver fails every lookup.
+type failingResolver struct{}
+
+func (failingResolver) LookupHost(context.Context, string) ([]string, error) {
+	return nil, errors.New("no such host")
+}
+
+func engineTarget(host string) agentInfo {
+	return agentInfo{OrgId: "org-1", Device: &agent.Device{RewstEngineHost: host}}
+}
+
+func TestCheckEngine_Reachable(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	params := &diagnosticContext{HTTPClient: server.Client()}
+	target := engineTarget(server.Listener.Addr().String())
+
+	results := checkEngine(context.Background(), params, target)
+	if len(results) != 3 {
+		t.Fatalf("expected dns, https and clock results, got %+v", results)
+	}
+	for _, result := range results {
+		if result.Status != checkPass {
+			t.Errorf("%s: expected pass, got %+v", result.Name, result)
+		}
+	}
+	if !strings.Contains(results[1].Message, "404") {
+		t.Errorf("expected response code in message, got %q", results[1].Message)
+	}
+}
+
+func TestCheckEngine_ServerError(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	params := &diagnosticContext{HTTPClient: server.Client()}
+	target := engineTarget(server.Listener.Addr().String())
+	results := checkEngine(context.Background(), params, target)
+
+	if results[1].Status != checkWarn || results[1].Remediation == "" {
+		t.Errorf("expected a warning with remediation for 503, got %+v", results[1])
+	}
+}
+
+func TestCheckEngine_Unreachable(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	host := server.Listener.Addr().String()
+	server.Close()
+
+	params := &diagnosticContext{HTTPClient: &http.Client{Timeout: time.Second}}
+	results := checkEngine(context.Background(), params, engineTarget(host))
+
+	if len(results) != 3 {
+		t.Fatalf("expected dns, https and clock results, got %+v", results)
+	}
+	if results[1].Status != checkFail || !strings.Contains(results[1].Remediation, "443") {
+		t.Errorf("expected https failure with remediation, got %+v", results[1])
+	}
+	if results[2].Status != checkWarn {
+		t.Errorf("expected unmeasured clock skew to warn, got %+v", results[2])
+	}
+}
+
+func TestCheckEngine_DNSFailure(t *testing.T) {
+	params := &diagnosticContext{Resolver: failingResolver{}}
+	results := checkEngine(context.Background(), params, engineTarget("engine.example.com"))
+
+	if len(results) != 1 || results[0].Name != "engine_dns" || results[0].Status != checkFail {
+		t.Fatalf("expected a single dns failure, got %+v", results)
+	}
+	if !strings.Contains(results[0].Remediation, "engine.example.com") {
+		t.Errorf("expected remediation to name the host, got %q", results[0].Remediation)
+	}
+}
+
+func TestCheckEngine_AlternateHosts(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	down := httptest.NewTLSServer(http.NotFoundHandler())
+	downHost := down.Listener.Addr().String()
+	down.Close()
+
+	params := &diagnosticContext{HTTPClient: server.Client()}
+	target := engineTarget(server.Listener.Addr().String())
+	target.Device.RewstEngineAlternateHosts = []string{server.Listener.Addr().String(), downHost}
+
+	results := checkEngine(context.Background(), params, target)
+	names := make([]string, 0, len(results))
+	for _, result := range results {
+		names = append(names, result.Name)
+	}
+	want := []string{
+		"engine_dns", "engine_https", "clock_skew",
+		"engine_alternate_dns", "engine_alternate_https",
+		"engine_alternate_dns", "engine_alternate_https",
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+	if results[4].Status != checkPass {
+		t.Errorf("expected the reachable alternate to pass, got %+v", results[4])
+	}
+	// An unreachable alternate only warns while the primary answers
+	if results[6].Status != checkWarn || !strings.Contains(results[6].Message, downHost) {
+		t.Errorf("expected the unreachable alternate to warn, got %+v", results[6])
+	}
+}
+
+func TestCheckEngine_NotConfigured(t *testing.T) {
+	results := checkEngine(context.Background(), &diagnosticContext{}, agentInfo{OrgId: "org-1"})
+	if len(results) != 1 || results[0].Status != checkFail {
+		t.Errorf("expected a single failure without config, got %+v", results)
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		date   string
+		status checkStatus
+	}{
+		{"in sync", now.Format(http.TimeFormat), checkPass},
+		{"slightly off", now.Add(-30 * time.Second).Format(http.TimeFormat), checkPass},
+		{"minutes off", now.Add(3 * time.Minute).Format(http.TimeFormat), checkWarn},
+		{"far off", now.Add(-2 * time.Hour).Format(http.TimeFormat), checkFail},
+		{"missing date", "", checkWarn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkClockSkew(tt.date, now)
+			if result.Status != tt.status {
+				t.Errorf("expected %q, got %+v", tt.status, result)
+			}
+			if result.Status == checkFail && result.Remediation == "" {
+				t.Error("expected remediation for a failing clock")
+			}
+		})
+	}
+
+	result := checkClockSkew(now.Add(-2*time.Hour).Format(http.TimeFormat), now)
+	if !strings.Contains(result.Message, "2h0m0s ahead of") {
+		t.Errorf("expected skew direction in message, got %q", result.Message)
+	}
+}
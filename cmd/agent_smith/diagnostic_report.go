@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/version"
+)
+
+// checkStatus is the outcome of a single diagnostic check.
+type checkStatus string
+
+const (
+	checkPass checkStatus = "pass"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+	// checkUnknown is the report status when the checks could not be run,
+	// such as when no agent is installed.
+	checkUnknown checkStatus = "unknown"
+)
+
+// Exit codes of a non-interactive diagnostic run. They follow the
+// Nagios/monitoring plugin convention so RMM tools can consume them directly.
+const (
+	diagnosticExitPass    = 0
+	diagnosticExitWarn    = 1
+	diagnosticExitFail    = 2
+	diagnosticExitUnknown = 3
+)
+
+// checkDetail is an extra labelled value reported alongside a check.
+type checkDetail struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// checkResult is the structured result of one diagnostic check. The same
+// results back the interactive menu and the non-interactive report.
+type checkResult struct {
+	Name    string        `json:"name"`
+	Status  checkStatus   `json:"status"`
+	Message string        `json:"message"`
+	Details []checkDetail `json:"details,omitempty"`
+	// Remediation tells the operator how to fix a warning or failure.
+	Remediation string `json:"remediation,omitempty"`
+}
+
+func newCheckResult(name string, status checkStatus, message string) checkResult {
+	return checkResult{Name: name, Status: status, Message: message}
+}
+
+func (r *checkResult) addDetail(name, value string) {
+	r.Details = append(r.Details, checkDetail{Name: name, Value: value})
+}
+
+// severity orders statuses so the worst of several can be picked.
+func (s checkStatus) severity() int {
+	switch s {
+	case checkUnknown:
+		return 3
+	case checkFail:
+		return 2
+	case checkWarn:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// worstStatus returns the most severe status among results, or checkPass when
+// there are none.
+func worstStatus(results []checkResult) checkStatus {
+	worst := checkPass
+	for _, result := range results {
+		if result.Status.severity() > worst.severity() {
+			worst = result.Status
+		}
+	}
+	return worst
+}
+
+// agentReport holds the check results for one installed agent.
+type agentReport struct {
+	OrgId  string        `json:"org_id"`
+	Status checkStatus   `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+// diagnosticReport is the document printed by a non-interactive run.
+type diagnosticReport struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Version     string        `json:"version"`
+	Platform    string        `json:"platform"`
+	Status      checkStatus   `json:"status"`
+	Agents      []agentReport `json:"agents"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// exitCode maps the overall report status to the process exit code.
+func (r diagnosticReport) exitCode() int {
+	if r.Error != "" {
+		return diagnosticExitUnknown
+	}
+	switch r.Status {
+	case checkUnknown:
+		return diagnosticExitUnknown
+	case checkFail:
+		return diagnosticExitFail
+	case checkWarn:
+		return diagnosticExitWarn
+	default:
+		return diagnosticExitPass
+	}
+}
+
+// resolveDiagnosticTargets returns the agents to diagnose: every installed
+// agent, or only the one selected with --org-id (even when it was not found on
+// disk, so its missing pieces are reported).
+func resolveDiagnosticTargets(
+	params *diagnosticContext,
+	agentRoot string,
+	fallback func(string) []agentInfo,
+) []agentInfo {
+	agents := scanAgentsFrom(agentRoot)
+	if len(agents) == 0 && fallback != nil {
+		agents = fallback(agentRoot)
+	}
+
+	if params.OrgId == "" {
+		return agents
+	}
+
+	for _, a := range agents {
+		if a.OrgId == params.OrgId {
+			return []agentInfo{a}
+		}
+	}
+	return []agentInfo{{
+		OrgId:       params.OrgId,
+		ConfigFile:  agent.GetConfigFilePath(params.OrgId),
+		LogFile:     agent.GetLogFilePath(params.OrgId),
+		ServiceName: formatServiceName(params.OrgId),
+	}}
+}
+
+// runDiagnosticReport runs every check without prompting and prints the
+// report to out. It returns the process exit code summarizing the worst result.
+func runDiagnosticReport(params *diagnosticContext, out io.Writer) int {
+	return runDiagnosticReportWith(
+		context.Background(),
+		params,
+		out,
+		&defaultTLSDialer{},
+		getAgentDataRoot(),
+		fallbackScanAgents,
+	)
+}
+
+func runDiagnosticReportWith(
+	ctx context.Context,
+	params *diagnosticContext,
+	out io.Writer,
+	dialer tlsDialer,
+	agentRoot string,
+	fallback func(string) []agentInfo,
+) int {
+	report := diagnosticReport{
+		GeneratedAt: time.Now(),
+		Version:     version.Version,
+		Platform:    runtime.GOOS + "/" + runtime.GOARCH,
+		Status:      checkPass,
+		Agents:      []agentReport{},
+	}
+
+	targets := resolveDiagnosticTargets(params, agentRoot, fallback)
+	if len(targets) == 0 {
+		report.Error = "no installed agents found; use --org-id <ORG_ID> to select one"
+	}
+
+	for _, target := range targets {
+		checks := collectAllChecks(ctx, params, target, dialer)
+		status := worstStatus(checks)
+		report.Agents = append(report.Agents, agentReport{
+			OrgId:  target.OrgId,
+			Status: status,
+			Checks: checks,
+		})
+		if status.severity() > report.Status.severity() {
+			report.Status = status
+		}
+	}
+
+	if report.Error != "" {
+		report.Status = checkUnknown
+	}
+
+	if params.Json {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(report)
+	} else {
+		_, _ = io.WriteString(out, formatDiagnosticReport(report))
+	}
+
+	return report.exitCode()
+}
+
+// formatDiagnosticReport renders a report as plain text, one line per check.
+func formatDiagnosticReport(report diagnosticReport) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Agent Smith diagnostic report (%s, %s)\n", report.Version, report.Platform)
+	if report.Error != "" {
+		fmt.Fprintf(&b, "\nUNKNOWN: %s\n", report.Error)
+		return b.String()
+	}
+
+	for _, a := range report.Agents {
+		fmt.Fprintf(&b, "\nAgent %s: %s\n", a.OrgId, strings.ToUpper(string(a.Status)))
+		for _, check := range a.Checks {
+			fmt.Fprintf(
+				&b,
+				"  [%s] %-18s %s\n",
+				strings.ToUpper(string(check.Status)),
+				check.Name,
+				check.Message,
+			)
+			for _, detail := range check.Details {
+				fmt.Fprintf(&b, "         %-26s %s\n", detail.Name+":", detail.Value)
+			}
+			if check.Remediation != "" {
+				fmt.Fprintf(&b, "         %-26s %s\n", "Fix:", check.Remediation)
+			}
+		}
+	}
+
+	fmt.Fprintf(&b, "\nOverall: %s\n", strings.ToUpper(string(report.Status)))
+	return b.String()
+}
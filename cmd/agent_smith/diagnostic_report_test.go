@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/mqtt"
+)
+
+func TestWorstStatus(t *testing.T) {
+	tests := []struct {
+		statuses []checkStatus
+		want     checkStatus
+	}{
+		{nil, checkPass},
+		{[]checkStatus{checkPass, checkPass}, checkPass},
+		{[]checkStatus{checkPass, checkWarn}, checkWarn},
+		{[]checkStatus{checkFail, checkWarn, checkPass}, checkFail},
+	}
+	for _, tt := range tests {
+		var results []checkResult
+		for _, status := range tt.statuses {
+			results = append(results, newCheckResult("check", status, ""))
+		}
+		if got := worstStatus(results); got != tt.want {
+			t.Errorf("worstStatus(%v) = %q, want %q", tt.statuses, got, tt.want)
+		}
+	}
+}
+
+func TestDiagnosticReport_ExitCode(t *testing.T) {
+	tests := []struct {
+		report diagnosticReport
+		want   int
+	}{
+		{diagnosticReport{Status: checkPass}, diagnosticExitPass},
+		{diagnosticReport{Status: checkWarn}, diagnosticExitWarn},
+		{diagnosticReport{Status: checkFail}, diagnosticExitFail},
+		{diagnosticReport{Status: checkPass, Error: "no agents"}, diagnosticExitUnknown},
+		{diagnosticReport{Status: checkUnknown}, diagnosticExitUnknown},
+	}
+	for _, tt := range tests {
+		if got := tt.report.exitCode(); got != tt.want {
+			t.Errorf("exitCode(%+v) = %d, want %d", tt.report, got, tt.want)
+		}
+	}
+}
+
+// scriptedTLSDialer answers Dial per port.
+type scriptedTLSDialer map[string]bool
+
+func (d scriptedTLSDialer) Dial(_, port string) bool {
+	return d[port]
+}
+
+func TestCheckConnectivity_Statuses(t *testing.T) {
+	target := agentInfo{OrgId: "org-1", Device: &agent.Device{AzureIotHubHost: "hub.example.com"}}
+
+	tests := []struct {
+		name           string
+		dialer         scriptedTLSDialer
+		wantMqtt       checkStatus
+		wantWebSockets checkStatus
+	}{
+		{"both up", scriptedTLSDialer{"8883": true, "443": true}, checkPass, checkPass},
+		{"mqtt down", scriptedTLSDialer{"443": true}, checkWarn, checkPass},
+		{"websocket down", scriptedTLSDialer{"8883": true}, checkPass, checkWarn},
+		{"both down", scriptedTLSDialer{}, checkFail, checkFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := checkConnectivity(&diagnosticContext{}, target, tt.dialer)
+			if len(results) != 2 {
+				t.Fatalf("expected 2 results, got %+v", results)
+			}
+			if results[0].Status != tt.wantMqtt || results[1].Status != tt.wantWebSockets {
+				t.Errorf("got %q/%q, want %q/%q",
+					results[0].Status, results[1].Status, tt.wantMqtt, tt.wantWebSockets)
+			}
+		})
+	}
+
+	noConfig := agentInfo{OrgId: "org-1"}
+	results := checkConnectivity(&diagnosticContext{}, noConfig, scriptedTLSDialer{})
+	if len(results) != 1 || results[0].Status != checkFail {
+		t.Errorf("expected single failure without config, got %+v", results)
+	}
+}
+
+// mockMqttHandshaker returns scripted stages per scheme and records the
+// schemes it was asked to test.
+type mockMqttHandshaker struct {
+	stages  map[string][]mqtt.ProbeStage
+	schemes []string
+}
+
+func (h *mockMqttHandshaker) Handshake(_ agent.Device, scheme string) []mqtt.ProbeStage {
+	h.schemes = append(h.schemes, scheme)
+	return h.stages[scheme]
+}
+
+func okSession() []mqtt.ProbeStage {
+	return []mqtt.ProbeStage{
+		{Name: mqtt.ProbeConnect, Latency: 40 * time.Millisecond},
+		{Name: mqtt.ProbeSubscribe, Latency: 20 * time.Millisecond},
+		{Name: mqtt.ProbeUnsubscribe, Latency: 10 * time.Millisecond},
+	}
+}
+
+func refusedSession() []mqtt.ProbeStage {
+	return []mqtt.ProbeStage{{
+		Name: mqtt.ProbeConnect,
+		Err:  errors.New("not Authorized (CONNACK return code 5)"),
+	}}
+}
+
+func detailValue(result checkResult, name string) string {
+	for _, detail := range result.Details {
+		if detail.Name == name {
+			return detail.Value
+		}
+	}
+	return ""
+}
+
+func TestCheckConnectivity_Handshake(t *testing.T) {
+	target := agentInfo{
+		OrgId:       "org-1",
+		ServiceName: "svc-1",
+		Device:      &agent.Device{AzureIotHubHost: "hub.example.com"},
+	}
+	up := scriptedTLSDialer{"8883": true, "443": true}
+
+	tests := []struct {
+		name            string
+		running         bool
+		allowDisconnect bool
+		stages          map[string][]mqtt.ProbeStage
+		wantSchemes     int
+		wantMqtt        checkStatus
+		wantWebSockets  checkStatus
+	}{
+		{
+			name:           "stopped service",
+			stages:         map[string][]mqtt.ProbeStage{"tls": okSession(), "wss": okSession()},
+			wantSchemes:    2,
+			wantMqtt:       checkPass,
+			wantWebSockets: checkPass,
+		},
+		{
+			name:           "running service is left alone",
+			running:        true,
+			stages:         map[string][]mqtt.ProbeStage{"tls": refusedSession()},
+			wantSchemes:    0,
+			wantMqtt:       checkPass,
+			wantWebSockets: checkPass,
+		},
+		{
+			name:            "running service with allow-disconnect",
+			running:         true,
+			allowDisconnect: true,
+			stages:          map[string][]mqtt.ProbeStage{"tls": okSession(), "wss": okSession()},
+			wantSchemes:     2,
+			wantMqtt:        checkPass,
+			wantWebSockets:  checkPass,
+		},
+		{
+			name: "connect refused",
+			stages: map[string][]mqtt.ProbeStage{
+				"tls": refusedSession(),
+				"wss": refusedSession(),
+			},
+			wantSchemes:    2,
+			wantMqtt:       checkFail,
+			wantWebSockets: checkFail,
+		},
+		{
+			name: "websocket session fails",
+			stages: map[string][]mqtt.ProbeStage{
+				"tls": okSession(),
+				"wss": refusedSession(),
+			},
+			wantSchemes:    2,
+			wantMqtt:       checkPass,
+			wantWebSockets: checkWarn,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handshaker := &mockMqttHandshaker{stages: tt.stages}
+			params := &diagnosticContext{
+				AllowDisconnect: tt.allowDisconnect,
+				ServiceManager: &mockServiceManager{
+					openService: &mockService{isActive: tt.running},
+				},
+				MQTT: handshaker,
+			}
+
+			results := checkConnectivity(params, target, up)
+			if len(results) != 2 {
+				t.Fatalf("expected 2 results, got %+v", results)
+			}
+			if len(handshaker.schemes) != tt.wantSchemes {
+				t.Errorf("expected %d sessions, got %v", tt.wantSchemes, handshaker.schemes)
+			}
+			if results[0].Status != tt.wantMqtt || results[1].Status != tt.wantWebSockets {
+				t.Errorf("got %q/%q, want %q/%q",
+					results[0].Status, results[1].Status, tt.wantMqtt, tt.wantWebSockets)
+			}
+		})
+	}
+}
+
+func TestCheckConnectivity_HandshakeDetails(t *testing.T) {
+	target := agentInfo{OrgId: "org-1", Device: &agent.Device{AzureIotHubHost: "hub.example.com"}}
+	params := &diagnosticContext{
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: false}},
+		MQTT: &mockMqttHandshaker{stages: map[string][]mqtt.ProbeStage{
+			"tls": okSession(),
+			"wss": refusedSession(),
+		}},
+	}
+
+	results := checkConnectivity(params, target, scriptedTLSDialer{"8883": true, "443": true})
+
+	if got := detailValue(results[0], "CONNECT"); got != "ok (40ms)" {
+		t.Errorf("expected CONNECT latency, got %q", got)
+	}
+	if detailValue(results[0], "UNSUBSCRIBE") == "" {
+		t.Errorf("expected every stage to be reported, got %+v", results[0].Details)
+	}
+	if !strings.Contains(results[1].Message, "CONNECT failed") ||
+		!strings.Contains(results[1].Message, "return code 5") {
+		t.Errorf("expected refused CONNECT in message, got %q", results[1].Message)
+	}
+	if !strings.HasPrefix(detailValue(results[1], "TLS handshake"), "ok (") {
+		t.Errorf("expected TLS handshake latency, got %+v", results[1].Details)
+	}
+}
+
+func TestCheckConnectivity_HandshakeSkippedDetail(t *testing.T) {
+	target := agentInfo{OrgId: "org-1", Device: &agent.Device{AzureIotHubHost: "hub.example.com"}}
+	params := &diagnosticContext{
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: true}},
+		MQTT:           &mockMqttHandshaker{},
+	}
+
+	results := checkConnectivity(params, target, scriptedTLSDialer{"8883": true, "443": true})
+	if !strings.Contains(detailValue(results[0], "MQTT session"), "--allow-disconnect") {
+		t.Errorf(
+			"expected skipped session to point at --allow-disconnect, got %+v",
+			results[0].Details,
+		)
+	}
+}
+
+func TestConfirmHandshake(t *testing.T) {
+	target := agentInfo{OrgId: "org-1", ServiceName: "svc-1"}
+	params := &diagnosticContext{
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: true}},
+		MQTT:           &mockMqttHandshaker{},
+	}
+
+	got := confirmHandshake(bufio.NewReader(strings.NewReader("y\n")), params, target)
+	if !got.AllowDisconnect || params.AllowDisconnect {
+		t.Errorf("expected a confirmed copy, got %+v (original %+v)", got, params)
+	}
+
+	got = confirmHandshake(bufio.NewReader(strings.NewReader("\n")), params, target)
+	if got.AllowDisconnect {
+		t.Error("expected declining to keep the session test disabled")
+	}
+
+	stopped := &diagnosticContext{
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: false}},
+		MQTT:           &mockMqttHandshaker{},
+	}
+	got = confirmHandshake(bufio.NewReader(strings.NewReader("")), stopped, target)
+	if got != stopped {
+		t.Error("expected no prompt when the service is stopped")
+	}
+}
+
+func TestCheckServiceStatus(t *testing.T) {
+	target := agentInfo{OrgId: "org-1", ServiceName: "svc-1"}
+
+	running := &diagnosticContext{
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: true}},
+	}
+	if got := checkServiceStatus(running, target).Status; got != checkPass {
+		t.Errorf("running service: got %q, want pass", got)
+	}
+
+	stopped := &diagnosticContext{
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: false}},
+	}
+	if got := checkServiceStatus(stopped, target).Status; got != checkFail {
+		t.Errorf("stopped service: got %q, want fail", got)
+	}
+}
+
+func TestRunDiagnosticReportWith_Json(t *testing.T) {
+	orgId := "6a0f7f64-3f0e-4f43-9d3c-5d2b7e1c9a10"
+	root := t.TempDir()
+	orgDir := filepath.Join(root, orgId)
+	_ = os.MkdirAll(orgDir, 0o755)
+	data, _ := json.Marshal(agent.Device{AzureIotHubHost: "hub.example.com"})
+	_ = os.WriteFile(filepath.Join(orgDir, "config.json"), data, 0o644)
+
+	params := &diagnosticContext{
+		OrgId:          orgId,
+		Diagnostic:     true,
+		NonInteractive: true,
+		Json:           true,
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: true}},
+		Sys:            &mockSystemInfoProvider{hostname: "host", hostPlatform: "linux"},
+		Domain:         &mockDomainInfoProvider{},
+	}
+	defer func() { _ = os.RemoveAll(agent.GetScriptsDirectory(params.OrgId)) }()
+
+	var out bytes.Buffer
+	code := runDiagnosticReportWith(
+		context.Background(),
+		params,
+		&out,
+		&mockTLSDialer{result: true},
+		root,
+		nil,
+	)
+
+	var report diagnosticReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if len(report.Agents) != 1 || report.Agents[0].OrgId != params.OrgId {
+		t.Fatalf("expected a report for %s, got %+v", params.OrgId, report.Agents)
+	}
+
+	names := map[string]checkStatus{}
+	for _, check := range report.Agents[0].Checks {
+		names[check.Name] = check.Status
+	}
+	for _, name := range []string{
+		"service_status", "command_execution", "mqtt_tls", "mqtt_websocket",
+		"scripts_directory", "data_directory", "host_info",
+	} {
+		if _, ok := names[name]; !ok {
+			t.Errorf("expected check %q in report, got %v", name, names)
+		}
+	}
+
+	// The agent is only installed in the temp root, so its real data directory
+	// is missing.
+	if names["data_directory"] != checkFail || report.Status != checkFail {
+		t.Errorf("expected missing data directory to fail the report, got %+v", report)
+	}
+	if code != diagnosticExitFail {
+		t.Errorf("exit code = %d, want %d", code, diagnosticExitFail)
+	}
+}
+
+func TestRunDiagnosticReportWith_NoAgents(t *testing.T) {
+	var out bytes.Buffer
+	code := runDiagnosticReportWith(
+		context.Background(),
+		&diagnosticContext{Diagnostic: true, NonInteractive: true},
+		&out,
+		&mockTLSDialer{},
+		t.TempDir(),
+		nil,
+	)
+
+	if code != diagnosticExitUnknown {
+		t.Errorf("exit code = %d, want %d", code, diagnosticExitUnknown)
+	}
+	if !strings.Contains(out.String(), "UNKNOWN: no installed agents found") {
+		t.Errorf("expected unknown status in text output, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	runDiagnosticReportWith(
+		context.Background(),
+		&diagnosticContext{Diagnostic: true, NonInteractive: true, Json: true},
+		&out,
+		&mockTLSDialer{},
+		t.TempDir(),
+		nil,
+	)
+	var report diagnosticReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	if report.Status != checkUnknown || report.Error == "" {
+		t.Errorf("expected an unknown status with the error, got %q (%q)",
+			report.Status, report.Error)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
 )
 
 func getAgentDataRoot() string {
@@ -46,3 +47,22 @@ func queryServiceStatus(name string) (bool, bool) {
 	}
 	return true, false
 }
+
+// readServiceDefinition returns the launchd plist of the named service for the
+// support bundle.
+func readServiceDefinition(name string) (string, []byte, error) {
+	fileName := fmt.Sprintf("%s.plist", name)
+	data, err := os.ReadFile( // #nosec G304 - path is built from the service name
+		filepath.Join("/Library/LaunchDaemons", fileName),
+	)
+	return fileName, data, err
+}
+
+// fileOwner returns the uid owning the file described by info.
+func fileOwner(info os.FileInfo) (uint32, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return stat.Uid, true
+}
@@ -4,9 +4,11 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
 )
 
 func getAgentDataRoot() string {
@@ -38,3 +40,22 @@ func queryServiceStatus(name string) (bool, bool) {
 	running := strings.Contains(output, "ActiveState=active")
 	return installed, running
 }
+
+// readServiceDefinition returns the systemd unit file of the named service for
+// the support bundle.
+func readServiceDefinition(name string) (string, []byte, error) {
+	fileName := fmt.Sprintf("%s.service", name)
+	data, err := os.ReadFile( // #nosec G304 - path is built from the service name
+		filepath.Join("/etc/systemd/system", fileName),
+	)
+	return fileName, data, err
+}
+
+// fileOwner returns the uid owning the file described by info.
+func fileOwner(info os.FileInfo) (uint32, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return stat.Uid, true
+}
@@ -89,3 +89,17 @@ func queryServiceStatus(name string) (bool, bool) {
 	// Service exists; check whether it is running
 	return true, strings.Contains(output, "RUNNING")
 }
+
+// readServiceDefinition returns the SCM configuration of the named service, as
+// reported by "sc qc", for the support bundle.
+func readServiceDefinition(name string) (string, []byte, error) {
+	out, err := exec.Command("sc", "qc", name).CombinedOutput() // #nosec G204
+	if err != nil {
+		return "sc_qc.txt", nil, fmt.Errorf("sc qc %s: %w: %s", name, err, out)
+	}
+	return "sc_qc.txt", out, nil
+}
+
+// fileOwner is not implemented on Windows, where access is governed by ACLs
+// rather than an owning uid.
+func fileOwner(_ os.FileInfo) (uint32, bool) { return 0, false }
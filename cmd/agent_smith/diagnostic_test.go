@@ -218,12 +218,12 @@ func TestRunCheckServiceStatus_StoppedService(t *testing.T) {
 // ── runConnectivityTestWith ───────────────────────────────────────────────────
 
 func TestRunConnectivityTest_NoConfig(t *testing.T) {
-	runConnectivityTestWith(agentInfo{OrgId: "org-1"}, &mockTLSDialer{})
+	runConnectivityTestWith(&diagnosticContext{}, agentInfo{OrgId: "org-1"}, &mockTLSDialer{})
 }
 
 func TestRunConnectivityTest_EmptyHost(t *testing.T) {
 	target := agentInfo{OrgId: "org-1", Device: &agent.Device{AzureIotHubHost: ""}}
-	runConnectivityTestWith(target, &mockTLSDialer{})
+	runConnectivityTestWith(&diagnosticContext{}, target, &mockTLSDialer{})
 }
 
 func TestRunConnectivityTest_BothFail(t *testing.T) {
@@ -232,7 +232,7 @@ func TestRunConnectivityTest_BothFail(t *testing.T) {
 		OrgId:  "org-1",
 		Device: &agent.Device{AzureIotHubHost: "hub.example.com"},
 	}
-	runConnectivityTestWith(target, dialer)
+	runConnectivityTestWith(&diagnosticContext{}, target, dialer)
 	if len(dialer.calls) != 2 {
 		t.Errorf("expected 2 dial attempts, got %d", len(dialer.calls))
 	}
@@ -244,7 +244,7 @@ func TestRunConnectivityTest_BothSucceed(t *testing.T) {
 		OrgId:  "org-1",
 		Device: &agent.Device{AzureIotHubHost: "hub.example.com"},
 	}
-	runConnectivityTestWith(target, dialer)
+	runConnectivityTestWith(&diagnosticContext{}, target, dialer)
 	if len(dialer.calls) != 2 {
 		t.Errorf("expected 2 dial attempts, got %d", len(dialer.calls))
 	}
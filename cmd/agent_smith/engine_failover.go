@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/interpreter"
+	"github.com/hashicorp/go-hclog"
+)
+
+// engineHostCooldown is how long an engine host that failed a postback is
+// tried only after the hosts that did not.
+const engineHostCooldown = time.Minute
+
+// engineFailoverStatus is the failover state written to the status file.
+type engineFailoverStatus struct {
+	PreferredHost    string   `json:"preferred_host,omitempty"`
+	UnreachableHosts []string `json:"unreachable_hosts,omitempty"`
+}
+
+// engineFailover picks the engine host each postback goes to, out of the
+// device's EngineHosts. The host that last answered is preferred until it
+// fails, so results keep going to one host rather than flapping between them.
+// A host that fails is passed over for engineHostCooldown while another host
+// is available. It is shared by every worker, the spool drainer and replay.
+//
+// A nil failover tries the hosts in configured order.
+type engineFailover struct {
+	logger hclog.Logger
+
+	mu        sync.Mutex
+	preferred string
+	downUntil map[string]time.Time
+}
+
+func newEngineFailover(logger hclog.Logger) *engineFailover {
+	return &engineFailover{logger: logger, downUntil: map[string]time.Time{}}
+}
+
+// hosts returns the order to try device's engine hosts in: the preferred host
+// first, then the rest in configured order, with hosts that failed within
+// engineHostCooldown moved to the end.
+func (f *engineFailover) hosts(device agent.Device) []string {
+	hosts := device.EngineHosts()
+	if f == nil {
+		return hosts
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	rank := func(host string) int {
+		switch {
+		case now.Before(f.downUntil[host]):
+			return 2
+		case host == f.preferred:
+			return 0
+		default:
+			return 1
+		}
+	}
+	slices.SortStableFunc(hosts, func(a, b string) int {
+		return rank(a) - rank(b)
+	})
+	return hosts
+}
+
+// preferredHost returns the host a postback for device goes to first.
+func (f *engineFailover) preferredHost(device agent.Device) string {
+	return f.hosts(device)[0]
+}
+
+// succeeded records that host answered a postback, making it the preferred
+// host.
+func (f *engineFailover) succeeded(host string) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	delete(f.downUntil, host)
+	previous := f.preferred
+	f.preferred = host
+	f.mu.Unlock()
+
+	if previous != "" && previous != host {
+		f.logger.Warn("Postbacks switched engine host", "from", previous, "to", host)
+	}
+}
+
+// failed records that host did not answer a postback.
+func (f *engineFailover) failed(host string) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.downUntil[host] = time.Now().Add(engineHostCooldown)
+}
+
+// snapshot returns the failover state for the status file.
+func (f *engineFailover) snapshot() engineFailoverStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := engineFailoverStatus{PreferredHost: f.preferred}
+	now := time.Now()
+	for host, until := range f.downUntil {
+		if now.Before(until) {
+			status.UnreachableHosts = append(status.UnreachableHosts, host)
+		}
+	}
+	slices.Sort(status.UnreachableHosts)
+	return status
+}
+
+// failoverUploader sends output uploads to the preferred engine host. An
+// upload is not failed over part way: the chunks the engine already holds live
+// on the host it started on.
+type failoverUploader struct {
+	interpreter.OutputUploader
+	failover *engineFailover
+}
+
+func (u *failoverUploader) UploadOutput(
+	ctx context.Context,
+	message *interpreter.Message,
+	device agent.Device,
+	stream string,
+	content io.ReaderAt,
+	size int64,
+	logger hclog.Logger,
+) (interpreter.OutputUpload, error) {
+	device.RewstEngineHost = u.failover.preferredHost(device)
+	return u.OutputUploader.UploadOutput(ctx, message, device, stream, content, size, logger)
+}
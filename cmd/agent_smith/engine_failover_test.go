@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/interpreter"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestEngineFailover_HostOrder(t *testing.T) {
+	device := agent.Device{
+		RewstEngineHost:           "primary",
+		RewstEngineAlternateHosts: []string{"second", "third"},
+	}
+
+	var nilFailover *engineFailover
+	got := nilFailover.hosts(device)
+	if !slices.Equal(got, []string{"primary", "second", "third"}) {
+		t.Errorf("nil failover hosts = %v, want the configured order", got)
+	}
+
+	f := newEngineFailover(hclog.NewNullLogger())
+	f.failed("primary")
+	if got := f.hosts(device); !slices.Equal(got, []string{"second", "third", "primary"}) {
+		t.Errorf("hosts = %v, want the failed host last", got)
+	}
+
+	// The host that last answered stays first, even once the primary recovers
+	f.succeeded("third")
+	f.succeeded("primary")
+	f.failed("primary")
+	f.succeeded("third")
+	if got := f.hosts(device); !slices.Equal(got, []string{"third", "second", "primary"}) {
+		t.Errorf("hosts = %v, want the preferred host first", got)
+	}
+
+	status := f.snapshot()
+	if status.PreferredHost != "third" ||
+		!slices.Equal(status.UnreachableHosts, []string{"primary"}) {
+		t.Errorf("unexpected failover status %+v", status)
+	}
+}
+
+// TestAttemptPostback_FailsOverToAlternateHost verifies that a postback the
+// primary host fails is delivered to the alternate host in the same attempt,
+// and that later postbacks go straight to the alternate.
+func TestAttemptPostback_FailsOverToAlternateHost(t *testing.T) {
+	var primaryCalls, alternateCalls atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+	alternate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alternateCalls.Add(1)
+		if r.URL.Path != "/rewst/abc/123" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer alternate.Close()
+
+	svc := newProcessMessageSvc(&mockExecutor{}, &http.Client{
+		Transport: &schemeRewriteTransport{scheme: "http"},
+	})
+	svc.failover = newEngineFailover(hclog.NewNullLogger())
+
+	device := deviceWithEngine(primary.Listener.Addr().String())
+	device.RewstEngineAlternateHosts = []string{alternate.Listener.Addr().String()}
+	device.PostbackPathTemplate = "/rewst/{post_id}"
+
+	for range 2 {
+		msg := &interpreter.Message{PostId: "abc:123"}
+		done, err := svc.attemptPostback(
+			context.Background(),
+			msg,
+			device,
+			[]byte(`{}`),
+			hclog.NewNullLogger(),
+			1,
+		)
+		if !done || err != nil {
+			t.Fatalf("attemptPostback = %v, %v; want delivered", done, err)
+		}
+	}
+
+	if primaryCalls.Load() != 1 || alternateCalls.Load() != 2 {
+		t.Errorf(
+			"expected 1 primary and 2 alternate calls, got %d and %d",
+			primaryCalls.Load(),
+			alternateCalls.Load(),
+		)
+	}
+}
+
+// TestAttemptPostback_AllHostsDown verifies that the attempt fails only when
+// every host fails.
+func TestAttemptPostback_AllHostsDown(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	svc := newProcessMessageSvc(&mockExecutor{}, &http.Client{
+		Transport: &schemeRewriteTransport{scheme: "http"},
+	})
+	svc.failover = newEngineFailover(hclog.NewNullLogger())
+
+	// Two names for the same server
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	device := deviceWithEngine(srv.Listener.Addr().String())
+	device.RewstEngineAlternateHosts = []string{net.JoinHostPort("localhost", port)}
+
+	done, err := svc.attemptPostback(
+		context.Background(),
+		&interpreter.Message{PostId: "abc:123"},
+		device,
+		[]byte(`{}`),
+		hclog.NewNullLogger(),
+		1,
+	)
+	if done || err == nil {
+		t.Errorf("attemptPostback = %v, %v; want a transient failure", done, err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected both hosts tried, got %d calls", calls.Load())
+	}
+}
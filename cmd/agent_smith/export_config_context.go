@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+type exportConfigContext struct {
+	OrgId          string
+	ExportConfig   string
+	PassphraseFile string
+
+	FS utils.FileSystem
+}
+
+// newExportConfigFlagSet builds the flag set for config export mode, binding
+// flags to the provided params. It is shared between argument parsing and usage
+// rendering so that the per-flag descriptions stay in a single place.
+func newExportConfigFlagSet(params *exportConfigContext) *flag.FlagSet {
+	fs := flag.NewFlagSet("export-config", flag.ContinueOnError)
+	fs.StringVar(&params.OrgId, "org-id", "", "Organization ID")
+	fs.StringVar(
+		&params.ExportConfig,
+		"export-config",
+		"",
+		"Write the agent's config to this bundle file, without its secrets",
+	)
+	fs.StringVar(
+		&params.PassphraseFile,
+		"passphrase-file",
+		"",
+		"Encrypt the secrets into the bundle with the passphrase in this file",
+	)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func newExportConfigContext(
+	args []string,
+	fsys utils.FileSystem,
+) (*exportConfigContext, error) {
+	var params exportConfigContext
+
+	fs := newExportConfigFlagSet(&params)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.OrgId == "" {
+		return nil, fmt.Errorf("missing org-id")
+	}
+
+	if params.ExportConfig == "" {
+		return nil, fmt.Errorf("missing export-config")
+	}
+
+	params.FS = fsys
+
+	return &params, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewExportConfigContext(t *testing.T) {
+	orgId := "test123"
+	result, _ := newExportConfigContext([]string{
+		"--org-id", orgId, "--export-config", "bundle.json", "--passphrase-file", "pass.txt",
+	}, nil)
+
+	if result.OrgId != orgId {
+		t.Errorf("expected %v, got %v", orgId, result.OrgId)
+	}
+
+	if result.ExportConfig != "bundle.json" || result.PassphraseFile != "pass.txt" {
+		t.Errorf("unexpected context %+v", result)
+	}
+
+	errorTests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"--export-config", "bundle.json"}, "missing org-id"},
+		{[]string{"--org-id", orgId}, "missing export-config"},
+		{[]string{"--=export-config"}, "bad flag syntax"},
+	}
+
+	for _, errorTest := range errorTests {
+		_, err := newExportConfigContext(errorTest.args, nil)
+
+		if err == nil || !strings.Contains(err.Error(), errorTest.message) {
+			t.Errorf("expected error %s, got %v", errorTest.message, err)
+		}
+	}
+}
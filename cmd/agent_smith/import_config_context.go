@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/RewstApp/agent-smith-go/internal/service"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+type importConfigContext struct {
+	OrgId           string
+	ImportConfig    string
+	PassphraseFile  string
+	ServiceUsername string
+	ServicePassword string
+	// KeepSourceFields keeps the source host's service account and the config
+	// fields this release does not know, which import otherwise drops.
+	KeepSourceFields bool
+
+	ServiceManager service.ServiceManager
+	FS             utils.FileSystem
+}
+
+// newImportConfigFlagSet builds the flag set for config import mode, binding
+// flags to the provided params. It is shared between argument parsing and usage
+// rendering so that the per-flag descriptions stay in a single place.
+func newImportConfigFlagSet(params *importConfigContext) *flag.FlagSet {
+	fs := flag.NewFlagSet("import-config", flag.ContinueOnError)
+	fs.StringVar(&params.OrgId, "org-id", "", "Organization ID")
+	fs.StringVar(
+		&params.ImportConfig,
+		"import-config",
+		"",
+		"Install the agent with the config in this bundle file",
+	)
+	fs.StringVar(
+		&params.PassphraseFile,
+		"passphrase-file",
+		"",
+		"Decrypt the bundle's secrets with the passphrase in this file",
+	)
+	fs.StringVar(
+		&params.ServiceUsername,
+		"service-username",
+		"",
+		"User account the service should run as (e.g. DOMAIN\\svc_rewst on Windows, rewst on Linux/macOS)",
+	)
+	fs.StringVar(
+		&params.ServicePassword,
+		"service-password",
+		"",
+		"Password for --service-username (Windows only; not persisted to disk)",
+	)
+	fs.BoolVar(
+		&params.KeepSourceFields,
+		"keep-source-fields",
+		false,
+		"Keep the bundle's service account and the config fields this release does not know",
+	)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func newImportConfigContext(
+	args []string,
+	fsys utils.FileSystem,
+	svcMgr service.ServiceManager,
+) (*importConfigContext, error) {
+	var params importConfigContext
+
+	fs := newImportConfigFlagSet(&params)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.OrgId == "" {
+		return nil, fmt.Errorf("missing org-id")
+	}
+
+	if params.ImportConfig == "" {
+		return nil, fmt.Errorf("missing import-config")
+	}
+
+	if params.ServicePassword != "" && params.ServiceUsername == "" {
+		return nil, fmt.Errorf("service-password requires service-username")
+	}
+
+	params.FS = fsys
+	params.ServiceManager = svcMgr
+
+	return &params, nil
+}
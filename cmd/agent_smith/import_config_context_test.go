@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewImportConfigContext(t *testing.T) {
+	orgId := "test123"
+	result, _ := newImportConfigContext([]string{
+		"--org-id", orgId,
+		"--import-config", "bundle.json",
+		"--passphrase-file", "pass.txt",
+		"--service-username", "rewst",
+		"--keep-source-fields",
+	}, nil, nil)
+
+	if result.OrgId != orgId {
+		t.Errorf("expected %v, got %v", orgId, result.OrgId)
+	}
+
+	if result.ImportConfig != "bundle.json" || result.PassphraseFile != "pass.txt" ||
+		result.ServiceUsername != "rewst" || !result.KeepSourceFields {
+		t.Errorf("unexpected context %+v", result)
+	}
+
+	errorTests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"--import-config", "bundle.json"}, "missing org-id"},
+		{[]string{"--org-id", orgId}, "missing import-config"},
+		{
+			[]string{"--org-id", orgId, "--import-config", "b.json", "--service-password", "x"},
+			"service-password requires service-username",
+		},
+		{[]string{"--=import-config"}, "bad flag syntax"},
+	}
+
+	for _, errorTest := range errorTests {
+		_, err := newImportConfigContext(errorTest.args, nil, nil)
+
+		if err == nil || !strings.Contains(err.Error(), errorTest.message) {
+			t.Errorf("expected error %s, got %v", errorTest.message, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+// Service states reported by --list.
+const (
+	serviceStateRunning      = "running"
+	serviceStateStopped      = "stopped"
+	serviceStateNotInstalled = "not installed"
+)
+
+// versionLinkerFlag is the -X linker flag the build scripts stamp the agent
+// version with.
+const versionLinkerFlag = "github.com/RewstApp/agent-smith-go/internal/version.Version="
+
+// agentListing is one installed agent as reported by --list. Fields that
+// cannot be read are left empty.
+type agentListing struct {
+	OrgId        string `json:"org_id"`
+	Version      string `json:"version"`
+	ServiceState string `json:"service_state"`
+	DeviceId     string `json:"device_id"`
+	BrokerHost   string `json:"broker_host"`
+	LogFile      string `json:"log_file"`
+}
+
+// scanInstalledAgents finds the installed agents the same way the diagnostic
+// does.
+func scanInstalledAgents() []agentInfo {
+	root := getAgentDataRoot()
+	agents := scanAgentsFrom(root)
+	if len(agents) == 0 {
+		agents = fallbackScanAgents(root)
+	}
+	return agents
+}
+
+// selectOrgIds returns the org to act on, or with all every installed org.
+func selectOrgIds(orgId string, all bool) []string {
+	if !all {
+		return []string{orgId}
+	}
+
+	var orgIds []string
+	for _, info := range scanInstalledAgents() {
+		orgIds = append(orgIds, info.OrgId)
+	}
+	return orgIds
+}
+
+// runList prints every installed agent, as a table or, with --json, as a JSON
+// array.
+func runList(params *listContext, out io.Writer) error {
+	return writeAgentList(params, listAgents(params, scanInstalledAgents()), out)
+}
+
+// listAgents describes each agent from its config, the status snapshot its
+// service last wrote, and the service manager. The version is the one the
+// service reported running, or the installed binary's when it has not written
+// a snapshot.
+func listAgents(params *listContext, agents []agentInfo) []agentListing {
+	listings := make([]agentListing, 0, len(agents))
+	for _, info := range agents {
+		listing := agentListing{
+			OrgId:        info.OrgId,
+			ServiceState: serviceState(params, info.OrgId),
+			LogFile:      info.LogFile,
+		}
+		if info.Device != nil {
+			listing.DeviceId = info.Device.DeviceId
+			listing.BrokerHost = info.Device.AzureIotHubHost
+		}
+
+		data, err := params.FS.ReadFile(agent.GetStatusFilePath(info.OrgId))
+		if err == nil {
+			var snap statusSnapshot
+			if json.Unmarshal(data, &snap) == nil {
+				listing.Version = snap.Version
+			}
+		}
+		if listing.Version == "" {
+			listing.Version = installedVersion(
+				params.FS,
+				agent.GetAgentExecutablePath(info.OrgId),
+			)
+		}
+
+		listings = append(listings, listing)
+	}
+	return listings
+}
+
+// installedVersion returns the version the agent binary at path was built
+// with, or "" when it cannot be read.
+func installedVersion(fsys utils.FileSystem, path string) string {
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	info, err := buildinfo.Read(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	return linkedVersion(info)
+}
+
+// linkedVersion finds the version in the linker flags a binary's build info
+// records.
+func linkedVersion(info *debug.BuildInfo) string {
+	for _, setting := range info.Settings {
+		if setting.Key != "-ldflags" {
+			continue
+		}
+		for _, field := range strings.Fields(setting.Value) {
+			field = strings.TrimPrefix(strings.Trim(field, `"'`), "-X=")
+			if v, ok := strings.CutPrefix(field, versionLinkerFlag); ok {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+func serviceState(params *listContext, orgId string) string {
+	svc, err := params.ServiceManager.Open(agent.GetServiceName(orgId))
+	if err != nil {
+		return serviceStateNotInstalled
+	}
+	defer func() { _ = svc.Close() }()
+
+	if svc.IsActive() {
+		return serviceStateRunning
+	}
+	return serviceStateStopped
+}
+
+func writeAgentList(params *listContext, listings []agentListing, out io.Writer) error {
+	if params.Json {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(listings)
+	}
+
+	if len(listings) == 0 {
+		_, err := io.WriteString(out, "No installed agents found\n")
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ORG ID\tVERSION\tSERVICE\tDEVICE ID\tBROKER\tLOG FILE")
+	for _, l := range listings {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			l.OrgId,
+			strOrNA(l.Version),
+			l.ServiceState,
+			strOrNA(l.DeviceId),
+			strOrNA(l.BrokerHost),
+			l.LogFile,
+		)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/RewstApp/agent-smith-go/internal/service"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+type listContext struct {
+	List bool
+	Json bool
+
+	ServiceManager service.ServiceManager
+	FS             utils.FileSystem
+}
+
+// newListFlagSet builds the flag set for list mode, binding flags to the
+// provided params. It is shared between argument parsing and usage rendering so
+// that the per-flag descriptions stay in a single place.
+func newListFlagSet(params *listContext) *flag.FlagSet {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.BoolVar(&params.List, "list", false, "List every agent installed on this host")
+	fs.BoolVar(&params.Json, "json", false, "Print the list as JSON")
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func newListContext(
+	args []string,
+	svcMgr service.ServiceManager,
+	fsys utils.FileSystem,
+) (*listContext, error) {
+	var params listContext
+
+	fs := newListFlagSet(&params)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if !params.List {
+		return nil, fmt.Errorf("missing list")
+	}
+
+	params.ServiceManager = svcMgr
+	params.FS = fsys
+
+	return &params, nil
+}
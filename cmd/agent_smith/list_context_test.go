@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewListContext(t *testing.T) {
+	result, _ := newListContext([]string{"--list", "--json"}, nil, nil)
+
+	if !result.List || !result.Json {
+		t.Errorf("expected list and json to be set, got %+v", result)
+	}
+
+	errorTests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"--json"}, "missing list"},
+		{[]string{"--list", "--org-id", "x"}, "flag provided but not defined"},
+		{[]string{"--=list"}, "bad flag syntax"},
+	}
+
+	for _, errorTest := range errorTests {
+		_, err := newListContext(errorTest.args, nil, nil)
+
+		if err == nil || !strings.Contains(err.Error(), errorTest.message) {
+			t.Errorf("expected error %s, got %v", errorTest.message, err)
+		}
+	}
+}
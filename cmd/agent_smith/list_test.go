@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"debug/buildinfo"
+	"encoding/json"
+	"errors"
+	"os"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/service"
+)
+
+// listServiceManager opens a service per name, failing for unknown names.
+type listServiceManager struct {
+	mockServiceManager
+	services map[string]service.Service
+}
+
+func (m *listServiceManager) Open(name string) (service.Service, error) {
+	svc, ok := m.services[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return svc, nil
+}
+
+func newListTestParams(json bool) *listContext {
+	return &listContext{
+		Json: json,
+		ServiceManager: &listServiceManager{
+			services: map[string]service.Service{
+				agent.GetServiceName("org-a"): &mockService{isActive: true},
+				agent.GetServiceName("org-b"): &mockService{isActive: false},
+			},
+		},
+		FS: &mockFileSystem{
+			readFileFunc: func(name string) ([]byte, error) {
+				if name == agent.GetStatusFilePath("org-a") {
+					return []byte(`{"version":"1.2.3"}`), nil
+				}
+				return nil, os.ErrNotExist
+			},
+		},
+	}
+}
+
+func listTestAgents() []agentInfo {
+	return []agentInfo{
+		{
+			OrgId:   "org-a",
+			LogFile: "/logs/a.log",
+			Device:  &agent.Device{DeviceId: "dev-a", AzureIotHubHost: "hub-a.example.net"},
+		},
+		{OrgId: "org-b", LogFile: "/logs/b.log"},
+		{OrgId: "org-c", LogFile: "/logs/c.log"},
+	}
+}
+
+func TestListAgents(t *testing.T) {
+	listings := listAgents(newListTestParams(false), listTestAgents())
+
+	want := []agentListing{
+		{
+			OrgId:        "org-a",
+			Version:      "1.2.3",
+			ServiceState: serviceStateRunning,
+			DeviceId:     "dev-a",
+			BrokerHost:   "hub-a.example.net",
+			LogFile:      "/logs/a.log",
+		},
+		{OrgId: "org-b", ServiceState: serviceStateStopped, LogFile: "/logs/b.log"},
+		{OrgId: "org-c", ServiceState: serviceStateNotInstalled, LogFile: "/logs/c.log"},
+	}
+
+	if len(listings) != len(want) {
+		t.Fatalf("expected %d listings, got %d", len(want), len(listings))
+	}
+	for i := range want {
+		if listings[i] != want[i] {
+			t.Errorf("listing %d: expected %+v, got %+v", i, want[i], listings[i])
+		}
+	}
+}
+
+func TestListAgents_InstalledVersion(t *testing.T) {
+	// The test binary stands in for an installed agent without a snapshot; it
+	// is not stamped with a version, but its build info must be readable
+	path, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildinfo.Read(bytes.NewReader(binary)); err != nil {
+		t.Fatalf("read build info: %v", err)
+	}
+
+	params := newListTestParams(false)
+	params.FS = &mockFileSystem{
+		readFileFunc: func(name string) ([]byte, error) {
+			if name == agent.GetAgentExecutablePath("org-b") {
+				return binary, nil
+			}
+			return nil, os.ErrNotExist
+		},
+	}
+	listings := listAgents(params, listTestAgents())
+	for _, listing := range listings {
+		if listing.Version != "" {
+			t.Errorf("expected no version for %s, got %q", listing.OrgId, listing.Version)
+		}
+	}
+}
+
+func TestLinkedVersion(t *testing.T) {
+	tests := []struct {
+		ldflags string
+		want    string
+	}{
+		{"-w -s -X " + versionLinkerFlag + "v1.4.0", "v1.4.0"},
+		{"-X=" + versionLinkerFlag + "v1.4.1 -X other.Var=1", "v1.4.1"},
+		{"-X '" + versionLinkerFlag + "v1.4.2'", "v1.4.2"},
+		{"-w -s", ""},
+	}
+
+	for _, tt := range tests {
+		info := &debug.BuildInfo{Settings: []debug.BuildSetting{
+			{Key: "-compiler", Value: "gc"},
+			{Key: "-ldflags", Value: tt.ldflags},
+		}}
+		if got := linkedVersion(info); got != tt.want {
+			t.Errorf("linkedVersion(%q) = %q, want %q", tt.ldflags, got, tt.want)
+		}
+	}
+	if got := linkedVersion(&debug.BuildInfo{}); got != "" {
+		t.Errorf("expected no version without linker flags, got %q", got)
+	}
+}
+
+func TestWriteAgentList_Table(t *testing.T) {
+	params := newListTestParams(false)
+	var out bytes.Buffer
+
+	err := writeAgentList(params, listAgents(params, listTestAgents()), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected header and 3 rows, got:\n%s", out.String())
+	}
+	if !strings.HasPrefix(lines[0], "ORG ID") {
+		t.Errorf("expected header first, got %q", lines[0])
+	}
+	for _, want := range []string{"org-a", "1.2.3", "running", "dev-a", "hub-a.example.net"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("expected %q in %q", want, lines[1])
+		}
+	}
+	if !strings.Contains(lines[3], "not installed") || !strings.Contains(lines[3], "N/A") {
+		t.Errorf("expected unknown fields as N/A, got %q", lines[3])
+	}
+}
+
+func TestWriteAgentList_Json(t *testing.T) {
+	params := newListTestParams(true)
+	var out bytes.Buffer
+
+	err := writeAgentList(params, listAgents(params, listTestAgents()), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []map[string]string
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("expected a JSON array, got %v:\n%s", err, out.String())
+	}
+	if len(got) != 3 || got[0]["org_id"] != "org-a" ||
+		got[0]["broker_host"] != "hub-a.example.net" {
+		t.Errorf("unexpected JSON: %s", out.String())
+	}
+}
+
+func TestWriteAgentList_Empty(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeAgentList(&listContext{}, nil, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "No installed agents found") {
+		t.Errorf("expected empty message, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := writeAgentList(&listContext{Json: true}, []agentListing{}, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("expected an empty JSON array, got %q", out.String())
+	}
+}
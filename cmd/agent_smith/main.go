@@ -61,6 +61,16 @@ func main() {
 	modeErrs["diagnostic"] = err
 	if err == nil {
 		// Run diagnostic routine
+		if diagnosticCtx.Bundle != "" {
+			if err := runDiagnosticBundle(diagnosticCtx, os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "bundle error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		if diagnosticCtx.NonInteractive {
+			os.Exit(runDiagnosticReport(diagnosticCtx, os.Stdout))
+		}
 		runDiagnostic(diagnosticCtx)
 		return
 	}
@@ -73,6 +83,101 @@ func main() {
 		return
 	}
 
+	statusContext, err := newStatusContext(os.Args[1:], fs)
+	modeErrs["status"] = err
+	if err == nil {
+		// Run status routine
+		if err := runStatus(statusContext, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "status error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	repairContext, err := newRepairContext(os.Args[1:], svcMgr, fs)
+	modeErrs["repair"] = err
+	if err == nil {
+		// Run repair routine
+		if err := runRepair(repairContext); err != nil {
+			fmt.Fprintf(os.Stderr, "repair error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	runMessageContext, err := newRunMessageContext(os.Args[1:], sys, domain, executor, fs)
+	modeErrs["run-message"] = err
+	if err == nil {
+		// Run message routine
+		if err := runMessage(runMessageContext); err != nil {
+			fmt.Fprintf(os.Stderr, "run-message error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	validateConfigContext, err := newValidateConfigContext(os.Args[1:], fs)
+	modeErrs["validate-config"] = err
+	if err == nil {
+		// Run config validation routine
+		os.Exit(runValidateConfig(validateConfigContext, os.Stdout))
+	}
+
+	listContext, err := newListContext(os.Args[1:], svcMgr, fs)
+	modeErrs["list"] = err
+	if err == nil {
+		// Run list routine
+		if err := runList(listContext, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "list error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	controlContext, err := newControlContext(os.Args[1:], svcMgr)
+	modeErrs["control"] = err
+	if err == nil {
+		// Run service control routine
+		if err := runControl(controlContext); err != nil {
+			fmt.Fprintf(os.Stderr, "control error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	spoolContext, err := newSpoolContext(os.Args[1:], fs)
+	modeErrs["spool"] = err
+	if err == nil {
+		// Run spool routine
+		if err := runSpool(spoolContext, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "spool error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	exportConfigContext, err := newExportConfigContext(os.Args[1:], fs)
+	modeErrs["export-config"] = err
+	if err == nil {
+		// Run config export routine
+		if err := runExportConfig(exportConfigContext); err != nil {
+			fmt.Fprintf(os.Stderr, "export-config error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	importConfigContext, err := newImportConfigContext(os.Args[1:], fs, svcMgr)
+	modeErrs["import-config"] = err
+	if err == nil {
+		// Run config import routine
+		if err := runImportConfig(importConfigContext); err != nil {
+			fmt.Fprintf(os.Stderr, "import-config error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	configContext, err := newConfigContext(os.Args[1:], sys, domain, fs, svcMgr)
 	modeErrs["config"] = err
 	if err == nil {
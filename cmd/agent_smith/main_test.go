@@ -100,14 +100,31 @@ type mockService struct {
 	stopErr   error
 	deleteErr error
 	startErr  error
+
+	stopCalls  int
+	startCalls int
 }
 
 func (m *mockService) IsActive() bool { return m.isActive }
-func (m *mockService) Stop() error    { return m.stopErr }
 func (m *mockService) Delete() error  { return m.deleteErr }
-func (m *mockService) Start() error   { return m.startErr }
 func (m *mockService) Close() error   { return nil }
 
+func (m *mockService) Stop() error {
+	m.stopCalls++
+	if m.stopErr == nil {
+		m.isActive = false
+	}
+	return m.stopErr
+}
+
+func (m *mockService) Start() error {
+	m.startCalls++
+	if m.startErr == nil {
+		m.isActive = true
+	}
+	return m.startErr
+}
+
 type mockServiceManager struct {
 	openErr       error
 	openService   service.Service
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// postbackBreakerMaxCooldown caps the wait before a probe, which doubles every
+// time a probe fails. A longer configured cooldown is used as is.
+const postbackBreakerMaxCooldown = 10 * time.Minute
+
+// Circuit breaker states, reported in the log, to plugins and in the status
+// snapshot.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// breakerNotifications maps each breaker state to the plugin notification
+// sent when the breaker enters it.
+var breakerNotifications = map[string]string{
+	breakerClosed:   "AgentPostbackCircuit:Closed",
+	breakerOpen:     "AgentPostbackCircuit:Open",
+	breakerHalfOpen: "AgentPostbackCircuit:HalfOpen",
+}
+
+// errPostbackCircuitOpen is returned for a postback that was not attempted
+// because the circuit breaker is open.
+var errPostbackCircuitOpen = errors.New("postback circuit breaker is open")
+
+// postbackBreakerStatus is the breaker state written to the status file.
+type postbackBreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	ProbeAt             *time.Time `json:"probe_at,omitempty"`
+}
+
+// postbackBreaker tracks engine health across every worker and the spool
+// drainer, so an outage is detected once rather than by each result burning its
+// own retry budget. After threshold consecutive transient failures it opens and
+// postbacks are refused, which sends new results straight to the spool. Once
+// the cooldown elapses it half-opens and lets a single probe through: a
+// success closes it, a failure opens it again with twice the cooldown.
+//
+// A nil breaker allows every postback.
+type postbackBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    hclog.Logger
+	// onChange is called with the new state after every transition, outside
+	// the lock.
+	onChange func(state string)
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	trips    int
+	probing  bool
+	probeAt  time.Time
+	lastErr  error
+}
+
+func newPostbackBreaker(
+	threshold int,
+	cooldown time.Duration,
+	logger hclog.Logger,
+	onChange func(state string),
+) *postbackBreaker {
+	return &postbackBreaker{
+		threshold: max(threshold, 1),
+		cooldown:  cooldown,
+		logger:    logger,
+		onChange:  onChange,
+		state:     breakerClosed,
+	}
+}
+
+// allow reports whether a postback may be attempted now. When the breaker is
+// open it also returns how long until the next probe is due. A caller that is
+// allowed must report the outcome with record.
+func (b *postbackBreaker) allow() (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+
+	b.mu.Lock()
+	switch b.state {
+	case breakerOpen:
+		if wait := time.Until(b.probeAt); wait > 0 {
+			b.mu.Unlock()
+			return false, wait
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		b.mu.Unlock()
+		b.logger.Info("Postback circuit breaker half-open: probing the engine")
+		b.changed(breakerHalfOpen)
+		return true, 0
+	case breakerHalfOpen:
+		// Only one probe at a time; everyone else waits for its outcome.
+		if b.probing {
+			b.mu.Unlock()
+			return false, 0
+		}
+		b.probing = true
+	}
+	b.mu.Unlock()
+	return true, 0
+}
+
+// record reports the outcome of an allowed postback. done is the result of
+// attemptPostback: a response that ends the postback, including a 4xx
+// rejection, shows the engine is up. An attempt cut short by ctx says nothing
+// about the engine and only releases the probe slot.
+func (b *postbackBreaker) record(ctx context.Context, done bool, err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	wasProbe := b.state == breakerHalfOpen && b.probing
+	if wasProbe {
+		b.probing = false
+	}
+	if ctx.Err() != nil {
+		b.mu.Unlock()
+		return
+	}
+
+	if done {
+		b.failures = 0
+		b.trips = 0
+		b.lastErr = nil
+		if b.state == breakerClosed {
+			b.mu.Unlock()
+			return
+		}
+		b.state = breakerClosed
+		b.mu.Unlock()
+		b.logger.Info("Postback circuit breaker closed: engine recovered")
+		b.changed(breakerClosed)
+		return
+	}
+
+	b.failures++
+	b.lastErr = err
+	if b.state == breakerOpen || (b.state == breakerClosed && b.failures < b.threshold) ||
+		(b.state == breakerHalfOpen && !wasProbe) {
+		b.mu.Unlock()
+		return
+	}
+	cooldown := min(
+		b.cooldown<<min(b.trips, 16),
+		max(b.cooldown, postbackBreakerMaxCooldown),
+	)
+	b.trips++
+	b.state = breakerOpen
+	b.probeAt = time.Now().Add(cooldown)
+	failures := b.failures
+	b.mu.Unlock()
+
+	b.logger.Warn(
+		"Postback circuit breaker open: spooling results until the engine recovers",
+		"consecutive_failures", failures,
+		"probe_in", cooldown,
+		"error", err,
+	)
+	b.changed(breakerOpen)
+}
+
+func (b *postbackBreaker) changed(state string) {
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
+
+// snapshot returns the breaker state for the status file.
+func (b *postbackBreaker) snapshot() postbackBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := postbackBreakerStatus{State: b.state, ConsecutiveFailures: b.failures}
+	if b.lastErr != nil {
+		status.LastError = b.lastErr.Error()
+	}
+	if b.state == breakerOpen {
+		probeAt := b.probeAt
+		status.ProbeAt = &probeAt
+	}
+	return status
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// newTestBreaker returns a breaker that records its transitions.
+func newTestBreaker(threshold int, cooldown time.Duration) (*postbackBreaker, func() []string) {
+	var mu sync.Mutex
+	var states []string
+	b := newPostbackBreaker(threshold, cooldown, hclog.NewNullLogger(), func(state string) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, state)
+	})
+	return b, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), states...)
+	}
+}
+
+func TestPostbackBreaker_OpensAfterThreshold(t *testing.T) {
+	b, states := newTestBreaker(3, time.Hour)
+	ctx := context.Background()
+	down := errors.New("bad gateway")
+
+	for range 2 {
+		b.record(ctx, false, down)
+	}
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("expected the breaker to stay closed below the threshold")
+	}
+	b.record(ctx, true, nil)
+	b.record(ctx, false, down)
+	b.record(ctx, false, down)
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("expected a success to reset the failure count")
+	}
+
+	b.record(ctx, false, down)
+	ok, wait := b.allow()
+	if ok || wait <= 59*time.Minute {
+		t.Errorf("allow() = %v, %v; want refused until the probe is due", ok, wait)
+	}
+	if s := b.snapshot(); s.State != breakerOpen || s.LastError != "bad gateway" ||
+		s.ProbeAt == nil {
+		t.Errorf("unexpected breaker status %+v", s)
+	}
+	if got := states(); !slices.Equal(got, []string{breakerOpen}) {
+		t.Errorf("expected one transition to open, got %v", got)
+	}
+}
+
+// TestPostbackBreaker_HalfOpenProbe verifies that once the cooldown elapses a
+// single probe is let through, a failed probe reopens the breaker for longer,
+// and a successful one closes it.
+func TestPostbackBreaker_HalfOpenProbe(t *testing.T) {
+	b, states := newTestBreaker(1, 20*time.Millisecond)
+	ctx := context.Background()
+
+	b.record(ctx, false, errors.New("down"))
+	time.Sleep(30 * time.Millisecond)
+
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("expected a probe once the cooldown elapsed")
+	}
+	if ok, _ := b.allow(); ok {
+		t.Fatal("expected a single probe at a time")
+	}
+
+	b.record(ctx, false, errors.New("still down"))
+	if _, wait := b.allow(); wait <= 20*time.Millisecond {
+		t.Errorf("expected the cooldown to double after a failed probe, got %v", wait)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("expected a second probe")
+	}
+	b.record(ctx, true, nil)
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("expected the breaker to close after a successful probe")
+	}
+
+	want := []string{breakerOpen, breakerHalfOpen, breakerOpen, breakerHalfOpen, breakerClosed}
+	if got := states(); !slices.Equal(got, want) {
+		t.Errorf("transitions = %v, want %v", got, want)
+	}
+}
+
+// TestPostbackBreaker_CancelledProbe verifies that a probe cut short by the
+// caller's context frees the slot without counting against the engine.
+func TestPostbackBreaker_CancelledProbe(t *testing.T) {
+	b, _ := newTestBreaker(1, time.Millisecond)
+	b.record(context.Background(), false, errors.New("down"))
+	time.Sleep(5 * time.Millisecond)
+
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("expected a probe")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.record(ctx, false, context.Canceled)
+
+	if ok, _ := b.allow(); !ok {
+		t.Error("expected another probe after the first was cancelled")
+	}
+	if s := b.snapshot(); s.State != breakerHalfOpen {
+		t.Errorf("expected the breaker to stay half-open, got %s", s.State)
+	}
+}
+
+// TestProcessMessage_OpenBreakerSpoolsWithoutRetrying verifies that once the
+// breaker trips, results are spooled at once instead of holding the worker
+// for the retry budget.
+func TestProcessMessage_OpenBreakerSpoolsWithoutRetrying(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	exec := &mockExecutor{result: []byte(`{}`)}
+	svc := newProcessMessageSvc(exec, &http.Client{
+		Transport: &schemeRewriteTransport{scheme: "http"},
+	})
+	svc.PostbackMaxAttempts = 5
+	svc.spool = newTestSpool(t, 10, time.Hour)
+	svc.breaker, _ = newTestBreaker(2, time.Hour)
+
+	notifier := &recordingNotifierWrapper{}
+	device := deviceWithEngine(srv.Listener.Addr().String())
+	for _, id := range []string{"id:first", "id:second"} {
+		svc.processMessage(
+			postbackPayload("echo hi", id),
+			context.Background(),
+			device,
+			hclog.NewNullLogger(),
+			notifier,
+		)
+	}
+
+	// The first result trips the breaker on its second attempt; the second is
+	// never sent.
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 postback attempts, got %d", got)
+	}
+	if ids := spoolPostIds(t, svc.spool); len(ids) != 2 {
+		t.Errorf("expected both results spooled, got %v", ids)
+	}
+	if slices.Contains(notifier.all(), "AgentPostbackFailed:id:second") {
+		t.Error("a result spooled by the open breaker must not be reported as failed")
+	}
+}
+
+// TestFlushPostbackSpool_OpenBreakerHoldsPass verifies that the drainer does
+// not deliver while the breaker is open and waits for the probe to be due.
+func TestFlushPostbackSpool_OpenBreakerHoldsPass(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	svc := newProcessMessageSvc(&mockExecutor{}, &http.Client{
+		Transport: &schemeRewriteTransport{scheme: "http"},
+	})
+	svc.spool = newTestSpool(t, 10, time.Hour)
+	enqueueTestEntries(t, svc.spool, "id:held")
+	svc.breaker, _ = newTestBreaker(1, time.Hour)
+	svc.breaker.record(context.Background(), false, errors.New("down"))
+
+	device := deviceWithEngine(srv.Listener.Addr().String())
+	pass := svc.flushPostbackSpool(context.Background(), device, hclog.NewNullLogger())
+
+	if !pass.failed || !errors.Is(pass.err, errPostbackCircuitOpen) ||
+		pass.retryAfter <= 59*time.Minute {
+		t.Errorf("unexpected pass %+v", pass)
+	}
+	if calls.Load() != 0 || countSpoolFiles(t, svc.spool.dir) != 1 {
+		t.Error("expected the spooled result kept and not sent")
+	}
+}
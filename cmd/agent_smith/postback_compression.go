@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sync"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/hashicorp/go-hclog"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdEncoder is shared by every postback; EncodeAll is safe for concurrent
+// use.
+var zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+	return zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+})
+
+// compressPostbackBody returns the body to post and the Content-Encoding to
+// send it with. The body is compressed with the configured encoding once it
+// reaches the size threshold, and sent as is when compression is off, the
+// body is smaller, or compressing it does not make it smaller. The decision is
+// logged with the sizes when log is set.
+func compressPostbackBody(
+	device agent.Device,
+	body []byte,
+	postId string,
+	logger hclog.Logger,
+	log bool,
+) ([]byte, string) {
+	encoding := device.ResolvedPostbackCompression()
+	if encoding == agent.PostbackCompressionNone {
+		return body, ""
+	}
+	if minBytes := device.ResolvedPostbackCompressionMinBytes(); len(body) < minBytes {
+		if log {
+			logger.Debug(
+				"Postback body not compressed: below threshold",
+				"post_id", postId,
+				"bytes", len(body),
+				"min_bytes", minBytes,
+			)
+		}
+		return body, ""
+	}
+
+	compressed, err := compressBytes(encoding, body)
+	if err != nil {
+		logger.Error(
+			"Failed to compress postback body; sending it uncompressed",
+			"post_id", postId,
+			"encoding", encoding,
+			"error", err,
+		)
+		return body, ""
+	}
+	if len(compressed) >= len(body) {
+		if log {
+			logger.Info(
+				"Postback body not compressed: no size reduction",
+				"post_id", postId,
+				"encoding", encoding,
+				"bytes", len(body),
+				"compressed_bytes", len(compressed),
+			)
+		}
+		return body, ""
+	}
+
+	if log {
+		logger.Info(
+			"Postback body compressed",
+			"post_id", postId,
+			"encoding", encoding,
+			"bytes", len(body),
+			"compressed_bytes", len(compressed),
+		)
+	}
+	return compressed, encoding
+}
+
+func compressBytes(encoding string, body []byte) ([]byte, error) {
+	switch encoding {
+	case agent.PostbackCompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case agent.PostbackCompressionZstd:
+		encoder, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(body, make([]byte, 0, len(body)/4)), nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %s", encoding)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/interpreter"
+	"github.com/hashicorp/go-hclog"
+	"github.com/klauspost/compress/zstd"
+)
+
+func compressibleBody(size int) []byte {
+	return bytes.Repeat([]byte(`{"output":"line of command output"}`), size/35+1)[:size]
+}
+
+func decodeBody(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+	switch encoding {
+	case "":
+		return body
+	case agent.PostbackCompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("gzip reader: %v", err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("gzip read: %v", err)
+		}
+		return data
+	case agent.PostbackCompressionZstd:
+		d, err := zstd.NewReader(nil)
+		if err != nil {
+			t.Fatalf("zstd reader: %v", err)
+		}
+		defer d.Close()
+		data, err := d.DecodeAll(body, nil)
+		if err != nil {
+			t.Fatalf("zstd decode: %v", err)
+		}
+		return data
+	default:
+		t.Fatalf("unexpected encoding %q", encoding)
+		return nil
+	}
+}
+
+func TestCompressPostbackBody(t *testing.T) {
+	minBytes := 1024
+	random := make([]byte, 4096)
+	_, _ = rand.Read(random)
+
+	tests := []struct {
+		name        string
+		compression string
+		body        []byte
+		encoding    string
+	}{
+		{"off by default", "", compressibleBody(4096), ""},
+		{"none", "none", compressibleBody(4096), ""},
+		{"below threshold", "gzip", compressibleBody(512), ""},
+		{"gzip", "gzip", compressibleBody(4096), agent.PostbackCompressionGzip},
+		{"zstd", "zstd", compressibleBody(4096), agent.PostbackCompressionZstd},
+		{"incompressible", "zstd", random, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := agent.Device{
+				PostbackCompression:         tt.compression,
+				PostbackCompressionMinBytes: &minBytes,
+			}
+			body, encoding := compressPostbackBody(
+				device, tt.body, "post-1", hclog.NewNullLogger(), true,
+			)
+			if encoding != tt.encoding {
+				t.Fatalf("encoding = %q, want %q", encoding, tt.encoding)
+			}
+			if encoding != "" && len(body) >= len(tt.body) {
+				t.Errorf("compressed %d bytes into %d", len(tt.body), len(body))
+			}
+			if got := decodeBody(t, encoding, body); !bytes.Equal(got, tt.body) {
+				t.Error("decoded body does not match the original")
+			}
+		})
+	}
+}
+
+// TestAttemptPostback_CompressesBody verifies that a large postback is sent
+// with its Content-Encoding and decodes to the original result.
+func TestAttemptPostback_CompressesBody(t *testing.T) {
+	result := compressibleBody(128 * 1024)
+
+	var encoding string
+	var received []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	svc := &serviceContext{
+		HTTPClient: &http.Client{Transport: &schemeRewriteTransport{scheme: "http"}},
+	}
+	device := deviceWithEngine(srv.Listener.Addr().String())
+	device.PostbackCompression = agent.PostbackCompressionZstd
+
+	done, err := svc.attemptPostback(
+		context.Background(),
+		&interpreter.Message{PostId: "id:1"},
+		device,
+		result,
+		hclog.NewNullLogger(),
+		1,
+	)
+	if !done || err != nil {
+		t.Fatalf("attemptPostback = %v, %v", done, err)
+	}
+	if encoding != agent.PostbackCompressionZstd {
+		t.Fatalf("Content-Encoding = %q, want zstd", encoding)
+	}
+	if len(received) >= len(result) {
+		t.Errorf("sent %d bytes for a %d byte result", len(received), len(result))
+	}
+	if !bytes.Equal(decodeBody(t, encoding, received), result) {
+		t.Error("engine received a body that does not decode to the result")
+	}
+}
+
+// TestSendPostbackWithRetry_CompressesOnce verifies that a result is compressed
+// once and the same body is sent on every retry and to every host.
+func TestSendPostbackWithRetry_CompressesOnce(t *testing.T) {
+	result := compressibleBody(128 * 1024)
+
+	var mu sync.Mutex
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	svc := newProcessMessageSvc(&mockExecutor{}, &http.Client{
+		Transport: &schemeRewriteTransport{scheme: "http"},
+	})
+	svc.PostbackMaxAttempts = 2
+	svc.failover = newEngineFailover(hclog.NewNullLogger())
+
+	// Two names for the same server
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	device := deviceWithEngine(srv.Listener.Addr().String())
+	device.RewstEngineAlternateHosts = []string{net.JoinHostPort("localhost", port)}
+	device.PostbackCompression = agent.PostbackCompressionGzip
+
+	var logs bytes.Buffer
+	logger := hclog.New(&hclog.LoggerOptions{Output: &logs, Level: hclog.Info})
+	svc.sendPostbackWithRetry(
+		context.Background(),
+		&interpreter.Message{PostId: "id:1"},
+		device,
+		result,
+		logger,
+		&mockNotifierWrapper{},
+	)
+
+	if len(bodies) != 4 {
+		t.Fatalf("expected 2 attempts on 2 hosts, got %d requests", len(bodies))
+	}
+	for _, body := range bodies[1:] {
+		if !bytes.Equal(body, bodies[0]) {
+			t.Error("expected every request to send the same compressed body")
+		}
+	}
+	if n := strings.Count(logs.String(), "Postback body compressed"); n != 1 {
+		t.Errorf("expected the body compressed once, got %d", n)
+	}
+}
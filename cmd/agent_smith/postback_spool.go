@@ -2,33 +2,61 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/cipher"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/RewstApp/agent-smith-go/internal/utils"
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/interpreter"
 	"github.com/hashicorp/go-hclog"
 )
 
 const (
-	// defaultSpoolMaxEntries bounds how many undelivered postbacks the on-disk
-	// spool retains. Older entries are evicted once this many accumulate so a
-	// prolonged engine outage cannot grow the spool without limit.
-	defaultSpoolMaxEntries = 100
-	// defaultSpoolMaxAge bounds how long an undelivered postback is retained.
-	// Entries older than this are discarded on the next enqueue or flush; a stale
-	// result is unlikely to be useful to a workflow that has long since timed out.
-	defaultSpoolMaxAge = 24 * time.Hour
 	// spoolFileSuffix is the extension used for spool entry files so unrelated
 	// files in the directory are ignored.
 	spoolFileSuffix = ".json"
+	// spoolTempSuffix marks an entry file that is still being written. One left
+	// behind by a crash is reconciled when the service next opens the spool.
+	spoolTempSuffix = ".tmp"
+	// postbackSpoolDirName is the spool directory inside the agent data
+	// directory.
+	postbackSpoolDirName = "postback_spool"
+	// spoolQuarantineDirName is the directory inside the spool that corrupt
+	// entries are moved to, so support can inspect them.
+	spoolQuarantineDirName = "quarantine"
+	// spoolQuarantineMaxEntries bounds the quarantine; the oldest files are
+	// removed past it.
+	spoolQuarantineMaxEntries = 50
+	// spoolLockFileName is the file in the spool locked while entries are
+	// delivered or removed, so the service and a --spool command never work on
+	// the same entries at once. It is not a spool entry, so it is never listed.
+	spoolLockFileName = ".lock"
+	// spoolDirMod and spoolFileMod keep the spool private to the service
+	// account; command results often carry secrets.
+	spoolDirMod  os.FileMode = 0o700
+	spoolFileMod os.FileMode = 0o600
 )
 
+// errSpoolCorrupt is returned by readEntry for an entry that cannot be
+// decoded.
+var errSpoolCorrupt = errors.New("corrupt spool entry")
+
+// errSpoolOutranked is returned by enqueue for an entry that could only be
+// spooled by evicting entries of a higher priority.
+var errSpoolOutranked = errors.New("postback spool is full of higher priority entries")
+
+// errSpoolLocked is returned by lockDir when another process holds the spool
+// lock.
+var errSpoolLocked = errors.New("postback spool is locked by another process")
+
 // spoolEntry is the durable record of a command result whose postback could not
 // be delivered in-line. It carries everything needed to rebuild and retry the
 // postback on a later connection cycle.
@@ -36,6 +64,33 @@ type spoolEntry struct {
 	PostId    string    `json:"post_id"`
 	Result    []byte    `json:"result"`
 	CreatedAt time.Time `json:"created_at"`
+	// Priority is the message's resolved priority. It is also encoded in the
+	// file name (see spoolFileName) so the spool can be ordered without
+	// decrypting every entry.
+	Priority string `json:"priority,omitempty"`
+}
+
+// spoolLimits bounds what the postback spool retains so a prolonged engine
+// outage cannot grow it without limit. Entries older than maxAge are discarded
+// on the next enqueue or flush; a stale result is unlikely to be useful to a
+// workflow that has long since timed out. Past maxEntries or maxBytes, entries
+// of the lowest priority are evicted first, oldest first or largest first when
+// evictLargest is set. Zero values fall back to the agent defaults.
+type spoolLimits struct {
+	maxEntries   int
+	maxAge       time.Duration
+	maxBytes     int64
+	evictLargest bool
+}
+
+// deviceSpoolLimits returns the spool limits configured for device.
+func deviceSpoolLimits(device agent.Device) spoolLimits {
+	return spoolLimits{
+		maxEntries:   device.ResolvedSpoolMaxEntries(),
+		maxAge:       device.ResolvedSpoolMaxAge(),
+		maxBytes:     device.ResolvedSpoolMaxBytes(),
+		evictLargest: device.ResolvedSpoolEvictionPolicy() == agent.SpoolEvictLargest,
+	}
 }
 
 // postbackSpool is a bounded, file-backed queue of command results whose
@@ -50,101 +105,384 @@ type spoolEntry struct {
 // workers — enqueue only ever creates new files and flush only ever reads or
 // removes existing ones, so the two never corrupt a shared file.
 type postbackSpool struct {
-	dir        string
-	maxEntries int
-	maxAge     time.Duration
-	logger     hclog.Logger
+	dir          string
+	maxEntries   int
+	maxAge       time.Duration
+	maxBytes     int64
+	evictLargest bool
+	logger       hclog.Logger
+
+	// aead seals entries written to disk. When nil, entries are written in
+	// clear text and encrypted entries cannot be read.
+	aead cipher.AEAD
 
 	mu  sync.Mutex
 	seq uint64
 
 	// droppedTotal counts spool entries discarded because the spool was at
-	// capacity or an entry exceeded maxAge. Exposed for observability beyond the
-	// per-drop log line.
+	// capacity or over its size budget, or an entry exceeded maxAge. Exposed for
+	// observability beyond the per-drop log line.
 	droppedTotal atomic.Int64
 }
 
-func newPostbackSpool(
-	dir string,
-	maxEntries int,
-	maxAge time.Duration,
-	logger hclog.Logger,
-) *postbackSpool {
-	if maxEntries <= 0 {
-		maxEntries = defaultSpoolMaxEntries
+func newPostbackSpool(dir string, limits spoolLimits, logger hclog.Logger) *postbackSpool {
+	if limits.maxEntries <= 0 {
+		limits.maxEntries = agent.DefaultSpoolMaxEntries
+	}
+	if limits.maxAge <= 0 {
+		limits.maxAge = agent.DefaultSpoolMaxAge
 	}
-	if maxAge <= 0 {
-		maxAge = defaultSpoolMaxAge
+	if limits.maxBytes <= 0 {
+		limits.maxBytes = agent.DefaultSpoolMaxBytes
 	}
 	return &postbackSpool{
-		dir:        dir,
-		maxEntries: maxEntries,
-		maxAge:     maxAge,
-		logger:     logger,
+		dir:          dir,
+		maxEntries:   limits.maxEntries,
+		maxAge:       limits.maxAge,
+		maxBytes:     limits.maxBytes,
+		evictLargest: limits.evictLargest,
+		logger:       logger,
 	}
 }
 
 // enqueue persists entry for later delivery. The spool is kept within its
-// configured size and age bounds: expired entries and, if necessary, the oldest
-// entries are evicted before the new one is written. The write is atomic (temp
-// file + rename) so a flush never observes a partially written entry.
+// configured count, size and age bounds: expired entries and, if necessary,
+// the entries chosen by the eviction policy are evicted before the new one is
+// written. An entry larger than the whole size budget is refused, and so is one
+// that would evict an entry of a higher priority. The write is
+// atomic and durable (see writeFile) so neither a flush nor a power loss
+// leaves a partially written entry.
 func (s *postbackSpool) enqueue(entry spoolEntry) error {
+	data, err := s.encodeEntry(entry)
+	if err != nil {
+		return fmt.Errorf("encode spool entry: %w", err)
+	}
+	if int64(len(data)) > s.maxBytes {
+		return fmt.Errorf(
+			"spool entry of %d bytes exceeds the spool size budget of %d bytes",
+			len(data), s.maxBytes,
+		)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if err := os.MkdirAll(s.dir, utils.DefaultDirMod); err != nil {
+	if err := os.MkdirAll(s.dir, spoolDirMod); err != nil {
 		return fmt.Errorf("create spool dir: %w", err)
 	}
 
-	// Drop expired entries first, then evict oldest until there is room for one
-	// more (target maxEntries-1 so the new write lands at the cap).
-	s.pruneLocked(s.maxEntries - 1)
-
-	data, err := json.Marshal(entry)
-	if err != nil {
-		return fmt.Errorf("marshal spool entry: %w", err)
+	// Drop expired entries first, then evict until there is room for one more
+	// entry of this size (target maxEntries-1 so the new write lands at the cap).
+	rank := priorityRank(entry.Priority)
+	if !s.pruneLocked(s.maxEntries-1, s.maxBytes-int64(len(data)), rank) {
+		dropped := s.droppedTotal.Add(1)
+		s.logger.Error(
+			"Postback spool entry dropped",
+			"post_id", entry.PostId,
+			"reason", "outranked",
+			"priority", entry.Priority,
+			"dropped_total", dropped,
+		)
+		return errSpoolOutranked
 	}
 
 	s.seq++
-	name := fmt.Sprintf("%020d-%06d%s", entry.CreatedAt.UnixNano(), s.seq, spoolFileSuffix)
-	final := filepath.Join(s.dir, name)
-	tmp := final + ".tmp"
+	final := filepath.Join(s.dir, spoolFileName(entry, s.seq))
+
+	return s.writeFile(final, data)
+}
 
-	if err := os.WriteFile(tmp, data, utils.DefaultFileMod); err != nil {
+// writeFile writes a spool entry file atomically (temp file + rename). The
+// temp file is synced before the rename and the directory after it, so once
+// it returns the entry survives a power loss. A failed directory sync is only
+// logged: the entry is committed, and the next write syncs the directory
+// again.
+func (s *postbackSpool) writeFile(path string, data []byte) error {
+	tmp := path + spoolTempSuffix
+	if err := writeSyncedFile(tmp, data); err != nil {
+		_ = os.Remove(tmp)
 		return fmt.Errorf("write spool entry: %w", err)
 	}
-	if err := os.Rename(tmp, final); err != nil {
+	if err := os.Rename(tmp, path); err != nil {
 		_ = os.Remove(tmp)
 		return fmt.Errorf("commit spool entry: %w", err)
 	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		s.logger.Error("Failed to sync postback spool dir", "dir", s.dir, "error", err)
+	}
 	return nil
 }
 
-// pruneLocked removes expired entries and then, if more than keep entries
-// remain, evicts the oldest until keep remain. Callers must hold mu.
-func (s *postbackSpool) pruneLocked(keep int) {
+func writeSyncedFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, spoolFileMod)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// reconcile checks the spool when the service opens it. A temp file left by a
+// write a crash interrupted is committed when it holds a valid entry and
+// quarantined otherwise, and every entry that fails its integrity check is
+// quarantined, so damage is found at startup rather than when the entry is
+// due for delivery. An intact entry sealed with another key is left alone.
+func (s *postbackSpool) reconcile() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.Error("Failed to read postback spool dir", "dir", s.dir, "error", err)
+		}
+		return
+	}
+
+	committed, quarantined := 0, 0
+	for _, de := range dirEntries {
+		final, ok := strings.CutSuffix(de.Name(), spoolTempSuffix)
+		if de.IsDir() || !ok || filepath.Ext(final) != spoolFileSuffix {
+			continue
+		}
+		if err := s.checkFile(de.Name()); err != nil && !spoolKeyError(err) {
+			s.quarantineLocked(de.Name(), err)
+			quarantined++
+			continue
+		}
+		err := os.Rename(filepath.Join(s.dir, de.Name()), filepath.Join(s.dir, final))
+		if err != nil {
+			s.logger.Error("Failed to commit spool entry", "file", de.Name(), "error", err)
+			continue
+		}
+		committed++
+	}
+	if committed > 0 {
+		if err := syncDir(s.dir); err != nil {
+			s.logger.Error("Failed to sync postback spool dir", "dir", s.dir, "error", err)
+		}
+	}
+
+	unreadable := 0
+	for _, name := range s.listLocked() {
+		err := s.checkFile(name)
+		switch {
+		case spoolKeyError(err):
+			unreadable++
+		case err != nil:
+			s.quarantineLocked(name, err)
+			quarantined++
+		}
+	}
+
+	if committed > 0 || quarantined > 0 || unreadable > 0 {
+		s.logger.Warn(
+			"Reconciled postback spool",
+			"committed", committed,
+			"quarantined", quarantined,
+			"sealed_with_another_key", unreadable,
+		)
+	}
+}
+
+// checkFile reports why the named file does not hold a readable entry.
+func (s *postbackSpool) checkFile(name string) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return err
+	}
+	_, _, err = s.decodeEntry(data)
+	return err
+}
+
+// quarantine moves a spool file that can never be delivered into the
+// quarantine directory, where support can inspect it, instead of deleting it.
+func (s *postbackSpool) quarantine(name string, cause error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quarantineLocked(name, cause)
+}
+
+// quarantineLocked is quarantine for callers that hold mu. The file is
+// removed when it cannot be moved, and only the newest
+// spoolQuarantineMaxEntries quarantined files are kept.
+func (s *postbackSpool) quarantineLocked(name string, cause error) {
+	dir := filepath.Join(s.dir, spoolQuarantineDirName)
+	err := os.MkdirAll(dir, spoolDirMod)
+	if err == nil {
+		err = os.Rename(filepath.Join(s.dir, name), filepath.Join(dir, name))
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		s.logger.Error(
+			"Failed to quarantine corrupt spool entry; removing it",
+			"file", name,
+			"cause", cause,
+			"error", err,
+		)
+		s.removeLocked(name, "corrupt")
+		return
+	}
+	s.logger.Error(
+		"Quarantined corrupt spool entry",
+		"file", name,
+		"dir", dir,
+		"error", cause,
+	)
+
+	quarantined, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	// ReadDir sorts by name, which for spool files is oldest first.
+	for _, de := range quarantined[:max(len(quarantined)-spoolQuarantineMaxEntries, 0)] {
+		if err := os.Remove(filepath.Join(dir, de.Name())); err != nil {
+			s.logger.Error(
+				"Failed to remove quarantined spool entry",
+				"file", de.Name(),
+				"error", err,
+			)
+		}
+	}
+}
+
+// quarantineDepth reports how many files are in the quarantine directory.
+func (s *postbackSpool) quarantineDepth() int {
+	entries, err := os.ReadDir(filepath.Join(s.dir, spoolQuarantineDirName))
+	if err != nil {
+		return 0
+	}
+	return len(entries)
+}
+
+// secure restricts the permissions of the spool directory and its entries,
+// which older agents created readable by every user, and encrypts entries
+// written in clear text before the spool had a key. It is run once when the
+// service opens the spool.
+func (s *postbackSpool) secure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Chmod(s.dir, spoolDirMod); err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.Error("Failed to restrict postback spool dir", "dir", s.dir, "error", err)
+		}
+		return
+	}
+
+	sealed := 0
+	for _, name := range s.listLocked() {
+		path := filepath.Join(s.dir, name)
+		if err := os.Chmod(path, spoolFileMod); err != nil {
+			s.logger.Error("Failed to restrict spool entry", "file", name, "error", err)
+		}
+		if s.aead == nil {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			s.logger.Error("Failed to read spool entry", "file", name, "error", err)
+			continue
+		}
+		entry, wasSealed, err := s.decodeEntry(data)
+		if err != nil || wasSealed {
+			// Unreadable entries are quarantined by reconcile or the next flush
+			continue
+		}
+		data, err = s.encodeEntry(entry)
+		if err == nil {
+			err = s.writeFile(path, data)
+		}
+		if err != nil {
+			s.logger.Error("Failed to encrypt spool entry", "file", name, "error", err)
+			continue
+		}
+		sealed++
+	}
+
+	if sealed > 0 {
+		s.logger.Info("Encrypted postback spool entries", "count", sealed)
+	}
+}
+
+// pruneLocked removes expired entries and then evicts entries until at most
+// keep remain and they take at most budget bytes. Entries of the lowest
+// priority present are evicted first; among them the oldest, or the largest
+// (oldest among equals) with evictLargest. Only entries ranked no better than
+// rank, the priorityRank of the entry being made room for, are evicted: when
+// they cannot make the room, nothing is evicted and it returns false. Callers
+// must hold mu.
+func (s *postbackSpool) pruneLocked(keep int, budget int64, rank int) bool {
 	files := s.listLocked()
 	if len(files) == 0 {
-		return
+		return true
+	}
+
+	type spoolFile struct {
+		name string
+		size int64
+		rank int
 	}
 
 	cutoff := time.Now().Add(-s.maxAge)
-	survivors := files[:0]
+	survivors := make([]spoolFile, 0, len(files))
+	var total int64
 	for _, name := range files {
 		if ts, ok := spoolFileTime(name); ok && ts.Before(cutoff) {
 			s.removeLocked(name, "expired")
 			continue
 		}
-		survivors = append(survivors, name)
+		var size int64
+		if info, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+			size = info.Size()
+		}
+		survivors = append(
+			survivors,
+			spoolFile{name: name, size: size, rank: priorityRank(spoolFilePriority(name))},
+		)
+		total += size
 	}
 
-	if keep < 0 {
-		keep = 0
+	keep = max(keep, 0)
+	var victims []spoolFile
+	var reasons []string
+	for len(survivors) > 0 && (len(survivors) > keep || total > budget) {
+		reason := "capacity"
+		if len(survivors) <= keep {
+			reason = "size"
+		}
+
+		// The lowest priority goes first, then the oldest or the largest
+		victim := 0
+		for i, f := range survivors {
+			v := survivors[victim]
+			if f.rank > v.rank || (f.rank == v.rank && s.evictLargest && f.size > v.size) {
+				victim = i
+			}
+		}
+		if survivors[victim].rank < rank {
+			return false
+		}
+
+		victims = append(victims, survivors[victim])
+		reasons = append(reasons, reason)
+		total -= survivors[victim].size
+		survivors = slices.Delete(survivors, victim, victim+1)
 	}
-	for len(survivors) > keep {
-		s.removeLocked(survivors[0], "capacity")
-		survivors = survivors[1:]
+
+	for i, f := range victims {
+		s.removeLocked(f.name, reasons[i])
 	}
+	return true
 }
 
 // listLocked returns the spool entry file names sorted oldest-first. The
@@ -170,6 +508,13 @@ func (s *postbackSpool) listLocked() []string {
 	return names
 }
 
+// depth reports how many entries are waiting in the spool.
+func (s *postbackSpool) depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.listLocked())
+}
+
 func (s *postbackSpool) removeLocked(name, reason string) {
 	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
 		s.logger.Error("Failed to remove spool entry", "file", name, "reason", reason, "error", err)
@@ -184,7 +529,8 @@ func (s *postbackSpool) removeLocked(name, reason string) {
 	)
 }
 
-// flush attempts to deliver each spooled entry oldest-first. deliver reports
+// flush attempts to deliver each spooled entry, highest priority first and
+// oldest first within a priority. deliver reports
 // done=true when the entry is resolved (delivered or permanently rejected), in
 // which case it is removed from the spool. A done=false result is treated as a
 // transient failure (the engine is still unreachable): flushing stops so the
@@ -194,6 +540,7 @@ func (s *postbackSpool) flush(ctx context.Context, deliver func(spoolEntry) (boo
 	s.mu.Lock()
 	names := s.listLocked()
 	s.mu.Unlock()
+	sortForDelivery(names)
 
 	if len(names) == 0 {
 		return
@@ -206,26 +553,8 @@ func (s *postbackSpool) flush(ctx context.Context, deliver func(spoolEntry) (boo
 			return
 		}
 
-		path := filepath.Join(s.dir, name)
-		data, err := os.ReadFile(path)
-		if err != nil {
-			if !os.IsNotExist(err) {
-				s.logger.Error("Failed to read spool entry", "file", name, "error", err)
-			}
-			continue
-		}
-
-		var entry spoolEntry
-		if err := json.Unmarshal(data, &entry); err != nil {
-			// A corrupt entry can never be delivered; drop it rather than wedging
-			// the flush on it forever.
-			s.logger.Error("Discarding corrupt spool entry", "file", name, "error", err)
-			s.remove(name)
-			continue
-		}
-
-		if entry.CreatedAt.Before(cutoff) {
-			s.remove(name)
+		entry, ok := s.loadForDelivery(name, cutoff)
+		if !ok {
 			continue
 		}
 
@@ -251,6 +580,186 @@ func (s *postbackSpool) flush(ctx context.Context, deliver func(spoolEntry) (boo
 	}
 }
 
+// spoolDrainPass is the outcome of one drain pass over the spool.
+type spoolDrainPass struct {
+	delivered int
+	// failed is set when a delivery failed transiently and the pass stopped;
+	// err is the first such failure.
+	failed bool
+	err    error
+	// retryAfter is the longest delay the engine asked for with Retry-After.
+	retryAfter time.Duration
+}
+
+// drain delivers the spooled entries like flush, but with up to workers
+// deliveries in flight and a new one started at most every interval. The
+// first transient failure stops new deliveries; those already in flight are
+// left to finish. Entries are started in the same order as flush, but with
+// more than one worker they may complete out of order. The pass holds the
+// spool lock and is skipped while another process holds it.
+func (s *postbackSpool) drain(
+	ctx context.Context,
+	workers int,
+	interval time.Duration,
+	deliver func(context.Context, spoolEntry) (bool, error),
+) spoolDrainPass {
+	s.mu.Lock()
+	names := s.listLocked()
+	s.mu.Unlock()
+	sortForDelivery(names)
+
+	var pass spoolDrainPass
+	if len(names) == 0 {
+		return pass
+	}
+
+	// A --spool replay or purge holds the lock; its entries are left to it
+	unlock, err := s.lockDir()
+	if err != nil {
+		if errors.Is(err, errSpoolLocked) {
+			s.logger.Info("Postback spool in use by another process; skipping drain pass")
+		} else {
+			s.logger.Error("Failed to lock postback spool", "dir", s.dir, "error", err)
+		}
+		return pass
+	}
+	defer unlock()
+
+	feedCtx, stopFeed := context.WithCancel(ctx)
+	defer stopFeed()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	cutoff := time.Now().Add(-s.maxAge)
+	for range max(workers, 1) {
+		wg.Go(func() {
+			for name := range queue {
+				// An entry handed over as the pass stopped is left for the next
+				if feedCtx.Err() != nil {
+					continue
+				}
+				entry, ok := s.loadForDelivery(name, cutoff)
+				if !ok {
+					continue
+				}
+
+				done, err := deliver(ctx, entry)
+
+				mu.Lock()
+				if done {
+					pass.delivered++
+				} else if !pass.failed {
+					pass.failed, pass.err = true, err
+				}
+				var retryAfter *retryAfterError
+				if errors.As(err, &retryAfter) {
+					pass.retryAfter = max(pass.retryAfter, retryAfter.after)
+				}
+				mu.Unlock()
+
+				if done {
+					s.remove(name)
+				} else {
+					stopFeed()
+				}
+			}
+		})
+	}
+
+	var pace <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+
+feed:
+	for i, name := range names {
+		if i > 0 && pace != nil {
+			select {
+			case <-feedCtx.Done():
+				break feed
+			case <-pace:
+			}
+		}
+		select {
+		case <-feedCtx.Done():
+			break feed
+		case queue <- name:
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	return pass
+}
+
+// lockDir takes the spool's lock, which unlike mu is shared with other
+// processes, without waiting for it. It returns errSpoolLocked when another
+// process holds it. unlock releases it.
+func (s *postbackSpool) lockDir() (unlock func(), err error) {
+	if err := os.MkdirAll(s.dir, spoolDirMod); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(
+		filepath.Join(s.dir, spoolLockFileName),
+		os.O_RDWR|os.O_CREATE,
+		spoolFileMod,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return func() {
+		if err := unlockFile(f); err != nil {
+			s.logger.Error("Failed to unlock postback spool", "dir", s.dir, "error", err)
+		}
+		_ = f.Close()
+	}, nil
+}
+
+// loadForDelivery reads the entry in the named file for delivery. Corrupt
+// entries are quarantined, expired ones removed and ones sealed with another
+// key skipped; ok is false for them and for entries that can no longer be
+// read.
+func (s *postbackSpool) loadForDelivery(name string, cutoff time.Time) (spoolEntry, bool) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.Error("Failed to read spool entry", "file", name, "error", err)
+		}
+		return spoolEntry{}, false
+	}
+
+	entry, _, err := s.decodeEntry(data)
+	if spoolKeyError(err) {
+		// The entry is intact, so it is kept until it expires in case the key
+		// it was sealed with comes back.
+		if ts, ok := spoolFileTime(name); ok && ts.Before(cutoff) {
+			s.remove(name)
+		} else {
+			s.logger.Warn("Skipping spool entry sealed with another key", "file", name)
+		}
+		return spoolEntry{}, false
+	}
+	if err != nil {
+		// A corrupt entry can never be delivered; set it aside rather than
+		// wedging the flush on it forever.
+		s.quarantine(name, err)
+		return spoolEntry{}, false
+	}
+
+	if entry.CreatedAt.Before(cutoff) {
+		s.remove(name)
+		return spoolEntry{}, false
+	}
+	return entry, true
+}
+
 // remove deletes a spool entry that has been resolved during flush.
 func (s *postbackSpool) remove(name string) {
 	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
@@ -258,6 +767,107 @@ func (s *postbackSpool) remove(name string) {
 	}
 }
 
+// spoolEntryId is the id under which --spool shows the entry stored in the
+// file name.
+func spoolEntryId(name string) string {
+	return strings.TrimSuffix(name, spoolFileSuffix)
+}
+
+// entryIds returns the ids of the spooled entries in delivery order.
+func (s *postbackSpool) entryIds() []string {
+	s.mu.Lock()
+	names := s.listLocked()
+	s.mu.Unlock()
+	sortForDelivery(names)
+
+	ids := make([]string, len(names))
+	for i, name := range names {
+		ids[i] = spoolEntryId(name)
+	}
+	return ids
+}
+
+// readEntry reads the entry with the given id. Only ids listed in the spool
+// are accepted, so an id can never name a file outside it.
+func (s *postbackSpool) readEntry(id string) (spoolEntry, error) {
+	var entry spoolEntry
+
+	if !slices.Contains(s.entryIds(), id) {
+		return entry, fmt.Errorf("no spool entry %s", id)
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, id+spoolFileSuffix))
+	if err != nil {
+		return entry, err
+	}
+	entry, _, err = s.decodeEntry(data)
+	if spoolKeyError(err) {
+		return entry, fmt.Errorf("spool entry %s: %w", id, err)
+	}
+	if err != nil {
+		return entry, fmt.Errorf("%w %s: %w", errSpoolCorrupt, id, err)
+	}
+	return entry, nil
+}
+
+// discard removes the entry with the given id, whether or not it is readable.
+func (s *postbackSpool) discard(id string) error {
+	if !slices.Contains(s.entryIds(), id) {
+		return fmt.Errorf("no spool entry %s", id)
+	}
+
+	err := os.Remove(filepath.Join(s.dir, id+spoolFileSuffix))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// spoolFileName returns the file name for entry: its creation time, seq, and a
+// marker for a priority other than normal, so names sort oldest first and
+// entries written before priorities existed read as normal.
+func spoolFileName(entry spoolEntry, seq uint64) string {
+	marker := ""
+	if entry.Priority == interpreter.PriorityHigh || entry.Priority == interpreter.PriorityLow {
+		marker = "-" + entry.Priority
+	}
+	return fmt.Sprintf("%020d-%06d%s%s", entry.CreatedAt.UnixNano(), seq, marker, spoolFileSuffix)
+}
+
+// spoolFilePriority returns the priority encoded in a spool file name.
+func spoolFilePriority(name string) string {
+	base := strings.TrimSuffix(name, spoolFileSuffix)
+	switch {
+	case strings.HasSuffix(base, "-"+interpreter.PriorityHigh):
+		return interpreter.PriorityHigh
+	case strings.HasSuffix(base, "-"+interpreter.PriorityLow):
+		return interpreter.PriorityLow
+	default:
+		return interpreter.PriorityNormal
+	}
+}
+
+// priorityRank orders priorities for delivery: a lower rank is delivered
+// first and evicted last.
+func priorityRank(priority string) int {
+	switch priority {
+	case interpreter.PriorityHigh:
+		return 0
+	case interpreter.PriorityLow:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// sortForDelivery orders spool file names the way they are delivered: by
+// priority, then oldest first. names must already be sorted oldest first.
+func sortForDelivery(names []string) {
+	slices.SortStableFunc(names, func(a, b string) int {
+		return priorityRank(spoolFilePriority(a)) - priorityRank(spoolFilePriority(b))
+	})
+}
+
 // spoolFileTime parses the creation timestamp encoded in a spool file name
 // (the leading zero-padded unix-nano field). It returns ok=false for names that
 // do not match the expected format.
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+)
+
+const (
+	// spoolKeyInfo separates the spool key from any other key derived from the
+	// same material.
+	spoolKeyInfo = "agent-smith postback spool v1"
+	spoolKeySize = 32
+	// spoolSecretFileName is the file in the agent data directory, outside the
+	// spool, holding the random secret the spool key is derived from.
+	spoolSecretFileName = "spool.key"
+)
+
+// errSpoolKeyMissing is returned when an encrypted entry is read by a spool
+// opened without a key.
+var errSpoolKeyMissing = errors.New("spool entry is encrypted and no key is available")
+
+// errSpoolKeyMismatch is returned for an intact entry that was sealed with a
+// key other than the spool's, such as one written before the device was
+// reconfigured. It is not corrupt, so it is left in place rather than
+// quarantined, and expires like any other entry.
+var errSpoolKeyMismatch = errors.New("spool entry was sealed with another key")
+
+// errSpoolChecksum is returned for an entry whose contents do not match the
+// checksum stored with them.
+var errSpoolChecksum = errors.New("spool entry checksum mismatch")
+
+// spoolRecord is the on-disk form of a spool entry. A sealed entry holds a
+// nonce and the ciphertext of the JSON encoding of a spoolEntry; an entry
+// written by a spool without a key holds that encoding in Plaintext. Sha256
+// covers whichever payload is present, so a torn or damaged file is told apart
+// from one sealed with another key. Entries written before records carried a
+// checksum are read without one, and entries written before the spool was
+// encrypted are a bare spoolEntry.
+type spoolRecord struct {
+	Nonce      []byte          `json:"nonce,omitempty"`
+	Ciphertext []byte          `json:"ciphertext,omitempty"`
+	Plaintext  json.RawMessage `json:"plaintext,omitempty"`
+	Sha256     string          `json:"sha256,omitempty"`
+}
+
+// checksum returns the hex SHA-256 of the record's payload.
+func (r spoolRecord) checksum() string {
+	hash := sha256.New()
+	hash.Write(r.Nonce)
+	hash.Write(r.Ciphertext)
+	hash.Write(r.Plaintext)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// spoolSecretPath returns the spool secret file of the agent for orgId.
+func spoolSecretPath(orgId string) string {
+	return filepath.Join(agent.GetDataDirectory(orgId), spoolSecretFileName)
+}
+
+// newSpoolCipher returns the cipher the spool entries of device are sealed
+// with. The key is derived with HKDF-SHA256 from the random secret in
+// secretPath and the device's shared access key. The secret file is readable
+// by the service account only, unlike config.json, so the key cannot be
+// derived from what other users can read, and a spool left behind by an
+// earlier install cannot be opened. The service creates the secret when it is
+// missing; with create unset a missing secret is an error.
+func newSpoolCipher(secretPath string, device agent.Device, create bool) (cipher.AEAD, error) {
+	secret, err := readSpoolSecret(secretPath)
+	if os.IsNotExist(err) && create {
+		secret, err = createSpoolSecret(secretPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool secret: %w", err)
+	}
+	return spoolCipher(secret, device)
+}
+
+func readSpoolSecret(path string) (string, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - path is inside the agent data directory
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(data))
+	if decoded, err := hex.DecodeString(secret); err != nil || len(decoded) != spoolKeySize {
+		return "", fmt.Errorf("%s does not hold a spool secret", path)
+	}
+	return secret, nil
+}
+
+// createSpoolSecret writes a new random secret to path, private to the
+// current account. When another process creates it first, its secret is used.
+func createSpoolSecret(path string) (string, error) {
+	raw := make([]byte, spoolKeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(raw)
+
+	if err := os.MkdirAll(filepath.Dir(path), spoolDirMod); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, spoolFileMod)
+	if os.IsExist(err) {
+		return readSpoolSecret(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(secret)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = restrictSpoolSecret(path)
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	return secret, nil
+}
+
+func spoolCipher(spoolSecret string, device agent.Device) (cipher.AEAD, error) {
+	if spoolSecret == "" {
+		return nil, fmt.Errorf("missing spool secret")
+	}
+	if device.SharedAccessKey == "" {
+		return nil, fmt.Errorf("missing shared_access_key")
+	}
+
+	secret := []byte(spoolSecret + "\x00" + device.SharedAccessKey)
+	key, err := hkdf.Key(sha256.New, secret, []byte(device.DeviceId), spoolKeyInfo, spoolKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encodeEntry returns the file contents for entry, sealed when the spool has a
+// key.
+func (s *postbackSpool) encodeEntry(entry spoolEntry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	var record spoolRecord
+	if s.aead == nil {
+		record.Plaintext = data
+	} else {
+		record.Nonce = make([]byte, s.aead.NonceSize())
+		if _, err := rand.Read(record.Nonce); err != nil {
+			return nil, err
+		}
+		record.Ciphertext = s.aead.Seal(nil, record.Nonce, data, nil)
+	}
+	record.Sha256 = record.checksum()
+	return json.Marshal(record)
+}
+
+// parseSpoolRecord parses the contents of a spool entry file and verifies its
+// checksum, without decrypting it.
+func parseSpoolRecord(data []byte) (spoolRecord, error) {
+	var record spoolRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, err
+	}
+	if record.Sha256 != "" && record.Sha256 != record.checksum() {
+		return record, errSpoolChecksum
+	}
+	return record, nil
+}
+
+// decodeEntry parses the contents of a spool entry file and verifies its
+// checksum. sealed reports whether the file was encrypted.
+func (s *postbackSpool) decodeEntry(data []byte) (entry spoolEntry, sealed bool, err error) {
+	record, err := parseSpoolRecord(data)
+	if err != nil {
+		return entry, record.Ciphertext != nil, err
+	}
+
+	switch {
+	case record.Ciphertext != nil:
+	case record.Plaintext != nil:
+		err = json.Unmarshal(record.Plaintext, &entry)
+		return entry, false, err
+	default:
+		err = json.Unmarshal(data, &entry)
+		return entry, false, err
+	}
+
+	if s.aead == nil {
+		return entry, true, errSpoolKeyMissing
+	}
+	if len(record.Nonce) != s.aead.NonceSize() {
+		return entry, true, fmt.Errorf("invalid nonce")
+	}
+	plaintext, err := s.aead.Open(nil, record.Nonce, record.Ciphertext, nil)
+	if err != nil {
+		// The checksum held, so the entry is intact and only the key differs
+		return entry, true, errSpoolKeyMismatch
+	}
+	err = json.Unmarshal(plaintext, &entry)
+	return entry, true, err
+}
+
+// spoolKeyError reports whether err means an entry cannot be decrypted with
+// the spool's key, as opposed to being corrupt.
+func spoolKeyError(err error) bool {
+	return errors.Is(err, errSpoolKeyMissing) || errors.Is(err, errSpoolKeyMismatch)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/hashicorp/go-hclog"
+)
+
+func newSealedTestSpool(t *testing.T, secret string) *postbackSpool {
+	t.Helper()
+	aead, err := spoolCipher(secret, agent.Device{DeviceId: "device-1", SharedAccessKey: "key"})
+	if err != nil {
+		t.Fatalf("newSpoolCipher: %v", err)
+	}
+	s := newPostbackSpool(
+		t.TempDir(),
+		spoolLimits{maxEntries: 10, maxAge: time.Hour},
+		hclog.NewNullLogger(),
+	)
+	s.aead = aead
+	return s
+}
+
+func readOnlySpoolFile(t *testing.T, s *postbackSpool) ([]byte, os.FileInfo) {
+	t.Helper()
+	ids := s.entryIds()
+	if len(ids) != 1 {
+		t.Fatalf("expected one spool entry, got %v", ids)
+	}
+	path := filepath.Join(s.dir, ids[0]+spoolFileSuffix)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read spool entry: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat spool entry: %v", err)
+	}
+	return data, info
+}
+
+func TestSpoolCipher_RequiresKeyMaterial(t *testing.T) {
+	if _, err := spoolCipher("", agent.Device{SharedAccessKey: "key"}); err == nil {
+		t.Error("expected an error without a spool secret")
+	}
+	if _, err := spoolCipher("secret", agent.Device{}); err == nil {
+		t.Error("expected an error without a shared access key")
+	}
+}
+
+// TestNewSpoolCipher_SecretFile verifies that the service creates a private
+// spool secret once and reuses it, and that readers never create one.
+func TestNewSpoolCipher_SecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), spoolSecretFileName)
+	device := agent.Device{DeviceId: "device-1", SharedAccessKey: "key"}
+
+	if _, err := newSpoolCipher(path, device, false); err == nil {
+		t.Fatal("expected an error without a spool secret")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("a reader created the spool secret: %v", err)
+	}
+
+	first, err := newSpoolCipher(path, device, true)
+	if err != nil {
+		t.Fatalf("newSpoolCipher: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat spool secret: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != spoolFileMod {
+		t.Errorf("expected mode %v, got %v", spoolFileMod, info.Mode().Perm())
+	}
+
+	second, err := newSpoolCipher(path, device, false)
+	if err != nil {
+		t.Fatalf("newSpoolCipher: %v", err)
+	}
+	nonce := make([]byte, first.NonceSize())
+	sealed := first.Seal(nil, nonce, []byte("result"), nil)
+	if opened, err := second.Open(nil, nonce, sealed, nil); err != nil ||
+		string(opened) != "result" {
+		t.Errorf("expected the same key from the same secret, got %q, %v", opened, err)
+	}
+}
+
+// TestSpool_EncryptsEntries verifies that a spooled result is neither readable
+// on disk nor by other users, and is delivered intact.
+func TestSpool_EncryptsEntries(t *testing.T) {
+	s := newSealedTestSpool(t, "secret-1")
+
+	secret := []byte(`{"output":"password=hunter2"}`)
+	err := s.enqueue(spoolEntry{PostId: "post-1", Result: secret, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	data, info := readOnlySpoolFile(t, s)
+	if bytes.Contains(data, []byte("post-1")) || bytes.Contains(data, []byte("hunter2")) {
+		t.Errorf("spool entry holds clear text: %s", data)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != spoolFileMod {
+		t.Errorf("expected mode %v, got %v", spoolFileMod, info.Mode().Perm())
+	}
+
+	var delivered []spoolEntry
+	s.flush(context.Background(), func(e spoolEntry) (bool, error) {
+		delivered = append(delivered, e)
+		return true, nil
+	})
+	if len(delivered) != 1 || delivered[0].PostId != "post-1" ||
+		!bytes.Equal(delivered[0].Result, secret) {
+		t.Errorf("unexpected delivered entries %+v", delivered)
+	}
+}
+
+// TestSpool_OtherKeyCannotRead verifies that an entry sealed with another key
+// is neither delivered nor quarantined: it is intact, so it is kept until it
+// expires.
+func TestSpool_OtherKeyCannotRead(t *testing.T) {
+	s := newSealedTestSpool(t, "secret-1")
+	err := s.enqueue(spoolEntry{PostId: "post-1", Result: []byte("x"), CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	other := newSealedTestSpool(t, "secret-2")
+	other.dir = s.dir
+	_, err = other.readEntry(s.entryIds()[0])
+	if !errors.Is(err, errSpoolKeyMismatch) || errors.Is(err, errSpoolCorrupt) {
+		t.Errorf("expected a key mismatch, got %v", err)
+	}
+
+	other.reconcile()
+	other.flush(context.Background(), func(spoolEntry) (bool, error) {
+		t.Error("entry sealed with another key must not be delivered")
+		return true, nil
+	})
+	if n := countSpoolFiles(t, s.dir); n != 1 || other.quarantineDepth() != 0 {
+		t.Errorf("expected the entry kept and nothing quarantined, %d remain and %d quarantined",
+			n, other.quarantineDepth())
+	}
+
+	other.maxAge = time.Nanosecond
+	other.flush(context.Background(), func(spoolEntry) (bool, error) { return true, nil })
+	if n := countSpoolFiles(t, s.dir); n != 0 {
+		t.Errorf("expected the expired entry removed, %d remain", n)
+	}
+}
+
+// TestSpool_SecureMigratesPlaintextEntries verifies that entries written in
+// clear text by an older agent are encrypted and made private in place.
+func TestSpool_SecureMigratesPlaintextEntries(t *testing.T) {
+	s := newSealedTestSpool(t, "secret-1")
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	legacy, err := json.Marshal(spoolEntry{
+		PostId:    "post-1",
+		Result:    []byte("hunter2"),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "00000000000000000001-000001" + spoolFileSuffix
+	if err := os.WriteFile(filepath.Join(s.dir, name), legacy, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s.secure()
+
+	data, info := readOnlySpoolFile(t, s)
+	if bytes.Contains(data, []byte("post-1")) {
+		t.Errorf("plaintext entry was not encrypted: %s", data)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != spoolFileMod {
+		t.Errorf("expected mode %v, got %v", spoolFileMod, info.Mode().Perm())
+	}
+
+	entry, err := s.readEntry(spoolEntryId(name))
+	if err != nil {
+		t.Fatalf("readEntry: %v", err)
+	}
+	if entry.PostId != "post-1" || string(entry.Result) != "hunter2" {
+		t.Errorf("unexpected migrated entry %+v", entry)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build darwin || linux
+
+package main
+
+// restrictSpoolSecret is a no-op on Unix, where the secret file is created
+// with mode 0600.
+func restrictSpoolSecret(string) error { return nil }
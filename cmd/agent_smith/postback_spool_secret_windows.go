@@ -0,0 +1,32 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// spoolSecretSddl grants the spool secret to LocalSystem, Administrators and
+// the account that created it (the service account) only, without inheriting
+// the ProgramData ACL that lets every user read.
+const spoolSecretSddl = "D:P(A;;FA;;;SY)(A;;FA;;;BA)(A;;FA;;;OW)"
+
+// restrictSpoolSecret replaces the ACL of the secret file, since Windows
+// ignores the file mode it was created with.
+func restrictSpoolSecret(path string) error {
+	sd, err := windows.SecurityDescriptorFromString(spoolSecretSddl)
+	if err != nil {
+		return err
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return err
+	}
+	return windows.SetNamedSecurityInfo(
+		path,
+		windows.SE_FILE_OBJECT,
+		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION,
+		nil,
+		nil,
+		dacl,
+		nil,
+	)
+}
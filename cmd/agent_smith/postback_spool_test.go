@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,7 +18,11 @@ import (
 
 func newTestSpool(t *testing.T, maxEntries int, maxAge time.Duration) *postbackSpool {
 	t.Helper()
-	return newPostbackSpool(t.TempDir(), maxEntries, maxAge, hclog.NewNullLogger())
+	return newPostbackSpool(
+		t.TempDir(),
+		spoolLimits{maxEntries: maxEntries, maxAge: maxAge},
+		hclog.NewNullLogger(),
+	)
 }
 
 func countSpoolFiles(t *testing.T, dir string) int {
@@ -46,12 +56,20 @@ func TestSpool_EnqueueFlushRoundTrip(t *testing.T) {
 		}
 	}
 
+	if got := s.depth(); got != 3 {
+		t.Errorf("expected spool depth 3 before flush, got %d", got)
+	}
+
 	var delivered []string
 	s.flush(context.Background(), func(e spoolEntry) (bool, error) {
 		delivered = append(delivered, e.PostId)
 		return true, nil
 	})
 
+	if got := s.depth(); got != 0 {
+		t.Errorf("expected spool depth 0 after flush, got %d", got)
+	}
+
 	want := []string{"a", "b", "c"}
 	if len(delivered) != len(want) {
 		t.Fatalf("expected %d deliveries, got %v", len(want), delivered)
@@ -94,6 +112,160 @@ func TestSpool_FlushStopsOnTransientFailure(t *testing.T) {
 	}
 }
 
+// spoolPostIds returns the post ids left in the spool, oldest first.
+func spoolPostIds(t *testing.T, s *postbackSpool) []string {
+	t.Helper()
+	var ids []string
+	for _, id := range s.entryIds() {
+		entry, err := s.readEntry(id)
+		if err != nil {
+			t.Fatalf("read entry %s: %v", id, err)
+		}
+		ids = append(ids, entry.PostId)
+	}
+	return ids
+}
+
+// TestSpool_SizeBudget verifies that the oldest entries are evicted to keep
+// the spool within its size budget, and that an entry larger than the whole
+// budget is refused.
+func TestSpool_SizeBudget(t *testing.T) {
+	s := newPostbackSpool(
+		t.TempDir(),
+		spoolLimits{maxEntries: 10, maxAge: time.Hour, maxBytes: 1200},
+		hclog.NewNullLogger(),
+	)
+
+	for _, id := range []string{"a", "b", "c"} {
+		err := s.enqueue(spoolEntry{PostId: id, Result: make([]byte, 300), CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("enqueue %s: %v", id, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Each entry is a little under 600 bytes once encoded, so only two fit
+	if got := spoolPostIds(t, s); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("expected [b c] retained, got %v", got)
+	}
+	if got := s.droppedTotal.Load(); got != 1 {
+		t.Errorf("expected 1 size drop, got %d", got)
+	}
+
+	err := s.enqueue(spoolEntry{PostId: "huge", Result: make([]byte, 2000), CreatedAt: time.Now()})
+	if err == nil {
+		t.Fatal("expected an entry over the size budget to be refused")
+	}
+	if got := spoolPostIds(t, s); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("expected a refused entry to evict nothing, got %v", got)
+	}
+}
+
+// TestSpool_EvictLargest verifies that the largest entry is evicted first
+// under the largest policy, for both the size budget and the entry count.
+func TestSpool_EvictLargest(t *testing.T) {
+	s := newPostbackSpool(
+		t.TempDir(),
+		spoolLimits{maxEntries: 3, maxAge: time.Hour, maxBytes: 2300, evictLargest: true},
+		hclog.NewNullLogger(),
+	)
+
+	sizes := []struct {
+		id   string
+		size int
+	}{{"small", 10}, {"big", 900}, {"medium", 300}, {"tiny", 1}, {"new", 500}}
+	for _, e := range sizes {
+		entry := spoolEntry{PostId: e.id, Result: make([]byte, e.size), CreatedAt: time.Now()}
+		err := s.enqueue(entry)
+		if err != nil {
+			t.Fatalf("enqueue %s: %v", e.id, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// "tiny" evicts "big" for the count; "new" evicts "medium"
+	want := []string{"small", "tiny", "new"}
+	if got := spoolPostIds(t, s); !slices.Equal(got, want) {
+		t.Errorf("expected %v retained, got %v", want, got)
+	}
+}
+
+// enqueuePriorityEntries spools one entry per id, with the priority after the
+// colon, e.g. "a:high".
+func enqueuePriorityEntries(t *testing.T, s *postbackSpool, specs ...string) {
+	t.Helper()
+	for _, spec := range specs {
+		id, priority, _ := strings.Cut(spec, ":")
+		err := s.enqueue(
+			spoolEntry{PostId: id, Result: []byte(id), CreatedAt: time.Now(), Priority: priority},
+		)
+		if err != nil {
+			t.Fatalf("enqueue %s: %v", id, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestSpool_PriorityOrder verifies that high-priority entries are delivered
+// first and low-priority ones last, oldest first within a priority.
+func TestSpool_PriorityOrder(t *testing.T) {
+	s := newTestSpool(t, 10, time.Hour)
+	enqueuePriorityEntries(t, s, "a:low", "b:normal", "c:high", "d:", "e:low", "f:high")
+
+	var delivered []string
+	s.flush(context.Background(), func(e spoolEntry) (bool, error) {
+		delivered = append(delivered, e.PostId)
+		return true, nil
+	})
+
+	want := []string{"c", "f", "b", "d", "a", "e"}
+	if !slices.Equal(delivered, want) {
+		t.Errorf("delivered %v, want %v", delivered, want)
+	}
+}
+
+// TestSpool_EvictsLowPriorityFirst verifies that over capacity the lowest
+// priority present is evicted first, whatever its age.
+func TestSpool_EvictsLowPriorityFirst(t *testing.T) {
+	s := newTestSpool(t, 3, time.Hour)
+	enqueuePriorityEntries(t, s, "a:high", "b:normal", "c:low", "d:normal", "e:normal")
+
+	// "d" evicts "c"; "e" evicts "b", the oldest normal entry
+	want := []string{"a", "d", "e"}
+	if got := spoolPostIds(t, s); !slices.Equal(got, want) {
+		t.Errorf("expected %v retained, got %v", want, got)
+	}
+
+	entry, err := s.readEntry(s.entryIds()[0])
+	if err != nil || entry.Priority != "high" {
+		t.Errorf("expected the priority kept with the entry, got %q (%v)", entry.Priority, err)
+	}
+}
+
+// TestSpool_RefusesEntryOutrankedByEveryVictim verifies that a full spool
+// drops an incoming entry rather than evict one of a higher priority for it.
+func TestSpool_RefusesEntryOutrankedByEveryVictim(t *testing.T) {
+	s := newTestSpool(t, 2, time.Hour)
+	enqueuePriorityEntries(t, s, "a:high", "b:normal")
+
+	err := s.enqueue(spoolEntry{PostId: "c", CreatedAt: time.Now(), Priority: "low"})
+	if !errors.Is(err, errSpoolOutranked) {
+		t.Errorf("expected the low priority entry refused, got %v", err)
+	}
+	if got := spoolPostIds(t, s); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("expected the spool unchanged, got %v", got)
+	}
+	if got := s.droppedTotal.Load(); got != 1 {
+		t.Errorf("expected the refused entry counted as dropped, got %d", got)
+	}
+
+	// An entry of the same priority as the lowest present still evicts it
+	enqueuePriorityEntries(t, s, "d:normal")
+	if got := spoolPostIds(t, s); !slices.Equal(got, []string{"a", "d"}) {
+		t.Errorf("expected b evicted for d, got %v", got)
+	}
+}
+
 // TestSpool_CapacityBound verifies that the spool never exceeds maxEntries: the
 // oldest entries are evicted as new ones arrive.
 func TestSpool_CapacityBound(t *testing.T) {
@@ -201,9 +373,9 @@ func TestSpool_AgeBoundOnEnqueue(t *testing.T) {
 	}
 }
 
-// TestSpool_CorruptEntryDropped verifies a non-parseable spool file is discarded
-// rather than wedging the flush.
-func TestSpool_CorruptEntryDropped(t *testing.T) {
+// TestSpool_CorruptEntryQuarantined verifies a non-parseable spool file is set
+// aside rather than wedging the flush.
+func TestSpool_CorruptEntryQuarantined(t *testing.T) {
 	s := newTestSpool(t, 10, time.Hour)
 	if err := os.MkdirAll(s.dir, 0o755); err != nil {
 		t.Fatalf("mkdir: %v", err)
@@ -226,6 +398,104 @@ func TestSpool_CorruptEntryDropped(t *testing.T) {
 	if n := countSpoolFiles(t, s.dir); n != 0 {
 		t.Errorf("expected corrupt entry removed, %d remain", n)
 	}
+	if n := countSpoolFiles(t, filepath.Join(s.dir, spoolQuarantineDirName)); n != 1 {
+		t.Errorf("expected corrupt entry quarantined, %d there", n)
+	}
+}
+
+// TestSpool_ChecksumMismatchQuarantined verifies that an entry whose contents
+// were altered on disk is caught by its checksum and not delivered.
+func TestSpool_ChecksumMismatchQuarantined(t *testing.T) {
+	s := newTestSpool(t, 10, time.Hour)
+	enqueueTestEntries(t, s, "id:flipped")
+
+	path := filepath.Join(s.dir, s.entryIds()[0]+spoolFileSuffix)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record spoolRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	record.Plaintext = bytes.Replace(record.Plaintext, []byte("flipped"), []byte("flopped"), 1)
+	data, _ = json.Marshal(record)
+	if err := os.WriteFile(path, data, spoolFileMod); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.decodeEntry(data); !errors.Is(err, errSpoolChecksum) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	var attempts int
+	s.flush(context.Background(), func(spoolEntry) (bool, error) {
+		attempts++
+		return true, nil
+	})
+	if attempts != 0 || s.quarantineDepth() != 1 {
+		t.Errorf("expected the altered entry quarantined, %d attempts", attempts)
+	}
+}
+
+// TestSpool_Reconcile verifies the startup scan: a complete temp file left by
+// a crash is committed, while a torn one and a damaged entry are quarantined.
+func TestSpool_Reconcile(t *testing.T) {
+	s := newTestSpool(t, 10, time.Hour)
+	enqueueTestEntries(t, s, "id:kept", "id:pending")
+	ids := s.entryIds()
+
+	// The second entry's rename never happened.
+	pending := filepath.Join(s.dir, ids[1]+spoolFileSuffix)
+	if err := os.Rename(pending, pending+spoolTempSuffix); err != nil {
+		t.Fatal(err)
+	}
+	torn := filepath.Join(s.dir, "00000000000000000003-000003"+spoolFileSuffix+spoolTempSuffix)
+	if err := os.WriteFile(torn, []byte(`{"plain`), spoolFileMod); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(s.dir, "00000000000000000004-000004"+spoolFileSuffix)
+	if err := os.WriteFile(empty, nil, spoolFileMod); err != nil {
+		t.Fatal(err)
+	}
+
+	s.reconcile()
+
+	if got := spoolPostIds(t, s); !slices.Equal(got, []string{"id:kept", "id:pending"}) {
+		t.Errorf("expected both complete entries in the spool, got %v", got)
+	}
+	quarantined, err := os.ReadDir(filepath.Join(s.dir, spoolQuarantineDirName))
+	if err != nil || len(quarantined) != 2 {
+		t.Fatalf("expected the torn and empty files quarantined, got %v, %v", quarantined, err)
+	}
+	if _, err := os.Stat(torn); !os.IsNotExist(err) {
+		t.Error("expected no temp files left in the spool")
+	}
+}
+
+// TestSpool_QuarantineBounded verifies that only the newest quarantined files
+// are kept.
+func TestSpool_QuarantineBounded(t *testing.T) {
+	s := newTestSpool(t, 10, time.Hour)
+	if err := os.MkdirAll(s.dir, spoolDirMod); err != nil {
+		t.Fatal(err)
+	}
+	for i := range spoolQuarantineMaxEntries + 2 {
+		name := fmt.Sprintf("%020d-%06d%s", i, i, spoolFileSuffix)
+		if err := os.WriteFile(filepath.Join(s.dir, name), nil, spoolFileMod); err != nil {
+			t.Fatal(err)
+		}
+		s.quarantine(name, errors.New("corrupt"))
+	}
+
+	quarantined, err := os.ReadDir(filepath.Join(s.dir, spoolQuarantineDirName))
+	if err != nil || len(quarantined) != spoolQuarantineMaxEntries {
+		t.Fatalf("expected %d quarantined files, got %d, %v",
+			spoolQuarantineMaxEntries, len(quarantined), err)
+	}
+	oldest := fmt.Sprintf("%020d-%06d%s", 2, 2, spoolFileSuffix)
+	if got := quarantined[0].Name(); got != oldest {
+		t.Errorf("expected the oldest files removed, oldest kept is %s", got)
+	}
 }
 
 // TestSpool_FlushContextCancelled verifies that a cancelled context stops the
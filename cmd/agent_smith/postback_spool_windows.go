@@ -0,0 +1,37 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// syncDir is a no-op on Windows: a directory cannot be opened for flushing,
+// and NTFS journals the rename itself.
+func syncDir(string) error {
+	return nil
+}
+
+// lockFile takes an exclusive lock on the first byte of f without waiting,
+// returning errSpoolLocked when another handle holds it.
+func lockFile(f *os.File) error {
+	err := windows.LockFileEx(
+		windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0,
+		1,
+		0,
+		&windows.Overlapped{},
+	)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errSpoolLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/interpreter"
 	"github.com/hashicorp/go-hclog"
 )
 
@@ -220,7 +221,11 @@ func TestProcessMessage_PostbackExhaustionSpoolsAndNotifies(t *testing.T) {
 	svc := newProcessMessageSvc(exec, &http.Client{
 		Transport: &schemeRewriteTransport{scheme: "http"},
 	})
-	svc.spool = newPostbackSpool(t.TempDir(), 10, time.Hour, hclog.NewNullLogger())
+	svc.spool = newPostbackSpool(
+		t.TempDir(),
+		spoolLimits{maxEntries: 10, maxAge: time.Hour},
+		hclog.NewNullLogger(),
+	)
 
 	ctx := context.Background()
 	logger := hclog.NewNullLogger()
@@ -266,7 +271,11 @@ func TestFlushPostbackSpool_DeliversSpooledResult(t *testing.T) {
 	svc := newProcessMessageSvc(exec, &http.Client{
 		Transport: &schemeRewriteTransport{scheme: "http"},
 	})
-	svc.spool = newPostbackSpool(t.TempDir(), 10, time.Hour, hclog.NewNullLogger())
+	svc.spool = newPostbackSpool(
+		t.TempDir(),
+		spoolLimits{maxEntries: 10, maxAge: time.Hour},
+		hclog.NewNullLogger(),
+	)
 
 	if err := svc.spool.enqueue(spoolEntry{
 		PostId:    "id:recover",
@@ -300,7 +309,11 @@ func TestFlushPostbackSpool_RetainsOnEngineDown(t *testing.T) {
 	svc := newProcessMessageSvc(exec, &http.Client{
 		Transport: &schemeRewriteTransport{scheme: "http"},
 	})
-	svc.spool = newPostbackSpool(t.TempDir(), 10, time.Hour, hclog.NewNullLogger())
+	svc.spool = newPostbackSpool(
+		t.TempDir(),
+		spoolLimits{maxEntries: 10, maxAge: time.Hour},
+		hclog.NewNullLogger(),
+	)
 
 	if err := svc.spool.enqueue(spoolEntry{
 		PostId:    "id:still-down",
@@ -635,3 +648,38 @@ func TestBuildReceivedMessageNotification_BoundedAcrossSizes(t *testing.T) {
 		}
 	}
 }
+
+// TestAttemptPostback_SignsRequest verifies that postbacks carry the device id
+// and a signature when the device has a shared access key.
+func TestAttemptPostback_SignsRequest(t *testing.T) {
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	svc := newProcessMessageSvc(&mockExecutor{}, &http.Client{
+		Transport: &schemeRewriteTransport{scheme: "http"},
+	})
+	device := deviceWithEngine(srv.Listener.Addr().String())
+	device.DeviceId = "dev-1"
+	device.SharedAccessKey = "c2VjcmV0"
+
+	done, err := svc.attemptPostback(
+		context.Background(),
+		&interpreter.Message{PostId: "id:signed"},
+		device,
+		[]byte(`{}`),
+		hclog.NewNullLogger(),
+		1,
+	)
+	if !done || err != nil {
+		t.Fatalf("attemptPostback = %v, %v", done, err)
+	}
+	if header.Get(interpreter.PostbackDeviceIdHeader) != "dev-1" ||
+		header.Get(interpreter.PostbackTimestampHeader) == "" ||
+		!strings.HasPrefix(header.Get(interpreter.PostbackSignatureHeader), "v1=") {
+		t.Errorf("expected a signed postback, got headers %v", header)
+	}
+}
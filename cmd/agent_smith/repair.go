@@ -0,0 +1,425 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/service"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+	"github.com/RewstApp/agent-smith-go/internal/version"
+	"github.com/hashicorp/go-hclog"
+)
+
+// repairPaths are the install locations repair mode inspects.
+type repairPaths struct {
+	DataDir         string
+	ScriptsDir      string
+	ProgramDir      string
+	AgentExecutable string
+	ConfigFile      string
+	LogFile         string
+	SpoolDir        string
+}
+
+func newRepairPaths(orgId string) repairPaths {
+	return repairPaths{
+		DataDir:         agent.GetDataDirectory(orgId),
+		ScriptsDir:      agent.GetScriptsDirectory(orgId),
+		ProgramDir:      agent.GetProgramDirectory(orgId),
+		AgentExecutable: agent.GetAgentExecutablePath(orgId),
+		ConfigFile:      agent.GetConfigFilePath(orgId),
+		LogFile:         agent.GetLogFilePath(orgId),
+		SpoolDir:        filepath.Join(agent.GetDataDirectory(orgId), postbackSpoolDirName),
+	}
+}
+
+// repairAction is a single fix repair mode can make.
+type repairAction struct {
+	Description string
+	apply       func() error
+}
+
+// repairPlan lists the fixes for an installation, in the order they must be
+// made, and the problems repair mode cannot fix on its own.
+type repairPlan struct {
+	Actions      []repairAction
+	Unrepairable []string
+}
+
+func (p *repairPlan) add(description string, apply func() error) {
+	p.Actions = append(p.Actions, repairAction{Description: description, apply: apply})
+}
+
+func runRepair(params *repairContext) error {
+	logger := utils.ConfigureLogger("agent_smith", os.Stdout, utils.Default)
+
+	// Show header
+	logger.Info("Agent Smith started", "version", version.Version, "os", runtime.GOOS)
+
+	return runRepairWith(params, logger, newRepairPaths(params.OrgId), readServiceDefinition)
+}
+
+// runRepairWith logs the repair plan and, with --apply, makes every fix in it.
+// A failed fix is logged and the remaining fixes are still attempted.
+func runRepairWith(
+	params *repairContext,
+	logger hclog.Logger,
+	paths repairPaths,
+	serviceDefinition func(string) (string, []byte, error),
+) error {
+	plan := planRepair(params, logger, paths, serviceDefinition)
+
+	for _, problem := range plan.Unrepairable {
+		logger.Warn("Cannot repair", "problem", problem)
+	}
+
+	if len(plan.Actions) == 0 {
+		logger.Info("Nothing to repair")
+		return nil
+	}
+
+	if !params.Apply {
+		for _, action := range plan.Actions {
+			logger.Info("Dry run: would repair", "action", action.Description)
+		}
+		logger.Info("Run again with --apply to make these changes")
+		return nil
+	}
+
+	var errs []error
+	for _, action := range plan.Actions {
+		logger.Info("Repairing", "action", action.Description)
+		if err := action.apply(); err != nil {
+			logger.Error("Repair failed", "action", action.Description, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", action.Description, err))
+			continue
+		}
+		logger.Info("Repaired", "action", action.Description)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d repairs failed: %w",
+			len(errs), len(plan.Actions), errors.Join(errs...))
+	}
+	return nil
+}
+
+// planRepair inspects the installation and returns the fixes it needs:
+// directories first, then the agent binary and spool, then the service, so
+// the service is only started once everything it uses is in place. The
+// service is left alone while the config is unrepairable, since it would only
+// fail to start.
+func planRepair(
+	params *repairContext,
+	logger hclog.Logger,
+	paths repairPaths,
+	serviceDefinition func(string) (string, []byte, error),
+) repairPlan {
+	var plan repairPlan
+
+	planDirectory(&plan, params, paths.DataDir)
+	planDirectory(&plan, params, paths.ScriptsDir)
+	planAgentExecutable(&plan, params, paths)
+	planSpool(&plan, params, logger, paths.SpoolDir)
+
+	// The config holds the device credentials, which only the config URL and
+	// secret can recover.
+	data, err := os.ReadFile(paths.ConfigFile) // #nosec G304 - path comes from internal config
+	var device agent.Device
+	if err == nil {
+		device, _, err = agent.ParseConfig(data)
+	}
+	if err != nil {
+		plan.Unrepairable = append(plan.Unrepairable, fmt.Sprintf(
+			"%s is missing or corrupt (%v); reinstall with --config-url and --config-secret",
+			paths.ConfigFile, err,
+		))
+		return plan
+	}
+
+	planService(&plan, params, paths, device, serviceDefinition)
+	return plan
+}
+
+func planDirectory(plan *repairPlan, params *repairContext, dir string) {
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		plan.add(fmt.Sprintf("Create missing directory %s", dir), func() error {
+			return params.FS.MkdirAll(dir)
+		})
+		return
+	}
+	if err != nil {
+		plan.Unrepairable = append(plan.Unrepairable,
+			fmt.Sprintf("Cannot inspect %s: %v", dir, err))
+		return
+	}
+	if !info.IsDir() {
+		plan.Unrepairable = append(plan.Unrepairable,
+			fmt.Sprintf("%s is not a directory; move it aside and rerun repair", dir))
+		return
+	}
+
+	// Mode bits are meaningless on Windows, where ACLs govern access.
+	if runtime.GOOS == "windows" || info.Mode().Perm()&0o022 == 0 {
+		return
+	}
+	perm := info.Mode().Perm() &^ 0o022
+	plan.add(
+		fmt.Sprintf("Remove group and other write access from %s (%s to %s)",
+			dir, info.Mode().Perm(), perm),
+		func() error { return os.Chmod(dir, perm) },
+	)
+}
+
+func planAgentExecutable(plan *repairPlan, params *repairContext, paths repairPaths) {
+	info, err := os.Stat(paths.AgentExecutable)
+	if errors.Is(err, fs.ErrNotExist) {
+		plan.add(
+			fmt.Sprintf("Restore missing agent binary %s from this executable",
+				paths.AgentExecutable),
+			func() error {
+				execFilePath, err := params.FS.Executable()
+				if err != nil {
+					return fmt.Errorf("failed to get executable: %w", err)
+				}
+				execFileBytes, err := params.FS.ReadFile(execFilePath)
+				if err != nil {
+					return fmt.Errorf("failed to read executable file: %w", err)
+				}
+				if err := params.FS.MkdirAll(paths.ProgramDir); err != nil {
+					return fmt.Errorf("failed to create program directory: %w", err)
+				}
+				return params.FS.WriteFile(
+					paths.AgentExecutable,
+					execFileBytes,
+					utils.DefaultExecutableFileMod,
+				)
+			},
+		)
+		return
+	}
+	if err != nil {
+		plan.Unrepairable = append(plan.Unrepairable,
+			fmt.Sprintf("Cannot inspect %s: %v", paths.AgentExecutable, err))
+		return
+	}
+
+	if runtime.GOOS == "windows" || info.Mode().Perm()&0o100 != 0 {
+		return
+	}
+	plan.add(fmt.Sprintf("Make agent binary %s executable", paths.AgentExecutable), func() error {
+		return os.Chmod(paths.AgentExecutable, utils.DefaultExecutableFileMod)
+	})
+}
+
+// planSpool quarantines the spool entries that do not parse or fail their
+// checksum, leaving the rest for the service to deliver. A spool that is not a
+// directory holds no entries, so it is moved aside and recreated empty; it is
+// kept for support rather than deleted.
+func planSpool(plan *repairPlan, params *repairContext, logger hclog.Logger, dir string) {
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		plan.Unrepairable = append(plan.Unrepairable,
+			fmt.Sprintf("Cannot inspect %s: %v", dir, err))
+		return
+	}
+
+	if !info.IsDir() {
+		aside := fmt.Sprintf("%s.corrupt-%s", dir, time.Now().UTC().Format("20060102T150405Z"))
+		plan.add(
+			fmt.Sprintf("Replace postback spool %s, which is not a directory; move it to %s",
+				dir, aside),
+			func() error {
+				if err := os.Rename(dir, aside); err != nil {
+					return err
+				}
+				return params.FS.MkdirAll(dir)
+			},
+		)
+		return
+	}
+
+	corrupt := corruptSpoolEntries(dir)
+	if len(corrupt) == 0 {
+		return
+	}
+	plan.add(
+		fmt.Sprintf("Quarantine %d unreadable postback spool entries in %s",
+			len(corrupt), filepath.Join(dir, spoolQuarantineDirName)),
+		func() error { return quarantineCorruptSpoolEntries(dir, logger) },
+	)
+}
+
+// quarantineCorruptSpoolEntries moves the corrupt entries in the spool at dir
+// into its quarantine. It holds the spool lock so a running service is never
+// delivering the entries it moves, and looks for them again under the lock.
+func quarantineCorruptSpoolEntries(dir string, logger hclog.Logger) error {
+	spool := newPostbackSpool(dir, spoolLimits{}, logger)
+	unlock, err := spool.lockDir()
+	if errors.Is(err, errSpoolLocked) {
+		return fmt.Errorf(
+			"the service is delivering spooled results; run repair again when it is done: %w",
+			err,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock postback spool: %w", err)
+	}
+	defer unlock()
+
+	spool.mu.Lock()
+	defer spool.mu.Unlock()
+	for _, name := range corruptSpoolEntries(dir) {
+		spool.quarantineLocked(name, errSpoolCorrupt)
+	}
+	return nil
+}
+
+// corruptSpoolEntries returns the names of the spool entry files that cannot
+// be read or parsed, or fail their checksum.
+func corruptSpoolEntries(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var corrupt []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), spoolFileSuffix) {
+			continue
+		}
+		data, err := os.ReadFile( // #nosec G304 - path is inside the spool directory
+			filepath.Join(dir, entry.Name()),
+		)
+		if err == nil {
+			_, err = parseSpoolRecord(data)
+		}
+		if err != nil {
+			corrupt = append(corrupt, entry.Name())
+		}
+	}
+	return corrupt
+}
+
+// planService registers the service if it is missing, re-registers it if its
+// definition no longer points at the agent's paths, and starts it if it is
+// stopped. Registration uses the account recorded in the device config, or the
+// platform default when none was.
+func planService(
+	plan *repairPlan,
+	params *repairContext,
+	paths repairPaths,
+	device agent.Device,
+	serviceDefinition func(string) (string, []byte, error),
+) {
+	name := agent.GetServiceName(params.OrgId)
+	agentParams := service.AgentParams{
+		Name:                name,
+		AgentExecutablePath: paths.AgentExecutable,
+		OrgId:               params.OrgId,
+		ConfigFilePath:      paths.ConfigFile,
+		LogFilePath:         paths.LogFile,
+		ServiceUsername:     device.ServiceUsername,
+	}
+	account := "the default account"
+	if device.ServiceUsername != "" {
+		account = fmt.Sprintf("account %s", device.ServiceUsername)
+	}
+
+	svc, err := params.ServiceManager.Open(name)
+	if err != nil {
+		plan.add(
+			fmt.Sprintf("Register and start missing service %s with %s", name, account),
+			func() error { return createAndStartService(params, agentParams) },
+		)
+		return
+	}
+	active := svc.IsActive()
+	_ = svc.Close()
+
+	if reason := staleServiceDefinition(name, paths, serviceDefinition); reason != "" {
+		plan.add(
+			fmt.Sprintf("Re-register service %s with %s, %s", name, account, reason),
+			func() error {
+				if err := deleteService(params, name); err != nil {
+					return err
+				}
+				return createAndStartService(params, agentParams)
+			},
+		)
+		return
+	}
+
+	if active {
+		return
+	}
+	plan.add(fmt.Sprintf("Start stopped service %s", name), func() error {
+		svc, err := params.ServiceManager.Open(name)
+		if err != nil {
+			return fmt.Errorf("failed to open service %s: %w", name, err)
+		}
+		defer func() { _ = svc.Close() }()
+		return svc.Start()
+	})
+}
+
+// staleServiceDefinition returns why the installed service definition does
+// not match the agent's paths, or "" if it does.
+func staleServiceDefinition(
+	name string,
+	paths repairPaths,
+	serviceDefinition func(string) (string, []byte, error),
+) string {
+	fileName, data, err := serviceDefinition(name)
+	if err != nil {
+		return fmt.Sprintf("its definition %s is unreadable (%v)", fileName, err)
+	}
+	for _, path := range []string{paths.AgentExecutable, paths.ConfigFile, paths.LogFile} {
+		if !strings.Contains(string(data), path) {
+			return fmt.Sprintf("its definition %s does not reference %s", fileName, path)
+		}
+	}
+	return ""
+}
+
+func deleteService(params *repairContext, name string) error {
+	svc, err := params.ServiceManager.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open service %s: %w", name, err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	if svc.IsActive() {
+		if err := svc.Stop(); err != nil {
+			return fmt.Errorf("failed to stop service %s: %w", name, err)
+		}
+	}
+	if err := svc.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service %s: %w", name, err)
+	}
+	return nil
+}
+
+func createAndStartService(params *repairContext, agentParams service.AgentParams) error {
+	svc, err := params.ServiceManager.Create(agentParams)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	if err := svc.Start(); err != nil {
+		return fmt.Errorf("failed to start service %s: %w", agentParams.Name, err)
+	}
+	return nil
+}
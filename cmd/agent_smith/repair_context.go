@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/RewstApp/agent-smith-go/internal/service"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+type repairContext struct {
+	OrgId  string
+	Repair bool
+	Apply  bool
+
+	ServiceManager service.ServiceManager
+	FS             utils.FileSystem
+}
+
+// newRepairFlagSet builds the flag set for repair mode, binding flags to the
+// provided params. It is shared between argument parsing and usage rendering so
+// that the per-flag descriptions stay in a single place.
+func newRepairFlagSet(params *repairContext) *flag.FlagSet {
+	fs := flag.NewFlagSet("repair", flag.ContinueOnError)
+	fs.StringVar(&params.OrgId, "org-id", "", "Organization ID")
+	fs.BoolVar(&params.Repair, "repair", false, "List the fixes for a broken agent installation")
+	fs.BoolVar(&params.Apply, "apply", false, "Make the listed fixes instead of a dry run")
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func newRepairContext(
+	args []string,
+	svcMgr service.ServiceManager,
+	fsys utils.FileSystem,
+) (*repairContext, error) {
+	var params repairContext
+
+	fs := newRepairFlagSet(&params)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.OrgId == "" {
+		return nil, fmt.Errorf("missing org-id")
+	}
+
+	if !params.Repair {
+		return nil, fmt.Errorf("missing repair")
+	}
+
+	params.ServiceManager = svcMgr
+	params.FS = fsys
+
+	return &params, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewRepairContext(t *testing.T) {
+	orgId := "test123"
+	result, _ := newRepairContext([]string{"--org-id", orgId, "--repair", "--apply"}, nil, nil)
+
+	if result.OrgId != orgId {
+		t.Errorf("expected %v, got %v", orgId, result.OrgId)
+	}
+
+	if !result.Repair || !result.Apply {
+		t.Errorf("expected repair and apply to be set, got %+v", result)
+	}
+
+	errorTests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"--org-id", orgId}, "missing repair"},
+		{[]string{"--repair"}, "missing org-id"},
+		{[]string{"--=repair"}, "bad flag syntax"},
+	}
+
+	for _, errorTest := range errorTests {
+		_, err := newRepairContext(errorTest.args, nil, nil)
+
+		if err == nil || !strings.Contains(err.Error(), errorTest.message) {
+			t.Errorf("expected error %s, got %v", errorTest.message, err)
+		}
+	}
+}
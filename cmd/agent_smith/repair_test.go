@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+	"github.com/hashicorp/go-hclog"
+)
+
+// newRepairTestInstall lays out a healthy installation under a temporary
+// directory and returns its paths along with a service definition that
+// references them.
+func newRepairTestInstall(t *testing.T) (repairPaths, []byte) {
+	t.Helper()
+	root := t.TempDir()
+	paths := repairPaths{
+		DataDir:         filepath.Join(root, "data"),
+		ScriptsDir:      filepath.Join(root, "scripts"),
+		ProgramDir:      filepath.Join(root, "program"),
+		AgentExecutable: filepath.Join(root, "program", "agent_smith"),
+		ConfigFile:      filepath.Join(root, "data", "config.json"),
+		LogFile:         filepath.Join(root, "data", "rewst_agent.log"),
+		SpoolDir:        filepath.Join(root, "data", postbackSpoolDirName),
+	}
+
+	for _, dir := range []string{paths.DataDir, paths.ScriptsDir, paths.ProgramDir} {
+		if err := os.MkdirAll(dir, utils.DefaultDirMod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeRepairTestFile(t, paths.AgentExecutable, "binary", utils.DefaultExecutableFileMod)
+	writeRepairTestFile(t, paths.ConfigFile, `{"device_id":"dev"}`, 0o600)
+
+	definition := strings.Join(
+		[]string{paths.AgentExecutable, paths.ConfigFile, paths.LogFile},
+		" ",
+	)
+	return paths, []byte(definition)
+}
+
+func writeRepairTestFile(t *testing.T, name, data string, perm os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(data), perm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newRepairTestFileSystem performs real file operations and reports source as
+// the running executable.
+func newRepairTestFileSystem(source string) *mockFileSystem {
+	fsys := utils.NewFileSystem()
+	return &mockFileSystem{
+		executableFunc: func() (string, error) { return source, nil },
+		readFileFunc:   fsys.ReadFile,
+		writeFileFunc:  fsys.WriteFile,
+		mkdirAllFunc:   fsys.MkdirAll,
+		removeAllFunc:  fsys.RemoveAll,
+	}
+}
+
+func staticServiceDefinition(data []byte, err error) func(string) (string, []byte, error) {
+	return func(string) (string, []byte, error) { return "agent.service", data, err }
+}
+
+func planDescriptions(plan repairPlan) string {
+	var descriptions []string
+	for _, action := range plan.Actions {
+		descriptions = append(descriptions, action.Description)
+	}
+	return strings.Join(descriptions, "\n")
+}
+
+func TestPlanRepair_HealthyInstall(t *testing.T) {
+	paths, definition := newRepairTestInstall(t)
+	params := &repairContext{
+		OrgId:          "test-org",
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: true}},
+		FS:             newRepairTestFileSystem(paths.AgentExecutable),
+	}
+
+	plan := planRepair(params, hclog.NewNullLogger(), paths,
+		staticServiceDefinition(definition, nil))
+
+	if len(plan.Actions) != 0 || len(plan.Unrepairable) != 0 {
+		t.Errorf("expected nothing to repair, got %q and %v",
+			planDescriptions(plan), plan.Unrepairable)
+	}
+}
+
+func TestRunRepair_DryRunChangesNothing(t *testing.T) {
+	paths, definition := newRepairTestInstall(t)
+	if err := os.RemoveAll(paths.ScriptsDir); err != nil {
+		t.Fatal(err)
+	}
+	svcMgr := &mockServiceManager{openErr: errors.New("not found")}
+	params := &repairContext{
+		OrgId:          "test-org",
+		ServiceManager: svcMgr,
+		FS:             newRepairTestFileSystem(paths.AgentExecutable),
+	}
+
+	err := runRepairWith(params, hclog.NewNullLogger(), paths,
+		staticServiceDefinition(definition, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(paths.ScriptsDir); !os.IsNotExist(err) {
+		t.Errorf("dry run created %s", paths.ScriptsDir)
+	}
+	if len(svcMgr.createCalls) != 0 {
+		t.Errorf("dry run registered the service")
+	}
+}
+
+func TestRunRepair_ApplyRestoresInstall(t *testing.T) {
+	paths, definition := newRepairTestInstall(t)
+	source := filepath.Join(t.TempDir(), "running")
+	writeRepairTestFile(t, source, "new binary", utils.DefaultExecutableFileMod)
+	for _, path := range []string{paths.ScriptsDir, paths.ProgramDir} {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(paths.SpoolDir, utils.DefaultDirMod); err != nil {
+		t.Fatal(err)
+	}
+	writeRepairTestFile(t, filepath.Join(paths.SpoolDir, "1.json"), "{", utils.DefaultFileMod)
+	writeRepairTestFile(t, filepath.Join(paths.SpoolDir, "2.json"),
+		`{"post_id":"abc"}`, utils.DefaultFileMod)
+
+	svcMgr := &mockServiceManager{
+		openErr:       errors.New("not found"),
+		createService: &mockService{},
+	}
+	params := &repairContext{
+		OrgId:          "test-org",
+		Apply:          true,
+		ServiceManager: svcMgr,
+		FS:             newRepairTestFileSystem(source),
+	}
+
+	err := runRepairWith(params, hclog.NewNullLogger(), paths,
+		staticServiceDefinition(definition, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if info, err := os.Stat(paths.ScriptsDir); err != nil || !info.IsDir() {
+		t.Errorf("expected %s to be recreated, got %v", paths.ScriptsDir, err)
+	}
+	if data, err := os.ReadFile(paths.AgentExecutable); err != nil || string(data) != "new binary" {
+		t.Errorf("expected agent binary to be restored, got %q, %v", data, err)
+	}
+	if corrupt := corruptSpoolEntries(paths.SpoolDir); len(corrupt) != 0 {
+		t.Errorf("expected no corrupt spool entries, got %v", corrupt)
+	}
+	if _, err := os.Stat(filepath.Join(paths.SpoolDir, "2.json")); err != nil {
+		t.Errorf("expected the readable spool entry to be kept, got %v", err)
+	}
+	quarantined := filepath.Join(paths.SpoolDir, spoolQuarantineDirName, "1.json")
+	if _, err := os.Stat(quarantined); err != nil {
+		t.Errorf("expected the corrupt spool entry to be quarantined, got %v", err)
+	}
+	if len(svcMgr.createCalls) != 1 ||
+		svcMgr.createCalls[0].AgentExecutablePath != paths.AgentExecutable {
+		t.Errorf("expected the service to be registered once, got %+v", svcMgr.createCalls)
+	}
+}
+
+func TestPlanRepair_StaleServiceDefinition(t *testing.T) {
+	paths, _ := newRepairTestInstall(t)
+	params := &repairContext{
+		OrgId:          "test-org",
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: true}},
+		FS:             newRepairTestFileSystem(paths.AgentExecutable),
+	}
+
+	plan := planRepair(params, hclog.NewNullLogger(), paths,
+		staticServiceDefinition([]byte("/old/agent_smith"), nil))
+
+	if got := planDescriptions(plan); !strings.Contains(got, "Re-register service") {
+		t.Errorf("expected the service to be re-registered, got %q", got)
+	}
+}
+
+func TestPlanRepair_StoppedService(t *testing.T) {
+	paths, definition := newRepairTestInstall(t)
+	params := &repairContext{
+		OrgId:          "test-org",
+		ServiceManager: &mockServiceManager{openService: &mockService{}},
+		FS:             newRepairTestFileSystem(paths.AgentExecutable),
+	}
+
+	plan := planRepair(params, hclog.NewNullLogger(), paths,
+		staticServiceDefinition(definition, nil))
+
+	if got := planDescriptions(plan); !strings.HasPrefix(got, "Start stopped service") {
+		t.Errorf("expected only a service start, got %q", got)
+	}
+}
+
+func TestPlanRepair_MissingConfigIsUnrepairable(t *testing.T) {
+	paths, definition := newRepairTestInstall(t)
+	if err := os.Remove(paths.ConfigFile); err != nil {
+		t.Fatal(err)
+	}
+	params := &repairContext{
+		OrgId:          "test-org",
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: true}},
+		FS:             newRepairTestFileSystem(paths.AgentExecutable),
+	}
+
+	plan := planRepair(params, hclog.NewNullLogger(), paths,
+		staticServiceDefinition(definition, nil))
+
+	if len(plan.Unrepairable) != 1 || !strings.Contains(plan.Unrepairable[0], "--config-url") {
+		t.Errorf("expected the missing config to be unrepairable, got %v", plan.Unrepairable)
+	}
+	if len(plan.Actions) != 0 {
+		t.Errorf("expected the service to be left alone, got %q", planDescriptions(plan))
+	}
+}
+
+func TestRunRepair_ReregistersWithConfiguredAccount(t *testing.T) {
+	paths, _ := newRepairTestInstall(t)
+	writeRepairTestFile(t, paths.ConfigFile,
+		`{"device_id":"dev","service_username":"svc_rewst"}`, 0o600)
+	svcMgr := &mockServiceManager{
+		openService:   &mockService{isActive: true},
+		createService: &mockService{},
+	}
+	params := &repairContext{
+		OrgId:          "test-org",
+		Apply:          true,
+		ServiceManager: svcMgr,
+		FS:             newRepairTestFileSystem(paths.AgentExecutable),
+	}
+
+	err := runRepairWith(params, hclog.NewNullLogger(), paths,
+		staticServiceDefinition([]byte("/old/agent_smith"), nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(svcMgr.createCalls) != 1 || svcMgr.createCalls[0].ServiceUsername != "svc_rewst" {
+		t.Errorf("expected the service to be registered as svc_rewst, got %+v",
+			svcMgr.createCalls)
+	}
+}
+
+func TestRunRepair_SpoolLockedByService(t *testing.T) {
+	paths, definition := newRepairTestInstall(t)
+	if err := os.MkdirAll(paths.SpoolDir, utils.DefaultDirMod); err != nil {
+		t.Fatal(err)
+	}
+	writeRepairTestFile(t, filepath.Join(paths.SpoolDir, "1.json"), "{", utils.DefaultFileMod)
+
+	// The service holds the lock for the whole of a delivery pass
+	unlock, err := newPostbackSpool(paths.SpoolDir, spoolLimits{}, hclog.NewNullLogger()).lockDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	params := &repairContext{
+		OrgId:          "test-org",
+		Apply:          true,
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: true}},
+		FS:             newRepairTestFileSystem(paths.AgentExecutable),
+	}
+
+	err = runRepairWith(params, hclog.NewNullLogger(), paths,
+		staticServiceDefinition(definition, nil))
+	if !errors.Is(err, errSpoolLocked) {
+		t.Errorf("expected the locked spool to be reported, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(paths.SpoolDir, "1.json")); err != nil {
+		t.Errorf("expected the entry to be left in place, got %v", err)
+	}
+}
+
+func TestPlanRepair_WorldWritableDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mode bits are not checked on Windows")
+	}
+	paths, definition := newRepairTestInstall(t)
+	if err := os.Chmod(paths.ScriptsDir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	params := &repairContext{
+		OrgId:          "test-org",
+		Apply:          true,
+		ServiceManager: &mockServiceManager{openService: &mockService{isActive: true}},
+		FS:             newRepairTestFileSystem(paths.AgentExecutable),
+	}
+
+	err := runRepairWith(params, hclog.NewNullLogger(), paths,
+		staticServiceDefinition(definition, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(paths.ScriptsDir)
+	if err != nil || info.Mode().Perm() != 0o755 {
+		t.Errorf("expected mode 0755, got %v, %v", info.Mode().Perm(), err)
+	}
+}
+
+func TestRunRepair_ReportsFailedActions(t *testing.T) {
+	paths, definition := newRepairTestInstall(t)
+	params := &repairContext{
+		OrgId: "test-org",
+		Apply: true,
+		ServiceManager: &mockServiceManager{
+			openService: &mockService{startErr: errors.New("unit failed")},
+		},
+		FS: newRepairTestFileSystem(paths.AgentExecutable),
+	}
+
+	err := runRepairWith(params, hclog.NewNullLogger(), paths,
+		staticServiceDefinition(definition, nil))
+	if err == nil || !strings.Contains(err.Error(), "unit failed") {
+		t.Errorf("expected the start failure to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/interpreter"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+	"github.com/RewstApp/agent-smith-go/internal/version"
+	"github.com/hashicorp/go-hclog"
+)
+
+// runMessage runs a message file through the executor the service uses, with
+// the installed device config, and prints the result JSON to stdout. Logs go
+// to stderr so the output can be piped.
+func runMessage(params *runMessageContext) error {
+	logger := utils.ConfigureLogger("agent_smith", os.Stderr, utils.Default)
+
+	// Show header
+	logger.Info("Agent Smith started", "version", version.Version, "os", runtime.GOOS)
+
+	// Interrupting cancels the command the same way stopping the service does
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return runMessageWith(ctx, params, os.Stdin, os.Stdout, logger)
+}
+
+func runMessageWith(
+	ctx context.Context,
+	params *runMessageContext,
+	stdin io.Reader,
+	out io.Writer,
+	logger hclog.Logger,
+) error {
+	configFilePath := agent.GetConfigFilePath(params.OrgId)
+	configBytes, err := params.FS.ReadFile(configFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	device, _, err := agent.ParseConfig(configBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", configFilePath, err)
+	}
+
+	var payload []byte
+	if params.RunMessage == "-" {
+		payload, err = io.ReadAll(stdin)
+	} else {
+		payload, err = params.FS.ReadFile(params.RunMessage)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+
+	var message interpreter.Message
+	if err := message.Parse(payload); err != nil {
+		return fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	// As in the service, overflowing output is only uploaded when the result
+	// is posted back.
+	postback := params.Postback && message.PostId != "" &&
+		(!device.DisableAgentPostback || params.Executor.AlwaysPostback())
+	if postback {
+		message.Uploader = &interpreter.ChunkedUploader{Client: params.HTTPClient}
+	}
+
+	resultBytes := message.Execute(
+		params.Executor,
+		ctx,
+		device,
+		logger,
+		params.Sys,
+		params.Domain,
+	)
+
+	if _, err := fmt.Fprintf(out, "%s\n", resultBytes); err != nil {
+		return err
+	}
+
+	if !params.Postback {
+		return nil
+	}
+
+	// Apply the same rules as the service before posting back
+	if message.PostId == "" {
+		return fmt.Errorf("message has no post_id to post the result back to")
+	}
+	if device.DisableAgentPostback && !params.Executor.AlwaysPostback() {
+		logger.Warn("Postback skipped: disabled in config", "post_id", message.PostId)
+		return nil
+	}
+
+	svc := &serviceContext{OrgId: params.OrgId, HTTPClient: params.HTTPClient}
+	if _, err := svc.attemptPostback(ctx, &message, device, resultBytes, logger, 1); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/interpreter"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+type runMessageContext struct {
+	OrgId      string
+	RunMessage string
+	Postback   bool
+
+	Sys    agent.SystemInfoProvider
+	Domain agent.DomainInfoProvider
+
+	Executor   interpreter.Executor
+	HTTPClient *http.Client
+	FS         utils.FileSystem
+}
+
+// newRunMessageFlagSet builds the flag set for run-message mode, binding flags
+// to the provided params. It is shared between argument parsing and usage
+// rendering so that the per-flag descriptions stay in a single place.
+func newRunMessageFlagSet(params *runMessageContext) *flag.FlagSet {
+	fs := flag.NewFlagSet("run-message", flag.ContinueOnError)
+	fs.StringVar(&params.OrgId, "org-id", "", "Organization ID")
+	fs.StringVar(
+		&params.RunMessage,
+		"run-message",
+		"",
+		"Run the message in this file (- for stdin) and print the result",
+	)
+	fs.BoolVar(&params.Postback, "postback", false, "Post the result back to the Rewst engine")
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func newRunMessageContext(
+	args []string,
+	sys agent.SystemInfoProvider,
+	domain agent.DomainInfoProvider,
+	executor interpreter.Executor,
+	fsys utils.FileSystem,
+) (*runMessageContext, error) {
+	var params runMessageContext
+
+	fs := newRunMessageFlagSet(&params)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.OrgId == "" {
+		return nil, fmt.Errorf("missing org-id")
+	}
+
+	if params.RunMessage == "" {
+		return nil, fmt.Errorf("missing run-message")
+	}
+
+	params.Sys = sys
+	params.Domain = domain
+	params.Executor = executor
+	params.HTTPClient = &http.Client{Timeout: postbackHTTPTimeout}
+	params.FS = fsys
+
+	return &params, nil
+}
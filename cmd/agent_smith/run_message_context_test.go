@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewRunMessageContext(t *testing.T) {
+	orgId := "test123"
+	result, _ := newRunMessageContext(
+		[]string{"--org-id", orgId, "--run-message", "msg.json", "--postback"},
+		nil, nil, nil, nil,
+	)
+
+	if result.OrgId != orgId {
+		t.Errorf("expected %v, got %v", orgId, result.OrgId)
+	}
+
+	if result.RunMessage != "msg.json" || !result.Postback {
+		t.Errorf("expected run-message and postback to be set, got %+v", result)
+	}
+
+	if result.HTTPClient == nil {
+		t.Error("expected an HTTP client for the postback")
+	}
+
+	errorTests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"--org-id", orgId}, "missing run-message"},
+		{[]string{"--run-message", "-"}, "missing org-id"},
+		{[]string{"--=run-message"}, "bad flag syntax"},
+	}
+
+	for _, errorTest := range errorTests {
+		_, err := newRunMessageContext(errorTest.args, nil, nil, nil, nil)
+
+		if err == nil || !strings.Contains(err.Error(), errorTest.message) {
+			t.Errorf("expected error %s, got %v", errorTest.message, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/hashicorp/go-hclog"
+)
+
+func newRunMessageTestParams(
+	exec *mockExecutor,
+	config string,
+	message string,
+	postback bool,
+) *runMessageContext {
+	return &runMessageContext{
+		OrgId:      "test-org",
+		RunMessage: "msg.json",
+		Postback:   postback,
+		Executor:   exec,
+		HTTPClient: &http.Client{Transport: &schemeRewriteTransport{scheme: "http"}},
+		FS: &mockFileSystem{
+			readFileFunc: func(name string) ([]byte, error) {
+				switch name {
+				case agent.GetConfigFilePath("test-org"):
+					return []byte(config), nil
+				case "msg.json":
+					return []byte(message), nil
+				}
+				return nil, os.ErrNotExist
+			},
+		},
+	}
+}
+
+func TestRunMessage_PrintsResult(t *testing.T) {
+	exec := &mockExecutor{result: []byte(`{"error":"","output":"hi"}`)}
+	params := newRunMessageTestParams(exec, `{}`, `{"commands":"ZQBjAGgAbwA="}`, false)
+	var out bytes.Buffer
+
+	err := runMessageWith(context.Background(), params, nil, &out, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !exec.executeCalled {
+		t.Error("expected the executor to run the message")
+	}
+	if got := out.String(); got != "{\"error\":\"\",\"output\":\"hi\"}\n" {
+		t.Errorf("expected the result JSON, got %q", got)
+	}
+}
+
+func TestRunMessage_ReadsStdin(t *testing.T) {
+	exec := &mockExecutor{result: []byte(`{}`)}
+	params := newRunMessageTestParams(exec, `{}`, "", false)
+	params.RunMessage = "-"
+
+	err := runMessageWith(
+		context.Background(),
+		params,
+		strings.NewReader(`{"commands":"ZQBjAGgAbwA="}`),
+		io.Discard,
+		hclog.NewNullLogger(),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !exec.executeCalled {
+		t.Error("expected the executor to run the message from stdin")
+	}
+}
+
+func TestRunMessage_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		message  string
+		postback bool
+		want     string
+	}{
+		{"corrupt config", `{`, `{}`, false, "failed to parse config"},
+		{"corrupt message", `{}`, `{`, false, "failed to parse message"},
+		{"postback without post id", `{}`, `{"commands":"x"}`, true, "no post_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := newRunMessageTestParams(&mockExecutor{}, tt.config, tt.message, tt.postback)
+
+			err := runMessageWith(
+				context.Background(), params, nil, io.Discard, hclog.NewNullLogger(),
+			)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestRunMessage_Postback(t *testing.T) {
+	tests := []struct {
+		name       string
+		disabled   bool
+		status     int
+		wantPosted bool
+		wantErr    bool
+	}{
+		{"posted", false, http.StatusOK, true, false},
+		{"rejected", false, http.StatusNotFound, true, true},
+		{"disabled in config", true, http.StatusOK, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posted []byte
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				posted, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(`{"error":"not found"}`))
+			}
+			srv := httptest.NewServer(http.HandlerFunc(handler))
+			defer srv.Close()
+
+			config := fmt.Sprintf(
+				`{"rewst_engine_host":%q,"disable_agent_postback":%v}`,
+				srv.Listener.Addr().String(), tt.disabled,
+			)
+			exec := &mockExecutor{result: []byte(`{"output":"hi"}`)}
+			params := newRunMessageTestParams(
+				exec, config, `{"post_id":"id:123","commands":"x"}`, true,
+			)
+
+			err := runMessageWith(
+				context.Background(), params, nil, io.Discard, hclog.NewNullLogger(),
+			)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if gotPosted := posted != nil; gotPosted != tt.wantPosted {
+				t.Errorf("expected posted %v, got %v", tt.wantPosted, gotPosted)
+			}
+			if tt.wantPosted && string(posted) != `{"output":"hi"}` {
+				t.Errorf("expected the printed result to be posted, got %q", posted)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -60,8 +61,8 @@ func (svc *serviceContext) loadConfig() (agent.Device, error) {
 		return device, err
 	}
 
-	// Decode the config file
-	err = json.Unmarshal(configFileBytes, &device)
+	// Decode the config file, migrating it to the current schema in memory
+	device, _, err = agent.ParseConfig(configFileBytes)
 	if err != nil {
 		return device, err
 	}
@@ -70,6 +71,10 @@ func (svc *serviceContext) loadConfig() (agent.Device, error) {
 		return device, fmt.Errorf("mqtt_qos must be 0 or 1; got %d", *device.MqttQos)
 	}
 
+	if err := validateSyslogSettings(device); err != nil {
+		return device, err
+	}
+
 	return device, nil
 }
 
@@ -97,6 +102,39 @@ func (svc *serviceContext) scriptsOrgId(device agent.Device) string {
 	return svc.OrgId
 }
 
+// newSysLogger builds the syslog sink selected by the device config. Without a
+// syslog_transport the platform writer is kept (the logger binary on Linux and
+// macOS, the Event Log on Windows) so existing deployments see no change;
+// otherwise the native writer speaks the syslog protocol directly to the local
+// socket or a remote collector.
+func (svc *serviceContext) newSysLogger(device agent.Device, out io.Writer) (syslog.Syslog, error) {
+	if device.SyslogTransport == "" {
+		return syslog.New(svc.Name(), out)
+	}
+
+	transport, err := syslog.ParseTransport(device.SyslogTransport)
+	if err != nil {
+		return nil, err
+	}
+	facility, err := syslog.ParseFacility(device.SyslogFacility)
+	if err != nil {
+		return nil, err
+	}
+	appName := device.SyslogAppName
+	if appName == "" {
+		appName = svc.Name()
+	}
+
+	return syslog.NewNetwork(syslog.NetworkOptions{
+		Transport:  transport,
+		Address:    device.SyslogAddress,
+		Format:     syslog.Format(device.SyslogFormat),
+		Facility:   facility,
+		AppName:    appName,
+		BufferSize: device.ResolvedSyslogBufferSize(),
+	}, out)
+}
+
 func (svc *serviceContext) Name() string {
 	return agent.GetServiceName(svc.OrgId)
 }
@@ -124,12 +162,14 @@ func (svc *serviceContext) Execute(
 		_ = logFile.Close()
 	}()
 
+	var logOutput io.Writer = logFile
 	logger := utils.ConfigureLogger("agent_smith", logFile, device.LoggingLevel)
 
 	// Configure syslogger if needed
 	if device.UseSyslog {
-		sysLogger, err := syslog.New(svc.Name(), logFile)
+		sysLogger, err := svc.newSysLogger(device, logFile)
 		if err != nil {
+			logger.Error("Failed to configure syslog", "error", err)
 			return service.LogFileError
 		}
 		defer func() {
@@ -139,9 +179,38 @@ func (svc *serviceContext) Execute(
 			}
 		}()
 
+		logOutput = sysLogger
 		logger = utils.ConfigureLogger("agent_smith", sysLogger, device.LoggingLevel)
 	}
 
+	// Mirror structured entries into journald if needed, so journalctl can
+	// filter on fields such as POST_ID and WORKER
+	if device.UseJournald {
+		journal, err := syslog.NewJournal(
+			svc.Name(),
+			hclog.LevelFromString(string(device.LoggingLevel)),
+		)
+		if err != nil {
+			// The log file still has every entry, so a missing journal is not
+			// worth refusing to start over
+			logger.Warn("Journald unavailable; logging to the log file only", "error", err)
+		} else {
+			defer func() {
+				err = journal.Close()
+				if err != nil {
+					logger.Error("Failed to close journald handle", "error", err)
+				}
+			}()
+
+			logger = utils.ConfigureLoggerWithSinks(
+				"agent_smith",
+				logOutput,
+				device.LoggingLevel,
+				journal,
+			)
+		}
+	}
+
 	// Resolve the postback retry budget from the device config, falling back to
 	// the documented defaults when unset. Existing deployments that omit these
 	// keys keep the previous behaviour.
@@ -150,13 +219,37 @@ func (svc *serviceContext) Execute(
 
 	// Create the durable postback spool so results that exhaust their in-line
 	// retry budget are persisted and re-attempted on a later cycle instead of
-	// being dropped.
-	svc.spool = newPostbackSpool(
-		filepath.Join(agent.GetDataDirectory(svc.OrgId), "postback_spool"),
-		defaultSpoolMaxEntries,
-		defaultSpoolMaxAge,
+	// being dropped. Its limits come from the device config, and its entries
+	// are encrypted with a key derived from the device and a secret only the
+	// service account can read, created on first start. Without a key no spool
+	// is used rather than writing command output in clear text. Writes a crash
+	// interrupted and damaged entries are dealt with before anything else
+	// touches it.
+	spoolAead, err := newSpoolCipher(spoolSecretPath(svc.OrgId), device, true)
+	if err != nil {
+		logger.Error("Postback spool disabled: failed to derive its key", "error", err)
+	} else {
+		svc.spool = newPostbackSpool(
+			filepath.Join(agent.GetDataDirectory(svc.OrgId), postbackSpoolDirName),
+			deviceSpoolLimits(device),
+			logger,
+		)
+		svc.spool.aead = spoolAead
+		svc.spool.reconcile()
+		svc.spool.secure()
+	}
+
+	// Track runtime state for --status. The file sits next to the config file,
+	// which for an installed agent is agent.GetStatusFilePath. The final
+	// snapshot records the service as stopped so a stale file is never mistaken
+	// for a live agent.
+	svc.status = newStatusTracker(
+		filepath.Join(filepath.Dir(svc.ConfigFile), statusFileName),
 		logger,
 	)
+	svc.status.spool = svc.spool
+	svc.status.dropped = svc.droppedMessages.Load
+	defer svc.status.setState(connectionStopped)
 
 	if !device.DisableAutoUpdates {
 		updater := agent.NewUpdater(
@@ -177,6 +270,8 @@ func (svc *serviceContext) Execute(
 		)
 		runner.Start()
 		defer runner.Stop()
+
+		svc.status.updates = runner
 	}
 
 	// Show header
@@ -216,6 +311,41 @@ func (svc *serviceContext) Execute(
 		notifier.Kill()
 	}()
 
+	svc.status.notifier = notifier
+
+	// Share one view of engine health between the workers and the drainer, so
+	// an outage trips a single breaker instead of every result retrying on its
+	// own. Its transitions are reported to plugins, and the drainer is kicked
+	// when the engine recovers.
+	svc.breaker = newPostbackBreaker(
+		device.ResolvedPostbackBreakerThreshold(),
+		device.ResolvedPostbackBreakerCooldown(),
+		logger,
+		func(state string) {
+			_ = notifier.Notify(breakerNotifications[state]) // Best effort notification
+			if state == breakerClosed {
+				svc.drainer.kick()
+			}
+		},
+	)
+	svc.status.breaker = svc.breaker
+	svc.failover = newEngineFailover(logger)
+	svc.status.failover = svc.failover
+
+	// Deliver spooled results in the background for the lifetime of the
+	// service rather than once per connection cycle, so a result spooled during
+	// an outage is delivered soon after the engine recovers. It stops with ctx
+	// when the service does.
+	if svc.spool != nil {
+		svc.drainer = newSpoolDrainer(func(ctx context.Context) spoolDrainPass {
+			return svc.flushPostbackSpool(ctx, device, logger)
+		}, logger)
+		svc.status.drainer = svc.drainer
+		utils.SafeGo(logger, func() {
+			svc.drainer.run(ctx)
+		}, "scope", "postback_spool_drainer")
+	}
+
 	loadedPlugins := notifier.Plugins()
 	if len(loadedPlugins) == 1 {
 		logger.Info("Plugin loaded", "plugin", loadedPlugins[0])
@@ -240,6 +370,13 @@ func (svc *serviceContext) Execute(
 		}
 	}, "scope", "stop_monitor")
 
+	statusStopped := make(chan struct{})
+	defer close(statusStopped)
+	svc.status.write()
+	utils.SafeGo(logger, func() {
+		svc.status.run(statusStopped, statusWriteInterval)
+	}, "scope", "status_writer")
+
 	running <- struct{}{}
 	_ = notifier.Notify("AgentStarted") // Best effort notification
 
@@ -312,7 +449,27 @@ func (svc *serviceContext) Execute(
 		if shouldReturn {
 			return exitCode
 		}
+		svc.status.setState(connectionReconnecting)
+	}
+}
+
+// deviceboundTopic is the topic cloud-to-device messages for deviceId arrive on.
+func deviceboundTopic(deviceId string) string {
+	return fmt.Sprintf("devices/%s/messages/devicebound/#", deviceId)
+}
+
+// deviceEventsTopic is the topic device-to-cloud events for deviceId are
+// published on.
+func deviceEventsTopic(deviceId string) string {
+	return fmt.Sprintf("devices/%s/messages/events/", deviceId)
+}
+
+// subscribeQos is the QoS the agent subscribes to its devicebound topic with.
+func subscribeQos(device agent.Device) byte {
+	if device.MqttQos != nil {
+		return *device.MqttQos
 	}
+	return 1
 }
 
 // runCycle runs one MQTT connection attempt through to disconnect. It returns
@@ -403,11 +560,14 @@ func (svc *serviceContext) runCycle(
 		lost <- struct{}{}
 	}
 
-	topic := fmt.Sprintf("devices/%s/messages/devicebound/#", device.DeviceId)
-	qos := byte(1)
-	if device.MqttQos != nil {
-		qos = *device.MqttQos
+	topic := deviceboundTopic(device.DeviceId)
+	qos := subscribeQos(device)
+
+	brokerUrl := ""
+	if len(opts.Servers) > 0 {
+		brokerUrl = opts.Servers[0].String()
 	}
+	svc.status.startCycle(brokerUrl, topic, msgQueue)
 
 	disconnectQuiesce := (uint)(mqtt.DefaultDisconnectQuiesce / time.Millisecond)
 	client := mqtt.NewClient(opts)
@@ -511,16 +671,15 @@ func (svc *serviceContext) runCycle(
 		return false, false, 0
 	}
 	subscribed = true
+	svc.status.setState(connectionConnected)
 
 	logger.Info("Subscribed to messages", "topic", topic, "qos", qos)
 	_ = notifier.Notify("AgentStatus:Online") // Best effort notification
 
-	// Now that connectivity is restored, re-attempt any postbacks that were
-	// spooled to disk when the engine was previously unreachable. Run it on a
-	// cycle-scoped goroutine so it cannot block the connection loop or teardown.
-	utils.SafeGo(logger, func() {
-		svc.flushPostbackSpool(cycleCtx, device, logger)
-	}, "scope", "postback_spool_flush")
+	// Now that connectivity is restored, have the drainer re-attempt any
+	// postbacks spooled while the engine was unreachable without waiting out
+	// its backoff.
+	svc.drainer.kick()
 
 	// Proactively renew the SAS token before Azure IoT Hub expires it. The token
 	// minted for this connection is valid for device.SasTokenLifetime(); Azure
@@ -652,10 +811,21 @@ func (svc *serviceContext) processMessage(
 		return
 	}
 
+	defer svc.status.beginCommand(message.PostId)()
+
 	_ = notifier.Notify(
 		buildReceivedMessageNotification(payload),
 	) // Best effort notification
 
+	// Output past the ceiling can only be uploaded when the result referencing
+	// it is posted back.
+	if message.PostId != "" && (!device.DisableAgentPostback || svc.Executor.AlwaysPostback()) {
+		message.Uploader = &failoverUploader{
+			OutputUploader: &interpreter.ChunkedUploader{Client: svc.HTTPClient},
+			failover:       svc.failover,
+		}
+	}
+
 	// Execute the message
 	resultBytes := message.Execute(
 		svc.Executor,
@@ -733,13 +903,29 @@ func postbackRetryBackoff(base, maxBackoff time.Duration, attempt int) time.Dura
 	return backoff
 }
 
+// priorityAttempts scales the in-line attempt budget by priority: a
+// high-priority result gets twice the attempts before it is spooled, a
+// low-priority one half (at least one).
+func priorityAttempts(attempts int, priority string) int {
+	switch priority {
+	case interpreter.PriorityHigh:
+		return attempts * 2
+	case interpreter.PriorityLow:
+		return max(attempts/2, 1)
+	default:
+		return attempts
+	}
+}
+
 // sendPostbackWithRetry posts the command result to the Rewst engine, retrying
-// transient failures (network errors and 5xx responses) with exponential
+// transient failures (network errors, 5xx and 429 responses) with exponential
 // backoff. Non-retryable responses (2xx success, 400 "already fulfilled", and
 // other 4xx errors) terminate the loop immediately. When all in-line attempts
 // fail the result is not silently dropped: the failure is surfaced via a
 // best-effort AgentPostbackFailed plugin notification and the result is spooled
-// to disk for re-attempt on a later cycle.
+// to disk for re-attempt on a later cycle. While the circuit breaker is open no
+// attempt is made and the result is spooled at once. The message's priority
+// scales the number of attempts (see priorityAttempts).
 func (svc *serviceContext) sendPostbackWithRetry(
 	ctx context.Context,
 	message *interpreter.Message,
@@ -752,11 +938,15 @@ func (svc *serviceContext) sendPostbackWithRetry(
 	if maxAttempts < 1 {
 		maxAttempts = postbackMaxAttempts
 	}
+	maxAttempts = priorityAttempts(maxAttempts, message.ResolvedPriority())
 	baseBackoff := svc.PostbackBaseRetryBackoff
 	if baseBackoff <= 0 {
 		baseBackoff = postbackBaseRetryBackoff
 	}
 
+	// Compressed once for every attempt and host
+	body, encoding := compressPostbackBody(device, resultBytes, message.PostId, logger, true)
+
 	var lastErr error
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		if attempt > 1 {
@@ -781,7 +971,15 @@ func (svc *serviceContext) sendPostbackWithRetry(
 			}
 		}
 
-		done, err := svc.attemptPostback(ctx, message, device, resultBytes, logger, attempt)
+		// While the engine is known to be down, spool at once instead of holding
+		// the worker for the rest of the retry budget.
+		if ok, _ := svc.breaker.allow(); !ok {
+			svc.spoolPostback(message, resultBytes, logger, "circuit_open")
+			return
+		}
+
+		done, err := svc.attemptPostbackBody(ctx, message, device, body, encoding, logger, attempt)
+		svc.breaker.record(ctx, done, err)
 		if done {
 			return
 		}
@@ -801,8 +999,23 @@ func (svc *serviceContext) sendPostbackWithRetry(
 		fmt.Sprintf("AgentPostbackFailed:%s", message.PostId),
 	) // Best effort notification
 
+	svc.spoolPostback(message, resultBytes, logger, "retries_exhausted")
+}
+
+// spoolPostback persists a result whose postback did not go through for the
+// drainer to deliver later. reason is logged with it.
+func (svc *serviceContext) spoolPostback(
+	message *interpreter.Message,
+	resultBytes []byte,
+	logger hclog.Logger,
+	reason string,
+) {
 	if svc.spool == nil {
-		logger.Error("Postback result dropped: no spool configured", "post_id", message.PostId)
+		logger.Error(
+			"Postback result dropped: no spool configured",
+			"post_id", message.PostId,
+			"reason", reason,
+		)
 		return
 	}
 
@@ -810,6 +1023,7 @@ func (svc *serviceContext) sendPostbackWithRetry(
 		PostId:    message.PostId,
 		Result:    resultBytes,
 		CreatedAt: time.Now(),
+		Priority:  message.ResolvedPriority(),
 	}); err != nil {
 		logger.Error(
 			"Postback result dropped: failed to spool for later delivery",
@@ -822,34 +1036,50 @@ func (svc *serviceContext) sendPostbackWithRetry(
 	logger.Warn(
 		"Postback result spooled for later delivery",
 		"post_id", message.PostId,
+		"reason", reason,
 	)
 }
 
-// flushPostbackSpool re-attempts delivery of any command results whose in-line
-// postback previously exhausted its retry budget and was spooled to disk. Each
-// entry is given a single attempt: a success or permanent (4xx) rejection
-// removes it from the spool, while a transient failure leaves it (and the rest)
-// for a later cycle. It is bound to the cycle context so it neither blocks the
-// connection loop nor delays teardown — cycle cancellation aborts any in-flight
-// request and stops the flush between entries.
+// flushPostbackSpool makes one drain pass over the command results whose
+// in-line postback previously exhausted its retry budget and was spooled to
+// disk, with the concurrency and rate configured for device. Each entry is
+// given a single attempt: a success or permanent (4xx) rejection removes it
+// from the spool, while a transient failure ends the pass and leaves the rest
+// for the drainer's next one. Cancelling ctx aborts in-flight requests.
 func (svc *serviceContext) flushPostbackSpool(
 	ctx context.Context,
 	device agent.Device,
 	logger hclog.Logger,
-) {
+) spoolDrainPass {
 	if svc.spool == nil {
-		return
+		return spoolDrainPass{}
 	}
-	svc.spool.flush(ctx, func(entry spoolEntry) (bool, error) {
-		msg := &interpreter.Message{PostId: entry.PostId}
-		return svc.attemptPostback(ctx, msg, device, entry.Result, logger, 1)
-	})
+	return svc.spool.drain(
+		ctx,
+		device.ResolvedSpoolDrainConcurrency(),
+		device.ResolvedSpoolDrainInterval(),
+		func(ctx context.Context, entry spoolEntry) (bool, error) {
+			// An open breaker ends the pass until its probe is due, so the drainer
+			// is the one to probe the engine when nothing else is being sent.
+			if ok, wait := svc.breaker.allow(); !ok {
+				return false, &retryAfterError{err: errPostbackCircuitOpen, after: wait}
+			}
+			msg := &interpreter.Message{PostId: entry.PostId}
+			done, err := svc.attemptPostback(ctx, msg, device, entry.Result, logger, 1)
+			svc.breaker.record(ctx, done, err)
+			return done, err
+		},
+	)
 }
 
 // attemptPostback performs a single postback attempt. It returns done=true
 // when no further retries should occur (success, "already fulfilled", or a
 // non-retryable 4xx response). When done=false the caller should retry; the
 // returned error describes the most recent failure for the final summary log.
+//
+// The attempt fails over through the device's engine hosts: a transient
+// failure on one host moves on to the next at once, so it only fails when no
+// host answers.
 func (svc *serviceContext) attemptPostback(
 	ctx context.Context,
 	message *interpreter.Message,
@@ -857,11 +1087,81 @@ func (svc *serviceContext) attemptPostback(
 	resultBytes []byte,
 	logger hclog.Logger,
 	attempt int,
+) (bool, error) {
+	body, encoding := compressPostbackBody(
+		device,
+		resultBytes,
+		message.PostId,
+		logger,
+		attempt == 1,
+	)
+	return svc.attemptPostbackBody(ctx, message, device, body, encoding, logger, attempt)
+}
+
+// attemptPostbackBody is attemptPostback with the body already compressed,
+// sent with the Content-Encoding encoding when it is set, so retries and
+// failover reuse one compressed body.
+func (svc *serviceContext) attemptPostbackBody(
+	ctx context.Context,
+	message *interpreter.Message,
+	device agent.Device,
+	body []byte,
+	encoding string,
+	logger hclog.Logger,
+	attempt int,
+) (bool, error) {
+	hosts := svc.failover.hosts(device)
+
+	var err error
+	for i, host := range hosts {
+		hostDevice := device
+		hostDevice.RewstEngineHost = host
+
+		var done bool
+		done, err = svc.attemptPostbackHost(
+			ctx,
+			message,
+			hostDevice,
+			body,
+			encoding,
+			logger,
+			attempt,
+		)
+		if done {
+			svc.failover.succeeded(host)
+			return true, err
+		}
+		if ctx.Err() != nil {
+			return false, err
+		}
+		svc.failover.failed(host)
+		if i+1 < len(hosts) {
+			logger.Warn(
+				"Postback failing over to the next engine host",
+				"post_id", message.PostId,
+				"from", host,
+				"to", hosts[i+1],
+				"error", err,
+			)
+		}
+	}
+	return false, err
+}
+
+// attemptPostbackHost posts the body to device.RewstEngineHost once.
+func (svc *serviceContext) attemptPostbackHost(
+	ctx context.Context,
+	message *interpreter.Message,
+	device agent.Device,
+	body []byte,
+	encoding string,
+	logger hclog.Logger,
+	attempt int,
 ) (bool, error) {
 	postbackReq, err := message.CreatePostbackRequest(
 		ctx,
 		device,
-		bytes.NewReader(resultBytes),
+		bytes.NewReader(body),
 	)
 	if err != nil {
 		logger.Error(
@@ -872,6 +1172,18 @@ func (svc *serviceContext) attemptPostback(
 		)
 		return true, err
 	}
+	if encoding != "" {
+		postbackReq.Header.Set("Content-Encoding", encoding)
+	}
+	if err := message.SignPostbackRequest(postbackReq, device, body, time.Now()); err != nil {
+		logger.Error(
+			"Failed to sign postback request",
+			"post_id", message.PostId,
+			"attempt", attempt,
+			"error", err,
+		)
+		return true, err
+	}
 
 	if attempt == 1 {
 		logger.Info("Sending postback", "post_id", message.PostId, "url", postbackReq.URL)
@@ -921,10 +1233,12 @@ func (svc *serviceContext) attemptPostback(
 		return true, nil
 	}
 
-	// 5xx responses (and any other unexpected non-2xx without a parseable body)
-	// are treated as transient. 4xx responses with a parseable error body are
-	// terminal — retrying a malformed request will not help.
-	retryable := res.StatusCode >= 500 || parseErr != nil
+	// 5xx and 429 responses (and any other unexpected non-2xx without a
+	// parseable body) are treated as transient. Other 4xx responses with a
+	// parseable error body are terminal — retrying a malformed request will not
+	// help.
+	retryable := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests ||
+		parseErr != nil
 
 	if retryable {
 		logger.Error(
@@ -937,7 +1251,11 @@ func (svc *serviceContext) attemptPostback(
 		if parseErr != nil && len(bodyBytes) > 0 {
 			logger.Error("Received error response", "data", string(bodyBytes))
 		}
-		return false, fmt.Errorf("postback failed: status %d: %s", res.StatusCode, response.Error)
+		err := fmt.Errorf("postback failed: status %d: %s", res.StatusCode, response.Error)
+		if after, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+			return false, &retryAfterError{err: err, after: after}
+		}
+		return false, err
 	}
 
 	logger.Error(
@@ -950,6 +1268,47 @@ func (svc *serviceContext) attemptPostback(
 	return true, fmt.Errorf("postback failed: status %d: %s", res.StatusCode, response.Error)
 }
 
+// maxRetryAfter caps how long a Retry-After from the engine can hold off
+// delivery, so a bogus header cannot park results for days.
+const maxRetryAfter = time.Hour
+
+// retryAfterError is a transient postback failure for which the engine, or an
+// open circuit breaker, said when to try again.
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.err, e.after)
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// parseRetryAfter parses a Retry-After header given either as seconds or as
+// an HTTP date, capped at maxRetryAfter. ok is false when the header is
+// missing or invalid.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	var after time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		after = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		after = max(at.Sub(now), 0)
+	} else {
+		return 0, false
+	}
+	return min(after, maxRetryAfter), true
+}
+
 func runService(params *serviceContext) {
 	exitCode, _ := service.Run(params)
 	os.Exit(exitCode)
@@ -0,0 +1,41 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// lookupServiceAccount returns the uid and gid of the account the service was
+// registered to run as.
+func lookupServiceAccount(username string) (uid int, gid int, err error) {
+	account, err := user.Lookup(username)
+	if err != nil {
+		return 0, 0, err
+	}
+	uid, err = strconv.Atoi(account.Uid)
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err = strconv.Atoi(account.Gid)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uid, gid, nil
+}
+
+// grantServiceAccount hands path to the service account, which could not read
+// a config file written 0600 by root otherwise. It does nothing for a service
+// that runs as root.
+func grantServiceAccount(path string, username string) error {
+	if username == "" {
+		return nil
+	}
+	uid, gid, err := lookupServiceAccount(username)
+	if err != nil {
+		return err
+	}
+	return os.Chown(path, uid, gid)
+}
@@ -0,0 +1,7 @@
+//go:build windows
+
+package main
+
+// grantServiceAccount is a no-op on Windows, where the config file inherits
+// the ProgramData ACL and the file mode does not restrict reading.
+func grantServiceAccount(string, string) error { return nil }
@@ -37,6 +37,22 @@ type serviceContext struct {
 	// case exhausted results are surfaced via log and plugin notification only.
 	spool *postbackSpool
 
+	// drainer delivers spooled results in the background. It is nil when there
+	// is no spool.
+	drainer *spoolDrainer
+
+	// breaker is the process-wide postback circuit breaker. It may be nil (e.g.
+	// in unit tests), in which case every postback is attempted.
+	breaker *postbackBreaker
+
+	// failover picks the engine host each postback goes to. It may be nil (e.g.
+	// in unit tests), in which case the hosts are tried in configured order.
+	failover *engineFailover
+
+	// status keeps the runtime status file read by --status up to date. It may
+	// be nil (e.g. in unit tests), in which case status tracking is skipped.
+	status *statusTracker
+
 	// droppedMessages counts inbound messages the agent could not accept and had
 	// to discard. Under normal operation the subscribe callback applies
 	// back-pressure instead of dropping, so this only increments when a payload
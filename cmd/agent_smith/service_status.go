@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/version"
+	"github.com/RewstApp/agent-smith-go/plugins"
+	"github.com/hashicorp/go-hclog"
+)
+
+// statusFileName is the status file's name inside the agent data directory; see
+// agent.GetStatusFilePath.
+const statusFileName = "status.json"
+
+// The status file lists the commands the agent is running, so it is readable
+// by the service account only. A data directory that already exists keeps its
+// mode.
+const (
+	statusDirMod  os.FileMode = 0o700
+	statusFileMod os.FileMode = 0o600
+)
+
+// statusWriteInterval is how often the service refreshes the status snapshot
+// between state changes, keeping in-flight command ages and queue and spool
+// depths current for --status.
+const statusWriteInterval = 5 * time.Second
+
+// Connection states reported in the status snapshot.
+const (
+	connectionStarting     = "starting"
+	connectionConnecting   = "connecting"
+	connectionConnected    = "connected"
+	connectionReconnecting = "reconnecting"
+	connectionStopped      = "stopped"
+)
+
+// statusSnapshot is the runtime state the service writes to the status file
+// and the --status mode reads back.
+type statusSnapshot struct {
+	UpdatedAt       time.Time              `json:"updated_at"`
+	Pid             int                    `json:"pid"`
+	Version         string                 `json:"version"`
+	StartedAt       time.Time              `json:"started_at"`
+	ConnectionState string                 `json:"connection_state"`
+	BrokerUrl       string                 `json:"broker_url,omitempty"`
+	Topic           string                 `json:"topic,omitempty"`
+	CycleStartedAt  *time.Time             `json:"cycle_started_at,omitempty"`
+	InFlight        []inFlightCommand      `json:"in_flight_commands"`
+	QueueDepth      int                    `json:"queue_depth"`
+	QueueCapacity   int                    `json:"queue_capacity"`
+	SpoolDepth      int                    `json:"spool_depth"`
+	SpoolDrain      *spoolDrainStatus      `json:"spool_drain,omitempty"`
+	PostbackBreaker *postbackBreakerStatus `json:"postback_breaker,omitempty"`
+	EngineFailover  *engineFailoverStatus  `json:"engine_failover,omitempty"`
+	DroppedMessages int64                  `json:"dropped_messages"`
+	Plugins         []pluginStatus         `json:"plugins"`
+	LastUpdateCheck *updateCheck           `json:"last_update_check,omitempty"`
+}
+
+// inFlightCommand describes a message a worker is currently executing.
+type inFlightCommand struct {
+	PostId         string    `json:"post_id,omitempty"`
+	StartedAt      time.Time `json:"started_at"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+}
+
+// pluginStatus reports a loaded plugin alongside the cumulative notifier
+// health counters shared by all plugins.
+type pluginStatus struct {
+	Name            string `json:"name"`
+	NotifyFailures  int64  `json:"notify_failures"`
+	Restarts        int64  `json:"restarts"`
+	RestartFailures int64  `json:"restart_failures"`
+}
+
+// updateCheck is the outcome of the most recent auto-update check.
+type updateCheck struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// updateChecker reports the most recent update check; *agent.AutoUpdateRunner
+// satisfies it.
+type updateChecker interface {
+	LastCheck() (time.Time, error)
+}
+
+// statusTracker collects the runtime state of the service and persists it as
+// an atomically replaced JSON file. Every method is a no-op on a nil tracker so
+// tests that build a serviceContext directly need not provide one.
+type statusTracker struct {
+	path      string
+	logger    hclog.Logger
+	startedAt time.Time
+
+	spool    *postbackSpool
+	drainer  *spoolDrainer
+	breaker  *postbackBreaker
+	failover *engineFailover
+	dropped  func() int64
+	notifier plugins.NotifierWrapper
+	updates  updateChecker
+
+	// writeMu serializes writes so the periodic refresh and a state change
+	// never race on the temporary file.
+	writeMu sync.Mutex
+
+	mu             sync.Mutex
+	state          string
+	brokerUrl      string
+	topic          string
+	cycleStartedAt time.Time
+	queue          chan []byte
+	nextCommand    uint64
+	inFlight       map[uint64]inFlightCommand
+}
+
+func newStatusTracker(path string, logger hclog.Logger) *statusTracker {
+	return &statusTracker{
+		path:      path,
+		logger:    logger,
+		startedAt: time.Now(),
+		state:     connectionStarting,
+		inFlight:  map[uint64]inFlightCommand{},
+	}
+}
+
+// setState records a connection state change and writes the snapshot at once
+// so --status never lags behind a connect or disconnect.
+func (t *statusTracker) setState(state string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.state = state
+	t.mu.Unlock()
+
+	t.write()
+}
+
+// startCycle records the broker, topic and message queue of a new connection
+// cycle.
+func (t *statusTracker) startCycle(brokerUrl, topic string, queue chan []byte) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.brokerUrl = brokerUrl
+	t.topic = topic
+	t.cycleStartedAt = time.Now()
+	t.queue = queue
+	t.mu.Unlock()
+
+	t.setState(connectionConnecting)
+}
+
+// beginCommand registers a command as in flight and returns the function that
+// removes it again once the command (and its postback) has finished.
+func (t *statusTracker) beginCommand(postId string) func() {
+	if t == nil {
+		return func() {}
+	}
+
+	t.mu.Lock()
+	t.nextCommand++
+	id := t.nextCommand
+	t.inFlight[id] = inFlightCommand{PostId: postId, StartedAt: time.Now()}
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		delete(t.inFlight, id)
+		t.mu.Unlock()
+	}
+}
+
+// snapshot assembles the current status.
+func (t *statusTracker) snapshot() statusSnapshot {
+	now := time.Now()
+
+	t.mu.Lock()
+	snap := statusSnapshot{
+		UpdatedAt:       now,
+		Pid:             os.Getpid(),
+		Version:         version.Version,
+		StartedAt:       t.startedAt,
+		ConnectionState: t.state,
+		BrokerUrl:       t.brokerUrl,
+		Topic:           t.topic,
+		InFlight:        make([]inFlightCommand, 0, len(t.inFlight)),
+		Plugins:         []pluginStatus{},
+	}
+	if !t.cycleStartedAt.IsZero() {
+		cycleStartedAt := t.cycleStartedAt
+		snap.CycleStartedAt = &cycleStartedAt
+	}
+	if t.queue != nil {
+		snap.QueueDepth = len(t.queue)
+		snap.QueueCapacity = cap(t.queue)
+	}
+	for _, cmd := range t.inFlight {
+		cmd.ElapsedSeconds = now.Sub(cmd.StartedAt).Seconds()
+		snap.InFlight = append(snap.InFlight, cmd)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(snap.InFlight, func(i, j int) bool {
+		return snap.InFlight[i].StartedAt.Before(snap.InFlight[j].StartedAt)
+	})
+
+	if t.spool != nil {
+		snap.SpoolDepth = t.spool.depth()
+	}
+	if t.drainer != nil {
+		drain := t.drainer.snapshot()
+		snap.SpoolDrain = &drain
+	}
+	if t.breaker != nil {
+		breaker := t.breaker.snapshot()
+		snap.PostbackBreaker = &breaker
+	}
+	if t.failover != nil {
+		failover := t.failover.snapshot()
+		snap.EngineFailover = &failover
+	}
+	if t.dropped != nil {
+		snap.DroppedMessages = t.dropped()
+	}
+	if t.notifier != nil {
+		stats := t.notifier.Stats()
+		for _, name := range t.notifier.Plugins() {
+			snap.Plugins = append(snap.Plugins, pluginStatus{
+				Name:            name,
+				NotifyFailures:  stats.NotifyFailures,
+				Restarts:        stats.Restarts,
+				RestartFailures: stats.RestartFailures,
+			})
+		}
+	}
+	if t.updates != nil {
+		if checkedAt, err := t.updates.LastCheck(); !checkedAt.IsZero() {
+			snap.LastUpdateCheck = &updateCheck{CheckedAt: checkedAt}
+			if err != nil {
+				snap.LastUpdateCheck.Error = err.Error()
+			}
+		}
+	}
+
+	return snap
+}
+
+// write replaces the status file with the current snapshot. The snapshot is
+// written to a temporary file and renamed over the old one so a reader never
+// sees a partial file. Failures are logged at debug level only; the status file
+// is a convenience and must never disturb the service.
+func (t *statusTracker) write() {
+	if t == nil {
+		return
+	}
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	if err := writeStatusFile(t.path, t.snapshot()); err != nil {
+		t.logger.Debug("Failed to write status file", "path", t.path, "error", err)
+	}
+}
+
+// run refreshes the status file every interval until stop is closed.
+func (t *statusTracker) run(stop <-chan struct{}, interval time.Duration) {
+	if t == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t.write()
+		}
+	}
+}
+
+func writeStatusFile(path string, snap statusSnapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal status: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), statusDirMod); err != nil {
+		return fmt.Errorf("create status dir: %w", err)
+	}
+
+	// A temporary file left by a crash would keep its mode through WriteFile
+	tmp := path + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.WriteFile(tmp, data, statusFileMod); err != nil {
+		return fmt.Errorf("write status: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("commit status: %w", err)
+	}
+	return nil
+}
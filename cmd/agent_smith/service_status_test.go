@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+type fixedUpdateChecker struct {
+	checkedAt time.Time
+	err       error
+}
+
+func (c *fixedUpdateChecker) LastCheck() (time.Time, error) {
+	return c.checkedAt, c.err
+}
+
+func readStatusFile(t *testing.T, path string) statusSnapshot {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read status file: %v", err)
+	}
+	var snap statusSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatalf("parse status file: %v", err)
+	}
+	return snap
+}
+
+func TestStatusTracker_WritesSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, statusFileName)
+
+	tracker := newStatusTracker(path, hclog.NewNullLogger())
+	tracker.spool = newPostbackSpool(
+		filepath.Join(dir, "spool"),
+		spoolLimits{maxEntries: 10, maxAge: time.Hour},
+		hclog.NewNullLogger(),
+	)
+	tracker.dropped = func() int64 { return 7 }
+	tracker.notifier = &mockNotifierWrapper{}
+	tracker.updates = &fixedUpdateChecker{
+		checkedAt: time.Now(),
+		err:       errors.New("github unreachable"),
+	}
+
+	_ = tracker.spool.enqueue(spoolEntry{PostId: "spooled", CreatedAt: time.Now()})
+
+	queue := make(chan []byte, 5)
+	queue <- []byte("pending")
+	tracker.startCycle("ssl://hub.example.net:8883", "devices/dev1/#", queue)
+
+	snap := readStatusFile(t, path)
+	if snap.ConnectionState != connectionConnecting {
+		t.Errorf("connection_state = %q, want %q", snap.ConnectionState, connectionConnecting)
+	}
+	if snap.BrokerUrl != "ssl://hub.example.net:8883" || snap.Topic != "devices/dev1/#" {
+		t.Errorf("unexpected broker/topic: %q %q", snap.BrokerUrl, snap.Topic)
+	}
+	if snap.CycleStartedAt == nil {
+		t.Error("expected cycle_started_at to be set")
+	}
+	if snap.QueueDepth != 1 || snap.QueueCapacity != 5 {
+		t.Errorf("queue = %d/%d, want 1/5", snap.QueueDepth, snap.QueueCapacity)
+	}
+	if snap.SpoolDepth != 1 {
+		t.Errorf("spool_depth = %d, want 1", snap.SpoolDepth)
+	}
+	if snap.DroppedMessages != 7 {
+		t.Errorf("dropped_messages = %d, want 7", snap.DroppedMessages)
+	}
+	if snap.LastUpdateCheck == nil || snap.LastUpdateCheck.Error != "github unreachable" {
+		t.Errorf("unexpected last_update_check: %+v", snap.LastUpdateCheck)
+	}
+	if snap.Pid != os.Getpid() {
+		t.Errorf("pid = %d, want %d", snap.Pid, os.Getpid())
+	}
+
+	tracker.setState(connectionConnected)
+	if got := readStatusFile(t, path).ConnectionState; got != connectionConnected {
+		t.Errorf("connection_state = %q after setState, want %q", got, connectionConnected)
+	}
+}
+
+func TestWriteStatusFile_Mode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mode bits are not enforced on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "data", statusFileName)
+
+	// A stale temporary file must not lend its mode to the status file
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".tmp", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStatusFile(path, statusSnapshot{Pid: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != statusFileMod {
+		t.Errorf("status file mode = %v, want %v", info.Mode().Perm(), statusFileMod)
+	}
+
+	// A missing data directory is created for the service account only
+	path = filepath.Join(t.TempDir(), "new", statusFileName)
+	if err := writeStatusFile(path, statusSnapshot{Pid: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info, err = os.Stat(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != statusDirMod {
+		t.Errorf("status dir mode = %v, want %v", info.Mode().Perm(), statusDirMod)
+	}
+}
+
+func TestStatusTracker_InFlightCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), statusFileName)
+	tracker := newStatusTracker(path, hclog.NewNullLogger())
+
+	finishFirst := tracker.beginCommand("post-1")
+	finishSecond := tracker.beginCommand("post-2")
+
+	snap := tracker.snapshot()
+	if len(snap.InFlight) != 2 || snap.InFlight[0].PostId != "post-1" {
+		t.Fatalf("expected two in-flight commands oldest first, got %+v", snap.InFlight)
+	}
+
+	finishFirst()
+	snap = tracker.snapshot()
+	if len(snap.InFlight) != 1 || snap.InFlight[0].PostId != "post-2" {
+		t.Errorf("expected only post-2 in flight, got %+v", snap.InFlight)
+	}
+
+	finishSecond()
+	if snap = tracker.snapshot(); len(snap.InFlight) != 0 {
+		t.Errorf("expected no in-flight commands, got %+v", snap.InFlight)
+	}
+}
+
+func TestStatusTracker_NilIsNoop(t *testing.T) {
+	var tracker *statusTracker
+
+	tracker.setState(connectionConnected)
+	tracker.startCycle("ssl://x", "topic", nil)
+	tracker.beginCommand("post-1")()
+	tracker.write()
+	tracker.run(make(chan struct{}), time.Millisecond)
+}
+
+func TestStatusTracker_RunRefreshesUntilStopped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), statusFileName)
+	tracker := newStatusTracker(path, hclog.NewNullLogger())
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		tracker.run(stop, 10*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("status file was never written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after stop")
+	}
+}
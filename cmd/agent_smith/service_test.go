@@ -155,6 +155,19 @@ func TestLoadConfig_MqttQos(t *testing.T) {
 	}
 }
 
+func TestLoadConfig_RejectsInvalidSyslogSettings(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	configBytes, _ := json.Marshal(agent.Device{DeviceId: "test-device", SyslogTransport: "udp"})
+	if err := os.WriteFile(configPath, configBytes, utils.DefaultFileMod); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	svc := &serviceContext{ConfigFile: configPath}
+	if _, err := svc.loadConfig(); err == nil {
+		t.Error("expected error for udp syslog transport without an address")
+	}
+}
+
 // TestLoadConfig_FileNotFound tests loadConfig with missing file
 func TestLoadConfig_FileNotFound(t *testing.T) {
 	svc := &serviceContext{
@@ -541,6 +554,12 @@ func TestRunService_ExitCode(t *testing.T) {
 	case <-time.After(3 * time.Second):
 		t.Fatal("Execute did not exit within timeout")
 	}
+
+	// The status file sits next to the config and records the final state.
+	snap := readStatusFile(t, filepath.Join(tmpDir, statusFileName))
+	if snap.ConnectionState != connectionStopped {
+		t.Errorf("expected final state %q, got %q", connectionStopped, snap.ConnectionState)
+	}
 }
 
 // TestLoadConfig_EmptyFile tests loadConfig with empty file
@@ -1437,6 +1456,25 @@ func TestExecute_NoUnsubscribeWhenSubscribeFails(t *testing.T) {
 	}
 }
 
+func TestPriorityAttempts(t *testing.T) {
+	tests := []struct {
+		attempts int
+		priority string
+		want     int
+	}{
+		{5, interpreter.PriorityHigh, 10},
+		{5, interpreter.PriorityNormal, 5},
+		{5, interpreter.PriorityLow, 2},
+		{1, interpreter.PriorityLow, 1},
+	}
+	for _, tt := range tests {
+		if got := priorityAttempts(tt.attempts, tt.priority); got != tt.want {
+			t.Errorf("priorityAttempts(%d, %q) = %d, want %d",
+				tt.attempts, tt.priority, got, tt.want)
+		}
+	}
+}
+
 // TestPostbackRetryBackoff_DefaultScheduleUnchanged verifies that the default
 // configuration (base 1s) still yields the historical ~1s / ~2s schedule for the
 // first two retries. Jitter is bounded to ±25%, so each slot is asserted within
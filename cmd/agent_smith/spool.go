@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/interpreter"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+	"github.com/RewstApp/agent-smith-go/internal/version"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Outcomes --spool replay reports for each entry.
+const (
+	replayDelivered   = "delivered"
+	replayRejected    = "rejected"
+	replayFailed      = "failed"
+	replaySkipped     = "skipped"
+	replayDiscarded   = "discarded"
+	replayQuarantined = "quarantined"
+)
+
+// runSpool runs a --spool subcommand against the postback spool of
+// params.OrgId. The spool is opened the same way the service opens it, so
+// entries are read, delivered and removed under the same rules. Logs go to
+// stderr so the output can be piped.
+func runSpool(params *spoolContext, out io.Writer) error {
+	logger := utils.ConfigureLogger("agent_smith", os.Stderr, utils.Default)
+
+	// Show header
+	logger.Info("Agent Smith started", "version", version.Version, "os", runtime.GOOS)
+
+	// Interrupting stops a replay between entries
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Use the configured limits and the spool key when the config is readable,
+	// so entries are read and expired as the service would. List and purge work
+	// without a config, but cannot show what encrypted entries hold.
+	var device agent.Device
+	configBytes, err := params.FS.ReadFile(agent.GetConfigFilePath(params.OrgId))
+	if err == nil {
+		device, _, err = agent.ParseConfig(configBytes)
+	}
+	if err != nil {
+		logger.Warn("Failed to read config; using default spool limits", "error", err)
+	}
+
+	spool := newPostbackSpool(
+		filepath.Join(agent.GetDataDirectory(params.OrgId), postbackSpoolDirName),
+		deviceSpoolLimits(device),
+		logger,
+	)
+	if err == nil {
+		spool.aead, err = newSpoolCipher(spoolSecretPath(params.OrgId), device, false)
+		if err != nil {
+			logger.Warn("Failed to derive the spool key", "error", err)
+		}
+	}
+	return runSpoolWith(ctx, params, spool, out, logger)
+}
+
+func runSpoolWith(
+	ctx context.Context,
+	params *spoolContext,
+	spool *postbackSpool,
+	out io.Writer,
+	logger hclog.Logger,
+) error {
+	switch params.Spool {
+	case spoolCommandList:
+		return listSpool(spool, out)
+	case spoolCommandShow:
+		return showSpoolEntry(spool, params.EntryId, out)
+	case spoolCommandReplay, spoolCommandPurge:
+		// Hold the spool lock like the service's drainer, so the two never
+		// deliver or remove the same entry
+		unlock, err := spool.lockDir()
+		if errors.Is(err, errSpoolLocked) {
+			return fmt.Errorf(
+				"the service is delivering spooled results; try again when it is done: %w",
+				err,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock the postback spool: %w", err)
+		}
+		defer unlock()
+
+		if params.Spool == spoolCommandReplay {
+			return replaySpool(ctx, params, spool, out, logger)
+		}
+		return purgeSpool(spool, params.EntryId, out)
+	default:
+		return fmt.Errorf("unknown spool command %s", params.Spool)
+	}
+}
+
+func listSpool(spool *postbackSpool, out io.Writer) error {
+	if n := spool.quarantineDepth(); n > 0 {
+		_, _ = fmt.Fprintf(out, "%d corrupt entries quarantined in %s\n",
+			n, filepath.Join(spool.dir, spoolQuarantineDirName))
+	}
+
+	ids := spool.entryIds()
+	if len(ids) == 0 {
+		_, err := io.WriteString(out, "Postback spool is empty\n")
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tPOST ID\tPRIORITY\tCREATED\tSIZE")
+	for _, id := range ids {
+		entry, err := spool.readEntry(id)
+		if err != nil {
+			_, _ = fmt.Fprintf(w, "%s\t(unreadable: %v)\t\t\t\n", id, err)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n",
+			id, entry.PostId, spoolFilePriority(id), entry.CreatedAt.Format(time.RFC3339),
+			len(entry.Result))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(out, "%d entries\n", len(ids))
+	return err
+}
+
+func showSpoolEntry(spool *postbackSpool, id string, out io.Writer) error {
+	entry, err := spool.readEntry(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(
+		out,
+		"ID:       %s\nPost ID:  %s\nPriority: %s\nCreated:  %s\nResult:\n%s\n",
+		id, entry.PostId, spoolFilePriority(id), entry.CreatedAt.Format(time.RFC3339),
+		entry.Result,
+	)
+	return err
+}
+
+// replaySpool gives each entry one postback attempt, in delivery order, with the
+// same rules as the service's spool flush: delivered and rejected entries are
+// removed, corrupt ones are quarantined, expired ones are discarded, ones
+// sealed with another key are skipped, and the first transient failure stops
+// the replay so the remaining entries keep their order.
+func replaySpool(
+	ctx context.Context,
+	params *spoolContext,
+	spool *postbackSpool,
+	out io.Writer,
+	logger hclog.Logger,
+) error {
+	ids := spool.entryIds()
+	if len(ids) == 0 {
+		_, err := io.WriteString(out, "Postback spool is empty\n")
+		return err
+	}
+
+	configFilePath := agent.GetConfigFilePath(params.OrgId)
+	configBytes, err := params.FS.ReadFile(configFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	device, _, err := agent.ParseConfig(configBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", configFilePath, err)
+	}
+
+	svc := &serviceContext{
+		OrgId:      params.OrgId,
+		HTTPClient: params.HTTPClient,
+		failover:   newEngineFailover(logger),
+	}
+	cutoff := time.Now().Add(-spool.maxAge)
+	report := func(id, postId, outcome string, detail error) {
+		if detail != nil {
+			_, _ = fmt.Fprintf(out, "%s %s %s: %v\n", id, postId, outcome, detail)
+			return
+		}
+		_, _ = fmt.Fprintf(out, "%s %s %s\n", id, postId, outcome)
+	}
+
+	left := 0
+	var stopErr, keyErr error
+	for _, id := range ids {
+		if stopErr == nil && ctx.Err() != nil {
+			stopErr = ctx.Err()
+		}
+		if stopErr != nil {
+			report(id, "-", replaySkipped, nil)
+			left++
+			continue
+		}
+
+		entry, err := spool.readEntry(id)
+		if spoolKeyError(err) {
+			// Kept, like the service does, until its name says it expired
+			if ts, ok := spoolFileTime(id + spoolFileSuffix); !ok || !ts.Before(cutoff) {
+				report(id, "-", replaySkipped, err)
+				keyErr = err
+				left++
+				continue
+			}
+			err = fmt.Errorf("older than %s", spool.maxAge)
+		}
+		if err == nil && entry.CreatedAt.Before(cutoff) {
+			err = fmt.Errorf("older than %s", spool.maxAge)
+		}
+		if errors.Is(err, errSpoolCorrupt) {
+			report(id, "-", replayQuarantined, err)
+			spool.quarantine(id+spoolFileSuffix, err)
+			continue
+		}
+		if err != nil {
+			report(id, "-", replayDiscarded, err)
+			if err := spool.discard(id); err != nil {
+				logger.Error("Failed to remove spool entry", "id", id, "error", err)
+			}
+			continue
+		}
+
+		msg := &interpreter.Message{PostId: entry.PostId}
+		done, err := svc.attemptPostback(ctx, msg, device, entry.Result, logger, 1)
+		if !done {
+			report(id, entry.PostId, replayFailed, err)
+			stopErr = err
+			left++
+			continue
+		}
+
+		if err != nil {
+			report(id, entry.PostId, replayRejected, err)
+		} else {
+			report(id, entry.PostId, replayDelivered, nil)
+		}
+		if err := spool.discard(id); err != nil {
+			logger.Error("Failed to remove spool entry", "id", id, "error", err)
+		}
+	}
+
+	if left > 0 {
+		if stopErr == nil {
+			stopErr = keyErr
+		}
+		return fmt.Errorf("%d entries left in the spool: %w", left, stopErr)
+	}
+	return nil
+}
+
+// purgeSpool discards one entry, or every entry when id is empty.
+func purgeSpool(spool *postbackSpool, id string, out io.Writer) error {
+	ids := []string{id}
+	if id == "" {
+		ids = spool.entryIds()
+	}
+
+	var errs []error
+	purged := 0
+	for _, id := range ids {
+		if err := spool.discard(id); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		purged++
+	}
+
+	_, _ = fmt.Fprintf(out, "Purged %d entries\n", purged)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+// Subcommands of --spool.
+const (
+	spoolCommandList   = "list"
+	spoolCommandShow   = "show"
+	spoolCommandReplay = "replay"
+	spoolCommandPurge  = "purge"
+)
+
+type spoolContext struct {
+	OrgId string
+	Spool string
+	// EntryId is the entry show or purge acts on. purge without one empties
+	// the spool.
+	EntryId string
+
+	HTTPClient *http.Client
+	FS         utils.FileSystem
+}
+
+// newSpoolFlagSet builds the flag set for spool mode, binding flags to the
+// provided params. It is shared between argument parsing and usage rendering so
+// that the per-flag descriptions stay in a single place.
+func newSpoolFlagSet(params *spoolContext) *flag.FlagSet {
+	fs := flag.NewFlagSet("spool", flag.ContinueOnError)
+	fs.StringVar(&params.OrgId, "org-id", "", "Organization ID")
+	fs.StringVar(
+		&params.Spool,
+		"spool",
+		"",
+		"Inspect the postback spool: list, show <ID>, replay, or purge [<ID>]",
+	)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func newSpoolContext(
+	args []string,
+	fsys utils.FileSystem,
+) (*spoolContext, error) {
+	var params spoolContext
+
+	fs := newSpoolFlagSet(&params)
+
+	// Flags may follow the entry id, so parse again after each positional
+	// argument
+	var rest []string
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+
+	if params.OrgId == "" {
+		return nil, fmt.Errorf("missing org-id")
+	}
+
+	if params.Spool == "" {
+		return nil, fmt.Errorf("missing spool")
+	}
+
+	switch params.Spool {
+	case spoolCommandShow:
+		if len(rest) != 1 {
+			return nil, fmt.Errorf("spool show requires one entry id")
+		}
+		params.EntryId = rest[0]
+	case spoolCommandPurge:
+		if len(rest) > 1 {
+			return nil, fmt.Errorf("spool purge takes at most one entry id")
+		}
+		if len(rest) == 1 {
+			params.EntryId = rest[0]
+		}
+	case spoolCommandList, spoolCommandReplay:
+		if len(rest) > 0 {
+			return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(rest, " "))
+		}
+	default:
+		return nil, fmt.Errorf("invalid spool: must be list, show, replay or purge")
+	}
+
+	params.HTTPClient = &http.Client{Timeout: postbackHTTPTimeout}
+	params.FS = fsys
+
+	return &params, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewSpoolContext(t *testing.T) {
+	orgId := "test123"
+
+	tests := []struct {
+		args    []string
+		command string
+		entryId string
+	}{
+		{[]string{"--org-id", orgId, "--spool", "list"}, "list", ""},
+		{[]string{"--org-id", orgId, "--spool", "show", "abc"}, "show", "abc"},
+		{[]string{"--spool", "show", "abc", "--org-id", orgId}, "show", "abc"},
+		{[]string{"--org-id", orgId, "--spool", "replay"}, "replay", ""},
+		{[]string{"--org-id", orgId, "--spool", "purge"}, "purge", ""},
+		{[]string{"--org-id", orgId, "--spool", "purge", "abc"}, "purge", "abc"},
+	}
+
+	for _, test := range tests {
+		result, err := newSpoolContext(test.args, nil)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.args, err)
+			continue
+		}
+
+		if result.OrgId != orgId || result.Spool != test.command || result.EntryId != test.entryId {
+			t.Errorf("%v: unexpected context %+v", test.args, result)
+		}
+
+		if result.HTTPClient == nil {
+			t.Errorf("%v: expected an HTTP client", test.args)
+		}
+	}
+
+	errorTests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"--spool", "list"}, "missing org-id"},
+		{[]string{"--org-id", orgId}, "missing spool"},
+		{[]string{"--org-id", orgId, "--spool", "flush"}, "invalid spool"},
+		{[]string{"--org-id", orgId, "--spool", "show"}, "spool show requires one entry id"},
+		{[]string{"--org-id", orgId, "--spool", "purge", "a", "b"}, "at most one entry id"},
+		{[]string{"--org-id", orgId, "--spool", "list", "a"}, "unexpected arguments: a"},
+		{[]string{"--=spool"}, "bad flag syntax"},
+	}
+
+	for _, errorTest := range errorTests {
+		_, err := newSpoolContext(errorTest.args, nil)
+
+		if err == nil || !strings.Contains(err.Error(), errorTest.message) {
+			t.Errorf("expected error %s, got %v", errorTest.message, err)
+		}
+	}
+}
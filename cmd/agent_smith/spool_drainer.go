@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	// spoolDrainIdleInterval is how often an idle drainer looks for new spool
+	// entries. Each look is a directory listing, so it is cheap.
+	spoolDrainIdleInterval = time.Minute
+	// spoolDrainBaseBackoff and spoolDrainMaxBackoff bound the exponential
+	// backoff between drain passes while the engine keeps failing.
+	spoolDrainBaseBackoff = 5 * time.Second
+	spoolDrainMaxBackoff  = 5 * time.Minute
+)
+
+// Drainer states reported in the status snapshot.
+const (
+	spoolDrainIdle       = "idle"
+	spoolDrainDraining   = "draining"
+	spoolDrainBackingOff = "backing_off"
+)
+
+// spoolDrainStatus is the drainer state written to the status file.
+type spoolDrainStatus struct {
+	State               string     `json:"state"`
+	DeliveredTotal      int64      `json:"delivered_total"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	NextAttemptAt       *time.Time `json:"next_attempt_at,omitempty"`
+}
+
+// spoolDrainer delivers spooled postbacks in the background for the lifetime
+// of the service, so results spooled during an outage reach the engine soon
+// after it recovers rather than on the next reconnect. It runs one drain pass
+// at a time: an idle drainer looks for new entries every
+// spoolDrainIdleInterval, a failed pass backs off exponentially, and a
+// Retry-After from the engine replaces the backoff and is honored even when
+// the drainer is kicked.
+type spoolDrainer struct {
+	pass   func(context.Context) spoolDrainPass
+	logger hclog.Logger
+	wake   chan struct{}
+
+	mu     sync.Mutex
+	status spoolDrainStatus
+}
+
+func newSpoolDrainer(
+	pass func(context.Context) spoolDrainPass,
+	logger hclog.Logger,
+) *spoolDrainer {
+	return &spoolDrainer{
+		pass:   pass,
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+		status: spoolDrainStatus{State: spoolDrainIdle},
+	}
+}
+
+// kick starts a drain pass at once and resets the backoff, unless the engine
+// asked to be left alone with Retry-After. It is called when the agent
+// reconnects, which is a good sign the engine is reachable again. It is a
+// no-op on a nil drainer.
+func (d *spoolDrainer) kick() {
+	if d == nil {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run drains the spool until ctx is cancelled. The first pass starts at once.
+func (d *spoolDrainer) run(ctx context.Context) {
+	var delay time.Duration
+	var holdUntil time.Time
+	failures := 0
+
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-d.wake:
+			timer.Stop()
+			if wait := time.Until(holdUntil); wait > 0 {
+				d.logger.Debug(
+					"Postback spool drain kick ignored: engine asked to wait",
+					"retry_after", wait.Round(time.Second),
+				)
+				delay = wait
+				continue
+			}
+			failures = 0
+		}
+
+		d.setState(spoolDrainDraining, time.Time{})
+		pass := d.pass(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if !pass.failed {
+			failures = 0
+			delay = spoolDrainIdleInterval
+			if pass.delivered > 0 {
+				d.logger.Info("Postback spool drained", "delivered", pass.delivered)
+			}
+			d.record(pass, 0, time.Now().Add(delay), spoolDrainIdle)
+			continue
+		}
+
+		failures++
+		delay = postbackRetryBackoff(spoolDrainBaseBackoff, spoolDrainMaxBackoff, failures+1)
+		if pass.retryAfter > 0 {
+			delay = pass.retryAfter
+			holdUntil = time.Now().Add(delay)
+		}
+		d.logger.Warn(
+			"Postback spool drain paused: engine still unreachable",
+			"delivered", pass.delivered,
+			"consecutive_failures", failures,
+			"next_attempt_in", delay.Round(time.Second),
+			"retry_after", pass.retryAfter,
+			"error", pass.err,
+		)
+		d.record(pass, failures, time.Now().Add(delay), spoolDrainBackingOff)
+	}
+}
+
+func (d *spoolDrainer) setState(state string, next time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status.State = state
+	d.status.NextAttemptAt = nil
+	if !next.IsZero() {
+		d.status.NextAttemptAt = &next
+	}
+}
+
+func (d *spoolDrainer) record(pass spoolDrainPass, failures int, next time.Time, state string) {
+	d.mu.Lock()
+	d.status.DeliveredTotal += int64(pass.delivered)
+	d.status.ConsecutiveFailures = failures
+	if pass.err != nil {
+		d.status.LastError = pass.err.Error()
+	}
+	d.mu.Unlock()
+
+	d.setState(state, next)
+}
+
+// snapshot returns the drainer state for the status file.
+func (d *spoolDrainer) snapshot() spoolDrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := d.status
+	if status.NextAttemptAt != nil {
+		next := *status.NextAttemptAt
+		status.NextAttemptAt = &next
+	}
+	return status
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/interpreter"
+	"github.com/hashicorp/go-hclog"
+)
+
+func enqueueTestEntries(t *testing.T, s *postbackSpool, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		err := s.enqueue(spoolEntry{PostId: id, Result: []byte(id), CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("enqueue %s: %v", id, err)
+		}
+	}
+}
+
+// TestSpool_DrainBoundsConcurrency verifies that a drain pass delivers every
+// entry with no more deliveries in flight than its worker count.
+func TestSpool_DrainBoundsConcurrency(t *testing.T) {
+	s := newTestSpool(t, 20, time.Hour)
+	enqueueTestEntries(t, s, "a", "b", "c", "d", "e", "f")
+
+	var inFlight, peak atomic.Int32
+	pass := s.drain(context.Background(), 2, 0, func(context.Context, spoolEntry) (bool, error) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		inFlight.Add(-1)
+		return true, nil
+	})
+
+	if pass.delivered != 6 || pass.failed {
+		t.Errorf("unexpected pass %+v", pass)
+	}
+	if got := peak.Load(); got != 2 {
+		t.Errorf("expected at most 2 deliveries in flight, peak was %d", got)
+	}
+	if n := countSpoolFiles(t, s.dir); n != 0 {
+		t.Errorf("expected spool emptied, %d remain", n)
+	}
+}
+
+func TestSpool_DrainIsRateLimited(t *testing.T) {
+	s := newTestSpool(t, 20, time.Hour)
+	enqueueTestEntries(t, s, "a", "b", "c", "d")
+
+	started := time.Now()
+	deliver := func(context.Context, spoolEntry) (bool, error) { return true, nil }
+	s.drain(context.Background(), 4, 50*time.Millisecond, deliver)
+
+	// Four deliveries started 50ms apart take at least 150ms.
+	if elapsed := time.Since(started); elapsed < 150*time.Millisecond {
+		t.Errorf("drain took %v, expected the rate limit to space deliveries", elapsed)
+	}
+}
+
+// TestSpool_DrainStopsOnFailure verifies that a transient failure stops the
+// pass, keeps the undelivered entries and reports the engine's Retry-After.
+func TestSpool_DrainStopsOnFailure(t *testing.T) {
+	s := newTestSpool(t, 20, time.Hour)
+	enqueueTestEntries(t, s, "a", "b", "c", "d")
+
+	var mu sync.Mutex
+	var attempted []string
+	deliver := func(_ context.Context, e spoolEntry) (bool, error) {
+		mu.Lock()
+		attempted = append(attempted, e.PostId)
+		mu.Unlock()
+		if e.PostId == "b" {
+			return false, &retryAfterError{err: errors.New("busy"), after: 30 * time.Second}
+		}
+		return true, nil
+	}
+	pass := s.drain(context.Background(), 1, 0, deliver)
+
+	if !pass.failed || pass.delivered != 1 || pass.retryAfter != 30*time.Second {
+		t.Errorf("unexpected pass %+v", pass)
+	}
+	// The entry queued to the worker while "b" failed may still be skipped, but
+	// nothing after it is attempted.
+	if len(attempted) > 3 {
+		t.Errorf("expected the pass to stop after the failure, attempted %v", attempted)
+	}
+	if n := countSpoolFiles(t, s.dir); n != 4-pass.delivered {
+		t.Errorf("expected %d entries kept, %d remain", 4-pass.delivered, n)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		expect time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"999999", maxRetryAfter, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.header, now)
+		if got != tt.expect || ok != tt.ok {
+			t.Errorf(
+				"parseRetryAfter(%q) = %v, %v; want %v, %v",
+				tt.header, got, ok, tt.expect, tt.ok,
+			)
+		}
+	}
+}
+
+// TestAttemptPostback_RetryAfter verifies that a 429 is retried and carries the
+// delay the engine asked for.
+func TestAttemptPostback_RetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":"slow down"}`))
+	}))
+	defer srv.Close()
+
+	svc := &serviceContext{
+		HTTPClient: &http.Client{Transport: &schemeRewriteTransport{scheme: "http"}},
+	}
+	msg := &interpreter.Message{PostId: "id:1"}
+	done, err := svc.attemptPostback(
+		context.Background(),
+		msg,
+		deviceWithEngine(srv.Listener.Addr().String()),
+		[]byte(`{}`),
+		hclog.NewNullLogger(),
+		1,
+	)
+
+	var retryAfter *retryAfterError
+	if done || !errors.As(err, &retryAfter) || retryAfter.after != 7*time.Second {
+		t.Errorf("attemptPostback = %v, %v; want a retry after 7s", done, err)
+	}
+}
+
+// TestSpoolDrainer_KickRunsPass verifies that the drainer drains at start and
+// again at once when kicked, and reports what it delivered.
+func TestSpoolDrainer_KickRunsPass(t *testing.T) {
+	passes := make(chan struct{}, 4)
+	d := newSpoolDrainer(func(context.Context) spoolDrainPass {
+		passes <- struct{}{}
+		return spoolDrainPass{delivered: 1}
+	}, hclog.NewNullLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.run(ctx)
+
+	waitForPass(t, passes)
+	d.kick()
+	waitForPass(t, passes)
+
+	waitFor(t, func() bool {
+		s := d.snapshot()
+		return s.State == spoolDrainIdle && s.DeliveredTotal == 2
+	})
+}
+
+// TestSpoolDrainer_HonorsRetryAfter verifies that a kick does not cut short a
+// delay the engine asked for.
+func TestSpoolDrainer_HonorsRetryAfter(t *testing.T) {
+	passes := make(chan struct{}, 4)
+	d := newSpoolDrainer(func(context.Context) spoolDrainPass {
+		passes <- struct{}{}
+		return spoolDrainPass{failed: true, err: errors.New("busy"), retryAfter: time.Hour}
+	}, hclog.NewNullLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.run(ctx)
+
+	waitForPass(t, passes)
+	waitFor(t, func() bool { return d.snapshot().State == spoolDrainBackingOff })
+	d.kick()
+
+	select {
+	case <-passes:
+		t.Fatal("kick started a pass before the engine's Retry-After elapsed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s := d.snapshot()
+	if s.ConsecutiveFailures != 1 || s.LastError != "busy" || s.NextAttemptAt == nil ||
+		time.Until(*s.NextAttemptAt) < 59*time.Minute {
+		t.Errorf("unexpected drainer status %+v", s)
+	}
+}
+
+func waitForPass(t *testing.T, passes <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-passes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a drain pass")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
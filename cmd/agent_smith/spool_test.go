@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/hashicorp/go-hclog"
+)
+
+// newSpoolTestParams returns a context whose config points the engine at
+// engineHost.
+func newSpoolTestParams(command, entryId, engineHost string) *spoolContext {
+	return &spoolContext{
+		OrgId:      "test-org",
+		Spool:      command,
+		EntryId:    entryId,
+		HTTPClient: &http.Client{Transport: &schemeRewriteTransport{scheme: "http"}},
+		FS: &mockFileSystem{
+			readFileFunc: func(name string) ([]byte, error) {
+				if name == agent.GetConfigFilePath("test-org") {
+					return []byte(fmt.Sprintf(`{"rewst_engine_host":%q}`, engineHost)), nil
+				}
+				return nil, os.ErrNotExist
+			},
+		},
+	}
+}
+
+// fillTestSpool enqueues one entry per post id, oldest first, and returns
+// their ids.
+func fillTestSpool(t *testing.T, spool *postbackSpool, postIds ...string) []string {
+	t.Helper()
+	for i, postId := range postIds {
+		err := spool.enqueue(spoolEntry{
+			PostId:    postId,
+			Result:    []byte(`{"output":"` + postId + `"}`),
+			CreatedAt: time.Now().Add(time.Duration(i-len(postIds)) * time.Second),
+		})
+		if err != nil {
+			t.Fatalf("enqueue %s: %v", postId, err)
+		}
+	}
+	return spool.entryIds()
+}
+
+func TestRunSpool_List(t *testing.T) {
+	spool := newTestSpool(t, 10, time.Hour)
+	ids := fillTestSpool(t, spool, "id:1", "id:2")
+	if err := os.WriteFile(filepath.Join(spool.dir, "bad.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+
+	err := runSpoolWith(context.Background(), newSpoolTestParams("list", "", ""), spool, &out,
+		hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := out.String()
+	wants := []string{ids[0], ids[1], "id:1", "id:2", "bad", "unreadable", "3 entries"}
+	for _, want := range wants {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestRunSpool_ListEmpty(t *testing.T) {
+	var out bytes.Buffer
+
+	err := runSpoolWith(context.Background(), newSpoolTestParams("list", "", ""),
+		newTestSpool(t, 10, time.Hour), &out, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "empty") {
+		t.Errorf("expected empty message, got %q", out.String())
+	}
+}
+
+func TestRunSpool_Show(t *testing.T) {
+	spool := newTestSpool(t, 10, time.Hour)
+	ids := fillTestSpool(t, spool, "id:1")
+	var out bytes.Buffer
+
+	err := runSpoolWith(context.Background(), newSpoolTestParams("show", ids[0], ""), spool, &out,
+		hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Post ID:  id:1") ||
+		!strings.Contains(out.String(), `{"output":"id:1"}`) {
+		t.Errorf("expected the entry, got:\n%s", out.String())
+	}
+}
+
+func TestRunSpool_ShowUnknown(t *testing.T) {
+	spool := newTestSpool(t, 10, time.Hour)
+	fillTestSpool(t, spool, "id:1")
+
+	for _, id := range []string{"missing", "../config"} {
+		err := runSpoolWith(context.Background(), newSpoolTestParams("show", id, ""), spool,
+			&bytes.Buffer{}, hclog.NewNullLogger())
+		if err == nil || !strings.Contains(err.Error(), "no spool entry") {
+			t.Errorf("%s: expected no spool entry error, got %v", id, err)
+		}
+	}
+}
+
+func TestRunSpool_Purge(t *testing.T) {
+	spool := newTestSpool(t, 10, time.Hour)
+	ids := fillTestSpool(t, spool, "id:1", "id:2", "id:3")
+	var out bytes.Buffer
+
+	err := runSpoolWith(context.Background(), newSpoolTestParams("purge", ids[1], ""), spool, &out,
+		hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := spool.entryIds(); len(got) != 2 || got[0] != ids[0] || got[1] != ids[2] {
+		t.Errorf("expected only %s purged, left %v", ids[1], got)
+	}
+
+	err = runSpoolWith(context.Background(), newSpoolTestParams("purge", "", ""), spool, &out,
+		hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := spool.depth(); got != 0 {
+		t.Errorf("expected an empty spool, got %d entries", got)
+	}
+	if !strings.Contains(out.String(), "Purged 2 entries") {
+		t.Errorf("expected purge count, got:\n%s", out.String())
+	}
+}
+
+// TestRunSpool_LockedSpool verifies that replay and purge refuse to touch the
+// spool while the service holds its lock, and that the service's drain pass
+// leaves the spool alone while a --spool command holds it.
+func TestRunSpool_LockedSpool(t *testing.T) {
+	spool := newTestSpool(t, 10, time.Hour)
+	fillTestSpool(t, spool, "id:1", "id:2")
+
+	// Another process's view of the same spool
+	other := newPostbackSpool(spool.dir, spoolLimits{maxAge: time.Hour}, hclog.NewNullLogger())
+	unlock, err := other.lockDir()
+	if err != nil {
+		t.Fatalf("lockDir: %v", err)
+	}
+
+	for _, command := range []string{"replay", "purge"} {
+		var out bytes.Buffer
+		err := runSpoolWith(context.Background(), newSpoolTestParams(command, "", "unused"),
+			spool, &out, hclog.NewNullLogger())
+		if !errors.Is(err, errSpoolLocked) {
+			t.Errorf("%s: expected errSpoolLocked, got %v", command, err)
+		}
+	}
+
+	deliver := func(context.Context, spoolEntry) (bool, error) {
+		t.Error("expected no delivery while the spool is locked")
+		return true, nil
+	}
+	pass := spool.drain(context.Background(), 1, 0, deliver)
+	if pass.delivered != 0 || spool.depth() != 2 {
+		t.Errorf("expected the locked spool left alone, got %+v and %d entries",
+			pass, spool.depth())
+	}
+
+	unlock()
+	unlock, err = spool.lockDir()
+	if err != nil {
+		t.Fatalf("expected the lock free once released, got %v", err)
+	}
+	unlock()
+}
+
+func TestRunSpool_Replay(t *testing.T) {
+	statuses := map[string]int{
+		"/webhooks/custom/action/id/1": http.StatusOK,
+		"/webhooks/custom/action/id/2": http.StatusNotFound,
+		"/webhooks/custom/action/id/3": http.StatusServiceUnavailable,
+	}
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		status, ok := statuses[r.URL.Path]
+		if !ok {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"error":"no"}`))
+	}))
+	defer srv.Close()
+
+	spool := newTestSpool(t, 10, time.Hour)
+	ids := fillTestSpool(t, spool, "id:1", "id:2", "id:3", "id:4")
+	var out bytes.Buffer
+
+	err := runSpoolWith(
+		context.Background(),
+		newSpoolTestParams("replay", "", srv.Listener.Addr().String()),
+		spool,
+		&out,
+		hclog.NewNullLogger(),
+	)
+	if err == nil || !strings.Contains(err.Error(), "2 entries left") {
+		t.Errorf("expected 2 entries left, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	wantOutcomes := []string{replayDelivered, replayRejected, replayFailed, replaySkipped}
+	if len(lines) != len(wantOutcomes) {
+		t.Fatalf("expected an outcome per entry, got:\n%s", out.String())
+	}
+	for i, want := range wantOutcomes {
+		if !strings.HasPrefix(lines[i], ids[i]+" ") || !strings.Contains(lines[i], " "+want) {
+			t.Errorf("expected %s for %s, got %q", want, ids[i], lines[i])
+		}
+	}
+
+	if len(requests) != 3 {
+		t.Errorf("expected the replay to stop at the transient failure, got %v", requests)
+	}
+	if got := spool.entryIds(); len(got) != 2 || got[0] != ids[2] || got[1] != ids[3] {
+		t.Errorf("expected the failed and skipped entries kept, got %v", got)
+	}
+}
+
+func TestRunSpool_ReplayQuarantinesCorruptAndDiscardsExpired(t *testing.T) {
+	spool := newTestSpool(t, 10, time.Hour)
+	if err := os.MkdirAll(spool.dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(spool.dir, "bad.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err := spool.enqueue(spoolEntry{PostId: "id:old", CreatedAt: time.Now().Add(-2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := spool.entryIds()[0]
+	var out bytes.Buffer
+
+	err = runSpoolWith(context.Background(), newSpoolTestParams("replay", "", "unused"), spool,
+		&out, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"bad - " + replayQuarantined, old + " - " + replayDiscarded} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, out.String())
+		}
+	}
+	if got := spool.depth(); got != 0 {
+		t.Errorf("expected an empty spool, got %d entries", got)
+	}
+	if got := spool.quarantineDepth(); got != 1 {
+		t.Errorf("expected the corrupt entry quarantined, got %d", got)
+	}
+}
+
+func TestRunSpool_ReplayKeepsEntriesSealedWithAnotherKey(t *testing.T) {
+	sealed := newSealedTestSpool(t, "secret-1")
+	err := sealed.enqueue(spoolEntry{PostId: "id:1", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool := newSealedTestSpool(t, "secret-2")
+	spool.dir = sealed.dir
+	var out bytes.Buffer
+
+	err = runSpoolWith(context.Background(), newSpoolTestParams("replay", "", "unused"), spool,
+		&out, hclog.NewNullLogger())
+	if !errors.Is(err, errSpoolKeyMismatch) {
+		t.Errorf("expected the key mismatch reported, got %v", err)
+	}
+	if !strings.Contains(out.String(), " "+replaySkipped) {
+		t.Errorf("expected the entry skipped, got:\n%s", out.String())
+	}
+	if spool.depth() != 1 || spool.quarantineDepth() != 0 {
+		t.Errorf("expected the entry kept, got %d entries and %d quarantined",
+			spool.depth(), spool.quarantineDepth())
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+)
+
+// statusStaleAfter is how old a snapshot from a service that is not stopped may
+// be before --status warns that the service is probably no longer running.
+const statusStaleAfter = 3 * statusWriteInterval
+
+// runStatus prints the status snapshot written by the service for
+// params.OrgId, as text or, with --json, as the raw snapshot.
+func runStatus(params *statusContext, out io.Writer) error {
+	path := agent.GetStatusFilePath(params.OrgId)
+
+	data, err := params.FS.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no status file at %s; has the agent service started?", path)
+	}
+	if err != nil {
+		return fmt.Errorf("read status file: %w", err)
+	}
+
+	var snap statusSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("parse status file %s: %w", path, err)
+	}
+
+	if params.Json {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snap)
+	}
+
+	_, err = io.WriteString(out, formatStatus(params.OrgId, snap, time.Now()))
+	return err
+}
+
+// formatStatus renders a snapshot for humans. now is passed in so ages are
+// deterministic in tests.
+func formatStatus(orgId string, snap statusSnapshot, now time.Time) string {
+	var b strings.Builder
+	row := func(label, value string) {
+		fmt.Fprintf(&b, "  %-19s %s\n", label+":", value)
+	}
+	age := func(t time.Time) string {
+		return now.Sub(t).Round(time.Second).String()
+	}
+	stamp := func(t time.Time) string {
+		return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), age(t))
+	}
+
+	fmt.Fprintf(&b, "Agent status (org: %s)\n", orgId)
+	row("Updated", stamp(snap.UpdatedAt))
+	row("Version", fmt.Sprintf("%s (pid %d)", snap.Version, snap.Pid))
+	row("Service started", stamp(snap.StartedAt))
+	row("Connection", snap.ConnectionState)
+	row("Broker", strOrNA(snap.BrokerUrl))
+	row("Topic", strOrNA(snap.Topic))
+	if snap.CycleStartedAt != nil {
+		row("Cycle started", stamp(*snap.CycleStartedAt))
+	} else {
+		row("Cycle started", "N/A")
+	}
+	row("Message queue", fmt.Sprintf("%d/%d", snap.QueueDepth, snap.QueueCapacity))
+	row("Spooled postbacks", fmt.Sprint(snap.SpoolDepth))
+	if drain := snap.SpoolDrain; drain != nil {
+		value := fmt.Sprintf("%s (delivered: %d", drain.State, drain.DeliveredTotal)
+		if drain.ConsecutiveFailures > 0 {
+			value += fmt.Sprintf(", failures: %d", drain.ConsecutiveFailures)
+		}
+		if drain.NextAttemptAt != nil {
+			value += fmt.Sprintf(", next attempt: %s", drain.NextAttemptAt.Format(time.RFC3339))
+		}
+		row("Spool drainer", value+")")
+	}
+	if breaker := snap.PostbackBreaker; breaker != nil {
+		value := breaker.State
+		if breaker.ConsecutiveFailures > 0 {
+			value += fmt.Sprintf(" (failures: %d", breaker.ConsecutiveFailures)
+			if breaker.ProbeAt != nil {
+				value += fmt.Sprintf(", probe at: %s", breaker.ProbeAt.Format(time.RFC3339))
+			}
+			value += ")"
+		}
+		row("Postback circuit", value)
+	}
+	if failover := snap.EngineFailover; failover != nil && failover.PreferredHost != "" {
+		value := failover.PreferredHost
+		if len(failover.UnreachableHosts) > 0 {
+			unreachable := strings.Join(failover.UnreachableHosts, ", ")
+			value += fmt.Sprintf(" (unreachable: %s)", unreachable)
+		}
+		row("Engine host", value)
+	}
+	row("Dropped messages", fmt.Sprint(snap.DroppedMessages))
+
+	switch {
+	case snap.LastUpdateCheck == nil:
+		row("Last update check", "N/A")
+	case snap.LastUpdateCheck.Error != "":
+		row("Last update check", fmt.Sprintf(
+			"%s (failed: %s)",
+			snap.LastUpdateCheck.CheckedAt.Format(time.RFC3339),
+			snap.LastUpdateCheck.Error,
+		))
+	default:
+		row("Last update check", snap.LastUpdateCheck.CheckedAt.Format(time.RFC3339))
+	}
+
+	if len(snap.Plugins) == 0 {
+		row("Plugins", "none")
+	} else {
+		row("Plugins", "")
+		for _, p := range snap.Plugins {
+			fmt.Fprintf(
+				&b,
+				"    %s (notify failures: %d, restarts: %d, restart failures: %d)\n",
+				p.Name,
+				p.NotifyFailures,
+				p.Restarts,
+				p.RestartFailures,
+			)
+		}
+	}
+
+	row("In-flight commands", fmt.Sprint(len(snap.InFlight)))
+	for _, cmd := range snap.InFlight {
+		// Elapsed time is measured from the snapshot, not from when it was written.
+		elapsed := now.Sub(cmd.StartedAt).Round(time.Second)
+		fmt.Fprintf(&b, "    %s running for %s\n", strOrNA(cmd.PostId), elapsed)
+	}
+
+	if snap.ConnectionState != connectionStopped && now.Sub(snap.UpdatedAt) > statusStaleAfter {
+		fmt.Fprintf(
+			&b,
+			"\nWarning: status was last updated %s ago; the service may not be running.\n",
+			age(snap.UpdatedAt),
+		)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+type statusContext struct {
+	OrgId  string
+	Status bool
+	Json   bool
+
+	FS utils.FileSystem
+}
+
+// newStatusFlagSet builds the flag set for status mode, binding flags to the
+// provided params. It is shared between argument parsing and usage rendering so
+// that the per-flag descriptions stay in a single place.
+func newStatusFlagSet(params *statusContext) *flag.FlagSet {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	fs.StringVar(&params.OrgId, "org-id", "", "Organization ID")
+	fs.BoolVar(&params.Status, "status", false, "Show the runtime status of the agent service")
+	fs.BoolVar(&params.Json, "json", false, "Print the status as JSON")
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func newStatusContext(args []string, fsys utils.FileSystem) (*statusContext, error) {
+	var params statusContext
+
+	fs := newStatusFlagSet(&params)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.OrgId == "" {
+		return nil, fmt.Errorf("missing org-id")
+	}
+
+	if !params.Status {
+		return nil, fmt.Errorf("missing status")
+	}
+
+	params.FS = fsys
+
+	return &params, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewStatusContext(t *testing.T) {
+	orgId := "test123"
+	result, _ := newStatusContext([]string{"--org-id", orgId, "--status", "--json"}, nil)
+
+	if result.OrgId != orgId {
+		t.Errorf("expected %v, got %v", orgId, result.OrgId)
+	}
+
+	if !result.Status || !result.Json {
+		t.Errorf("expected status and json to be set, got %+v", result)
+	}
+
+	errorTests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"--org-id", orgId}, "missing status"},
+		{[]string{"--status"}, "missing org-id"},
+		{[]string{"--=status"}, "bad flag syntax"},
+	}
+
+	for _, errorTest := range errorTests {
+		_, err := newStatusContext(errorTest.args, nil)
+
+		if err == nil || !strings.Contains(err.Error(), errorTest.message) {
+			t.Errorf("expected error %s, got %v", errorTest.message, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+)
+
+func newStatusTestParams(data []byte, readErr error, asJson bool) *statusContext {
+	return &statusContext{
+		OrgId:  "test-org",
+		Status: true,
+		Json:   asJson,
+		FS: &mockFileSystem{
+			readFileFunc: func(name string) ([]byte, error) {
+				if name != agent.GetStatusFilePath("test-org") {
+					return nil, os.ErrNotExist
+				}
+				return data, readErr
+			},
+		},
+	}
+}
+
+func sampleStatusSnapshot(now time.Time) statusSnapshot {
+	cycleStartedAt := now.Add(-10 * time.Minute)
+	return statusSnapshot{
+		UpdatedAt:       now.Add(-2 * time.Second),
+		Pid:             4242,
+		Version:         "v1.2.3",
+		StartedAt:       now.Add(-time.Hour),
+		ConnectionState: connectionConnected,
+		BrokerUrl:       "ssl://hub.example.net:8883",
+		Topic:           "devices/dev1/messages/devicebound/#",
+		CycleStartedAt:  &cycleStartedAt,
+		InFlight: []inFlightCommand{
+			{PostId: "post-1", StartedAt: now.Add(-42 * time.Second)},
+		},
+		QueueDepth:    3,
+		QueueCapacity: 100,
+		SpoolDepth:    2,
+		SpoolDrain: &spoolDrainStatus{
+			State:               spoolDrainBackingOff,
+			DeliveredTotal:      5,
+			ConsecutiveFailures: 2,
+		},
+		PostbackBreaker: &postbackBreakerStatus{
+			State:               breakerOpen,
+			ConsecutiveFailures: 5,
+		},
+		EngineFailover: &engineFailoverStatus{
+			PreferredHost:    "engine-eu.example.com",
+			UnreachableHosts: []string{"engine.example.com"},
+		},
+		Plugins: []pluginStatus{{Name: "notifier", Restarts: 1}},
+		LastUpdateCheck: &updateCheck{
+			CheckedAt: now.Add(-time.Hour),
+			Error:     "rate limited",
+		},
+	}
+}
+
+func TestRunStatus_Json(t *testing.T) {
+	snap := sampleStatusSnapshot(time.Now())
+	data, _ := json.Marshal(snap)
+
+	var out bytes.Buffer
+	if err := runStatus(newStatusTestParams(data, nil, true), &out); err != nil {
+		t.Fatalf("runStatus: %v", err)
+	}
+
+	var got statusSnapshot
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if got.ConnectionState != connectionConnected || got.SpoolDepth != 2 ||
+		len(got.InFlight) != 1 || got.InFlight[0].PostId != "post-1" {
+		t.Errorf("unexpected snapshot: %+v", got)
+	}
+}
+
+func TestRunStatus_Text(t *testing.T) {
+	snap := sampleStatusSnapshot(time.Now())
+	data, _ := json.Marshal(snap)
+
+	var out bytes.Buffer
+	if err := runStatus(newStatusTestParams(data, nil, false), &out); err != nil {
+		t.Fatalf("runStatus: %v", err)
+	}
+
+	for _, want := range []string{
+		"Agent status (org: test-org)",
+		"connected",
+		"ssl://hub.example.net:8883",
+		"3/100",
+		"post-1 running for",
+		"failed: rate limited",
+		"backing_off (delivered: 5, failures: 2)",
+		"open (failures: 5)",
+		"engine-eu.example.com (unreachable: engine.example.com)",
+		"notifier (notify failures: 0, restarts: 1, restart failures: 0)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Warning") {
+		t.Errorf("fresh snapshot must not be reported as stale:\n%s", out.String())
+	}
+}
+
+func TestRunStatus_MissingFile(t *testing.T) {
+	err := runStatus(newStatusTestParams(nil, os.ErrNotExist, false), &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "no status file") {
+		t.Errorf("expected missing status file error, got %v", err)
+	}
+}
+
+func TestRunStatus_ReadError(t *testing.T) {
+	err := runStatus(
+		newStatusTestParams(nil, errors.New("permission denied"), false),
+		&bytes.Buffer{},
+	)
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected read error, got %v", err)
+	}
+}
+
+func TestRunStatus_InvalidJson(t *testing.T) {
+	err := runStatus(newStatusTestParams([]byte("{"), nil, false), &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "parse status file") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
+
+func TestFormatStatus_StaleWarning(t *testing.T) {
+	now := time.Now()
+	snap := sampleStatusSnapshot(now)
+	snap.UpdatedAt = now.Add(-time.Hour)
+
+	if out := formatStatus("test-org", snap, now); !strings.Contains(out, "may not be running") {
+		t.Errorf("expected stale warning, got:\n%s", out)
+	}
+
+	snap.ConnectionState = connectionStopped
+	if out := formatStatus("test-org", snap, now); strings.Contains(out, "may not be running") {
+		t.Errorf("stopped service must not be reported as stale, got:\n%s", out)
+	}
+}
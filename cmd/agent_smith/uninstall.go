@@ -1,84 +1,316 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/mqtt"
+	"github.com/RewstApp/agent-smith-go/internal/service"
 	"github.com/RewstApp/agent-smith-go/internal/utils"
 	"github.com/RewstApp/agent-smith-go/internal/version"
+	"github.com/RewstApp/agent-smith-go/plugins"
+	"github.com/hashicorp/go-hclog"
 )
 
 const serviceExecutableTimeout = time.Second * 5
 
+const (
+	// agentExitTimeout bounds how long uninstall waits for the agent process
+	// to exit after the service is stopped.
+	agentExitTimeout = 30 * time.Second
+
+	agentExitPollInterval = 250 * time.Millisecond
+
+	// deregisterTimeout bounds each step of the uninstall notice to the engine.
+	deregisterTimeout = 10 * time.Second
+)
+
+// deregistrar tells the Rewst engine and the notification plugins that an
+// agent is being uninstalled.
+type deregistrar interface {
+	Deregister(device agent.Device, orgId string, logger hclog.Logger)
+}
+
+type defaultDeregistrar struct{}
+
+// uninstallNotice is the event published to the engine before teardown.
+type uninstallNotice struct {
+	Event     string `json:"event"`
+	DeviceId  string `json:"device_id"`
+	OrgId     string `json:"org_id"`
+	Version   string `json:"version"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Deregister is best effort: failures are logged and never stop the uninstall.
+func (d *defaultDeregistrar) Deregister(device agent.Device, orgId string, logger hclog.Logger) {
+	payload, err := json.Marshal(uninstallNotice{
+		Event:     "agent_uninstalled",
+		DeviceId:  device.DeviceId,
+		OrgId:     orgId,
+		Version:   version.Version,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err == nil {
+		err = publishDeviceEvent(device, payload)
+	}
+	if err != nil {
+		logger.Warn("Failed to notify engine of uninstall", "error", err)
+	} else {
+		logger.Info("Engine notified of uninstall", "device_id", device.DeviceId)
+	}
+
+	notifier, err := plugins.LoadNotifer(device.Plugins, io.Discard, logger)
+	if err != nil {
+		logger.Warn("Failed to load plugin", "error", err)
+	}
+	_ = notifier.Notify("AgentUninstalling") // Best effort notification
+	notifier.Kill()
+}
+
+// publishDeviceEvent sends payload to the engine on the device-to-cloud topic.
+func publishDeviceEvent(device agent.Device, payload []byte) error {
+	opts, err := mqtt.NewClientOptions(device)
+	if err != nil {
+		return err
+	}
+	return mqtt.Publish(
+		opts,
+		deviceEventsTopic(device.DeviceId),
+		subscribeQos(device),
+		payload,
+		deregisterTimeout,
+	)
+}
+
 func runUninstall(params *uninstallContext) {
 	logger := utils.ConfigureLogger("agent_smith", os.Stdout, utils.Default)
 
 	// Show header
 	logger.Info("Agent Smith started", "version", version.Version, "os", runtime.GOOS)
 
-	name := agent.GetServiceName(params.OrgId)
+	orgIds := selectOrgIds(params.OrgId, params.All)
+	if len(orgIds) == 0 {
+		logger.Info("No installed agents found")
+		return
+	}
+
+	for _, orgId := range orgIds {
+		err := uninstallAgent(params, orgId, logger)
+		if err != nil {
+			logger.Error("Failed to uninstall agent", "org_id", orgId, "error", err)
+			continue
+		}
+		logger.Info("Agent uninstalled", "org_id", orgId)
+	}
+}
+
+// uninstallAgent stops the agent of orgId, waits for its process to exit,
+// notifies the engine and plugins, and removes the service and its files.
+func uninstallAgent(params *uninstallContext, orgId string, logger hclog.Logger) error {
+	name := agent.GetServiceName(orgId)
 
-	service, err := params.ServiceManager.Open(name)
+	svc, err := params.ServiceManager.Open(name)
 	if err != nil {
-		logger.Error("Failed to open service", "service", name, "error", err)
-		return
+		return fmt.Errorf("failed to open service %s: %w", name, err)
 	}
 	defer func() {
-		err = service.Close()
+		err := svc.Close()
 		if err != nil {
 			logger.Error("Failed to close service handle", "error", err)
 		}
 	}()
 
-	if service.IsActive() {
+	// The config is read before anything is torn down, for the notices
+	var device *agent.Device
+	if params.Deregistrar != nil {
+		device = readUninstallDevice(params, orgId, logger)
+	}
+
+	if svc.IsActive() {
 		logger.Info("Stopping service", "service", name)
-		err = service.Stop()
+		err = svc.Stop()
 		if err != nil {
-			logger.Error("Failed to stop service", "error", err)
-			return
+			return fmt.Errorf("failed to stop service: %w", err)
 		}
 
 		logger.Info("Service stopped", "service", name)
 	}
 
+	logger.Info("Waiting for agent process to exit")
+	err = waitForAgentExit(svc, orgId, params.ProcessRunning, params.ExitTimeout, logger)
+	if err != nil {
+		return err
+	}
+
+	if device != nil {
+		params.Deregistrar.Deregister(*device, orgId, logger)
+	}
+
 	// Delete the service
-	err = service.Delete()
+	err = svc.Delete()
 	if err != nil {
-		logger.Error("Failed to delete service", "error", err)
-		return
+		return fmt.Errorf("failed to delete service: %w", err)
 	}
 	logger.Info("Service deleted", "service", name)
 
-	// Wait for some time for the service executable to clean up
-	logger.Info("Waiting for service executable to stop")
-	time.Sleep(serviceExecutableTimeout)
-
 	// Delete data directory
-	dataDir := agent.GetDataDirectory(params.OrgId)
-	err = params.FS.RemoveAll(dataDir)
+	err = removeDataDirectory(
+		params,
+		agent.GetDataDirectory(orgId),
+		keptDataFiles(params, orgId),
+		logger,
+	)
 	if err != nil {
-		logger.Error("Failed to delete directory", "directory", dataDir, "error", err)
-		return
+		return err
 	}
-	logger.Info("Directory deleted", "directory", dataDir)
 
-	// Delete program directory
-	programDir := agent.GetProgramDirectory(params.OrgId)
-	err = params.FS.RemoveAll(programDir)
-	if err != nil {
-		logger.Error("Failed to delete directory", "directory", programDir, "error", err)
-		return
+	// Delete program and scripts directories
+	for _, dir := range []string{
+		agent.GetProgramDirectory(orgId),
+		agent.GetScriptsDirectory(orgId),
+	} {
+		err = params.FS.RemoveAll(dir)
+		if err != nil {
+			return fmt.Errorf("failed to delete directory %s: %w", dir, err)
+		}
+		logger.Info("Directory deleted", "directory", dir)
+	}
+
+	return nil
+}
+
+// readUninstallDevice returns the installed config of orgId, or nil if it
+// cannot be read, in which case the notices are skipped.
+func readUninstallDevice(
+	params *uninstallContext,
+	orgId string,
+	logger hclog.Logger,
+) *agent.Device {
+	configFilePath := agent.GetConfigFilePath(orgId)
+	configBytes, err := params.FS.ReadFile(configFilePath)
+	if err == nil {
+		var device agent.Device
+		device, _, err = agent.ParseConfig(configBytes)
+		if err == nil {
+			return &device
+		}
+	}
+	logger.Warn("Skipping uninstall notices: config unreadable",
+		"config", configFilePath, "error", err)
+	return nil
+}
+
+// waitForAgentExit polls the service manager and the process table until the
+// agent has exited, so its files can be removed or it can be started again.
+// It fails after timeout (agentExitTimeout when zero) rather than leaving the
+// caller to act on a running agent. processRunning defaults to
+// agentProcessRunning when nil.
+func waitForAgentExit(
+	svc service.Service,
+	orgId string,
+	processRunning func(string) (bool, error),
+	timeout time.Duration,
+	logger hclog.Logger,
+) error {
+	if timeout == 0 {
+		timeout = agentExitTimeout
+	}
+	if processRunning == nil {
+		processRunning = agentProcessRunning
+	}
+	executablePath := agent.GetAgentExecutablePath(orgId)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		running := svc.IsActive()
+		if !running {
+			var err error
+			running, err = processRunning(executablePath)
+			if err != nil {
+				// Rely on the service manager alone
+				logger.Warn("Failed to check agent process", "error", err)
+				running = false
+			}
+		}
+		if !running {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("agent still running after %s", timeout)
+		}
+		time.Sleep(agentExitPollInterval)
 	}
-	logger.Info("Directory deleted", "directory", programDir)
+}
 
-	// Delete scripts directory
-	scriptsDir := agent.GetScriptsDirectory(params.OrgId)
-	err = params.FS.RemoveAll(scriptsDir)
+// removeDataDirectory deletes dataDir, or only the entries that do not start
+// with one of the kept prefixes.
+func removeDataDirectory(
+	params *uninstallContext,
+	dataDir string,
+	kept []string,
+	logger hclog.Logger,
+) error {
+	if len(kept) == 0 {
+		err := params.FS.RemoveAll(dataDir)
+		if err != nil {
+			return fmt.Errorf("failed to delete directory %s: %w", dataDir, err)
+		}
+		logger.Info("Directory deleted", "directory", dataDir)
+		return nil
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
 	if err != nil {
-		logger.Error("Failed to delete directory", "directory", scriptsDir, "error", err)
-		return
+		return fmt.Errorf("failed to read directory %s: %w", dataDir, err)
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dataDir, entry.Name())
+		if hasAnyPrefix(entry.Name(), kept) {
+			logger.Info("Keeping file", "path", path)
+			continue
+		}
+		err = params.FS.RemoveAll(path)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %w", path, err)
+		}
+	}
+	logger.Info("Directory cleaned", "directory", dataDir)
+	return nil
+}
+
+// keptDataFiles returns the name prefixes of the data files --keep-config and
+// --keep-logs keep. Prefixes also match config backups and rotated logs.
+func keptDataFiles(params *uninstallContext, orgId string) []string {
+	var kept []string
+	if params.KeepConfig {
+		kept = append(kept, filepath.Base(agent.GetConfigFilePath(orgId)))
+	}
+	if params.KeepLogs {
+		kept = append(kept, filepath.Base(agent.GetLogFilePath(orgId)))
+	}
+	return kept
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
 	}
-	logger.Info("Directory deleted", "directory", scriptsDir)
+	return false
 }
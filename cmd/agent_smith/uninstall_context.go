@@ -4,14 +4,28 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/RewstApp/agent-smith-go/internal/service"
 	"github.com/RewstApp/agent-smith-go/internal/utils"
 )
 
 type uninstallContext struct {
-	OrgId     string
-	Uninstall bool
+	OrgId      string
+	Uninstall  bool
+	All        bool
+	KeepLogs   bool
+	KeepConfig bool
+
+	// ProcessRunning reports whether an agent executable is still running.
+	// When nil agentProcessRunning is used.
+	ProcessRunning func(path string) (bool, error)
+	// Deregistrar notifies the engine and plugins before teardown. When nil
+	// no notices are sent.
+	Deregistrar deregistrar
+	// ExitTimeout bounds the wait for the agent to exit. When zero
+	// agentExitTimeout is used.
+	ExitTimeout time.Duration
 
 	ServiceManager service.ServiceManager
 	FS             utils.FileSystem
@@ -24,6 +38,9 @@ func newUninstallFlagSet(params *uninstallContext) *flag.FlagSet {
 	fs := flag.NewFlagSet("uninstall", flag.ContinueOnError)
 	fs.StringVar(&params.OrgId, "org-id", "", "Organization ID")
 	fs.BoolVar(&params.Uninstall, "uninstall", false, "Uninstall the agent")
+	fs.BoolVar(&params.All, "all", false, "Uninstall every agent installed on this host")
+	fs.BoolVar(&params.KeepLogs, "keep-logs", false, "Keep the agent log files")
+	fs.BoolVar(&params.KeepConfig, "keep-config", false, "Keep config.json and its backups")
 	fs.SetOutput(io.Discard)
 	return fs
 }
@@ -42,7 +59,11 @@ func newUninstallContext(
 		return nil, err
 	}
 
-	if params.OrgId == "" {
+	if params.All && params.OrgId != "" {
+		return nil, fmt.Errorf("all cannot be combined with org-id")
+	}
+
+	if params.OrgId == "" && !params.All {
 		return nil, fmt.Errorf("missing org-id")
 	}
 
@@ -50,6 +71,8 @@ func newUninstallContext(
 		return nil, fmt.Errorf("missing uninstall")
 	}
 
+	params.ProcessRunning = agentProcessRunning
+	params.Deregistrar = &defaultDeregistrar{}
 	params.ServiceManager = svcMgr
 	params.FS = fsys
 
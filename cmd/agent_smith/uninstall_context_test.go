@@ -17,6 +17,14 @@ func TestNewUninstallContext(t *testing.T) {
 		t.Errorf("expected true, got false")
 	}
 
+	if result.ProcessRunning == nil {
+		t.Error("expected default process check")
+	}
+
+	if result.Deregistrar == nil {
+		t.Error("expected default deregistrar")
+	}
+
 	errorTests := []struct {
 		args    []string
 		message string
@@ -24,6 +32,7 @@ func TestNewUninstallContext(t *testing.T) {
 		{[]string{"--org-id", orgId}, "missing uninstall"},
 		{[]string{"--uninstall"}, "missing org-id"},
 		{[]string{"--=uninstall"}, "bad flag syntax"},
+		{[]string{"--all", "--org-id", orgId, "--uninstall"}, "all cannot be combined with org-id"},
 	}
 
 	for _, errorTest := range errorTests {
@@ -34,3 +43,22 @@ func TestNewUninstallContext(t *testing.T) {
 		}
 	}
 }
+
+func TestNewUninstallContext_AllAndKeepFlags(t *testing.T) {
+	result, err := newUninstallContext(
+		[]string{"--all", "--uninstall", "--keep-logs", "--keep-config"},
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !result.All || !result.KeepLogs || !result.KeepConfig {
+		t.Errorf("expected all, keep-logs and keep-config set, got %+v", result)
+	}
+
+	if result.OrgId != "" {
+		t.Errorf("expected no org-id, got %v", result.OrgId)
+	}
+}
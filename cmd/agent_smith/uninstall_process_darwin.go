@@ -0,0 +1,33 @@
+//go:build darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// agentProcessRunning reports whether any other process was started from the
+// executable at path, using pgrep. The current process is skipped, since
+// uninstall and stop may run from the installed binary itself.
+func agentProcessRunning(path string) (bool, error) {
+	out, err := exec.Command("pgrep", "-f", path).Output() // #nosec G204
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// pgrep exits with 1 when nothing matches
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	self := strconv.Itoa(os.Getpid())
+	for _, pid := range strings.Fields(string(out)) {
+		if pid != self {
+			return true, nil
+		}
+	}
+	return false, nil
+}
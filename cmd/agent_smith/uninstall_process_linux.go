@@ -0,0 +1,37 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// agentProcessRunning reports whether any other process is running the
+// executable at path, by reading the /proc/<pid>/exe links. The current
+// process is skipped, since uninstall and stop may run from the installed
+// binary itself.
+func agentProcessRunning(path string) (bool, error) {
+	links, err := filepath.Glob("/proc/[0-9]*/exe")
+	if err != nil {
+		return false, err
+	}
+	self := fmt.Sprintf("/proc/%d/exe", os.Getpid())
+	for _, link := range links {
+		if link == self {
+			continue
+		}
+		target, err := os.Readlink(link)
+		if err != nil {
+			// Processes of other users, or ones that just exited
+			continue
+		}
+		// A binary replaced or removed while running shows as "(deleted)"
+		if strings.TrimSuffix(target, " (deleted)") == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
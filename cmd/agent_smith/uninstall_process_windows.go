@@ -0,0 +1,49 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// agentProcessRunning reports whether any other process is running the
+// executable at path, by querying Win32_Process. The image name alone is not
+// enough since every org's agent has the same one. The current process is
+// skipped, since uninstall and stop may run from the installed binary itself.
+func agentProcessRunning(path string) (bool, error) {
+	// Escape the path for a WQL string literal, then for a PowerShell
+	// single-quoted string
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `'`, `''`).Replace(path)
+	script := fmt.Sprintf(
+		`@(Get-CimInstance Win32_Process -Filter 'ExecutablePath="%s" AND ProcessId<>%d').Count`,
+		escaped,
+		os.Getpid(),
+	)
+
+	// -EncodedCommand takes base64 UTF-16LE and sidesteps command line quoting
+	units := utf16.Encode([]rune(script))
+	encoded := make([]byte, 2*len(units))
+	for i, unit := range units {
+		binary.LittleEndian.PutUint16(encoded[2*i:], unit)
+	}
+
+	out, err := exec.Command( // #nosec G204
+		"powershell", "-NoProfile", "-NonInteractive",
+		"-EncodedCommand", base64.StdEncoding.EncodeToString(encoded),
+	).Output()
+	if err != nil {
+		return false, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return false, fmt.Errorf("unexpected process count %q", out)
+	}
+	return count > 0, nil
+}
@@ -2,7 +2,17 @@ package main
 
 import (
 	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+	"github.com/hashicorp/go-hclog"
 )
 
 func newUninstallTestFS() *mockFileSystem {
@@ -61,7 +71,7 @@ func TestRunUninstall_InactiveService_DeleteFails(t *testing.T) {
 	runUninstall(params)
 }
 
-// ── post-delete tests (run in parallel to share the serviceExecutableTimeout delay) ──
+// ── post-delete tests ───────────────────────────────────────────────────────────
 
 func TestRunUninstall_RemoveAllDataDirFails(t *testing.T) {
 	t.Parallel()
@@ -152,3 +162,273 @@ func TestRunUninstall_ActiveService_Success(t *testing.T) {
 
 	runUninstall(params)
 }
+
+// ── exit wait and notices ─────────────────────────────────────────────────────
+
+type recordingDeregistrar struct {
+	devices []agent.Device
+}
+
+func (d *recordingDeregistrar) Deregister(device agent.Device, _ string, _ hclog.Logger) {
+	d.devices = append(d.devices, device)
+}
+
+func TestUninstallAgent_WaitsForProcessExit(t *testing.T) {
+	checks := 0
+	removed := 0
+	params := &uninstallContext{
+		ServiceManager: &mockServiceManager{
+			openService: &mockService{isActive: true},
+		},
+		ProcessRunning: func(path string) (bool, error) {
+			if path != agent.GetAgentExecutablePath("test-org") {
+				t.Errorf("unexpected executable path %s", path)
+			}
+			checks++
+			return checks < 3, nil
+		},
+		FS: &mockFileSystem{
+			removeAllFunc: func(string) error {
+				if checks < 3 {
+					t.Error("files removed before the agent exited")
+				}
+				removed++
+				return nil
+			},
+		},
+	}
+
+	err := uninstallAgent(params, "test-org", hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if checks != 3 {
+		t.Errorf("expected 3 process checks, got %d", checks)
+	}
+	if removed != 3 {
+		t.Errorf("expected 3 directories removed, got %d", removed)
+	}
+}
+
+func TestUninstallAgent_ProcessNeverExits(t *testing.T) {
+	params := &uninstallContext{
+		ServiceManager: &mockServiceManager{
+			openService: &mockService{isActive: false, deleteErr: errors.New("not expected")},
+		},
+		ProcessRunning: func(string) (bool, error) { return true, nil },
+		ExitTimeout:    time.Millisecond,
+		FS:             &mockFileSystem{},
+	}
+
+	err := uninstallAgent(params, "test-org", hclog.NewNullLogger())
+	if err == nil || !strings.Contains(err.Error(), "still running") {
+		t.Errorf("expected still running error, got %v", err)
+	}
+}
+
+func TestUninstallAgent_ProcessCheckFails(t *testing.T) {
+	params := &uninstallContext{
+		ServiceManager: &mockServiceManager{
+			openService: &mockService{isActive: false},
+		},
+		ProcessRunning: func(string) (bool, error) { return false, errors.New("no access") },
+		FS:             newUninstallTestFS(),
+	}
+
+	err := uninstallAgent(params, "test-org", hclog.NewNullLogger())
+	if err != nil {
+		t.Errorf("expected the service state to be enough, got %v", err)
+	}
+}
+
+func TestUninstallAgent_SendsNotices(t *testing.T) {
+	deregistrar := &recordingDeregistrar{}
+	fs := newUninstallTestFS()
+	fs.readFileFunc = func(name string) ([]byte, error) {
+		if name != agent.GetConfigFilePath("test-org") {
+			t.Errorf("unexpected config path %s", name)
+		}
+		return []byte(`{"device_id":"dev-1"}`), nil
+	}
+	params := &uninstallContext{
+		ServiceManager: &mockServiceManager{
+			openService: &mockService{isActive: false},
+		},
+		ProcessRunning: func(string) (bool, error) { return false, nil },
+		Deregistrar:    deregistrar,
+		FS:             fs,
+	}
+
+	err := uninstallAgent(params, "test-org", hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deregistrar.devices) != 1 || deregistrar.devices[0].DeviceId != "dev-1" {
+		t.Errorf("expected one notice for dev-1, got %+v", deregistrar.devices)
+	}
+}
+
+func TestUninstallAgent_UnreadableConfigSkipsNotices(t *testing.T) {
+	deregistrar := &recordingDeregistrar{}
+	fs := newUninstallTestFS()
+	fs.readFileFunc = func(string) ([]byte, error) { return nil, os.ErrNotExist }
+	params := &uninstallContext{
+		ServiceManager: &mockServiceManager{
+			openService: &mockService{isActive: false},
+		},
+		ProcessRunning: func(string) (bool, error) { return false, nil },
+		Deregistrar:    deregistrar,
+		FS:             fs,
+	}
+
+	err := uninstallAgent(params, "test-org", hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deregistrar.devices) != 0 {
+		t.Errorf("expected no notices, got %+v", deregistrar.devices)
+	}
+}
+
+// ── keep flags ────────────────────────────────────────────────────────────────
+
+func TestRemoveDataDirectory_Keep(t *testing.T) {
+	configName := filepath.Base(agent.GetConfigFilePath("test-org"))
+	logName := filepath.Base(agent.GetLogFilePath("test-org"))
+
+	tests := []struct {
+		name       string
+		keepConfig bool
+		keepLogs   bool
+		want       []string
+	}{
+		{"keep config", true, false, []string{configName, configName + ".v0.bak"}},
+		{"keep logs", false, true, []string{logName, logName + ".1"}},
+		{
+			"keep both",
+			true,
+			true,
+			[]string{configName, configName + ".v0.bak", logName, logName + ".1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{
+				configName, configName + ".v0.bak", logName, logName + ".1", "status.json",
+			} {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Mkdir(filepath.Join(dir, "spool"), 0o700); err != nil {
+				t.Fatal(err)
+			}
+
+			params := &uninstallContext{
+				KeepConfig: tt.keepConfig,
+				KeepLogs:   tt.keepLogs,
+				FS:         utils.NewFileSystem(),
+			}
+			kept := keptDataFiles(params, "test-org")
+			err := removeDataDirectory(params, dir, kept, hclog.NewNullLogger())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.Name())
+			}
+			sort.Strings(got)
+			want := append([]string(nil), tt.want...)
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("expected %v to remain, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestRemoveDataDirectory_NoKeepRemovesAll(t *testing.T) {
+	var removed []string
+	params := &uninstallContext{
+		FS: &mockFileSystem{
+			removeAllFunc: func(path string) error {
+				removed = append(removed, path)
+				return nil
+			},
+		},
+	}
+
+	err := removeDataDirectory(params, "/data", keptDataFiles(params, "test-org"),
+		hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "/data" {
+		t.Errorf("expected /data removed, got %v", removed)
+	}
+}
+
+func TestRemoveDataDirectory_MissingDirectory(t *testing.T) {
+	params := &uninstallContext{KeepLogs: true, FS: &mockFileSystem{}}
+
+	dir := filepath.Join(t.TempDir(), "missing")
+	err := removeDataDirectory(params, dir, keptDataFiles(params, "test-org"),
+		hclog.NewNullLogger())
+	if err != nil {
+		t.Errorf("expected a missing directory to be skipped, got %v", err)
+	}
+}
+
+// ── process table ─────────────────────────────────────────────────────────────
+
+// TestAgentProcessHelper is run as a child process by the process table tests,
+// as a stand-in for the agent running from the same executable.
+func TestAgentProcessHelper(t *testing.T) {
+	if os.Getenv("AGENT_SMITH_PROCESS_HELPER") != "1" {
+		t.Skip("only run as a child process")
+	}
+	time.Sleep(30 * time.Second)
+}
+
+func TestAgentProcessRunning_SkipsCurrentProcess(t *testing.T) {
+	// The test binary is the target path, as the installed binary is when
+	// uninstall or stop runs from it
+	path, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	running, err := agentProcessRunning(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if running {
+		t.Fatal("expected the current process not to count as a running agent")
+	}
+
+	cmd := exec.Command(path, "-test.run=^TestAgentProcessHelper$") // #nosec G204
+	cmd.Env = append(os.Environ(), "AGENT_SMITH_PROCESS_HELPER=1")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	running, err = agentProcessRunning(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !running {
+		t.Error("expected another process running the executable to be found")
+	}
+}
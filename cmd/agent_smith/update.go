@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"os"
 	"runtime"
 	"time"
@@ -70,9 +69,8 @@ func runUpdate(params *updateContext) {
 		return
 	}
 
-	// Decode the config file
-	var device agent.Device
-	err = json.Unmarshal(configFileBytes, &device)
+	// Decode the config file, migrating it to the current schema
+	device, schemaVersion, err := agent.ParseConfig(configFileBytes)
 	if err != nil {
 		logger.Error("Failed to decode config", "error", err)
 		return
@@ -80,9 +78,13 @@ func runUpdate(params *updateContext) {
 
 	device.LoggingLevel = utils.LoggingLevel(params.LoggingLevel)
 	device.UseSyslog = params.UseSyslog
+	device.UseJournald = params.UseJournald
 	device.DisableAgentPostback = params.DisableAgentPostback
 	device.DisableAutoUpdates = params.NoAutoUpdates
 	device.GithubToken = params.GithubToken
+	if params.ServiceUsername != "" {
+		device.ServiceUsername = params.ServiceUsername
+	}
 
 	if params.MqttQos != -1 {
 		qos := byte(params.MqttQos)
@@ -123,19 +125,90 @@ func runUpdate(params *updateContext) {
 	if params.Tuning.MaxOutputBytes != tuningFlagUnset {
 		device.MaxOutputBytes = tuningPtr(params.Tuning.MaxOutputBytes)
 	}
+	if params.Tuning.SyslogBufferSize != tuningFlagUnset {
+		device.SyslogBufferSize = tuningPtr(params.Tuning.SyslogBufferSize)
+	}
+	if params.Tuning.SpoolMaxEntries != tuningFlagUnset {
+		device.SpoolMaxEntries = tuningPtr(params.Tuning.SpoolMaxEntries)
+	}
+	if params.Tuning.SpoolMaxAgeHours != tuningFlagUnset {
+		device.SpoolMaxAgeHours = tuningPtr(params.Tuning.SpoolMaxAgeHours)
+	}
+	if params.Tuning.SpoolMaxBytes != tuningFlagUnset {
+		device.SpoolMaxBytes = tuningPtr(params.Tuning.SpoolMaxBytes)
+	}
+	if policy := params.Tuning.spoolEvictionPolicy(); policy != "" {
+		device.SpoolEvictionPolicy = policy
+	}
+	if params.Tuning.SpoolDrainConcurrency != tuningFlagUnset {
+		device.SpoolDrainConcurrency = tuningPtr(params.Tuning.SpoolDrainConcurrency)
+	}
+	if params.Tuning.SpoolDrainRatePerMinute != tuningFlagUnset {
+		device.SpoolDrainRatePerMinute = tuningPtr(params.Tuning.SpoolDrainRatePerMinute)
+	}
+	if params.Tuning.PostbackBreakerThreshold != tuningFlagUnset {
+		device.PostbackBreakerThreshold = tuningPtr(params.Tuning.PostbackBreakerThreshold)
+	}
+	if params.Tuning.PostbackBreakerCooldownSeconds != tuningFlagUnset {
+		device.PostbackBreakerCooldownSeconds = tuningPtr(
+			params.Tuning.PostbackBreakerCooldownSeconds,
+		)
+	}
+	if compression := params.Tuning.postbackCompression(); compression != "" {
+		device.PostbackCompression = compression
+	}
+	if params.Tuning.PostbackCompressionMinBytes != tuningFlagUnset {
+		device.PostbackCompressionMinBytes = tuningPtr(params.Tuning.PostbackCompressionMinBytes)
+	}
+	if mode := params.Tuning.outputOverflow(); mode != "" {
+		device.OutputOverflow = mode
+	}
+	if params.Tuning.OutputSpillMaxBytes != tuningFlagUnset {
+		device.OutputSpillMaxBytes = tuningPtr(params.Tuning.OutputSpillMaxBytes)
+	}
+	params.Tuning.applyEngineSettings(&device)
+	params.Syslog.applyTo(&device)
 
-	// Save the updated configuration file
-	configBytes, err := json.MarshalIndent(device, "", "  ")
-	if err != nil {
-		logger.Error("Failed to print config file", "error", err)
+	if err := validateSyslogSettings(device); err != nil {
+		logger.Error("Invalid syslog settings", "error", err)
 		return
 	}
 
-	err = params.FS.WriteFile(configFilePath, configBytes, utils.DefaultFileMod)
+	// Keep the original of a config written with an older schema before the
+	// migrated config replaces it
+	if schemaVersion < agent.CurrentSchemaVersion {
+		backupPath, err := agent.BackupConfigFile(
+			params.FS,
+			configFilePath,
+			configFileBytes,
+			schemaVersion,
+		)
+		if err != nil {
+			logger.Error("Failed to back up config", "path", backupPath, "error", err)
+			return
+		}
+		logger.Info(
+			"Migrating config",
+			"from_schema", schemaVersion,
+			"to_schema", agent.CurrentSchemaVersion,
+			"backup", backupPath,
+		)
+	}
+
+	// Save the updated configuration file
+	err = agent.WriteConfigFile(params.FS, configFilePath, device)
 	if err != nil {
 		logger.Error("Failed to save config", "error", err)
 		return
 	}
+	err = grantServiceAccount(configFilePath, device.ServiceUsername)
+	if err != nil {
+		logger.Warn(
+			"Failed to give the service account the config file",
+			"account", device.ServiceUsername,
+			"error", err,
+		)
+	}
 
 	logger.Info("Configuration successfully updated", "path", configFilePath)
 
@@ -15,6 +15,7 @@ type updateContext struct {
 	Update               bool
 	LoggingLevel         string
 	UseSyslog            bool
+	UseJournald          bool
 	DisableAgentPostback bool
 	NoAutoUpdates        bool
 	GithubToken          string
@@ -22,6 +23,7 @@ type updateContext struct {
 	ServiceUsername      string
 	ServicePassword      string
 	Tuning               tuningFlags
+	Syslog               syslogFlags
 
 	Sys    agent.SystemInfoProvider
 	Domain agent.DomainInfoProvider
@@ -44,6 +46,13 @@ func newUpdateFlagSet(params *updateContext) *flag.FlagSet {
 		fmt.Sprintf("Logging level: %s", getAllowedConfigLevelsString(", ")),
 	)
 	fs.BoolVar(&params.UseSyslog, "syslog", false, "Write log messages to system log")
+	bindSyslogFlags(fs, &params.Syslog)
+	fs.BoolVar(
+		&params.UseJournald,
+		"journald",
+		false,
+		"Write structured log entries to systemd-journald (Linux only)",
+	)
 	fs.BoolVar(
 		&params.DisableAgentPostback,
 		"disable-agent-postback",
@@ -108,6 +117,14 @@ func newUpdateContext(
 		return nil, err
 	}
 
+	if err := params.Syslog.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := validateJournald(params.UseJournald); err != nil {
+		return nil, err
+	}
+
 	if params.ServicePassword != "" && params.ServiceUsername == "" {
 		return nil, fmt.Errorf("service-password requires service-username")
 	}
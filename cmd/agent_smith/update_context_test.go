@@ -161,3 +161,20 @@ func TestNewUpdateContext(t *testing.T) {
 		}
 	}
 }
+
+func TestNewUpdateContext_JournaldPlatform(t *testing.T) {
+	args := []string{"--org-id", "test123", "--update", "--journald"}
+	defer func(supported bool) { journaldSupported = supported }(journaldSupported)
+
+	journaldSupported = true
+	params, err := newUpdateContext(args, nil, nil, nil, nil)
+	if err != nil || !params.UseJournald {
+		t.Errorf("expected --journald accepted on Linux, got %v", err)
+	}
+
+	journaldSupported = false
+	_, err = newUpdateContext(args, nil, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid journald") {
+		t.Errorf("expected --journald rejected off Linux, got %v", err)
+	}
+}
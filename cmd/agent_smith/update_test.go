@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/RewstApp/agent-smith-go/internal/agent"
@@ -152,6 +154,121 @@ func TestRunUpdate_AppliesProvidedTuningFlags(t *testing.T) {
 	}
 }
 
+func TestRunUpdate_AppliesSpoolFlags(t *testing.T) {
+	var written agent.Device
+	params := newBaseUpdateParams()
+	params.FS = captureUpdateFS(deviceWithTuningJSON("test-org", 10, 1, 10, 1, 1, 1), &written)
+	params.Tuning = tuningFlags{
+		MqttConnectTimeoutSeconds:       tuningFlagUnset,
+		MqttSubscribeTimeoutSeconds:     tuningFlagUnset,
+		WorkerCount:                     tuningFlagUnset,
+		MessageQueueSize:                tuningFlagUnset,
+		PostbackMaxAttempts:             tuningFlagUnset,
+		PostbackBaseRetryBackoffSeconds: tuningFlagUnset,
+		CommandTimeoutSeconds:           tuningFlagUnset,
+		SasTokenLifetimeHours:           tuningFlagUnset,
+		MaxOutputBytes:                  tuningFlagUnset,
+		SyslogBufferSize:                tuningFlagUnset,
+		SpoolMaxEntries:                 500,
+		SpoolMaxAgeHours:                72,
+		SpoolMaxBytes:                   64 << 20,
+		SpoolEvictionPolicy:             "Largest",
+	}
+
+	runUpdate(params)
+
+	if written.SpoolMaxEntries == nil || *written.SpoolMaxEntries != 500 {
+		t.Errorf("expected SpoolMaxEntries 500, got %v", written.SpoolMaxEntries)
+	}
+	if written.SpoolMaxAgeHours == nil || *written.SpoolMaxAgeHours != 72 {
+		t.Errorf("expected SpoolMaxAgeHours 72, got %v", written.SpoolMaxAgeHours)
+	}
+	if written.SpoolMaxBytes == nil || *written.SpoolMaxBytes != 64<<20 {
+		t.Errorf("expected SpoolMaxBytes %d, got %v", 64<<20, written.SpoolMaxBytes)
+	}
+	if written.SpoolEvictionPolicy != agent.SpoolEvictLargest {
+		t.Errorf("expected SpoolEvictionPolicy largest, got %q", written.SpoolEvictionPolicy)
+	}
+	if written.WorkerCount == nil || *written.WorkerCount != 1 {
+		t.Errorf("expected WorkerCount preserved at 1, got %v", written.WorkerCount)
+	}
+}
+
+func TestRunUpdate_AppliesOutputOverflowFlags(t *testing.T) {
+	var written agent.Device
+	params := newBaseUpdateParams()
+	params.FS = captureUpdateFS(deviceWithTuningJSON("test-org", 10, 1, 10, 1, 1, 1), &written)
+	params.Tuning = tuningFlags{
+		MqttConnectTimeoutSeconds:       tuningFlagUnset,
+		MqttSubscribeTimeoutSeconds:     tuningFlagUnset,
+		WorkerCount:                     tuningFlagUnset,
+		MessageQueueSize:                tuningFlagUnset,
+		PostbackMaxAttempts:             tuningFlagUnset,
+		PostbackBaseRetryBackoffSeconds: tuningFlagUnset,
+		CommandTimeoutSeconds:           tuningFlagUnset,
+		SasTokenLifetimeHours:           tuningFlagUnset,
+		MaxOutputBytes:                  tuningFlagUnset,
+		SyslogBufferSize:                tuningFlagUnset,
+		SpoolMaxEntries:                 tuningFlagUnset,
+		SpoolMaxAgeHours:                tuningFlagUnset,
+		SpoolMaxBytes:                   tuningFlagUnset,
+		PostbackCompressionMinBytes:     tuningFlagUnset,
+		OutputOverflow:                  "Upload",
+		OutputSpillMaxBytes:             512 << 20,
+	}
+
+	runUpdate(params)
+
+	if written.OutputOverflow != agent.OutputOverflowUpload {
+		t.Errorf("expected OutputOverflow upload, got %q", written.OutputOverflow)
+	}
+	if written.OutputSpillMaxBytes == nil || *written.OutputSpillMaxBytes != 512<<20 {
+		t.Errorf("expected OutputSpillMaxBytes %d, got %v", 512<<20, written.OutputSpillMaxBytes)
+	}
+	if written.SpoolMaxEntries != nil {
+		t.Errorf("expected SpoolMaxEntries unset, got %v", *written.SpoolMaxEntries)
+	}
+}
+
+func TestRunUpdate_AppliesEngineSettings(t *testing.T) {
+	var written agent.Device
+	params := newBaseUpdateParams()
+	params.FS = captureUpdateFS(deviceWithTuningJSON("test-org", 10, 1, 10, 1, 1, 1), &written)
+	params.Tuning = tuningFlags{
+		MqttConnectTimeoutSeconds:       tuningFlagUnset,
+		MqttSubscribeTimeoutSeconds:     tuningFlagUnset,
+		WorkerCount:                     tuningFlagUnset,
+		MessageQueueSize:                tuningFlagUnset,
+		PostbackMaxAttempts:             tuningFlagUnset,
+		PostbackBaseRetryBackoffSeconds: tuningFlagUnset,
+		CommandTimeoutSeconds:           tuningFlagUnset,
+		SasTokenLifetimeHours:           tuningFlagUnset,
+		MaxOutputBytes:                  tuningFlagUnset,
+		SyslogBufferSize:                tuningFlagUnset,
+		SpoolMaxEntries:                 tuningFlagUnset,
+		SpoolMaxAgeHours:                tuningFlagUnset,
+		SpoolMaxBytes:                   tuningFlagUnset,
+		PostbackCompressionMinBytes:     tuningFlagUnset,
+		OutputSpillMaxBytes:             tuningFlagUnset,
+		EngineAlternateHosts:            "eu.example.com, proxy.example.com:8443",
+		PostbackPathTemplate:            "/rewst/action/{post_id}",
+		provided: map[string]bool{
+			"engine-alternate-hosts": true,
+			"postback-path-template": true,
+		},
+	}
+
+	runUpdate(params)
+
+	want := []string{"eu.example.com", "proxy.example.com:8443"}
+	if !slices.Equal(written.RewstEngineAlternateHosts, want) {
+		t.Errorf("expected alternate hosts %v, got %v", want, written.RewstEngineAlternateHosts)
+	}
+	if written.PostbackPathTemplate != "/rewst/action/{post_id}" {
+		t.Errorf("expected the postback path template set, got %q", written.PostbackPathTemplate)
+	}
+}
+
 func TestRunUpdate_OmittedTuningFlagsPreserveExistingValues(t *testing.T) {
 	var written agent.Device
 	params := newBaseUpdateParams()
@@ -199,6 +316,38 @@ func TestRunUpdate_OmittedTuningFlagsPreserveExistingValues(t *testing.T) {
 	}
 }
 
+func TestRunUpdate_AppliesSyslogFlags(t *testing.T) {
+	var written agent.Device
+	params := newBaseUpdateParams()
+	params.FS = captureUpdateFS(validDeviceJSON("test-org"), &written)
+	params.UseSyslog = true
+	params.UseJournald = true
+	params.Syslog = syslogFlags{Transport: "udp", Address: "10.0.0.5:514", AppName: "rewst"}
+
+	runUpdate(params)
+
+	if written.SyslogTransport != "udp" || written.SyslogAddress != "10.0.0.5:514" ||
+		written.SyslogAppName != "rewst" {
+		t.Errorf("syslog flags not persisted: %+v", written)
+	}
+	if !written.UseJournald {
+		t.Error("expected journald flag to be persisted")
+	}
+}
+
+func TestRunUpdate_InvalidSyslogSettingsNotWritten(t *testing.T) {
+	var written agent.Device
+	params := newBaseUpdateParams()
+	params.FS = captureUpdateFS(validDeviceJSON("test-org"), &written)
+	params.Syslog = syslogFlags{Transport: "tcp"}
+
+	runUpdate(params)
+
+	if written.DeviceId != "" {
+		t.Error("expected config not to be rewritten when syslog settings are incomplete")
+	}
+}
+
 func TestRunUpdate_OpenFails(t *testing.T) {
 	params := newBaseUpdateParams()
 	params.ServiceManager = &mockServiceManager{openErr: errors.New("service not found")}
@@ -388,3 +537,84 @@ func TestRunUpdate_WithServiceUsername_CreateFails(t *testing.T) {
 
 	runUpdate(params)
 }
+
+func TestRunUpdate_MigratesConfigWithBackup(t *testing.T) {
+	legacy := []byte(`{"device_id":"device-123","rewst_org_id":"test-org",` +
+		`"rewst_engine_host":"engine.example.com","shared_access_key":"key123",` +
+		`"azure_iot_hub_host":"hub.example.com","future_field":{"enabled":true}}`)
+	configPath := agent.GetConfigFilePath("test-org")
+
+	writes := map[string][]byte{}
+	var order []string
+	params := newBaseUpdateParams()
+	params.FS = &mockFileSystem{
+		executableFunc: func() (string, error) { return "/fake/agent", nil },
+		readFileFunc: func(name string) ([]byte, error) {
+			if name == configPath {
+				return legacy, nil
+			}
+			return []byte("binary"), nil
+		},
+		writeFileFunc: func(name string, data []byte, _ os.FileMode) error {
+			writes[name] = data
+			order = append(order, name)
+			return nil
+		},
+		mkdirAllFunc:  func(string) error { return nil },
+		removeAllFunc: func(string) error { return nil },
+	}
+
+	runUpdate(params)
+
+	backupPath := configPath + ".v0.bak"
+	if string(writes[backupPath]) != string(legacy) {
+		t.Fatalf("expected the original config in %s, got %q", backupPath, writes[backupPath])
+	}
+	if len(order) < 2 || order[0] != backupPath || order[1] != configPath {
+		t.Errorf("expected the backup to be written before the config, got %v", order)
+	}
+
+	var saved map[string]json.RawMessage
+	if err := json.Unmarshal(writes[configPath], &saved); err != nil {
+		t.Fatalf("failed to parse saved config: %v", err)
+	}
+	if string(saved["schema_version"]) != "1" {
+		t.Errorf("expected schema_version 1, got %s", saved["schema_version"])
+	}
+	var future struct{ Enabled bool }
+	if err := json.Unmarshal(saved["future_field"], &future); err != nil || !future.Enabled {
+		t.Errorf("expected the unknown field to be preserved, got %s", saved["future_field"])
+	}
+}
+
+func TestRunUpdate_CurrentSchemaSkipsBackup(t *testing.T) {
+	var writes []string
+	params := newBaseUpdateParams()
+	fs := newUpdateTestFS()
+	current, _ := json.Marshal(agent.Device{
+		SchemaVersion:   agent.CurrentSchemaVersion,
+		DeviceId:        "device-123",
+		RewstEngineHost: "engine.example.com",
+	})
+	readCall := 0
+	fs.readFileFunc = func(string) ([]byte, error) {
+		readCall++
+		if readCall == 1 {
+			return current, nil
+		}
+		return []byte("binary"), nil
+	}
+	fs.writeFileFunc = func(name string, _ []byte, _ os.FileMode) error {
+		writes = append(writes, name)
+		return nil
+	}
+	params.FS = fs
+
+	runUpdate(params)
+
+	for _, name := range writes {
+		if filepath.Ext(name) == ".bak" {
+			t.Errorf("expected no backup for a current config, wrote %s", name)
+		}
+	}
+}
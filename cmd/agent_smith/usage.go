@@ -33,6 +33,9 @@ type operationalMode struct {
 	// selector is the primary flag (without leading dashes) that signals the
 	// operator's intent to use this mode (e.g. "config-url").
 	selector string
+	// altSelectors are further flags that signal this mode, for modes with
+	// several mutually exclusive actions (e.g. "stop" and "restart").
+	altSelectors []string
 	// summary is the one-line invocation fragment shown in the usage summary.
 	summary string
 	// flagSet returns a fresh flag set whose flags carry this mode's per-flag
@@ -45,7 +48,7 @@ type operationalMode struct {
 // historical one-line usage string so existing behavior is preserved.
 func operationalModes() []operationalMode {
 	configFlagsList := fmt.Sprintf(
-		"[--logging-level %s] [--syslog] [--disable-agent-postback] [--no-auto-updates] [--mqtt-qos 0|1] [--mqtt-connect-timeout-seconds <N>] [--worker-count <N>] [--message-queue-size <N>] [--postback-max-attempts <N>] [--postback-base-retry-backoff-seconds <N>] [--command-timeout-seconds <N>] [--service-username <USER>] [--service-password <PASS>]",
+		"[--logging-level %s] [--syslog] [--syslog-transport local|udp|tcp|tls] [--syslog-address <HOST:PORT>] [--journald] [--disable-agent-postback] [--no-auto-updates] [--mqtt-qos 0|1] [--mqtt-connect-timeout-seconds <N>] [--worker-count <N>] [--message-queue-size <N>] [--postback-max-attempts <N>] [--postback-base-retry-backoff-seconds <N>] [--command-timeout-seconds <N>] [--service-username <USER>] [--service-password <PASS>]",
 		getAllowedConfigLevelsString("|"),
 	)
 
@@ -53,14 +56,78 @@ func operationalModes() []operationalMode {
 		{
 			name:     "diagnostic",
 			selector: "diagnostic",
-			summary:  "--org-id <ORG_ID> --diagnostic",
-			flagSet:  func() *flag.FlagSet { return newDiagnosticFlagSet(&diagnosticContext{}) },
+			summary: "[--org-id <ORG_ID>] --diagnostic [--allow-disconnect] " +
+				"[--non-interactive [--json] | --bundle <PATH> [--bundle-log-mb <MB>]]",
+			flagSet: func() *flag.FlagSet { return newDiagnosticFlagSet(&diagnosticContext{}) },
 		},
 		{
 			name:     "uninstall",
 			selector: "uninstall",
-			summary:  "--org-id <ORG_ID> --uninstall",
-			flagSet:  func() *flag.FlagSet { return newUninstallFlagSet(&uninstallContext{}) },
+			summary: "(--org-id <ORG_ID> | --all) --uninstall " +
+				"[--keep-logs] [--keep-config]",
+			flagSet: func() *flag.FlagSet { return newUninstallFlagSet(&uninstallContext{}) },
+		},
+		{
+			name:     "status",
+			selector: "status",
+			summary:  "--org-id <ORG_ID> --status [--json]",
+			flagSet:  func() *flag.FlagSet { return newStatusFlagSet(&statusContext{}) },
+		},
+		{
+			name:     "repair",
+			selector: "repair",
+			summary:  "--org-id <ORG_ID> --repair [--apply]",
+			flagSet:  func() *flag.FlagSet { return newRepairFlagSet(&repairContext{}) },
+		},
+		{
+			name:     "run-message",
+			selector: "run-message",
+			summary:  "--org-id <ORG_ID> --run-message <MESSAGE FILE|-> [--postback]",
+			flagSet:  func() *flag.FlagSet { return newRunMessageFlagSet(&runMessageContext{}) },
+		},
+		{
+			name:     "validate-config",
+			selector: "validate-config",
+			summary:  "--validate-config <CONFIG FILE>",
+			flagSet: func() *flag.FlagSet {
+				return newValidateConfigFlagSet(&validateConfigContext{})
+			},
+		},
+		{
+			name:     "list",
+			selector: "list",
+			summary:  "--list [--json]",
+			flagSet:  func() *flag.FlagSet { return newListFlagSet(&listContext{}) },
+		},
+		{
+			name:         "control",
+			selector:     "start",
+			altSelectors: []string{"stop", "restart"},
+			summary:      "(--org-id <ORG_ID> | --all) --start|--stop|--restart",
+			flagSet:      func() *flag.FlagSet { return newControlFlagSet(&controlContext{}) },
+		},
+		{
+			name:     "spool",
+			selector: "spool",
+			summary:  "--org-id <ORG_ID> --spool list|show <ID>|replay|purge [<ID>]",
+			flagSet:  func() *flag.FlagSet { return newSpoolFlagSet(&spoolContext{}) },
+		},
+		{
+			name:     "export-config",
+			selector: "export-config",
+			summary:  "--org-id <ORG_ID> --export-config <BUNDLE FILE> [--passphrase-file <FILE>]",
+			flagSet: func() *flag.FlagSet {
+				return newExportConfigFlagSet(&exportConfigContext{})
+			},
+		},
+		{
+			name:     "import-config",
+			selector: "import-config",
+			summary: "--org-id <ORG_ID> --import-config <BUNDLE FILE> [--passphrase-file <FILE>] " +
+				"[--service-username <USER>] [--service-password <PASS>] [--keep-source-fields]",
+			flagSet: func() *flag.FlagSet {
+				return newImportConfigFlagSet(&importConfigContext{})
+			},
 		},
 		{
 			name:     "config",
@@ -129,6 +196,11 @@ func detectMode(args []string) (operationalMode, bool) {
 		if hasFlag(args, mode.selector) {
 			return mode, true
 		}
+		for _, selector := range mode.altSelectors {
+			if hasFlag(args, selector) {
+				return mode, true
+			}
+		}
 	}
 	return operationalMode{}, false
 }
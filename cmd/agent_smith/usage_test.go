@@ -20,6 +20,33 @@ func buildModeErrs(args []string) map[string]error {
 	_, err = newUninstallContext(args, nil, nil)
 	modeErrs["uninstall"] = err
 
+	_, err = newStatusContext(args, nil)
+	modeErrs["status"] = err
+
+	_, err = newRepairContext(args, nil, nil)
+	modeErrs["repair"] = err
+
+	_, err = newRunMessageContext(args, nil, nil, nil, nil)
+	modeErrs["run-message"] = err
+
+	_, err = newValidateConfigContext(args, nil)
+	modeErrs["validate-config"] = err
+
+	_, err = newListContext(args, nil, nil)
+	modeErrs["list"] = err
+
+	_, err = newControlContext(args, nil)
+	modeErrs["control"] = err
+
+	_, err = newSpoolContext(args, nil)
+	modeErrs["spool"] = err
+
+	_, err = newExportConfigContext(args, nil)
+	modeErrs["export-config"] = err
+
+	_, err = newImportConfigContext(args, nil, nil)
+	modeErrs["import-config"] = err
+
 	_, err = newConfigContext(args, nil, nil, nil, nil)
 	modeErrs["config"] = err
 
@@ -66,6 +93,16 @@ func TestDetectMode(t *testing.T) {
 	}{
 		{"diagnostic", []string{"--diagnostic"}, "diagnostic", true},
 		{"uninstall", []string{"--org-id", "x", "--uninstall"}, "uninstall", true},
+		{"status", []string{"--org-id", "x", "--status"}, "status", true},
+		{"repair", []string{"--org-id", "x", "--repair"}, "repair", true},
+		{"run-message", []string{"--org-id", "x", "--run-message", "-"}, "run-message", true},
+		{"validate-config", []string{"--validate-config", "c.json"}, "validate-config", true},
+		{"list", []string{"--list", "--json"}, "list", true},
+		{"control start", []string{"--all", "--start"}, "control", true},
+		{"control restart", []string{"--org-id", "x", "--restart"}, "control", true},
+		{"spool", []string{"--org-id", "x", "--spool", "show", "1"}, "spool", true},
+		{"export-config", []string{"--export-config", "b.json"}, "export-config", true},
+		{"import-config", []string{"--import-config", "b.json"}, "import-config", true},
 		{"config", []string{"--config-url", "https://x"}, "config", true},
 		{"service", []string{"--config-file", "/etc/x"}, "service", true},
 		{"update", []string{"--update"}, "update", true},
@@ -250,6 +287,30 @@ func TestReportUsageModeErrors(t *testing.T) {
 			mode:    "uninstall",
 			wantErr: "missing org-id",
 		},
+		{
+			name:    "control missing org-id",
+			args:    []string{"--stop"},
+			mode:    "control",
+			wantErr: "missing org-id",
+		},
+		{
+			name:    "spool show missing id",
+			args:    []string{"--org-id", "x", "--spool", "show"},
+			mode:    "spool",
+			wantErr: "spool show requires one entry id",
+		},
+		{
+			name:    "import-config missing org-id",
+			args:    []string{"--import-config", "b.json"},
+			mode:    "import-config",
+			wantErr: "missing org-id",
+		},
+		{
+			name:    "status missing org-id",
+			args:    []string{"--status", "--json"},
+			mode:    "status",
+			wantErr: "missing org-id",
+		},
 	}
 
 	for _, test := range tests {
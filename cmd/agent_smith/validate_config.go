@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/syslog"
+)
+
+// Severities of a config finding. Only errors make --validate-config fail.
+const (
+	findingError   = "error"
+	findingWarning = "warning"
+)
+
+// configFinding is one problem found in a config file, located by its JSON
+// path (e.g. $.plugins[0].executable_path).
+type configFinding struct {
+	Severity string
+	Path     string
+	Message  string
+}
+
+// configLint collects the findings for one config file.
+type configLint struct {
+	findings []configFinding
+}
+
+func (l *configLint) add(severity, path, format string, args ...any) {
+	l.findings = append(l.findings, configFinding{
+		Severity: severity,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// reported tells whether path already has a finding, so the semantic checks
+// do not pile onto a field that failed to decode.
+func (l *configLint) reported(path string) bool {
+	for _, finding := range l.findings {
+		if finding.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// runValidateConfig lints the config file and prints every finding. It returns
+// the process exit code: 1 if any error was found, 0 otherwise.
+func runValidateConfig(params *validateConfigContext, out io.Writer) int {
+	data, err := params.FS.ReadFile(params.ConfigFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(out, "%s: %v\n", params.ConfigFile, err)
+		return 1
+	}
+
+	findings := lintConfig(data)
+	errorCount := 0
+	for _, finding := range findings {
+		if finding.Severity == findingError {
+			errorCount++
+		}
+		_, _ = fmt.Fprintf(out, "%-8s %s: %s\n", finding.Severity, finding.Path, finding.Message)
+	}
+	_, _ = fmt.Fprintf(out, "%s: %d error(s), %d warning(s)\n",
+		params.ConfigFile, errorCount, len(findings)-errorCount)
+
+	if errorCount > 0 {
+		return 1
+	}
+	return 0
+}
+
+// lintConfig checks a config file the way the service would load it and
+// returns every problem, sorted by path. Keys and types are checked against
+// agent.Device first; the field values are then checked with the same
+// validation the config and service modes apply.
+func lintConfig(data []byte) []configFinding {
+	var lint configLint
+
+	if !json.Valid(data) {
+		var device agent.Device
+		lint.add(findingError, "$", "not valid JSON: %v", json.Unmarshal(data, &device))
+		return lint.findings
+	}
+
+	lintValue(&lint, "$", data, reflect.TypeOf(agent.Device{}))
+
+	// Fields that failed to decode keep their zero value; the type error is
+	// already reported for them.
+	var device agent.Device
+	_ = json.Unmarshal(data, &device)
+	if !lint.reported("$") {
+		lintDevice(&lint, device)
+	}
+
+	sort.SliceStable(lint.findings, func(i, j int) bool {
+		return lint.findings[i].Path < lint.findings[j].Path
+	})
+	return lint.findings
+}
+
+// lintValue checks that raw decodes into t, recursing into objects and arrays
+// so that unknown keys and type errors are reported at their own path.
+func lintValue(lint *configLint, path string, raw json.RawMessage, t reflect.Type) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	got := jsonKind(raw)
+	if got == "null" {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			lint.add(findingError, path, "expected an object, got %s", got)
+			return
+		}
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			field, ok := fields[key]
+			if !ok {
+				message := "unknown key"
+				if suggestion := closestKey(key, fields); suggestion != "" {
+					message = fmt.Sprintf("unknown key; did you mean %q?", suggestion)
+				}
+				lint.add(findingWarning, path+"."+key, "%s", message)
+				continue
+			}
+			lintValue(lint, path+"."+key, object[key], field)
+		}
+	case reflect.Slice:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			lint.add(findingError, path, "expected an array, got %s", got)
+			return
+		}
+		for i, item := range items {
+			lintValue(lint, fmt.Sprintf("%s[%d]", path, i), item, t.Elem())
+		}
+	default:
+		if err := json.Unmarshal(raw, reflect.New(t).Interface()); err != nil {
+			lint.add(findingError, path, "expected %s, got %s", describeKind(t), got)
+		}
+	}
+}
+
+// jsonFields maps the JSON names of a struct's fields to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// jsonKind names the JSON type of raw, or returns the number itself so a
+// fractional or oversized value is shown as written.
+func jsonKind(raw json.RawMessage) string {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return "nothing"
+	}
+	switch trimmed[0] {
+	case '{':
+		return "an object"
+	case '[':
+		return "an array"
+	case '"':
+		return "a string"
+	case 't', 'f':
+		return "a boolean"
+	case 'n':
+		return "null"
+	default:
+		return string(trimmed)
+	}
+}
+
+func describeKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Uint8:
+		return "an integer from 0 to 255"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	default:
+		return t.String()
+	}
+}
+
+// closestKey returns the known key within two edits of key, if any.
+func closestKey(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		d := editDistance(key, name)
+		if d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// lintDevice checks the decoded field values.
+func lintDevice(lint *configLint, device agent.Device) {
+	for _, field := range missingRequiredFields(device) {
+		if !lint.reported("$." + field) {
+			lint.add(findingError, "$."+field, "missing required field")
+		}
+	}
+
+	switch {
+	case device.SchemaVersion < 0:
+		lint.add(findingError, "$.schema_version", "must not be negative; got %d",
+			device.SchemaVersion)
+	case device.SchemaVersion > agent.CurrentSchemaVersion:
+		lint.add(findingWarning, "$.schema_version",
+			"written by a newer agent (schema %d, this agent supports %d); "+
+				"fields it does not know are kept but ignored",
+			device.SchemaVersion, agent.CurrentSchemaVersion)
+	}
+
+	if !allowedLoggingLevels[string(device.LoggingLevel)] {
+		lint.add(findingError, "$.logging_level",
+			"unknown logging level %q; expected one of %s",
+			device.LoggingLevel, getAllowedConfigLevelsString(", "))
+	}
+
+	for _, r := range tuningRanges(device) {
+		if r.value == nil || lint.reported("$."+r.field) {
+			continue
+		}
+		if *r.value < r.min || *r.value > r.max {
+			lint.add(findingError, "$."+r.field,
+				"must be between %d and %d; got %d", r.min, r.max, *r.value)
+		}
+	}
+
+	workers := device.ResolvedWorkerCount()
+	queue := device.ResolvedMessageQueueSize()
+	if (device.WorkerCount != nil || device.MessageQueueSize != nil) && queue < workers {
+		lint.add(findingWarning, "$.message_queue_size",
+			"queue of %d is smaller than worker_count %d; "+
+				"bursts are throttled before every worker is busy",
+			queue, workers)
+	}
+
+	lintSyslog(lint, device)
+
+	for i, plugin := range device.Plugins {
+		lintPlugin(lint, fmt.Sprintf("$.plugins[%d]", i), plugin)
+	}
+}
+
+// lintSyslog applies validateSyslogSettings field by field so each problem is
+// reported at its own path.
+func lintSyslog(lint *configLint, device agent.Device) {
+	if device.SyslogTransport == "" {
+		return
+	}
+	if !device.UseSyslog {
+		lint.add(findingWarning, "$.syslog_transport", "ignored because syslog is false")
+	}
+
+	transport, err := syslog.ParseTransport(device.SyslogTransport)
+	if err != nil {
+		lint.add(findingError, "$.syslog_transport", "%v", err)
+		return
+	}
+	if transport != syslog.TransportLocal && device.SyslogAddress == "" {
+		lint.add(findingError, "$.syslog_address",
+			"required by syslog_transport %s", transport)
+	}
+	if _, err := syslog.ParseFormat(device.SyslogFormat, transport); err != nil {
+		lint.add(findingError, "$.syslog_format", "%v", err)
+	}
+	if _, err := syslog.ParseFacility(device.SyslogFacility); err != nil {
+		lint.add(findingError, "$.syslog_facility", "%v", err)
+	}
+}
+
+// lintPlugin checks that a notification plugin's executable can be read and,
+// outside Windows, executed. Paths are resolved on the host running the check.
+func lintPlugin(lint *configLint, path string, plugin agent.Plugin) {
+	if plugin.Name == "" {
+		lint.add(findingError, path+".name", "missing plugin name")
+	}
+
+	path += ".executable_path"
+	if plugin.ExecutablePath == "" {
+		lint.add(findingError, path, "missing plugin executable")
+		return
+	}
+
+	file, err := os.Open(plugin.ExecutablePath) // #nosec G304 - path is being validated
+	if err != nil {
+		lint.add(findingError, path, "cannot read %s: %v",
+			plugin.ExecutablePath, errors.Unwrap(err))
+		return
+	}
+	info, err := file.Stat()
+	_ = file.Close()
+	if err != nil {
+		lint.add(findingError, path, "cannot inspect %s: %v", plugin.ExecutablePath, err)
+		return
+	}
+
+	if !info.Mode().IsRegular() {
+		lint.add(findingError, path, "%s is not a regular file", plugin.ExecutablePath)
+		return
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o111 == 0 {
+		lint.add(findingError, path, "%s is not executable", plugin.ExecutablePath)
+	}
+}
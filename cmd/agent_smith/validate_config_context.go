@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+type validateConfigContext struct {
+	ConfigFile string
+
+	FS utils.FileSystem
+}
+
+// newValidateConfigFlagSet builds the flag set for config validation mode,
+// binding flags to the provided params. It is shared between argument parsing
+// and usage rendering so that the per-flag descriptions stay in a single place.
+func newValidateConfigFlagSet(params *validateConfigContext) *flag.FlagSet {
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	fs.StringVar(
+		&params.ConfigFile,
+		"validate-config",
+		"",
+		"Check a config file offline and report every problem with its JSON path",
+	)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func newValidateConfigContext(
+	args []string,
+	fsys utils.FileSystem,
+) (*validateConfigContext, error) {
+	var params validateConfigContext
+
+	fs := newValidateConfigFlagSet(&params)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.ConfigFile == "" {
+		return nil, fmt.Errorf("missing validate-config")
+	}
+
+	params.FS = fsys
+
+	return &params, nil
+}
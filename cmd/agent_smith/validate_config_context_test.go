@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewValidateConfigContext(t *testing.T) {
+	result, _ := newValidateConfigContext([]string{"--validate-config", "config.json"}, nil)
+
+	if result.ConfigFile != "config.json" {
+		t.Errorf("expected config.json, got %v", result.ConfigFile)
+	}
+
+	errorTests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{}, "missing validate-config"},
+		{[]string{"--validate-config"}, "flag needs an argument"},
+		{[]string{"--=validate-config"}, "bad flag syntax"},
+	}
+
+	for _, errorTest := range errorTests {
+		_, err := newValidateConfigContext(errorTest.args, nil)
+
+		if err == nil || !strings.Contains(err.Error(), errorTest.message) {
+			t.Errorf("expected error %s, got %v", errorTest.message, err)
+		}
+	}
+}
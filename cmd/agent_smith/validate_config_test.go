@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const validLintConfig = `{
+	"device_id": "dev",
+	"rewst_org_id": "org",
+	"rewst_engine_host": "engine.rewst.io",
+	"shared_access_key": "key",
+	"azure_iot_hub_host": "hub.azure-devices.net",
+	"broker": "",
+	"logging_level": "info",
+	"syslog": false,
+	"plugins": null,
+	"disable_agent_postback": false,
+	"disable_auto_updates": false
+}`
+
+// lintConfigWith returns the valid config with the given top-level fields
+// replaced or added.
+func lintConfigWith(fields string) string {
+	return strings.TrimSuffix(validLintConfig, "}") + "," + fields + "}"
+}
+
+func findingAt(findings []configFinding, path string) (configFinding, bool) {
+	for _, finding := range findings {
+		if finding.Path == path {
+			return finding, true
+		}
+	}
+	return configFinding{}, false
+}
+
+func TestLintConfig_Valid(t *testing.T) {
+	if findings := lintConfig([]byte(validLintConfig)); len(findings) != 0 {
+		t.Errorf("expected no findings, got %+v", findings)
+	}
+
+	// Every broker value connects to Azure IoT Hub, so none is flagged
+	config := lintConfigWith(`"broker": "mosquitto"`)
+	if findings := lintConfig([]byte(config)); len(findings) != 0 {
+		t.Errorf("expected no findings for a broker, got %+v", findings)
+	}
+}
+
+func TestLintConfig_Findings(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		path     string
+		severity string
+		message  string
+	}{
+		{
+			"invalid json",
+			`{"device_id": `,
+			"$", findingError, "not valid JSON",
+		},
+		{
+			"not an object",
+			`[]`,
+			"$", findingError, "expected an object, got an array",
+		},
+		{
+			"unknown key with suggestion",
+			lintConfigWith(`"wroker_count": 4`),
+			"$.wroker_count", findingWarning, `did you mean "worker_count"?`,
+		},
+		{
+			"unknown key",
+			lintConfigWith(`"colour": "blue"`),
+			"$.colour", findingWarning, "unknown key",
+		},
+		{
+			"wrong type",
+			lintConfigWith(`"worker_count": "4"`),
+			"$.worker_count", findingError, "expected an integer, got a string",
+		},
+		{
+			"fractional number",
+			lintConfigWith(`"worker_count": 1.5`),
+			"$.worker_count", findingError, "expected an integer, got 1.5",
+		},
+		{
+			"qos overflow",
+			lintConfigWith(`"mqtt_qos": 300`),
+			"$.mqtt_qos", findingError, "an integer from 0 to 255",
+		},
+		{
+			"missing required field",
+			`{"device_id": "dev"}`,
+			"$.shared_access_key", findingError, "missing required field",
+		},
+		{
+			"out of range",
+			lintConfigWith(`"postback_max_attempts": 50`),
+			"$.postback_max_attempts", findingError, "must be between 1 and 20; got 50",
+		},
+		{
+			"queue smaller than workers",
+			lintConfigWith(`"worker_count": 20, "message_queue_size": 5`),
+			"$.message_queue_size", findingWarning, "smaller than worker_count 20",
+		},
+		{
+			"newer schema",
+			lintConfigWith(`"schema_version": 99`),
+			"$.schema_version", findingWarning, "written by a newer agent",
+		},
+		{
+			"unknown logging level",
+			lintConfigWith(`"logging_level": "verbose"`),
+			"$.logging_level", findingError, `unknown logging level "verbose"`,
+		},
+		{
+			"syslog address",
+			lintConfigWith(`"syslog": true, "syslog_transport": "tcp"`),
+			"$.syslog_address", findingError, "required by syslog_transport tcp",
+		},
+		{
+			"nested unknown key",
+			lintConfigWith(`"plugins": [{"name": "n", "path": "/x"}]`),
+			"$.plugins[0].path", findingWarning, "unknown key",
+		},
+		{
+			"missing plugin executable",
+			lintConfigWith(`"plugins": [{"name": "n", "executable_path": "/does/not/exist"}]`),
+			"$.plugins[0].executable_path", findingError, "cannot read /does/not/exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := lintConfig([]byte(tt.config))
+
+			finding, ok := findingAt(findings, tt.path)
+			if !ok {
+				t.Fatalf("expected a finding at %s, got %+v", tt.path, findings)
+			}
+			if finding.Severity != tt.severity || !strings.Contains(finding.Message, tt.message) {
+				t.Errorf("expected %s containing %q, got %+v", tt.severity, tt.message, finding)
+			}
+		})
+	}
+}
+
+func TestLintConfig_TypeErrorIsNotAlsoMissing(t *testing.T) {
+	findings := lintConfig([]byte(lintConfigWith(`"device_id": 42`)))
+
+	count := 0
+	for _, finding := range findings {
+		if finding.Path == "$.device_id" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected one finding for $.device_id, got %+v", findings)
+	}
+}
+
+func TestLintConfig_PluginExecutable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("execute permission is not checked on Windows")
+	}
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "plugin")
+	notExecutable := filepath.Join(dir, "plugin.txt")
+	if err := os.WriteFile(executable, []byte("#!/bin/sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(notExecutable, []byte("text"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	findings := lintConfig([]byte(lintConfigWith(fmt.Sprintf(
+		`"plugins": [{"name": "a", "executable_path": %q}, {"name": "b", "executable_path": %q}]`,
+		executable, notExecutable,
+	))))
+
+	if _, ok := findingAt(findings, "$.plugins[0].executable_path"); ok {
+		t.Errorf("expected the executable plugin to pass, got %+v", findings)
+	}
+	finding, ok := findingAt(findings, "$.plugins[1].executable_path")
+	if !ok || !strings.Contains(finding.Message, "not executable") {
+		t.Errorf("expected the second plugin to be reported, got %+v", findings)
+	}
+}
+
+func TestRunValidateConfig_ExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		readErr  error
+		wantCode int
+		wantOut  string
+	}{
+		{"valid", validLintConfig, nil, 0, "0 error(s), 0 warning(s)"},
+		{"warnings only", lintConfigWith(`"colour": "blue"`), nil, 0, "0 error(s), 1 warning(s)"},
+		{"errors", lintConfigWith(`"worker_count": 0`), nil, 1, "1 error(s), 0 warning(s)"},
+		{"unreadable", "", errors.New("permission denied"), 1, "permission denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &validateConfigContext{
+				ConfigFile: "config.json",
+				FS: &mockFileSystem{
+					readFileFunc: func(string) ([]byte, error) {
+						return []byte(tt.data), tt.readErr
+					},
+				},
+			}
+			var out bytes.Buffer
+
+			code := runValidateConfig(params, &out)
+
+			if code != tt.wantCode {
+				t.Errorf("expected exit code %d, got %d", tt.wantCode, code)
+			}
+			if !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("expected output to contain %q, got:\n%s", tt.wantOut, out.String())
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/hashicorp/go-hclog v1.6.3
 	github.com/hashicorp/go-plugin v1.6.3
+	github.com/klauspost/compress v1.20.1
 	github.com/shirou/gopsutil/v4 v4.25.1
 	golang.org/x/sys v0.45.0
 )
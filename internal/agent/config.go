@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+// CurrentSchemaVersion is the config.json schema this binary writes.
+const CurrentSchemaVersion = 1
+
+// configMigrations[i] migrates a decoded config from schema version i to i+1.
+// To change the schema, append a migration and bump CurrentSchemaVersion; a
+// migration that has shipped must never change, since configs on disk may be
+// at any earlier version.
+var configMigrations = []func(config map[string]json.RawMessage) error{
+	// 0 -> 1: schema_version is introduced; no fields change.
+	func(map[string]json.RawMessage) error { return nil },
+}
+
+// MigrateConfig migrates a config.json document to CurrentSchemaVersion. It
+// returns the migrated document and the schema version it started at. A
+// document already at, or newer than, CurrentSchemaVersion is returned as is.
+func MigrateConfig(data []byte) ([]byte, int, error) {
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, 0, err
+	}
+	if config == nil {
+		return nil, 0, fmt.Errorf("config is not a JSON object")
+	}
+
+	version := 0
+	if raw, ok := config["schema_version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, 0, fmt.Errorf("invalid schema_version: %w", err)
+		}
+	}
+	if version < 0 {
+		return nil, version, fmt.Errorf("invalid schema_version: %d", version)
+	}
+	if version >= CurrentSchemaVersion {
+		return data, version, nil
+	}
+
+	for v := version; v < CurrentSchemaVersion; v++ {
+		if err := configMigrations[v](config); err != nil {
+			return nil, version, fmt.Errorf("failed to migrate config from schema %d: %w", v, err)
+		}
+	}
+
+	config["schema_version"] = json.RawMessage(fmt.Sprint(CurrentSchemaVersion))
+	migrated, err := json.Marshal(config)
+	if err != nil {
+		return nil, version, err
+	}
+	return migrated, version, nil
+}
+
+// ParseConfig migrates a config.json document and decodes it. It also returns
+// the schema version the document was written with, so a caller that rewrites
+// the config can back up the original when it was migrated.
+func ParseConfig(data []byte) (Device, int, error) {
+	var device Device
+
+	migrated, version, err := MigrateConfig(data)
+	if err != nil {
+		return device, version, err
+	}
+
+	err = json.Unmarshal(migrated, &device)
+	return device, version, err
+}
+
+// BackupConfigFile keeps a copy of a config before a migrated version replaces
+// it, named after the schema version it was written with, and returns the
+// backup path.
+func BackupConfigFile(fs utils.FileSystem, path string, data []byte, version int) (string, error) {
+	backupPath := fmt.Sprintf("%s.v%d.bak", path, version)
+	return backupPath, fs.WriteFile(backupPath, data, utils.SecretFileMod)
+}
+
+// WriteConfigFile writes the device config to path, stamped with the schema
+// version, readable only by its owner since it holds the shared access key. A config written by a newer release keeps its version, since its
+// fields are preserved in Unknown.
+func WriteConfigFile(fs utils.FileSystem, path string, device Device) error {
+	device.SchemaVersion = max(device.SchemaVersion, CurrentSchemaVersion)
+
+	data, err := json.MarshalIndent(device, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fs.WriteFile(path, data, utils.SecretFileMod)
+}
+
+// deviceFields has the fields of Device without its JSON methods.
+type deviceFields Device
+
+var (
+	knownFieldsOnce sync.Once
+	knownFields     map[string]bool
+)
+
+// deviceJSONNames returns the JSON names of the fields Device decodes.
+func deviceJSONNames() map[string]bool {
+	knownFieldsOnce.Do(func() {
+		knownFields = map[string]bool{}
+		t := reflect.TypeOf(Device{})
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name != "" && name != "-" {
+				knownFields[name] = true
+			}
+		}
+	})
+	return knownFields
+}
+
+// UnmarshalJSON decodes the config and keeps the fields Device does not
+// declare in Unknown.
+func (d *Device) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*deviceFields)(d)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	d.Unknown = nil
+	known := deviceJSONNames()
+	for name, value := range fields {
+		if known[name] {
+			continue
+		}
+		if d.Unknown == nil {
+			d.Unknown = map[string]json.RawMessage{}
+		}
+		d.Unknown[name] = value
+	}
+	return nil
+}
+
+// MarshalJSON encodes the config followed by the fields in Unknown, sorted by
+// name.
+func (d Device) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(deviceFields(d))
+	if err != nil || len(d.Unknown) == 0 {
+		return data, err
+	}
+
+	names := make([]string, 0, len(d.Unknown))
+	known := deviceJSONNames()
+	for name := range d.Unknown {
+		if !known[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	for _, name := range names {
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(d.Unknown[name])
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
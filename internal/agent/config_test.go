@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantVersion int
+		wantSchema  string
+		wantErr     string
+	}{
+		{"unversioned", `{"device_id":"d"}`, 0, "1", ""},
+		{"current", `{"schema_version":1,"device_id":"d"}`, 1, "1", ""},
+		{"newer", `{"schema_version":7,"device_id":"d"}`, 7, "7", ""},
+		{"negative", `{"schema_version":-1}`, -1, "", "invalid schema_version"},
+		{"wrong type", `{"schema_version":"1"}`, 0, "", "invalid schema_version"},
+		{"not an object", `null`, 0, "", "not a JSON object"},
+		{"invalid json", `{`, 0, "", "unexpected end"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrated, version, err := MigrateConfig([]byte(tt.data))
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if version != tt.wantVersion {
+				t.Errorf("expected version %d, got %d", tt.wantVersion, version)
+			}
+
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(migrated, &fields); err != nil {
+				t.Fatalf("migrated config is not JSON: %v", err)
+			}
+			if string(fields["schema_version"]) != tt.wantSchema {
+				t.Errorf("expected schema_version %s, got %s",
+					tt.wantSchema, fields["schema_version"])
+			}
+			if string(fields["device_id"]) != `"d"` {
+				t.Errorf("expected device_id to survive migration, got %s", fields["device_id"])
+			}
+		})
+	}
+}
+
+func TestConfigMigrationsCoverEverySchema(t *testing.T) {
+	if len(configMigrations) != CurrentSchemaVersion {
+		t.Errorf("expected %d migrations, got %d", CurrentSchemaVersion, len(configMigrations))
+	}
+}
+
+func TestDeviceJSON_PreservesUnknownFields(t *testing.T) {
+	data := `{"device_id":"d","future_flag":true,"future_list":[1,2]}`
+
+	var device Device
+	if err := json.Unmarshal([]byte(data), &device); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if device.DeviceId != "d" {
+		t.Errorf("expected device_id d, got %q", device.DeviceId)
+	}
+	if len(device.Unknown) != 2 || string(device.Unknown["future_list"]) != "[1,2]" {
+		t.Errorf("expected the unknown fields to be kept, got %v", device.Unknown)
+	}
+
+	encoded, err := json.Marshal(device)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(string(encoded), `,"future_flag":true,"future_list":[1,2]}`) {
+		t.Errorf("expected the unknown fields after the known ones, got %s", encoded)
+	}
+
+	var roundTrip Device
+	if err := json.Unmarshal(encoded, &roundTrip); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(roundTrip.Unknown) != 2 || roundTrip.DeviceId != "d" {
+		t.Errorf("expected the round trip to be lossless, got %+v", roundTrip)
+	}
+}
+
+func TestDeviceJSON_UnknownCannotShadowKnownField(t *testing.T) {
+	device := Device{
+		DeviceId: "d",
+		Unknown:  map[string]json.RawMessage{"device_id": json.RawMessage(`"other"`)},
+	}
+
+	encoded, err := json.Marshal(device)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Count(string(encoded), `"device_id"`) != 1 {
+		t.Errorf("expected device_id once, got %s", encoded)
+	}
+}
+
+func TestParseConfig_Migrates(t *testing.T) {
+	device, version, err := ParseConfig([]byte(`{"device_id":"d"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != 0 || device.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("expected migration from 0 to %d, got %d to %d",
+			CurrentSchemaVersion, version, device.SchemaVersion)
+	}
+	if device.Unknown != nil {
+		t.Errorf("expected no unknown fields, got %v", device.Unknown)
+	}
+}
+
+func TestWriteConfigFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    int
+		wantSchema int
+	}{
+		{"stamps current version", 0, CurrentSchemaVersion},
+		{"keeps newer version", CurrentSchemaVersion + 1, CurrentSchemaVersion + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/config.json"
+			device := Device{SchemaVersion: tt.version, DeviceId: "d"}
+
+			if err := WriteConfigFile(utils.NewFileSystem(), path, device); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			written, _, err := ParseConfig(data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if written.SchemaVersion != tt.wantSchema {
+				t.Errorf("expected schema_version %d, got %d", tt.wantSchema, written.SchemaVersion)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if runtime.GOOS != "windows" && info.Mode().Perm() != utils.SecretFileMod {
+				t.Errorf("expected mode %v, got %v", utils.SecretFileMod, info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestBackupConfigFile(t *testing.T) {
+	path := t.TempDir() + "/config.json"
+
+	backupPath, err := BackupConfigFile(utils.NewFileSystem(), path, []byte(`{}`), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if backupPath != path+".v0.bak" {
+		t.Errorf("expected %s.v0.bak, got %s", path, backupPath)
+	}
+	if data, err := os.ReadFile(backupPath); err != nil || string(data) != `{}` {
+		t.Errorf("expected the original config in the backup, got %q, %v", data, err)
+	}
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != utils.SecretFileMod {
+		t.Errorf("expected mode %v, got %v", utils.SecretFileMod, info.Mode().Perm())
+	}
+}
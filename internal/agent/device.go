@@ -1,12 +1,20 @@
 package agent
 
 import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/RewstApp/agent-smith-go/internal/utils"
 )
 
 type Device struct {
+	// SchemaVersion is the config.json schema the file was written with. A
+	// config without it predates versioning and is schema version 0; ParseConfig
+	// migrates older configs to CurrentSchemaVersion.
+	SchemaVersion        int                `json:"schema_version"`
 	DeviceId             string             `json:"device_id"`
 	RewstOrgId           string             `json:"rewst_org_id"`
 	RewstEngineHost      string             `json:"rewst_engine_host"`
@@ -73,6 +81,16 @@ type Device struct {
 	// legitimately returns very large results, lower it to tighten the memory
 	// ceiling.
 	MaxOutputBytes *int `json:"max_output_bytes,omitempty"`
+	// OutputOverflow selects what happens to command output past MaxOutputBytes:
+	// "truncate" (the default) discards it, while "upload" spills the stream to
+	// a file in the scripts directory and uploads it to the engine in chunks once
+	// the command finishes, so the result can reference the full output.
+	OutputOverflow string `json:"output_overflow,omitempty"`
+	// OutputSpillMaxBytes optionally overrides how much disk the spill files of
+	// all running commands may use together. When unset (or non-positive) the
+	// agent falls back to DefaultOutputSpillMaxBytes. Output past it is
+	// discarded, and the upload is marked truncated.
+	OutputSpillMaxBytes *int `json:"output_spill_max_bytes,omitempty"`
 	// SasTokenLifetimeHours optionally overrides the lifetime of the Azure IoT
 	// Hub SAS token minted for each MQTT connection, in hours. When unset (or
 	// non-positive) the agent falls back to utils.DefaultSasTokenLifetime. Azure
@@ -81,6 +99,93 @@ type Device struct {
 	// deadline (see utils.SasTokenRenewMargin), so a longer lifetime means less
 	// frequent — but always graceful — reconnects.
 	SasTokenLifetimeHours *int `json:"sas_token_lifetime_hours,omitempty"`
+	// SyslogTransport selects how log lines reach syslog when UseSyslog is set.
+	// When empty the platform default is kept: the logger binary on Linux and
+	// macOS, the Event Log on Windows. "local" writes straight to the local
+	// daemon socket (/dev/log) without spawning a process per line, while "udp",
+	// "tcp" and "tls" ship messages to the remote collector at SyslogAddress.
+	SyslogTransport string `json:"syslog_transport,omitempty"`
+	// SyslogAddress is the host:port of the remote collector for the udp, tcp
+	// and tls transports, or an optional socket path for the local transport.
+	SyslogAddress string `json:"syslog_address,omitempty"`
+	// SyslogFormat selects the message layout: "rfc5424" or "rfc3164". When
+	// unset the local transport uses rfc3164, which every local daemon parses,
+	// and the network transports use rfc5424.
+	SyslogFormat string `json:"syslog_format,omitempty"`
+	// SyslogFacility is the facility name messages are logged under (e.g.
+	// "daemon", "local3"). When unset it falls back to "daemon", matching the
+	// priorities the logger-based writer has always used.
+	SyslogFacility string `json:"syslog_facility,omitempty"`
+	// SyslogAppName overrides the APP-NAME (rfc5424) or TAG (rfc3164) of each
+	// message. When unset the service name is used.
+	SyslogAppName string `json:"syslog_app_name,omitempty"`
+	// SyslogBufferSize optionally overrides how many messages may wait to be
+	// sent to the collector. When unset (or non-positive) the agent falls back
+	// to DefaultSyslogBufferSize. Messages past the buffer are dropped rather
+	// than blocking the agent on a slow or unreachable collector; the log file
+	// always keeps every line.
+	SyslogBufferSize *int `json:"syslog_buffer_size,omitempty"`
+	// UseJournald additionally writes every log entry to systemd-journald over
+	// its native socket (Linux only), with key/value pairs such as post_id
+	// kept as journal fields (POST_ID) that journalctl can filter on.
+	UseJournald bool `json:"journald,omitempty"`
+	// SpoolMaxEntries optionally overrides how many undelivered postbacks the
+	// on-disk spool retains. When unset (or non-positive) the agent falls back
+	// to DefaultSpoolMaxEntries.
+	SpoolMaxEntries *int `json:"spool_max_entries,omitempty"`
+	// SpoolMaxAgeHours optionally overrides how long an undelivered postback is
+	// retained, in hours. When unset (or non-positive) the agent falls back to
+	// DefaultSpoolMaxAge.
+	SpoolMaxAgeHours *int `json:"spool_max_age_hours,omitempty"`
+	// SpoolMaxBytes optionally overrides the total size the spooled entries may
+	// take on disk. When unset (or non-positive) the agent falls back to
+	// DefaultSpoolMaxBytes.
+	SpoolMaxBytes *int `json:"spool_max_bytes,omitempty"`
+	// SpoolEvictionPolicy selects which entries are evicted when the spool is
+	// over its entry count or size budget: "oldest" (the default) or "largest".
+	SpoolEvictionPolicy string `json:"spool_eviction_policy,omitempty"`
+	// SpoolDrainConcurrency optionally overrides how many spooled results the
+	// background drainer delivers at once. When unset (or non-positive) the
+	// agent falls back to DefaultSpoolDrainConcurrency.
+	SpoolDrainConcurrency *int `json:"spool_drain_concurrency,omitempty"`
+	// SpoolDrainRatePerMinute optionally overrides how many spooled results the
+	// background drainer starts delivering per minute, so a large backlog does
+	// not flood an engine that just recovered. When unset (or non-positive) the
+	// agent falls back to DefaultSpoolDrainRatePerMinute.
+	SpoolDrainRatePerMinute *int `json:"spool_drain_rate_per_minute,omitempty"`
+	// PostbackBreakerThreshold optionally overrides how many consecutive
+	// transient postback failures open the circuit breaker, after which new
+	// results are spooled without being attempted. When unset (or non-positive)
+	// the agent falls back to DefaultPostbackBreakerThreshold.
+	PostbackBreakerThreshold *int `json:"postback_breaker_threshold,omitempty"`
+	// PostbackBreakerCooldownSeconds optionally overrides how long an open
+	// circuit breaker waits before letting a probe postback through, in seconds.
+	// When unset (or non-positive) the agent falls back to
+	// DefaultPostbackBreakerCooldown.
+	PostbackBreakerCooldownSeconds *int `json:"postback_breaker_cooldown_seconds,omitempty"`
+	// PostbackCompression selects the Content-Encoding of large postback
+	// bodies: "none" (the default), "gzip" or "zstd".
+	PostbackCompression string `json:"postback_compression,omitempty"`
+	// PostbackCompressionMinBytes optionally overrides the body size from which
+	// postbacks are compressed. When unset (or non-positive) the agent falls
+	// back to DefaultPostbackCompressionMinBytes.
+	PostbackCompressionMinBytes *int `json:"postback_compression_min_bytes,omitempty"`
+	// RewstEngineAlternateHosts lists engine hosts that postbacks fail over to,
+	// in order, when RewstEngineHost does not answer. See EngineHosts.
+	RewstEngineAlternateHosts []string `json:"rewst_engine_alternate_hosts,omitempty"`
+	// PostbackPathTemplate optionally overrides the path postbacks are sent to
+	// on the engine host, for regional or proxied engine deployments.
+	// PostbackPathPostId in it is replaced with the message's post id. When
+	// unset the agent falls back to DefaultPostbackPathTemplate.
+	PostbackPathTemplate string `json:"postback_path_template,omitempty"`
+	// ServiceUsername is the account the service was registered to run as, or
+	// empty for the platform default. It is recorded so repair mode can
+	// re-register the service under the same account. The password is never
+	// stored.
+	ServiceUsername string `json:"service_username,omitempty"`
+	// Unknown holds the config fields this binary does not recognize, such as
+	// those added by a newer release, so that rewriting the config keeps them.
+	Unknown map[string]json.RawMessage `json:"-"`
 }
 
 const (
@@ -116,8 +221,149 @@ const (
 	// the agent to a small constant multiple of it instead of tracking however
 	// much the script decides to write.
 	DefaultMaxOutputBytes = 10 * 1024 * 1024
+	// DefaultOutputSpillMaxBytes is how much disk the output spill files may use
+	// together when OutputSpillMaxBytes is not configured.
+	DefaultOutputSpillMaxBytes = 1024 * 1024 * 1024
+	// DefaultSyslogBufferSize is how many messages the native syslog writer
+	// queues for the collector when SyslogBufferSize is not configured.
+	DefaultSyslogBufferSize = 1000
+	// DefaultSpoolMaxEntries is how many undelivered postbacks the spool
+	// retains when SpoolMaxEntries is not configured.
+	DefaultSpoolMaxEntries = 100
+	// DefaultSpoolMaxAge is how long an undelivered postback is retained when
+	// SpoolMaxAgeHours is not configured.
+	DefaultSpoolMaxAge = 24 * time.Hour
+	// DefaultSpoolMaxBytes is the total size of the spooled entries when
+	// SpoolMaxBytes is not configured.
+	DefaultSpoolMaxBytes = 256 * 1024 * 1024
+	// DefaultSpoolDrainConcurrency is how many spooled results are delivered at
+	// once when SpoolDrainConcurrency is not configured.
+	DefaultSpoolDrainConcurrency = 2
+	// DefaultSpoolDrainRatePerMinute is how many spooled results are delivered
+	// per minute when SpoolDrainRatePerMinute is not configured.
+	DefaultSpoolDrainRatePerMinute = 60
+	// DefaultPostbackBreakerThreshold is how many consecutive transient postback
+	// failures open the circuit breaker when PostbackBreakerThreshold is not
+	// configured.
+	DefaultPostbackBreakerThreshold = 5
+	// DefaultPostbackBreakerCooldown is how long an open circuit breaker waits
+	// before probing the engine when PostbackBreakerCooldownSeconds is not
+	// configured.
+	DefaultPostbackBreakerCooldown = 30 * time.Second
+	// DefaultPostbackCompressionMinBytes is the body size from which postbacks
+	// are compressed when PostbackCompressionMinBytes is not configured. Smaller
+	// bodies gain little and cost the engine a decode.
+	DefaultPostbackCompressionMinBytes = 64 * 1024
+)
+
+// Eviction policies for SpoolEvictionPolicy.
+const (
+	SpoolEvictOldest  = "oldest"
+	SpoolEvictLargest = "largest"
 )
 
+// ParseSpoolEvictionPolicy returns the normalized eviction policy for value,
+// where empty means SpoolEvictOldest.
+func ParseSpoolEvictionPolicy(value string) (string, error) {
+	switch policy := strings.ToLower(value); policy {
+	case "":
+		return SpoolEvictOldest, nil
+	case SpoolEvictOldest, SpoolEvictLargest:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown spool eviction policy %q: must be oldest or largest", value)
+	}
+}
+
+// PostbackPathPostId is the placeholder in PostbackPathTemplate replaced with
+// the message's post id, its colons turned into slashes.
+const PostbackPathPostId = "{post_id}"
+
+// DefaultPostbackPathTemplate is the postback path used when
+// PostbackPathTemplate is not configured.
+const DefaultPostbackPathTemplate = "/webhooks/custom/action/" + PostbackPathPostId
+
+// ParsePostbackPathTemplate returns the postback path template for value,
+// where empty means DefaultPostbackPathTemplate. A template must be an
+// absolute path containing PostbackPathPostId.
+func ParsePostbackPathTemplate(value string) (string, error) {
+	switch {
+	case value == "":
+		return DefaultPostbackPathTemplate, nil
+	case !strings.HasPrefix(value, "/"):
+		return "", fmt.Errorf("postback path template %q must start with /", value)
+	case !strings.Contains(value, PostbackPathPostId):
+		return "", fmt.Errorf(
+			"postback path template %q must contain %s",
+			value,
+			PostbackPathPostId,
+		)
+	case strings.ContainsAny(value, "?# \t"):
+		return "", fmt.Errorf("postback path template %q must be a plain path", value)
+	default:
+		return value, nil
+	}
+}
+
+// ResolvedPostbackPathTemplate returns the configured postback path template,
+// falling back to DefaultPostbackPathTemplate when it is unset or invalid.
+func (d Device) ResolvedPostbackPathTemplate() string {
+	template, err := ParsePostbackPathTemplate(d.PostbackPathTemplate)
+	if err != nil {
+		return DefaultPostbackPathTemplate
+	}
+	return template
+}
+
+// ParseEngineHosts splits a comma-separated list of engine hosts, as accepted
+// by --engine-alternate-hosts. Each host is a name or address with an optional
+// port, without a scheme or path. An empty value gives no hosts.
+func ParseEngineHosts(value string) ([]string, error) {
+	var hosts []string
+	for host := range strings.SplitSeq(value, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if err := validateEngineHost(host); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+func validateEngineHost(host string) error {
+	if host == "" || strings.ContainsAny(host, "/?#@ \t") {
+		return fmt.Errorf("engine host %q must be a host name with an optional port", host)
+	}
+	return nil
+}
+
+// ValidateEngineAlternateHosts reports the first invalid entry of
+// RewstEngineAlternateHosts.
+func (d Device) ValidateEngineAlternateHosts() error {
+	for _, host := range d.RewstEngineAlternateHosts {
+		if err := validateEngineHost(host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EngineHosts returns the engine hosts postbacks may be sent to, in order of
+// preference: RewstEngineHost, then each of RewstEngineAlternateHosts not
+// already listed.
+func (d Device) EngineHosts() []string {
+	hosts := []string{d.RewstEngineHost}
+	for _, host := range d.RewstEngineAlternateHosts {
+		if host != "" && !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
 // ResolvedWorkerCount returns the number of command-execution workers to start,
 // honoring the per-device override when set to a positive value and falling back
 // to DefaultWorkerCount otherwise.
@@ -180,6 +426,182 @@ func (d Device) ResolvedMaxOutputBytes() int {
 	return DefaultMaxOutputBytes
 }
 
+// ResolvedSyslogBufferSize returns how many messages the native syslog writer
+// may queue, honoring the per-device override when set to a positive value and
+// falling back to DefaultSyslogBufferSize otherwise.
+func (d Device) ResolvedSyslogBufferSize() int {
+	if d.SyslogBufferSize != nil && *d.SyslogBufferSize > 0 {
+		return *d.SyslogBufferSize
+	}
+	return DefaultSyslogBufferSize
+}
+
+// Modes for OutputOverflow.
+const (
+	OutputOverflowTruncate = "truncate"
+	OutputOverflowUpload   = "upload"
+)
+
+// ParseOutputOverflow returns the normalized output overflow mode for value,
+// where empty means OutputOverflowTruncate.
+func ParseOutputOverflow(value string) (string, error) {
+	switch mode := strings.ToLower(value); mode {
+	case "":
+		return OutputOverflowTruncate, nil
+	case OutputOverflowTruncate, OutputOverflowUpload:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown output overflow %q: must be truncate or upload", value)
+	}
+}
+
+// ResolvedOutputOverflow returns the configured output overflow mode, falling
+// back to OutputOverflowTruncate when it is unset or not recognized.
+func (d Device) ResolvedOutputOverflow() string {
+	mode, err := ParseOutputOverflow(d.OutputOverflow)
+	if err != nil {
+		return OutputOverflowTruncate
+	}
+	return mode
+}
+
+// ResolvedOutputSpillMaxBytes returns how much disk the output spill files may
+// use together, honoring the per-device override when set to a positive value
+// and falling back to DefaultOutputSpillMaxBytes otherwise.
+func (d Device) ResolvedOutputSpillMaxBytes() int64 {
+	if d.OutputSpillMaxBytes != nil && *d.OutputSpillMaxBytes > 0 {
+		return int64(*d.OutputSpillMaxBytes)
+	}
+	return DefaultOutputSpillMaxBytes
+}
+
+// Encodings for PostbackCompression.
+const (
+	PostbackCompressionNone = "none"
+	PostbackCompressionGzip = "gzip"
+	PostbackCompressionZstd = "zstd"
+)
+
+// ParsePostbackCompression returns the normalized postback compression for
+// value, where empty means PostbackCompressionNone.
+func ParsePostbackCompression(value string) (string, error) {
+	switch compression := strings.ToLower(value); compression {
+	case "":
+		return PostbackCompressionNone, nil
+	case PostbackCompressionNone, PostbackCompressionGzip, PostbackCompressionZstd:
+		return compression, nil
+	default:
+		return "", fmt.Errorf(
+			"unknown postback compression %q: must be none, gzip or zstd",
+			value,
+		)
+	}
+}
+
+// ResolvedPostbackCompression returns the configured postback compression,
+// falling back to PostbackCompressionNone when it is unset or not recognized.
+func (d Device) ResolvedPostbackCompression() string {
+	compression, err := ParsePostbackCompression(d.PostbackCompression)
+	if err != nil {
+		return PostbackCompressionNone
+	}
+	return compression
+}
+
+// ResolvedPostbackCompressionMinBytes returns the body size from which
+// postbacks are compressed, honoring the per-device override when set to a
+// positive value and falling back to DefaultPostbackCompressionMinBytes
+// otherwise.
+func (d Device) ResolvedPostbackCompressionMinBytes() int {
+	if d.PostbackCompressionMinBytes != nil && *d.PostbackCompressionMinBytes > 0 {
+		return *d.PostbackCompressionMinBytes
+	}
+	return DefaultPostbackCompressionMinBytes
+}
+
+// ResolvedSpoolMaxEntries returns how many undelivered postbacks the spool
+// retains, honoring the per-device override when set to a positive value and
+// falling back to DefaultSpoolMaxEntries otherwise.
+func (d Device) ResolvedSpoolMaxEntries() int {
+	if d.SpoolMaxEntries != nil && *d.SpoolMaxEntries > 0 {
+		return *d.SpoolMaxEntries
+	}
+	return DefaultSpoolMaxEntries
+}
+
+// ResolvedSpoolMaxAge returns how long an undelivered postback is retained,
+// honoring the per-device override when set to a positive value and falling
+// back to DefaultSpoolMaxAge otherwise.
+func (d Device) ResolvedSpoolMaxAge() time.Duration {
+	if d.SpoolMaxAgeHours != nil && *d.SpoolMaxAgeHours > 0 {
+		return time.Duration(*d.SpoolMaxAgeHours) * time.Hour
+	}
+	return DefaultSpoolMaxAge
+}
+
+// ResolvedSpoolMaxBytes returns the total size the spooled entries may take,
+// honoring the per-device override when set to a positive value and falling
+// back to DefaultSpoolMaxBytes otherwise.
+func (d Device) ResolvedSpoolMaxBytes() int64 {
+	if d.SpoolMaxBytes != nil && *d.SpoolMaxBytes > 0 {
+		return int64(*d.SpoolMaxBytes)
+	}
+	return DefaultSpoolMaxBytes
+}
+
+// ResolvedSpoolDrainConcurrency returns how many spooled results are delivered
+// at once, honoring the per-device override when set to a positive value and
+// falling back to DefaultSpoolDrainConcurrency otherwise.
+func (d Device) ResolvedSpoolDrainConcurrency() int {
+	if d.SpoolDrainConcurrency != nil && *d.SpoolDrainConcurrency > 0 {
+		return *d.SpoolDrainConcurrency
+	}
+	return DefaultSpoolDrainConcurrency
+}
+
+// ResolvedSpoolDrainInterval returns the pause between starting two spooled
+// deliveries, derived from the per-device rate when set to a positive value
+// and from DefaultSpoolDrainRatePerMinute otherwise.
+func (d Device) ResolvedSpoolDrainInterval() time.Duration {
+	rate := DefaultSpoolDrainRatePerMinute
+	if d.SpoolDrainRatePerMinute != nil && *d.SpoolDrainRatePerMinute > 0 {
+		rate = *d.SpoolDrainRatePerMinute
+	}
+	return time.Minute / time.Duration(rate)
+}
+
+// ResolvedPostbackBreakerThreshold returns how many consecutive transient
+// postback failures open the circuit breaker, honoring the per-device override
+// when set to a positive value and falling back to
+// DefaultPostbackBreakerThreshold otherwise.
+func (d Device) ResolvedPostbackBreakerThreshold() int {
+	if d.PostbackBreakerThreshold != nil && *d.PostbackBreakerThreshold > 0 {
+		return *d.PostbackBreakerThreshold
+	}
+	return DefaultPostbackBreakerThreshold
+}
+
+// ResolvedPostbackBreakerCooldown returns how long an open circuit breaker
+// waits before probing the engine, honoring the per-device override when set
+// to a positive value and falling back to DefaultPostbackBreakerCooldown
+// otherwise.
+func (d Device) ResolvedPostbackBreakerCooldown() time.Duration {
+	if d.PostbackBreakerCooldownSeconds != nil && *d.PostbackBreakerCooldownSeconds > 0 {
+		return time.Duration(*d.PostbackBreakerCooldownSeconds) * time.Second
+	}
+	return DefaultPostbackBreakerCooldown
+}
+
+// ResolvedSpoolEvictionPolicy returns the configured eviction policy, falling
+// back to SpoolEvictOldest when it is unset or not recognized.
+func (d Device) ResolvedSpoolEvictionPolicy() string {
+	policy, err := ParseSpoolEvictionPolicy(d.SpoolEvictionPolicy)
+	if err != nil {
+		return SpoolEvictOldest
+	}
+	return policy
+}
+
 // MqttConnectTimeout returns the per-attempt MQTT connect timeout, honoring the
 // per-device override when set and falling back to the documented default.
 func (d Device) MqttConnectTimeout() time.Duration {
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"slices"
 	"testing"
 	"time"
 
@@ -124,6 +125,186 @@ func TestResolvedMaxOutputBytes(t *testing.T) {
 	}
 }
 
+func TestResolvedSyslogBufferSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  *int
+		expect int
+	}{
+		{"unset falls back to default", nil, DefaultSyslogBufferSize},
+		{"zero falls back to default", intPtr(0), DefaultSyslogBufferSize},
+		{"positive override honored", intPtr(50), 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Device{SyslogBufferSize: tt.value}
+			if got := d.ResolvedSyslogBufferSize(); got != tt.expect {
+				t.Errorf("ResolvedSyslogBufferSize() = %d, want %d", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestResolvedSpoolLimits(t *testing.T) {
+	d := Device{}
+	if got := d.ResolvedSpoolMaxEntries(); got != DefaultSpoolMaxEntries {
+		t.Errorf("ResolvedSpoolMaxEntries() = %d, want %d", got, DefaultSpoolMaxEntries)
+	}
+	if got := d.ResolvedSpoolMaxAge(); got != DefaultSpoolMaxAge {
+		t.Errorf("ResolvedSpoolMaxAge() = %v, want %v", got, DefaultSpoolMaxAge)
+	}
+	if got := d.ResolvedSpoolMaxBytes(); got != DefaultSpoolMaxBytes {
+		t.Errorf("ResolvedSpoolMaxBytes() = %d, want %d", got, DefaultSpoolMaxBytes)
+	}
+
+	d = Device{
+		SpoolMaxEntries:  intPtr(500),
+		SpoolMaxAgeHours: intPtr(72),
+		SpoolMaxBytes:    intPtr(1 << 20),
+	}
+	if got := d.ResolvedSpoolMaxEntries(); got != 500 {
+		t.Errorf("ResolvedSpoolMaxEntries() = %d, want 500", got)
+	}
+	if got := d.ResolvedSpoolMaxAge(); got != 72*time.Hour {
+		t.Errorf("ResolvedSpoolMaxAge() = %v, want 72h", got)
+	}
+	if got := d.ResolvedSpoolMaxBytes(); got != 1<<20 {
+		t.Errorf("ResolvedSpoolMaxBytes() = %d, want %d", got, 1<<20)
+	}
+}
+
+func TestResolvedSpoolEvictionPolicy(t *testing.T) {
+	tests := []struct {
+		value  string
+		expect string
+	}{
+		{"", SpoolEvictOldest},
+		{"oldest", SpoolEvictOldest},
+		{"LARGEST", SpoolEvictLargest},
+		{"newest", SpoolEvictOldest},
+	}
+
+	for _, tt := range tests {
+		d := Device{SpoolEvictionPolicy: tt.value}
+		if got := d.ResolvedSpoolEvictionPolicy(); got != tt.expect {
+			t.Errorf("ResolvedSpoolEvictionPolicy(%q) = %q, want %q", tt.value, got, tt.expect)
+		}
+	}
+
+	if _, err := ParseSpoolEvictionPolicy("newest"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestResolvedPostbackCompression(t *testing.T) {
+	tests := []struct {
+		value  string
+		expect string
+	}{
+		{"", PostbackCompressionNone},
+		{"gzip", PostbackCompressionGzip},
+		{"ZSTD", PostbackCompressionZstd},
+		{"brotli", PostbackCompressionNone},
+	}
+
+	for _, tt := range tests {
+		d := Device{PostbackCompression: tt.value}
+		if got := d.ResolvedPostbackCompression(); got != tt.expect {
+			t.Errorf("ResolvedPostbackCompression(%q) = %q, want %q", tt.value, got, tt.expect)
+		}
+	}
+
+	if _, err := ParsePostbackCompression("brotli"); err == nil {
+		t.Error("expected an error for an unknown compression")
+	}
+
+	d := Device{}
+	if got := d.ResolvedPostbackCompressionMinBytes(); got != DefaultPostbackCompressionMinBytes {
+		t.Errorf("ResolvedPostbackCompressionMinBytes() = %d, want the default", got)
+	}
+	d = Device{PostbackCompressionMinBytes: intPtr(1024)}
+	if got := d.ResolvedPostbackCompressionMinBytes(); got != 1024 {
+		t.Errorf("ResolvedPostbackCompressionMinBytes() = %d, want 1024", got)
+	}
+}
+
+func TestResolvedSpoolDrain(t *testing.T) {
+	d := Device{}
+	if got := d.ResolvedSpoolDrainConcurrency(); got != DefaultSpoolDrainConcurrency {
+		t.Errorf("ResolvedSpoolDrainConcurrency() = %d, want the default", got)
+	}
+	if got := d.ResolvedSpoolDrainInterval(); got != time.Second {
+		t.Errorf("ResolvedSpoolDrainInterval() = %v, want 1s", got)
+	}
+
+	d = Device{SpoolDrainConcurrency: intPtr(4), SpoolDrainRatePerMinute: intPtr(600)}
+	if got := d.ResolvedSpoolDrainConcurrency(); got != 4 {
+		t.Errorf("ResolvedSpoolDrainConcurrency() = %d, want 4", got)
+	}
+	if got := d.ResolvedSpoolDrainInterval(); got != 100*time.Millisecond {
+		t.Errorf("ResolvedSpoolDrainInterval() = %v, want 100ms", got)
+	}
+
+	d = Device{SpoolDrainConcurrency: intPtr(0), SpoolDrainRatePerMinute: intPtr(-1)}
+	if got := d.ResolvedSpoolDrainConcurrency(); got != DefaultSpoolDrainConcurrency {
+		t.Errorf("ResolvedSpoolDrainConcurrency() = %d, want the default", got)
+	}
+	if got := d.ResolvedSpoolDrainInterval(); got != time.Second {
+		t.Errorf("ResolvedSpoolDrainInterval() = %v, want 1s", got)
+	}
+}
+
+func TestResolvedPostbackBreaker(t *testing.T) {
+	d := Device{}
+	if got := d.ResolvedPostbackBreakerThreshold(); got != DefaultPostbackBreakerThreshold {
+		t.Errorf("ResolvedPostbackBreakerThreshold() = %d, want the default", got)
+	}
+	if got := d.ResolvedPostbackBreakerCooldown(); got != DefaultPostbackBreakerCooldown {
+		t.Errorf("ResolvedPostbackBreakerCooldown() = %v, want the default", got)
+	}
+
+	d = Device{PostbackBreakerThreshold: intPtr(2), PostbackBreakerCooldownSeconds: intPtr(90)}
+	if got := d.ResolvedPostbackBreakerThreshold(); got != 2 {
+		t.Errorf("ResolvedPostbackBreakerThreshold() = %d, want 2", got)
+	}
+	if got := d.ResolvedPostbackBreakerCooldown(); got != 90*time.Second {
+		t.Errorf("ResolvedPostbackBreakerCooldown() = %v, want 90s", got)
+	}
+}
+
+func TestResolvedOutputOverflow(t *testing.T) {
+	tests := []struct {
+		value  string
+		expect string
+	}{
+		{"", OutputOverflowTruncate},
+		{"truncate", OutputOverflowTruncate},
+		{"Upload", OutputOverflowUpload},
+		{"stream", OutputOverflowTruncate},
+	}
+
+	for _, tt := range tests {
+		d := Device{OutputOverflow: tt.value}
+		if got := d.ResolvedOutputOverflow(); got != tt.expect {
+			t.Errorf("ResolvedOutputOverflow(%q) = %q, want %q", tt.value, got, tt.expect)
+		}
+	}
+
+	if _, err := ParseOutputOverflow("stream"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+
+	d := Device{}
+	if got := d.ResolvedOutputSpillMaxBytes(); got != DefaultOutputSpillMaxBytes {
+		t.Errorf("ResolvedOutputSpillMaxBytes() = %d, want the default", got)
+	}
+	d = Device{OutputSpillMaxBytes: intPtr(1 << 20)}
+	if got := d.ResolvedOutputSpillMaxBytes(); got != 1<<20 {
+		t.Errorf("ResolvedOutputSpillMaxBytes() = %d, want %d", got, 1<<20)
+	}
+}
+
 func TestSasTokenLifetime(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -247,3 +428,54 @@ func TestMqttConnectTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestResolvedPostbackPathTemplate(t *testing.T) {
+	tests := []struct {
+		value  string
+		expect string
+	}{
+		{"", DefaultPostbackPathTemplate},
+		{"/rewst/{post_id}/result", "/rewst/{post_id}/result"},
+		{"webhooks/{post_id}", DefaultPostbackPathTemplate},
+		{"/webhooks/custom/action", DefaultPostbackPathTemplate},
+		{"/webhooks/{post_id}?x=1", DefaultPostbackPathTemplate},
+	}
+
+	for _, tt := range tests {
+		d := Device{PostbackPathTemplate: tt.value}
+		if got := d.ResolvedPostbackPathTemplate(); got != tt.expect {
+			t.Errorf("ResolvedPostbackPathTemplate(%q) = %q, want %q", tt.value, got, tt.expect)
+		}
+	}
+}
+
+func TestEngineHosts(t *testing.T) {
+	hosts, err := ParseEngineHosts(" eu.example.com,,proxy.example.com:8443 ")
+	if err != nil {
+		t.Fatalf("ParseEngineHosts: %v", err)
+	}
+	if want := []string{"eu.example.com", "proxy.example.com:8443"}; !slices.Equal(hosts, want) {
+		t.Errorf("ParseEngineHosts = %v, want %v", hosts, want)
+	}
+	for _, bad := range []string{"https://eu.example.com", "eu.example.com/path", "a b"} {
+		if _, err := ParseEngineHosts(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+
+	d := Device{
+		RewstEngineHost: "engine.example.com",
+		RewstEngineAlternateHosts: []string{
+			"eu.example.com",
+			"engine.example.com",
+			"eu.example.com",
+		},
+	}
+	want := []string{"engine.example.com", "eu.example.com"}
+	if got := d.EngineHosts(); !slices.Equal(got, want) {
+		t.Errorf("EngineHosts() = %v, want %v", got, want)
+	}
+	if err := d.ValidateEngineAlternateHosts(); err != nil {
+		t.Errorf("ValidateEngineAlternateHosts: %v", err)
+	}
+}
@@ -58,6 +58,12 @@ func GetLogFilePath(orgId string) string {
 	return filepath.Join(GetDataDirectory(orgId), "rewst_agent.log")
 }
 
+// GetStatusFilePath returns the runtime status snapshot the service keeps
+// up to date for the --status mode.
+func GetStatusFilePath(orgId string) string {
+	return filepath.Join(GetDataDirectory(orgId), "status.json")
+}
+
 func GetServiceName(orgId string) string {
 	return fmt.Sprintf("io.rewst.remote_agent_%s", orgId)
 }
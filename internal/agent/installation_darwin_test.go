@@ -106,6 +106,24 @@ func TestGetLogFilePath(t *testing.T) {
 	}
 }
 
+func TestGetStatusFilePath(t *testing.T) {
+	setEnvVars(t)
+
+	orgId := "org123"
+	expected := filepath.Join(
+		"/Library/Application Support",
+		"rewst_remote_agent",
+		orgId,
+		"status.json",
+	)
+
+	result := GetStatusFilePath(orgId)
+
+	if result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+}
+
 func TestGetServiceName(t *testing.T) {
 	orgId := "org123"
 	expected := "io.rewst.remote_agent_" + orgId
@@ -129,6 +129,18 @@ func TestGetLogFilePath(t *testing.T) {
 	}
 }
 
+func TestGetStatusFilePath(t *testing.T) {
+	setEnvVars(t)
+	orgId := "org123"
+	expected := filepath.Join("C:\\ProgramData", "RewstRemoteAgent", orgId, "status.json")
+
+	result := GetStatusFilePath(orgId)
+
+	if result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+}
+
 func TestGetServiceName(t *testing.T) {
 	orgId := "org123"
 	expected := "RewstRemoteAgent_" + orgId
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/RewstApp/agent-smith-go/internal/utils"
@@ -287,6 +288,11 @@ type AutoUpdateRunner struct {
 	cancel      context.CancelFunc
 	stop        chan struct{}
 	done        chan struct{}
+
+	// mu guards the outcome of the most recent update check.
+	mu            sync.Mutex
+	lastCheckedAt time.Time
+	lastCheckErr  error
 }
 
 func NewAutoUpdateRunner(
@@ -347,11 +353,24 @@ func (r *AutoUpdateRunner) runUpdate() (err error) {
 		if rec := recover(); rec != nil {
 			err = utils.LogRecoveredPanic(r.logger, rec, "scope", "auto_update_tick")
 		}
+
+		r.mu.Lock()
+		r.lastCheckedAt = time.Now()
+		r.lastCheckErr = err
+		r.mu.Unlock()
 	}()
 
 	return r.updater.Run(r.ctx)
 }
 
+// LastCheck returns when the most recent update check finished and the error it
+// ended with. The time is zero until the first check has run.
+func (r *AutoUpdateRunner) LastCheck() (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastCheckedAt, r.lastCheckErr
+}
+
 func (r *AutoUpdateRunner) Stop() {
 	// Cancel the context first so any in-flight update check or download HTTP
 	// request is aborted promptly instead of blocking on the client Timeout,
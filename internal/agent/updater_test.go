@@ -388,6 +388,26 @@ func TestNewAutoUpdateRunner(t *testing.T) {
 	}
 }
 
+func TestAutoUpdateRunner_LastCheck(t *testing.T) {
+	mock := &mockUpdater{runErr: fmt.Errorf("github unreachable")}
+	runner := NewAutoUpdateRunner(hclog.NewNullLogger(), mock, time.Hour, 0, time.Second)
+
+	if checkedAt, err := runner.LastCheck(); !checkedAt.IsZero() || err != nil {
+		t.Fatalf("expected no check recorded yet, got %v, %v", checkedAt, err)
+	}
+
+	before := time.Now()
+	_ = runner.runUpdate()
+
+	checkedAt, err := runner.LastCheck()
+	if checkedAt.Before(before) {
+		t.Errorf("expected check time after %v, got %v", before, checkedAt)
+	}
+	if err == nil || err.Error() != "github unreachable" {
+		t.Errorf("expected last check error to be recorded, got %v", err)
+	}
+}
+
 func TestAutoUpdateRunner_StartAndStop(t *testing.T) {
 	logger := hclog.NewNullLogger()
 	mock := &mockUpdater{}
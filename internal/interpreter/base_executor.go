@@ -178,6 +178,19 @@ func (e *baseExecutor) Execute(
 	stdoutBuf := newBoundedWriter(maxOutputBytes)
 	stderrBuf := newBoundedWriter(maxOutputBytes)
 
+	// When overflowing output is uploaded, each stream also spills past the
+	// ceiling into a file next to the script, capped by the agent-wide spill
+	// budget. The files are removed on every exit path, after the upload.
+	uploadOverflow := message.Uploader != nil &&
+		device.ResolvedOutputOverflow() == agent.OutputOverflowUpload
+	if uploadOverflow {
+		spillMaxBytes := device.ResolvedOutputSpillMaxBytes()
+		stdoutBuf.withSpill(newOutputSpill(scriptsDir, spillMaxBytes, &spillUsage))
+		stderrBuf.withSpill(newOutputSpill(scriptsDir, spillMaxBytes, &spillUsage))
+		defer stdoutBuf.removeSpill(logger)
+		defer stderrBuf.removeSpill(logger)
+	}
+
 	// Bound the command to the configured per-command timeout when one is set, so
 	// a hung or interactive script (infinite loop, blocked on stdin, stuck network
 	// call) is killed after the deadline instead of permanently occupying its
@@ -224,6 +237,23 @@ func (e *baseExecutor) Execute(
 			"output_bytes_kept",
 			trunc.Kept,
 		)
+
+		if uploadOverflow {
+			// Upload under the parent ctx: a command that hit its own timeout
+			// still gets its output delivered.
+			uploads, uploadErr := uploadSpilledOutput(
+				ctx, message, device, logger, stdoutBuf, stderrBuf,
+			)
+			trunc.Uploads = uploads
+			if uploadErr != nil {
+				logger.Error(
+					"Failed to upload command output",
+					"message_id", message.PostId,
+					"error", uploadErr,
+				)
+				trunc.UploadError = uploadErr.Error()
+			}
+		}
 	}
 
 	if err != nil {
@@ -6,6 +6,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -447,3 +449,99 @@ func TestBaseExecutor_Diagnostics_ConcurrentCachedOnce(t *testing.T) {
 		)
 	}
 }
+
+func assertNoSpillFiles(t *testing.T, org string) {
+	t.Helper()
+	entries, err := os.ReadDir(agent.GetScriptsDirectory(org))
+	if err != nil {
+		t.Fatalf("failed to read scripts directory: %v", err)
+	}
+	for _, e := range entries {
+		if isSpillFile(e.Name()) {
+			t.Errorf("spill file %s was left behind", e.Name())
+		}
+	}
+}
+
+// TestBaseExecutor_OutputOverflowUploaded verifies that output past the ceiling
+// is uploaded in full, referenced from the result, and cleaned up.
+func TestBaseExecutor_OutputOverflowUploaded(t *testing.T) {
+	engine := newFakeUploadEngine()
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	maxOutput := 1024
+	device := agent.Device{
+		RewstOrgId:      "test-org-overflow",
+		RewstEngineHost: srv.Listener.Addr().String(),
+		MaxOutputBytes:  &maxOutput,
+		OutputOverflow:  agent.OutputOverflowUpload,
+	}
+	uploader := newTestUploader()
+	uploader.ChunkSize = 16 * 1024
+	msg := Message{
+		PostId:   "test:overflow",
+		Commands: encodeCommand("for i in $(seq 1 100); do printf 'x%.0s' $(seq 1 1024); done"),
+		Uploader: uploader,
+	}
+	resultJSON := newBashExecutor().Execute(
+		context.Background(), &msg, device, hclog.NewNullLogger(), nil, nil,
+	)
+
+	var r result
+	if err := json.Unmarshal(resultJSON, &r); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+	if !r.Truncated || len(r.Output) != maxOutput {
+		t.Errorf("expected the truncated preview to be kept, got %s", resultJSON)
+	}
+	if len(r.OutputUploads) != 1 || r.OutputUploadError != "" {
+		t.Fatalf("expected one upload and no error, got %s", resultJSON)
+	}
+	upload := r.OutputUploads[0]
+	if upload.Stream != "output" || upload.Bytes != 100*1024 || upload.Truncated {
+		t.Errorf("unexpected upload reference %+v", upload)
+	}
+	received := engine.received["/webhooks/custom/action/test/overflow/uploads/output"]
+	if !bytes.Equal(received, bytes.Repeat([]byte("x"), 100*1024)) {
+		t.Errorf("engine received %d bytes, want the full output", len(received))
+	}
+	assertNoSpillFiles(t, device.RewstOrgId)
+}
+
+// TestBaseExecutor_OutputOverflowUploadFailure verifies that a failed upload
+// falls back to the truncated result and still removes the spill file.
+func TestBaseExecutor_OutputOverflowUploadFailure(t *testing.T) {
+	engine := newFakeUploadEngine()
+	engine.status = http.StatusForbidden
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	maxOutput := 16
+	device := agent.Device{
+		RewstOrgId:      "test-org-overflow-fail",
+		RewstEngineHost: srv.Listener.Addr().String(),
+		MaxOutputBytes:  &maxOutput,
+		OutputOverflow:  agent.OutputOverflowUpload,
+	}
+	msg := Message{
+		PostId:   "test:overflow",
+		Commands: encodeCommand("printf 'y%.0s' $(seq 1 100) >&2"),
+		Uploader: newTestUploader(),
+	}
+	resultJSON := newBashExecutor().Execute(
+		context.Background(), &msg, device, hclog.NewNullLogger(), nil, nil,
+	)
+
+	var r result
+	if err := json.Unmarshal(resultJSON, &r); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+	if !r.Truncated || len(r.Error) != maxOutput || len(r.OutputUploads) != 0 {
+		t.Errorf("expected a truncated result without uploads, got %s", resultJSON)
+	}
+	if !strings.Contains(r.OutputUploadError, "403") {
+		t.Errorf("expected the upload error in the result, got %q", r.OutputUploadError)
+	}
+	assertNoSpillFiles(t, device.RewstOrgId)
+}
@@ -1,6 +1,11 @@
 package interpreter
 
-import "sync"
+import (
+	"os"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+)
 
 // boundedWriter is an io.Writer that keeps at most limit bytes of what is written
 // to it, discards the rest, and counts every byte the writer produced either way.
@@ -24,6 +29,9 @@ type boundedWriter struct {
 	limit    int
 	kept     []byte
 	produced int64
+	// spill, when set, receives the whole stream from the first byte past the
+	// ceiling on (see withSpill).
+	spill *outputSpill
 }
 
 // newBoundedWriter returns a writer that keeps at most limit bytes. Callers pass
@@ -33,6 +41,14 @@ func newBoundedWriter(limit int) *boundedWriter {
 	return &boundedWriter{limit: limit}
 }
 
+// withSpill makes the writer copy its stream to spill once it passes the
+// ceiling: the kept bytes first, then everything written after them, so the
+// spill file holds the complete output while memory stays bounded.
+func (w *boundedWriter) withSpill(spill *outputSpill) *boundedWriter {
+	w.spill = spill
+	return w
+}
+
 func (w *boundedWriter) Write(p []byte) (int, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -43,11 +59,22 @@ func (w *boundedWriter) Write(p []byte) (int, error) {
 	n := len(p)
 	w.produced += int64(n)
 
+	var rest []byte
 	if remaining := w.limit - len(w.kept); remaining > 0 {
 		if len(p) > remaining {
-			p = p[:remaining]
+			p, rest = p[:remaining], p[remaining:]
 		}
 		w.appendLocked(p)
+	} else {
+		rest = p
+	}
+
+	if w.spill != nil && len(rest) > 0 {
+		if w.produced-int64(len(rest)) == int64(len(w.kept)) {
+			// First overflowing write: the spill starts with what was kept.
+			w.spill.write(w.kept)
+		}
+		w.spill.write(rest)
 	}
 
 	return n, nil
@@ -104,6 +131,28 @@ func (w *boundedWriter) Truncated() bool {
 	return w.produced > int64(len(w.kept))
 }
 
+// spilled returns the writer's spill file and how many bytes it holds, or a nil
+// file when the stream never passed the ceiling. full reports whether the
+// spill budget cut the file short.
+func (w *boundedWriter) spilled() (file *os.File, size int64, full bool, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.spill == nil {
+		return nil, 0, false, nil
+	}
+	return w.spill.file, w.spill.written, w.spill.full, w.spill.err
+}
+
+// removeSpill deletes the writer's spill file, if any. It takes the mutex
+// because a copier released by an expired cmd.WaitDelay may still be writing.
+func (w *boundedWriter) removeSpill(logger hclog.Logger) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.spill != nil {
+		w.spill.remove(logger)
+	}
+}
+
 // truncationOf summarizes the truncation state of a command's two output streams.
 // The byte counts are totals across stdout and stderr (each of which is bounded
 // independently) so a single pair of numbers describes how much output the
@@ -20,6 +20,35 @@ type Message struct {
 	GetInstallation     bool        `json:"get_installation"`
 	Type                string      `json:"type"`
 	Content             string      `json:"content"`
+	// Priority is an optional hint for delivering the result: PriorityHigh,
+	// PriorityNormal or PriorityLow. See ResolvedPriority.
+	Priority string `json:"priority"`
+
+	// Uploader, when set, lets the executor upload output past the ceiling
+	// instead of discarding it (see agent.Device.OutputOverflow). It is set by
+	// the caller that delivers the result, since only it knows whether the
+	// result reaches the engine at all.
+	Uploader OutputUploader `json:"-"`
+}
+
+// Result priorities. A high-priority result gets a larger in-line retry
+// budget and leaves the postback spool first; a low-priority one gets a
+// smaller budget and is evicted from the spool first.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// ResolvedPriority returns the message's priority, falling back to
+// PriorityNormal when it is unset or not recognized.
+func (msg *Message) ResolvedPriority() string {
+	switch p := strings.ToLower(msg.Priority); p {
+	case PriorityHigh, PriorityLow:
+		return p
+	default:
+		return PriorityNormal
+	}
 }
 
 func (msg *Message) Parse(data []byte) error {
@@ -68,15 +97,8 @@ func (msg *Message) CreatePostbackRequest(
 	device agent.Device,
 	body io.Reader,
 ) (*http.Request, error) {
-	// Create a postback url
-	postBackUrl := fmt.Sprintf(
-		"https://%s/webhooks/custom/action/%s",
-		device.RewstEngineHost,
-		strings.ReplaceAll(msg.PostId, ":", "/"),
-	)
-
 	// Create an http request
-	req, err := utils.NewRequestWithContext(ctx, "POST", postBackUrl, body)
+	req, err := utils.NewRequestWithContext(ctx, "POST", msg.postbackUrl(device), body)
 	if err != nil {
 		return nil, err
 	}
@@ -85,3 +107,20 @@ func (msg *Message) CreatePostbackRequest(
 	// Return the request
 	return req, nil
 }
+
+// postbackUrl returns the postback URL on device.RewstEngineHost, following
+// the device's postback path template.
+func (msg *Message) postbackUrl(device agent.Device) string {
+	path := strings.ReplaceAll(
+		device.ResolvedPostbackPathTemplate(),
+		agent.PostbackPathPostId,
+		strings.ReplaceAll(msg.PostId, ":", "/"),
+	)
+	return "https://" + device.RewstEngineHost + path
+}
+
+// outputUploadUrl returns where the overflowing output of stream is uploaded,
+// next to the postback of the same message.
+func (msg *Message) outputUploadUrl(device agent.Device, stream string) string {
+	return msg.postbackUrl(device) + "/uploads/" + stream
+}
@@ -272,3 +272,38 @@ func TestMessage_CreatePostbackRequest_MultipleColons(t *testing.T) {
 		t.Errorf("expected URL %s, got %s", expectedUrl, req.URL.String())
 	}
 }
+
+func TestMessage_CreatePostbackRequest_PathTemplate(t *testing.T) {
+	msg := Message{PostId: "abc:123"}
+	device := agent.Device{
+		RewstEngineHost:      "proxy.example.com:8443",
+		PostbackPathTemplate: "/rewst/{post_id}/result",
+	}
+	req, err := msg.CreatePostbackRequest(context.Background(), device, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expectedUrl := "https://proxy.example.com:8443/rewst/abc/123/result"
+	if req.URL.String() != expectedUrl {
+		t.Errorf("expected URL %s, got %s", expectedUrl, req.URL.String())
+	}
+}
+
+func TestMessage_ResolvedPriority(t *testing.T) {
+	tests := map[string]string{
+		"":       PriorityNormal,
+		"high":   PriorityHigh,
+		"HIGH":   PriorityHigh,
+		"normal": PriorityNormal,
+		"low":    PriorityLow,
+		"urgent": PriorityNormal,
+		" low ":  PriorityNormal,
+	}
+	for priority, want := range tests {
+		msg := Message{Priority: priority}
+		if got := msg.ResolvedPriority(); got != want {
+			t.Errorf("ResolvedPriority(%q) = %q, want %q", priority, got, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package interpreter
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	// spillFilePrefix and spillFileSuffix are the fixed parts of the output spill
+	// file name pattern ("spill-*.out"), shared with the startup sweep like the
+	// script file pattern.
+	spillFilePrefix = "spill-"
+	spillFileSuffix = ".out"
+
+	// spillTempPattern is the os.CreateTemp pattern for an output spill file.
+	spillTempPattern = spillFilePrefix + "*" + spillFileSuffix
+)
+
+// spillUsage is the disk space held by the spill files of every command in
+// flight. The executor is shared by all workers, so the cap configured with
+// agent.Device.OutputSpillMaxBytes applies to the agent as a whole rather than
+// to each command.
+var spillUsage spillBudget
+
+// spillBudget hands out disk space to output spill files under a shared limit.
+type spillBudget struct {
+	mu   sync.Mutex
+	used int64
+}
+
+// reserve grants up to want bytes without taking the total past limit and
+// returns how many were granted.
+func (b *spillBudget) reserve(want int64, limit int64) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	granted := min(want, max(limit-b.used, 0))
+	b.used += granted
+	return granted
+}
+
+// release returns n previously reserved bytes to the budget.
+func (b *spillBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+}
+
+// outputSpill is the file one output stream overflows into once it passes the
+// in-memory ceiling, so the full stream can be uploaded after the command
+// finishes. The file is created on the first overflowing write, so a command
+// that stays below the ceiling never touches the disk.
+//
+// It is only written from boundedWriter.Write, under the writer's mutex, and
+// only read once the command has finished.
+type outputSpill struct {
+	dir    string
+	limit  int64
+	budget *spillBudget
+
+	file    *os.File
+	written int64
+	// full is set once the budget refused a write; everything after it is
+	// discarded, and the upload is marked truncated.
+	full bool
+	err  error
+}
+
+// newOutputSpill returns a spill that creates its file in dir and holds at most
+// limit bytes together with every other spill drawing on budget.
+func newOutputSpill(dir string, limit int64, budget *spillBudget) *outputSpill {
+	return &outputSpill{dir: dir, limit: limit, budget: budget}
+}
+
+// write appends p to the spill file. Like boundedWriter.Write it never fails
+// the command: a write the budget refuses is dropped and a file error stops
+// the spill, which is then reported when the output is uploaded.
+func (s *outputSpill) write(p []byte) {
+	if s.full || s.err != nil || len(p) == 0 {
+		return
+	}
+
+	if s.file == nil {
+		s.file, s.err = os.CreateTemp(s.dir, spillTempPattern)
+		if s.err != nil {
+			return
+		}
+	}
+
+	granted := s.budget.reserve(int64(len(p)), s.limit)
+	if granted < int64(len(p)) {
+		s.full = true
+	}
+	if granted == 0 {
+		return
+	}
+
+	n, err := s.file.Write(p[:granted])
+	s.written += int64(n)
+	s.budget.release(granted - int64(n))
+	if err != nil {
+		s.err = err
+	}
+}
+
+// remove closes and deletes the spill file and returns its space to the
+// budget. It is safe to call on a spill that never created a file.
+func (s *outputSpill) remove(logger hclog.Logger) {
+	if s.file == nil {
+		s.err = os.ErrClosed
+		return
+	}
+
+	name := s.file.Name()
+	if err := s.file.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		logger.Error("Failed to close output spill file", "file", name, "error", err)
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		logger.Error("Failed to remove output spill file", "file", name, "error", err)
+	}
+	s.budget.release(s.written)
+	s.file = nil
+	s.written = 0
+	// A copier released by an expired cmd.WaitDelay may still be writing; it
+	// must not create a new file behind the cleanup.
+	s.err = os.ErrClosed
+}
@@ -0,0 +1,102 @@
+package interpreter
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func readSpill(t *testing.T, w *boundedWriter) (string, bool) {
+	t.Helper()
+	file, size, full, err := w.spilled()
+	if err != nil {
+		t.Fatalf("spill failed: %v", err)
+	}
+	if file == nil {
+		return "", false
+	}
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, size))
+	if err != nil {
+		t.Fatalf("read spill: %v", err)
+	}
+	return string(data), full
+}
+
+// TestBoundedWriter_SpillHoldsWholeStream verifies that the spill file starts
+// with the kept bytes and carries on with everything past the ceiling, while
+// memory stays at the ceiling.
+func TestBoundedWriter_SpillHoldsWholeStream(t *testing.T) {
+	budget := &spillBudget{}
+	w := newBoundedWriter(8).withSpill(newOutputSpill(t.TempDir(), 1024, budget))
+	defer w.removeSpill(hclog.NewNullLogger())
+
+	var want strings.Builder
+	for _, chunk := range []string{"abc", "defghij", "klm", "", "nopqrstuvwxyz"} {
+		_, _ = io.WriteString(w, chunk)
+		want.WriteString(chunk)
+	}
+
+	if w.String() != want.String()[:8] {
+		t.Errorf("kept %q, want the first 8 bytes", w.String())
+	}
+	got, full := readSpill(t, w)
+	if got != want.String() || full {
+		t.Errorf("spill holds %q (full %v), want %q", got, full, want.String())
+	}
+	if budget.used != int64(len(got)) {
+		t.Errorf("budget used = %d, want %d", budget.used, len(got))
+	}
+}
+
+func TestBoundedWriter_NoSpillBelowCeiling(t *testing.T) {
+	dir := t.TempDir()
+	w := newBoundedWriter(8).withSpill(newOutputSpill(dir, 1024, &spillBudget{}))
+	_, _ = io.WriteString(w, "12345678")
+
+	if file, _, _, _ := w.spilled(); file != nil {
+		t.Error("expected no spill file for output at the ceiling")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected an empty directory, got %d entries", len(entries))
+	}
+}
+
+// TestBoundedWriter_SpillBudgetIsShared verifies that the budget caps the spill
+// files of every stream together and is returned once they are removed.
+func TestBoundedWriter_SpillBudgetIsShared(t *testing.T) {
+	dir := t.TempDir()
+	budget := &spillBudget{}
+	first := newBoundedWriter(4).withSpill(newOutputSpill(dir, 20, budget))
+	second := newBoundedWriter(4).withSpill(newOutputSpill(dir, 20, budget))
+
+	_, _ = io.WriteString(first, strings.Repeat("a", 16))
+	_, _ = io.WriteString(second, strings.Repeat("b", 16))
+
+	got, full := readSpill(t, first)
+	if len(got) != 16 || full {
+		t.Errorf("first spill holds %d bytes (full %v), want 16", len(got), full)
+	}
+	got, full = readSpill(t, second)
+	if got != "bbbb" || !full {
+		t.Errorf("second spill holds %q (full %v), want the 4 bytes left", got, full)
+	}
+
+	logger := hclog.NewNullLogger()
+	first.removeSpill(logger)
+	second.removeSpill(logger)
+	if budget.used != 0 {
+		t.Errorf("budget used = %d after removal, want 0", budget.used)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected spill files removed, %d remain", len(entries))
+	}
+
+	// Writes after the cleanup must not recreate a file.
+	_, _ = io.WriteString(first, "more")
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Error("a write after removal created a spill file")
+	}
+}
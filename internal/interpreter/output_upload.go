@@ -0,0 +1,298 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/RewstApp/agent-smith-go/internal/utils"
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	// DefaultOutputUploadChunkSize is how much of an overflowing stream each
+	// upload request carries.
+	DefaultOutputUploadChunkSize = 4 * 1024 * 1024
+	// DefaultOutputUploadAttempts is how many times a chunk is tried before the
+	// upload is given up.
+	DefaultOutputUploadAttempts = 3
+	// DefaultOutputUploadBackoff is the delay before the first retry of a chunk;
+	// it doubles on every further retry.
+	DefaultOutputUploadBackoff = time.Second
+
+	// statusResumeIncomplete is the status the engine answers a chunk with while
+	// the upload is not complete yet, with a Range header naming the bytes it
+	// holds.
+	statusResumeIncomplete = 308
+)
+
+// OutputUpload references the full contents of an output stream that passed
+// the ceiling and was uploaded to the engine.
+type OutputUpload struct {
+	// Stream is "output" or "error", naming the result field it completes.
+	Stream string `json:"stream"`
+	Url    string `json:"url"`
+	Bytes  int64  `json:"bytes"`
+	Sha256 string `json:"sha256"`
+	// Truncated is set when the stream outgrew the spill budget (see
+	// agent.Device.OutputSpillMaxBytes), so the upload holds only its start.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// OutputUploader uploads the overflowing output of a command so its result can
+// reference the upload instead of embedding it.
+type OutputUploader interface {
+	UploadOutput(
+		ctx context.Context,
+		message *Message,
+		device agent.Device,
+		stream string,
+		content io.ReaderAt,
+		size int64,
+		logger hclog.Logger,
+	) (OutputUpload, error)
+}
+
+// ChunkedUploader uploads output to the engine in resumable chunks. Each chunk
+// is a PUT carrying a Content-Range header; the engine answers 308 with the
+// range it holds until the last chunk, which it answers with a 2xx. After a
+// failed chunk the uploader asks the engine how much it received and resumes
+// from there, so a dropped connection does not restart a large upload.
+type ChunkedUploader struct {
+	Client *http.Client
+	// ChunkSize, Attempts and Backoff fall back to the Default* values when
+	// they are not positive.
+	ChunkSize int
+	Attempts  int
+	Backoff   time.Duration
+}
+
+func (u *ChunkedUploader) UploadOutput(
+	ctx context.Context,
+	message *Message,
+	device agent.Device,
+	stream string,
+	content io.ReaderAt,
+	size int64,
+	logger hclog.Logger,
+) (OutputUpload, error) {
+	upload := OutputUpload{
+		Stream: stream,
+		Url:    message.outputUploadUrl(device, stream),
+		Bytes:  size,
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(content, 0, size)); err != nil {
+		return upload, fmt.Errorf("failed to read output: %w", err)
+	}
+	upload.Sha256 = hex.EncodeToString(hash.Sum(nil))
+
+	chunkSize := int64(u.ChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = DefaultOutputUploadChunkSize
+	}
+	attempts := u.Attempts
+	if attempts <= 0 {
+		attempts = DefaultOutputUploadAttempts
+	}
+	backoff := u.Backoff
+	if backoff <= 0 {
+		backoff = DefaultOutputUploadBackoff
+	}
+
+	var offset int64
+	failures := 0
+	for {
+		end := min(offset+chunkSize, size)
+		chunk := make([]byte, end-offset)
+		if _, err := content.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return upload, fmt.Errorf("failed to read output: %w", err)
+		}
+
+		rangeHeader := fmt.Sprintf("bytes %d-%d/%d", offset, end-1, size)
+		if size == 0 {
+			rangeHeader = "bytes */0"
+		}
+		next, done, err := u.put(ctx, message, device, upload, rangeHeader, chunk)
+		if err == nil {
+			if done {
+				logger.Info(
+					"Command output uploaded",
+					"message_id", message.PostId,
+					"stream", stream,
+					"bytes", size,
+				)
+				return upload, nil
+			}
+			if next > offset {
+				offset, failures = next, 0
+				continue
+			}
+			err = fmt.Errorf("engine did not accept the chunk at offset %d", offset)
+		}
+
+		var permanent *permanentUploadError
+		failures++
+		if failures >= attempts || errors.As(err, &permanent) {
+			return upload, err
+		}
+		logger.Warn(
+			"Output upload chunk failed; resuming",
+			"message_id", message.PostId,
+			"stream", stream,
+			"offset", offset,
+			"attempt", failures,
+			"error", err,
+		)
+
+		select {
+		case <-ctx.Done():
+			return upload, ctx.Err()
+		case <-time.After(backoff << (failures - 1)):
+		}
+
+		next, done, err = u.put(ctx, message, device, upload, fmt.Sprintf("bytes */%d", size), nil)
+		switch {
+		case errors.As(err, &permanent):
+			return upload, err
+		case err != nil:
+			// Resend the same chunk; the engine ignores bytes it already holds.
+		case done:
+			return upload, nil
+		default:
+			offset = next
+		}
+	}
+}
+
+// put sends one request of the upload and reports the offset the engine
+// expects next and whether the upload is complete. Each request is signed like
+// a postback, over the chunk it carries. Server errors and 429 are returned as
+// errors to retry; any other status ends the upload.
+func (u *ChunkedUploader) put(
+	ctx context.Context,
+	message *Message,
+	device agent.Device,
+	upload OutputUpload,
+	contentRange string,
+	chunk []byte,
+) (int64, bool, error) {
+	req, err := utils.NewRequestWithContext(ctx, "PUT", upload.Url, bytes.NewReader(chunk))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", contentRange)
+	req.Header.Set("X-Content-Sha256", upload.Sha256)
+	if err := message.SignPostbackRequest(req, device, chunk, time.Now()); err != nil {
+		return 0, false, &permanentUploadError{err: err}
+	}
+
+	res, err := u.Client.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return upload.Bytes, true, nil
+	case res.StatusCode == statusResumeIncomplete:
+		next, err := parseUploadRange(res.Header.Get("Range"))
+		if err != nil {
+			return 0, false, err
+		}
+		if next > upload.Bytes {
+			return 0, false, fmt.Errorf(
+				"engine holds %d bytes of a %d byte upload", next, upload.Bytes,
+			)
+		}
+		// An engine that reports holding every byte has the whole upload.
+		return next, next == upload.Bytes, nil
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return 0, false, fmt.Errorf("upload failed with status %s", res.Status)
+	default:
+		return 0, false, &permanentUploadError{status: res.Status}
+	}
+}
+
+// permanentUploadError is returned for a status, or a signing failure,
+// retrying cannot fix.
+type permanentUploadError struct {
+	status string
+	err    error
+}
+
+func (e *permanentUploadError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("upload rejected with status %s", e.status)
+}
+
+// parseUploadRange returns the offset after the bytes named by a "bytes=0-N"
+// Range header. A missing header means the engine holds nothing yet.
+func parseUploadRange(header string) (int64, error) {
+	if header == "" {
+		return 0, nil
+	}
+	last, ok := strings.CutPrefix(header, "bytes=0-")
+	if !ok {
+		return 0, fmt.Errorf("invalid upload range %q", header)
+	}
+	n, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid upload range %q", header)
+	}
+	return n + 1, nil
+}
+
+// uploadSpilledOutput uploads the spill file of each stream that passed the
+// ceiling and returns the references to put in the result. Streams uploaded
+// before a failure are still returned alongside the error.
+func uploadSpilledOutput(
+	ctx context.Context,
+	message *Message,
+	device agent.Device,
+	logger hclog.Logger,
+	stdout *boundedWriter,
+	stderr *boundedWriter,
+) ([]OutputUpload, error) {
+	var uploads []OutputUpload
+	for _, s := range []struct {
+		stream string
+		writer *boundedWriter
+	}{
+		{"output", stdout},
+		{"error", stderr},
+	} {
+		file, size, full, err := s.writer.spilled()
+		if err != nil {
+			return uploads, fmt.Errorf("failed to spill %s: %w", s.stream, err)
+		}
+		if file == nil {
+			continue
+		}
+
+		upload, err := message.Uploader.UploadOutput(
+			ctx, message, device, s.stream, file, size, logger,
+		)
+		if err != nil {
+			return uploads, fmt.Errorf("failed to upload %s: %w", s.stream, err)
+		}
+		upload.Truncated = full
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
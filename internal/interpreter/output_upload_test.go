@@ -0,0 +1,216 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+	"github.com/hashicorp/go-hclog"
+)
+
+// httpTransport sends the agent's https engine requests to a plain httptest
+// server.
+type httpTransport struct{}
+
+func (httpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = "http"
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// fakeUploadEngine implements the engine side of a resumable upload. failAt
+// makes it store the chunk starting at that offset but answer 503, as if the
+// response were lost.
+type fakeUploadEngine struct {
+	mu       sync.Mutex
+	received map[string][]byte
+	failAt   int64
+	failed   bool
+	status   int
+	paths    []string
+}
+
+func newFakeUploadEngine() *fakeUploadEngine {
+	return &fakeUploadEngine{received: map[string][]byte{}, failAt: -1}
+}
+
+func (e *fakeUploadEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.paths = append(e.paths, r.URL.Path)
+	if e.status != 0 {
+		w.WriteHeader(e.status)
+		return
+	}
+
+	var start, end, total int64
+	contentRange := r.Header.Get("Content-Range")
+	data := e.received[r.URL.Path]
+	if _, err := fmt.Sscanf(contentRange, "bytes */%d", &total); err == nil {
+		if int64(len(data)) == total {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if len(data) > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(data)-1))
+		}
+		w.WriteHeader(statusResumeIncomplete)
+		return
+	}
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	if start == int64(len(data)) {
+		data = append(data, body...)
+		e.received[r.URL.Path] = data
+	}
+	if start == e.failAt && !e.failed {
+		e.failed = true
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if int64(len(data)) == total {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(data)-1))
+	w.WriteHeader(statusResumeIncomplete)
+}
+
+func newTestUploader() *ChunkedUploader {
+	return &ChunkedUploader{
+		Client:    &http.Client{Transport: httpTransport{}},
+		ChunkSize: 10,
+		Backoff:   time.Millisecond,
+	}
+}
+
+func TestChunkedUploader_UploadsInChunks(t *testing.T) {
+	engine := newFakeUploadEngine()
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	content := []byte(strings.Repeat("0123456789", 4) + "tail")
+	device := agent.Device{RewstEngineHost: srv.Listener.Addr().String()}
+	msg := &Message{PostId: "abc:123"}
+
+	upload, err := newTestUploader().UploadOutput(
+		context.Background(), msg, device, "output",
+		bytes.NewReader(content), int64(len(content)), hclog.NewNullLogger(),
+	)
+	if err != nil {
+		t.Fatalf("UploadOutput: %v", err)
+	}
+
+	path := "/webhooks/custom/action/abc/123/uploads/output"
+	if got := engine.received[path]; !bytes.Equal(got, content) {
+		t.Errorf("engine received %q, want %q", got, content)
+	}
+	if len(engine.paths) != 5 {
+		t.Errorf("expected 5 chunk requests, got %d", len(engine.paths))
+	}
+	sum := sha256.Sum256(content)
+	if upload.Sha256 != hex.EncodeToString(sum[:]) || upload.Bytes != int64(len(content)) {
+		t.Errorf("unexpected upload reference %+v", upload)
+	}
+	if upload.Url != "https://"+device.RewstEngineHost+path {
+		t.Errorf("unexpected upload url %q", upload.Url)
+	}
+}
+
+// TestChunkedUploader_ResumesAfterFailure verifies that a chunk whose response
+// is lost is not sent twice: the uploader asks the engine where it stands and
+// carries on from there.
+func TestChunkedUploader_ResumesAfterFailure(t *testing.T) {
+	engine := newFakeUploadEngine()
+	engine.failAt = 10
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	content := []byte(strings.Repeat("abcdefghij", 3))
+	device := agent.Device{RewstEngineHost: srv.Listener.Addr().String()}
+
+	_, err := newTestUploader().UploadOutput(
+		context.Background(), &Message{PostId: "abc:123"}, device, "error",
+		bytes.NewReader(content), int64(len(content)), hclog.NewNullLogger(),
+	)
+	if err != nil {
+		t.Fatalf("UploadOutput: %v", err)
+	}
+
+	path := "/webhooks/custom/action/abc/123/uploads/error"
+	if got := engine.received[path]; !bytes.Equal(got, content) {
+		t.Errorf("engine received %q, want %q", got, content)
+	}
+	// Three chunks, one status query.
+	if len(engine.paths) != 4 {
+		t.Errorf("expected 4 requests, got %d", len(engine.paths))
+	}
+}
+
+func TestChunkedUploader_GivesUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		requests int
+	}{
+		// Every attempt but the last is followed by a status query.
+		{"server error", http.StatusInternalServerError, 5},
+		{"rejected", http.StatusForbidden, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newFakeUploadEngine()
+			engine.status = tt.status
+			srv := httptest.NewServer(engine)
+			defer srv.Close()
+
+			device := agent.Device{RewstEngineHost: srv.Listener.Addr().String()}
+			_, err := newTestUploader().UploadOutput(
+				context.Background(), &Message{PostId: "abc:123"}, device, "output",
+				strings.NewReader("content"), 7, hclog.NewNullLogger(),
+			)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if len(engine.paths) != tt.requests {
+				t.Errorf("expected %d requests, got %d", tt.requests, len(engine.paths))
+			}
+		})
+	}
+}
+
+func TestParseUploadRange(t *testing.T) {
+	tests := []struct {
+		header string
+		expect int64
+		err    bool
+	}{
+		{"", 0, false},
+		{"bytes=0-9", 10, false},
+		{"bytes=5-9", 0, true},
+		{"bytes=0-x", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseUploadRange(tt.header)
+		if (err != nil) != tt.err || got != tt.expect {
+			t.Errorf("parseUploadRange(%q) = %d, %v", tt.header, got, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package interpreter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+)
+
+// Headers carried by a signed postback. See SignPostbackRequest for how the
+// signature is computed.
+const (
+	PostbackDeviceIdHeader  = "X-Rewst-Device-Id"
+	PostbackTimestampHeader = "X-Rewst-Timestamp"
+	PostbackSignatureHeader = "X-Rewst-Signature"
+)
+
+// PostbackSignatureVersion prefixes the signature header value and the signed
+// string, so the scheme can change without ambiguity.
+const PostbackSignatureVersion = "v1"
+
+// postbackSigningLabel separates the signing key from the device's shared
+// access key, which also signs the IoT Hub SAS token.
+const postbackSigningLabel = "agent-smith postback signature v1"
+
+// SignPostbackRequest lets the engine, or a webhook proxy in front of it,
+// check that a postback came from the device it names. It sets:
+//
+//	X-Rewst-Device-Id: <device_id>
+//	X-Rewst-Timestamp: <unix seconds>
+//	X-Rewst-Signature: v1=<hex HMAC-SHA256>
+//
+// The signature is HMAC-SHA256 keyed with
+// HMAC-SHA256(base64-decoded shared_access_key, "agent-smith postback signature v1")
+// over the lines
+//
+//	v1
+//	<device_id>
+//	<post_id>
+//	<timestamp>
+//	<hex SHA-256 of the body as sent>
+//
+// joined by "\n". body is hashed as it goes on the wire, after any
+// Content-Encoding, so it can be verified before it is decoded. A device
+// without a shared access key sends the request unsigned.
+func (msg *Message) SignPostbackRequest(
+	req *http.Request,
+	device agent.Device,
+	body []byte,
+	now time.Time,
+) error {
+	if device.SharedAccessKey == "" {
+		return nil
+	}
+	key, err := postbackSigningKey(device.SharedAccessKey)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(postbackStringToSign(device.DeviceId, msg.PostId, timestamp, body)))
+
+	req.Header.Set(PostbackDeviceIdHeader, device.DeviceId)
+	req.Header.Set(PostbackTimestampHeader, timestamp)
+	req.Header.Set(
+		PostbackSignatureHeader,
+		PostbackSignatureVersion+"="+hex.EncodeToString(mac.Sum(nil)),
+	)
+	return nil
+}
+
+func postbackSigningKey(sharedAccessKey string) ([]byte, error) {
+	secret, err := base64.StdEncoding.DecodeString(sharedAccessKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode shared_access_key: %w", err)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(postbackSigningLabel))
+	return mac.Sum(nil), nil
+}
+
+func postbackStringToSign(deviceId, postId, timestamp string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return PostbackSignatureVersion + "\n" +
+		deviceId + "\n" +
+		postId + "\n" +
+		timestamp + "\n" +
+		hex.EncodeToString(sum[:])
+}
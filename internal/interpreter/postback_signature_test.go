@@ -0,0 +1,83 @@
+package interpreter
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RewstApp/agent-smith-go/internal/agent"
+)
+
+// verifyPostbackSignature checks a signed request the way the engine would,
+// following the documented format rather than the signing code.
+func verifyPostbackSignature(req *http.Request, sharedAccessKey string, body []byte) bool {
+	secret, _ := base64.StdEncoding.DecodeString(sharedAccessKey)
+	keyMac := hmac.New(sha256.New, secret)
+	keyMac.Write([]byte("agent-smith postback signature v1"))
+
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, keyMac.Sum(nil))
+	mac.Write([]byte("v1\n" +
+		req.Header.Get("X-Rewst-Device-Id") + "\n" +
+		"abc:123\n" +
+		req.Header.Get("X-Rewst-Timestamp") + "\n" +
+		hex.EncodeToString(sum[:])))
+
+	return hmac.Equal(
+		[]byte(req.Header.Get("X-Rewst-Signature")),
+		[]byte("v1="+hex.EncodeToString(mac.Sum(nil))),
+	)
+}
+
+func TestSignPostbackRequest(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte("device secret"))
+	device := agent.Device{RewstEngineHost: "example.com", DeviceId: "dev-1", SharedAccessKey: key}
+	msg := &Message{PostId: "abc:123"}
+	body := []byte(`{"output":"ok"}`)
+	now := time.Unix(1700000000, 0)
+
+	req, err := msg.CreatePostbackRequest(context.Background(), device, nil)
+	if err != nil {
+		t.Fatalf("CreatePostbackRequest: %v", err)
+	}
+	if err := msg.SignPostbackRequest(req, device, body, now); err != nil {
+		t.Fatalf("SignPostbackRequest: %v", err)
+	}
+
+	if req.Header.Get(PostbackDeviceIdHeader) != "dev-1" ||
+		req.Header.Get(PostbackTimestampHeader) != "1700000000" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	if !verifyPostbackSignature(req, key, body) {
+		t.Error("signature did not verify")
+	}
+	if verifyPostbackSignature(req, key, []byte(`{"output":"forged"}`)) {
+		t.Error("signature verified for another body")
+	}
+	other := base64.StdEncoding.EncodeToString([]byte("other secret"))
+	if verifyPostbackSignature(req, other, body) {
+		t.Error("signature verified with another device's key")
+	}
+}
+
+func TestSignPostbackRequest_WithoutKey(t *testing.T) {
+	msg := &Message{PostId: "abc:123"}
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com", nil)
+
+	if err := msg.SignPostbackRequest(req, agent.Device{}, nil, time.Now()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if req.Header.Get(PostbackSignatureHeader) != "" {
+		t.Error("expected an unsigned request without a shared access key")
+	}
+
+	device := agent.Device{SharedAccessKey: "not base64!"}
+	if err := msg.SignPostbackRequest(req, device, nil, time.Now()); err == nil {
+		t.Error("expected an error for an undecodable shared access key")
+	}
+}
@@ -29,15 +29,24 @@ type result struct {
 	Truncated           bool  `json:"truncated,omitempty"`
 	OutputBytesProduced int64 `json:"output_bytes_produced,omitempty"`
 	OutputBytesKept     int64 `json:"output_bytes_kept,omitempty"`
+	// OutputUploads references the full contents of the streams that passed the
+	// ceiling when the device uploads overflowing output (see
+	// agent.Device.OutputOverflow); Output and Error still carry the truncated
+	// leading bytes. OutputUploadError explains a failed upload, in which case
+	// the result is truncated as it would be without uploads.
+	OutputUploads     []OutputUpload `json:"output_uploads,omitempty"`
+	OutputUploadError string         `json:"output_upload_error,omitempty"`
 }
 
 // outputTruncation reports whether a command's captured output was cut short by
 // the per-command output ceiling, along with how many bytes the command produced
 // across stdout and stderr and how many of those were kept.
 type outputTruncation struct {
-	Truncated bool
-	Produced  int64
-	Kept      int64
+	Truncated   bool
+	Produced    int64
+	Kept        int64
+	Uploads     []OutputUpload
+	UploadError string
 }
 
 // applyTo copies the truncation signal onto a result. Nothing is set when the
@@ -50,6 +59,8 @@ func (t outputTruncation) applyTo(r *result) {
 	r.Truncated = true
 	r.OutputBytesProduced = t.Produced
 	r.OutputBytesKept = t.Kept
+	r.OutputUploads = t.Uploads
+	r.OutputUploadError = t.UploadError
 }
 
 func errorResultBytes(logger hclog.Logger, err error) []byte {
@@ -33,7 +33,8 @@ const (
 // SweepStaleScripts removes orphaned command script files left in dir by agent
 // runs that were terminated before their deferred cleanup could run. Without it
 // exec-*.ps1 files accumulate for the lifetime of the installation, consuming
-// disk and leaving script contents on disk indefinitely.
+// disk and leaving script contents on disk indefinitely. Output spill files
+// (spill-*.out) orphaned the same way are reclaimed alongside them.
 //
 // The sweep is intentionally conservative: it only considers regular files whose
 // name matches the exact pattern Execute creates (see isScriptFile) and whose
@@ -61,7 +62,7 @@ func SweepStaleScripts(dir string, maxAge time.Duration, logger hclog.Logger) in
 	cutoff := time.Now().Add(-maxAge)
 	removed := 0
 	for _, de := range dirEntries {
-		if de.IsDir() || !isScriptFile(de.Name()) {
+		if de.IsDir() || !(isScriptFile(de.Name()) || isSpillFile(de.Name())) {
 			continue
 		}
 
@@ -105,11 +106,21 @@ func SweepStaleScripts(dir string, maxAge time.Duration, logger hclog.Logger) in
 // keeps the sweep from touching similarly named files that this agent did not
 // create (for example an operator's own "exec-backup.ps1").
 func isScriptFile(name string) bool {
-	if !strings.HasPrefix(name, scriptFilePrefix) || !strings.HasSuffix(name, scriptFileSuffix) {
+	return matchesTempPattern(name, scriptFilePrefix, scriptFileSuffix)
+}
+
+// isSpillFile reports whether name matches the output spill file names produced
+// by os.CreateTemp(dir, spillTempPattern), on the same terms as isScriptFile.
+func isSpillFile(name string) bool {
+	return matchesTempPattern(name, spillFilePrefix, spillFileSuffix)
+}
+
+func matchesTempPattern(name string, prefix string, suffix string) bool {
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
 		return false
 	}
 
-	middle := name[len(scriptFilePrefix) : len(name)-len(scriptFileSuffix)]
+	middle := name[len(prefix) : len(name)-len(suffix)]
 	if middle == "" {
 		return false
 	}
@@ -190,3 +190,25 @@ func TestIsScriptFile_MatchesExecutorTempPattern(t *testing.T) {
 		t.Errorf("isScriptFile(%q) = false, want true for an executor-created name", name)
 	}
 }
+
+func TestSweepStaleScripts_RemovesStaleSpillFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeScriptFile(t, dir, "spill-123456.out", 48*time.Hour)
+	writeScriptFile(t, dir, "spill-654321.out", time.Minute)
+	writeScriptFile(t, dir, "spill-notes.out", 48*time.Hour)
+
+	logger, _ := newSweepLogger()
+	if removed := SweepStaleScripts(dir, DefaultStaleScriptAge, logger); removed != 1 {
+		t.Errorf("expected 1 file removed, got %d", removed)
+	}
+	for name, kept := range map[string]bool{
+		"spill-123456.out": false,
+		"spill-654321.out": true,
+		"spill-notes.out":  true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept != (err == nil) {
+			t.Errorf("%s: kept = %v, stat err = %v", name, kept, err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Stages of a Probe session, in the order they run.
+const (
+	ProbeConnect     = "connect"
+	ProbeSubscribe   = "subscribe"
+	ProbeUnsubscribe = "unsubscribe"
+)
+
+// subackFailure is the SUBACK return code for a refused subscription.
+const subackFailure = 0x80
+
+// ProbeStage is the outcome of one step of a Probe session.
+type ProbeStage struct {
+	Name    string
+	Latency time.Duration
+	Err     error
+}
+
+// Probe runs a short-lived session against the first broker in opts: CONNECT,
+// SUBSCRIBE to topic, UNSUBSCRIBE, then DISCONNECT. Each stage is bounded by
+// timeout and the probe stops at the first stage that fails, so the returned
+// stages end with the failure (if any).
+//
+// Reconnects are disabled, and so is automatic acknowledgement: a command that
+// happens to be delivered during the probe is never acknowledged, so the broker
+// redelivers it to the service instead of it being lost to the probe.
+func Probe(opts *mqtt.ClientOptions, topic string, qos byte, timeout time.Duration) []ProbeStage {
+	opts.SetAutoReconnect(false)
+	opts.SetConnectRetry(false)
+	opts.SetAutoAckDisabled(true)
+
+	client := mqtt.NewClient(opts)
+	defer client.Disconnect(uint(DefaultDisconnectQuiesce / time.Millisecond))
+
+	var stages []ProbeStage
+	run := func(name string, start func() Token) bool {
+		started := time.Now()
+		token := start()
+		err := waitProbeToken(token, timeout)
+		if err == nil {
+			err = probeTokenResult(token, topic)
+		}
+		stages = append(stages, ProbeStage{Name: name, Latency: time.Since(started), Err: err})
+		return err == nil
+	}
+
+	if !run(ProbeConnect, client.Connect) {
+		return stages
+	}
+	if !run(ProbeSubscribe, func() Token {
+		return client.Subscribe(topic, qos, func(mqtt.Client, mqtt.Message) {})
+	}) {
+		return stages
+	}
+	run(ProbeUnsubscribe, func() Token { return client.Unsubscribe(topic) })
+
+	return stages
+}
+
+func waitProbeToken(token Token, timeout time.Duration) error {
+	if WaitToken(token, timeout, nil) == TokenTimedOut {
+		return fmt.Errorf("timed out after %v waiting for broker", timeout)
+	}
+	return nil
+}
+
+// probeTokenResult reports the error of a resolved token, adding the CONNACK
+// return code to a refused connect and failing a SUBACK that refused topic.
+func probeTokenResult(token Token, topic string) error {
+	switch t := token.(type) {
+	case *mqtt.ConnectToken:
+		if err := t.Error(); err != nil {
+			if code := t.ReturnCode(); code != 0 {
+				return fmt.Errorf("%w (CONNACK return code %d)", err, code)
+			}
+			return err
+		}
+	case *mqtt.SubscribeToken:
+		if err := t.Error(); err != nil {
+			return err
+		}
+		if code, ok := t.Result()[topic]; ok && code == subackFailure {
+			return errors.New("broker refused the subscription (SUBACK 0x80)")
+		}
+	default:
+		return token.Error()
+	}
+	return nil
+}
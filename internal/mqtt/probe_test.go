@@ -0,0 +1,142 @@
+package mqtt
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// fakeBroker answers a single client over an in-memory connection.
+type fakeBroker struct {
+	connackCode byte
+	subackCode  byte
+	// silentSubscribe drops SUBSCRIBE packets to simulate a throttling broker.
+	silentSubscribe bool
+	// published receives the payload of every PUBLISH, if set.
+	published chan []byte
+}
+
+func (b fakeBroker) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		var reply packets.ControlPacket
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			connack.ReturnCode = b.connackCode
+			reply = connack
+		case *packets.SubscribePacket:
+			if b.silentSubscribe {
+				continue
+			}
+			suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			suback.MessageID = p.MessageID
+			suback.ReturnCodes = []byte{b.subackCode}
+			reply = suback
+		case *packets.PublishPacket:
+			if b.published != nil {
+				b.published <- p.Payload
+			}
+			if p.Qos == 0 {
+				continue
+			}
+			puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+			puback.MessageID = p.MessageID
+			reply = puback
+		case *packets.UnsubscribePacket:
+			unsuback := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			unsuback.MessageID = p.MessageID
+			reply = unsuback
+		case *packets.PingreqPacket:
+			reply = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		default:
+			continue
+		}
+
+		if err := reply.Write(conn); err != nil {
+			return
+		}
+	}
+}
+
+func newProbeOptions(broker fakeBroker) *mqtt.ClientOptions {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker("tcp://broker.test:1883")
+	opts.SetClientID("device")
+	opts.SetConnectTimeout(time.Second)
+	opts.SetCustomOpenConnectionFn(func(*url.URL, mqtt.ClientOptions) (net.Conn, error) {
+		client, server := net.Pipe()
+		go broker.serve(server)
+		return client, nil
+	})
+	return opts
+}
+
+func stageNames(stages []ProbeStage) string {
+	var names []string
+	for _, stage := range stages {
+		names = append(names, stage.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestProbe_Success(t *testing.T) {
+	stages := Probe(newProbeOptions(fakeBroker{subackCode: 1}), "devices/d/#", 1, time.Second)
+
+	if got := stageNames(stages); got != "connect,subscribe,unsubscribe" {
+		t.Fatalf("expected all stages, got %s", got)
+	}
+	for _, stage := range stages {
+		if stage.Err != nil {
+			t.Errorf("stage %s: unexpected error %v", stage.Name, stage.Err)
+		}
+	}
+}
+
+func TestProbe_ConnectRefused(t *testing.T) {
+	broker := fakeBroker{connackCode: packets.ErrRefusedNotAuthorised}
+	stages := Probe(newProbeOptions(broker), "devices/d/#", 1, time.Second)
+
+	if got := stageNames(stages); got != ProbeConnect {
+		t.Fatalf("expected to stop after connect, got %s", got)
+	}
+	if stages[0].Err == nil || !strings.Contains(stages[0].Err.Error(), "return code 5") {
+		t.Errorf("expected CONNACK return code in error, got %v", stages[0].Err)
+	}
+}
+
+func TestProbe_SubscribeRefused(t *testing.T) {
+	stages := Probe(newProbeOptions(fakeBroker{subackCode: 0x80}), "devices/d/#", 1, time.Second)
+
+	if got := stageNames(stages); got != "connect,subscribe" {
+		t.Fatalf("expected to stop after subscribe, got %s", got)
+	}
+	if stages[1].Err == nil || !strings.Contains(stages[1].Err.Error(), "SUBACK") {
+		t.Errorf("expected SUBACK refusal, got %v", stages[1].Err)
+	}
+}
+
+func TestProbe_SubscribeTimeout(t *testing.T) {
+	broker := fakeBroker{silentSubscribe: true}
+	stages := Probe(newProbeOptions(broker), "devices/d/#", 1, 100*time.Millisecond)
+
+	if got := stageNames(stages); got != "connect,subscribe" {
+		t.Fatalf("expected to stop after subscribe, got %s", got)
+	}
+	if stages[1].Err == nil || !strings.Contains(stages[1].Err.Error(), "timed out") {
+		t.Errorf("expected subscribe timeout, got %v", stages[1].Err)
+	}
+}
@@ -0,0 +1,48 @@
+package mqtt
+
+import (
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Publish connects to the first broker in opts, publishes payload to topic and
+// disconnects. Connecting and publishing are each bounded by timeout.
+//
+// As in Probe, reconnects and automatic acknowledgement are disabled, so a
+// command the broker delivers on the persistent session meanwhile is
+// redelivered rather than lost.
+func Publish(
+	opts *mqtt.ClientOptions,
+	topic string,
+	qos byte,
+	payload []byte,
+	timeout time.Duration,
+) error {
+	opts.SetAutoReconnect(false)
+	opts.SetConnectRetry(false)
+	opts.SetAutoAckDisabled(true)
+
+	client := mqtt.NewClient(opts)
+	defer client.Disconnect(uint(DefaultDisconnectQuiesce / time.Millisecond))
+
+	token := client.Connect()
+	err := waitProbeToken(token, timeout)
+	if err == nil {
+		err = probeTokenResult(token, topic)
+	}
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+
+	token = client.Publish(topic, qos, false, payload)
+	err = waitProbeToken(token, timeout)
+	if err == nil {
+		err = token.Error()
+	}
+	if err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package mqtt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestPublish_Success(t *testing.T) {
+	broker := fakeBroker{published: make(chan []byte, 1)}
+
+	opts := newProbeOptions(broker)
+	err := Publish(opts, "devices/d/messages/events/", 1, []byte("bye"), time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case payload := <-broker.published:
+		if string(payload) != "bye" {
+			t.Errorf("expected payload bye, got %q", payload)
+		}
+	default:
+		t.Error("expected the broker to receive the message")
+	}
+}
+
+func TestPublish_ConnectRefused(t *testing.T) {
+	broker := fakeBroker{connackCode: packets.ErrRefusedNotAuthorised}
+
+	err := Publish(newProbeOptions(broker), "devices/d/messages/events/", 1, nil, time.Second)
+	if err == nil || !strings.HasPrefix(err.Error(), "connect:") {
+		t.Errorf("expected a connect error, got %v", err)
+	}
+}
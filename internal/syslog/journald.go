@@ -0,0 +1,142 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// journalPriority maps an hclog level to the syslog priority journald stores
+// in the PRIORITY field.
+func journalPriority(level hclog.Level) int {
+	switch level {
+	case hclog.Error:
+		return int(SeverityError)
+	case hclog.Warn:
+		return int(SeverityWarning)
+	case hclog.Trace, hclog.Debug:
+		return int(SeverityDebug)
+	default:
+		return int(SeverityInfo)
+	}
+}
+
+// reservedJournalFields are set by the sink itself or trusted by journald, so a
+// log argument that maps onto one of them is prefixed with ARG_ instead of
+// overwriting it.
+var reservedJournalFields = map[string]bool{
+	"MESSAGE":           true,
+	"MESSAGE_ID":        true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"SYSLOG_FACILITY":   true,
+	"SYSLOG_PID":        true,
+	"LOGGER":            true,
+}
+
+// journalFieldName converts an hclog key such as "post_id" or "dropped-total"
+// into a valid journal field name ("POST_ID", "DROPPED_TOTAL"). Journal field
+// names may only hold upper-case letters, digits and underscores and must not
+// start with an underscore (reserved for trusted fields) or a digit.
+func journalFieldName(key string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(key) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+
+	name := strings.TrimLeft(b.String(), "_")
+	if name == "" {
+		return ""
+	}
+	if name[0] >= '0' && name[0] <= '9' || reservedJournalFields[name] {
+		name = "ARG_" + name
+	}
+	return name
+}
+
+// journalFields builds the fields of one journal entry. The human-readable
+// MESSAGE matches the log file, while every key/value pair is also stored as
+// its own field so entries can be filtered with journalctl FIELD=value.
+func journalFields(
+	identifier, name string,
+	level hclog.Level,
+	msg string,
+	args []interface{},
+) map[string]string {
+	fields := map[string]string{
+		"MESSAGE":           msg,
+		"PRIORITY":          fmt.Sprint(journalPriority(level)),
+		"SYSLOG_IDENTIFIER": identifier,
+	}
+	if name != "" {
+		fields["LOGGER"] = name
+	}
+
+	for i := 0; i+1 < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			key = fmt.Sprint(args[i])
+		}
+		field := journalFieldName(key)
+		if field == "" {
+			continue
+		}
+		fields[field] = journalValue(args[i+1])
+	}
+	if len(args)%2 == 1 {
+		fields["EXTRA_VALUE_AT_END"] = journalValue(args[len(args)-1])
+	}
+
+	return fields
+}
+
+func journalValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case error:
+		return value.Error()
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// encodeJournalEntry serializes fields in the native journal protocol: one
+// "FIELD=value\n" line per field, or the length-prefixed binary form for values
+// containing a newline. Fields are sorted so the encoding is deterministic.
+func encodeJournalEntry(fields map[string]string) []byte {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		value := fields[name]
+		if !strings.Contains(value, "\n") {
+			buf.WriteString(name)
+			buf.WriteByte('=')
+			buf.WriteString(value)
+			buf.WriteByte('\n')
+			continue
+		}
+
+		buf.WriteString(name)
+		buf.WriteByte('\n')
+		_ = binary.Write(&buf, binary.LittleEndian, uint64(len(value)))
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,182 @@
+//go:build linux
+
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/sys/unix"
+)
+
+// JournalSocketPath is where systemd-journald accepts native protocol
+// datagrams.
+const JournalSocketPath = "/run/systemd/journal/socket"
+
+// JournalSupported reports whether this platform can log to journald at all.
+const JournalSupported = true
+
+const (
+	// journalRedialMinBackoff is how long Accept waits after the socket is
+	// lost before dialing journald again. Each failed dial doubles the wait
+	// up to journalRedialMaxBackoff; entries arriving meanwhile are dropped.
+	journalRedialMinBackoff = time.Second
+	journalRedialMaxBackoff = time.Minute
+)
+
+// Journal is an hclog sink that writes every log entry to systemd-journald
+// over its native socket, keeping hclog key/value pairs as journal fields.
+// Register it on an hclog.InterceptLogger; the regular log output is left
+// untouched.
+type Journal struct {
+	path       string
+	identifier string
+	level      hclog.Level
+
+	mu          sync.Mutex
+	conn        *net.UnixConn
+	closed      bool
+	nextDialAt  time.Time
+	dialBackoff time.Duration
+
+	dropped atomic.Int64
+}
+
+// NewJournal connects to the local journald socket. Entries below level are
+// ignored, mirroring the level of the logger the sink is registered on, and
+// identifier is stored as SYSLOG_IDENTIFIER.
+func NewJournal(identifier string, level hclog.Level) (*Journal, error) {
+	return newJournalAt(JournalSocketPath, identifier, level)
+}
+
+func newJournalAt(path, identifier string, level hclog.Level) (*Journal, error) {
+	if level == hclog.NoLevel {
+		level = hclog.DefaultLevel
+	}
+
+	j := &Journal{path: path, identifier: identifier, level: level}
+	if err := j.dial(); err != nil {
+		return nil, fmt.Errorf("connect to journald at %s: %w", path, err)
+	}
+	return j, nil
+}
+
+func (j *Journal) dial() error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: j.path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	j.conn = conn
+	return nil
+}
+
+// Accept implements hclog.SinkAdapter. Delivery failures never reach the
+// caller; they are counted and visible through Dropped.
+func (j *Journal) Accept(name string, level hclog.Level, msg string, args ...interface{}) {
+	if level == hclog.Off || level < j.level {
+		return
+	}
+
+	data := encodeJournalEntry(journalFields(j.identifier, name, level, msg, args))
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.conn == nil && !j.redial() {
+		j.dropped.Add(1)
+		return
+	}
+
+	err := j.send(data)
+	if err != nil && !errors.Is(err, syscall.ENOBUFS) {
+		// journald may have been restarted underneath a connected socket;
+		// reconnect once before giving up on the entry.
+		_ = j.conn.Close()
+		j.conn = nil
+		if j.redial() {
+			err = j.send(data)
+		}
+	}
+	if err != nil {
+		// A full socket buffer means journald is behind, not gone; the
+		// entry is dropped and the connection kept.
+		j.dropped.Add(1)
+	}
+}
+
+// redial connects again after the socket was lost, unless the journal is
+// closed or the previous dial failed too recently, and reports whether there
+// is a connection to send on.
+func (j *Journal) redial() bool {
+	if j.closed || time.Now().Before(j.nextDialAt) {
+		return false
+	}
+	if err := j.dial(); err != nil {
+		j.dialBackoff = min(max(2*j.dialBackoff, journalRedialMinBackoff), journalRedialMaxBackoff)
+		j.nextDialAt = time.Now().Add(j.dialBackoff)
+		return false
+	}
+	j.dialBackoff = 0
+	return true
+}
+
+// send writes data as a single datagram, falling back to passing a sealed
+// memfd when the entry exceeds the socket's datagram limit, as the native
+// protocol allows.
+func (j *Journal) send(data []byte) error {
+	_, err := j.conn.Write(data)
+	if err == nil || !isMessageTooLarge(err) {
+		return err
+	}
+
+	fd, err := unix.MemfdCreate("agent_smith-journal", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return err
+	}
+	file := os.NewFile(uintptr(fd), "agent_smith-journal")
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	if _, err := unix.FcntlInt(
+		file.Fd(),
+		unix.F_ADD_SEALS,
+		unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL,
+	); err != nil {
+		return err
+	}
+
+	_, _, err = j.conn.WriteMsgUnix(nil, unix.UnixRights(int(file.Fd())), nil)
+	return err
+}
+
+func isMessageTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE)
+}
+
+// Dropped reports how many entries could not be delivered to journald.
+func (j *Journal) Dropped() int64 {
+	return j.dropped.Load()
+}
+
+// Close releases the journald socket. Entries accepted afterwards are dropped.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.closed = true
+	if j.conn == nil {
+		return nil
+	}
+	err := j.conn.Close()
+	j.conn = nil
+	return err
+}
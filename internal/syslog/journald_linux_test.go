@@ -0,0 +1,166 @@
+//go:build linux
+
+package syslog
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func listenJournal(t *testing.T) (*net.UnixConn, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn, path
+}
+
+func readJournalEntry(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 65536)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read datagram: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestJournal_WritesStructuredEntry(t *testing.T) {
+	conn, path := listenJournal(t)
+
+	j, err := newJournalAt(path, "rewst_remote_agent_org", hclog.Info)
+	if err != nil {
+		t.Fatalf("newJournalAt: %v", err)
+	}
+	defer j.Close()
+
+	logger := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+		Name:   "agent_smith",
+		Output: &strings.Builder{},
+	})
+	logger.RegisterSink(j)
+	logger.Error("Postback failed", "post_id", "abc-123", "worker", 2)
+
+	entry := readJournalEntry(t, conn)
+	for _, line := range []string{
+		"MESSAGE=Postback failed",
+		"PRIORITY=3",
+		"SYSLOG_IDENTIFIER=rewst_remote_agent_org",
+		"POST_ID=abc-123",
+		"WORKER=2",
+	} {
+		if !strings.Contains(entry, line+"\n") {
+			t.Errorf("entry %q missing %q", entry, line)
+		}
+	}
+	if j.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", j.Dropped())
+	}
+}
+
+func TestJournal_FiltersBelowLevel(t *testing.T) {
+	conn, path := listenJournal(t)
+
+	j, err := newJournalAt(path, "svc", hclog.Warn)
+	if err != nil {
+		t.Fatalf("newJournalAt: %v", err)
+	}
+	defer j.Close()
+
+	j.Accept("agent_smith", hclog.Info, "ignored")
+	j.Accept("agent_smith", hclog.Warn, "kept")
+
+	if entry := readJournalEntry(t, conn); !strings.Contains(entry, "MESSAGE=kept\n") {
+		t.Errorf("expected only the warning to be written, got %q", entry)
+	}
+}
+
+func TestJournal_MissingSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.sock")
+	if _, err := newJournalAt(path, "svc", hclog.Info); err == nil {
+		t.Error("expected error when journald socket does not exist")
+	}
+}
+
+func TestJournal_AcceptAfterCloseDrops(t *testing.T) {
+	_, path := listenJournal(t)
+
+	j, err := newJournalAt(path, "svc", hclog.Info)
+	if err != nil {
+		t.Fatalf("newJournalAt: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	j.Accept("agent_smith", hclog.Info, "late")
+	if j.Dropped() != 1 {
+		t.Errorf("Dropped() = %d, want 1", j.Dropped())
+	}
+}
+
+func TestJournal_RedialsAfterJournaldRestart(t *testing.T) {
+	listener, path := listenJournal(t)
+
+	j, err := newJournalAt(path, "svc", hclog.Info)
+	if err != nil {
+		t.Fatalf("newJournalAt: %v", err)
+	}
+	t.Cleanup(func() { _ = j.Close() })
+
+	// journald goes away: the entry is dropped and the dial backed off
+	_ = listener.Close()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	j.Accept("agent_smith", hclog.Info, "lost")
+	if j.Dropped() != 1 {
+		t.Fatalf("Dropped() = %d, want 1", j.Dropped())
+	}
+
+	// Back, but still within the backoff: dropped without a dial
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	j.Accept("agent_smith", hclog.Info, "backing off")
+	if j.Dropped() != 2 {
+		t.Fatalf("Dropped() = %d, want 2", j.Dropped())
+	}
+
+	// Once the backoff passes the journal reconnects
+	j.mu.Lock()
+	j.nextDialAt = time.Time{}
+	j.mu.Unlock()
+	j.Accept("agent_smith", hclog.Info, "reconnected")
+	if entry := readJournalEntry(t, conn); !strings.Contains(entry, "MESSAGE=reconnected\n") {
+		t.Errorf("expected the entry after reconnecting, got %q", entry)
+	}
+	if j.Dropped() != 2 {
+		t.Errorf("Dropped() = %d, want 2", j.Dropped())
+	}
+}
+
+func TestIsMessageTooLarge(t *testing.T) {
+	if !isMessageTooLarge(syscall.EMSGSIZE) {
+		t.Error("expected EMSGSIZE to be too large")
+	}
+	// ENOBUFS is a full socket buffer; a memfd would not help
+	if isMessageTooLarge(syscall.ENOBUFS) {
+		t.Error("expected ENOBUFS not to be too large")
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+
+package syslog
+
+import (
+	"errors"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// JournalSupported reports whether this platform can log to journald at all.
+const JournalSupported = false
+
+// Journal is only available on Linux, where systemd-journald runs.
+type Journal struct{}
+
+// NewJournal always fails outside Linux.
+func NewJournal(identifier string, level hclog.Level) (*Journal, error) {
+	return nil, errors.New("journald logging is only supported on Linux")
+}
+
+// Accept implements hclog.SinkAdapter.
+func (j *Journal) Accept(name string, level hclog.Level, msg string, args ...interface{}) {}
+
+// Dropped reports how many entries could not be delivered to journald.
+func (j *Journal) Dropped() int64 {
+	return 0
+}
+
+// Close releases the journald socket.
+func (j *Journal) Close() error {
+	return nil
+}
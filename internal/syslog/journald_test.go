@@ -0,0 +1,96 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestJournalFieldName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"post_id", "POST_ID"},
+		{"worker", "WORKER"},
+		{"scope", "SCOPE"},
+		{"dropped-total", "DROPPED_TOTAL"},
+		{"_private", "PRIVATE"},
+		{"2fa", "ARG_2FA"},
+		{"message", "ARG_MESSAGE"},
+		{"priority", "ARG_PRIORITY"},
+		{"___", ""},
+	}
+	for _, tt := range tests {
+		if got := journalFieldName(tt.key); got != tt.want {
+			t.Errorf("journalFieldName(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestJournalPriority(t *testing.T) {
+	tests := []struct {
+		level hclog.Level
+		want  int
+	}{
+		{hclog.Error, 3},
+		{hclog.Warn, 4},
+		{hclog.Info, 6},
+		{hclog.Debug, 7},
+		{hclog.Trace, 7},
+	}
+	for _, tt := range tests {
+		if got := journalPriority(tt.level); got != tt.want {
+			t.Errorf("journalPriority(%s) = %d, want %d", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestJournalFields_MapsArgs(t *testing.T) {
+	fields := journalFields(
+		"rewst_remote_agent_org",
+		"agent_smith",
+		hclog.Warn,
+		"Postback failed",
+		[]interface{}{"post_id", "abc", "worker", 3, "error", errors.New("boom"), "dangling"},
+	)
+
+	want := map[string]string{
+		"MESSAGE":            "Postback failed",
+		"PRIORITY":           "4",
+		"SYSLOG_IDENTIFIER":  "rewst_remote_agent_org",
+		"LOGGER":             "agent_smith",
+		"POST_ID":            "abc",
+		"WORKER":             "3",
+		"ERROR":              "boom",
+		"EXTRA_VALUE_AT_END": "dangling",
+	}
+	for name, value := range want {
+		if fields[name] != value {
+			t.Errorf("%s = %q, want %q", name, fields[name], value)
+		}
+	}
+	if len(fields) != len(want) {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+}
+
+func TestEncodeJournalEntry(t *testing.T) {
+	got := encodeJournalEntry(map[string]string{
+		"PRIORITY": "6",
+		"MESSAGE":  "line one\nline two",
+	})
+
+	var want bytes.Buffer
+	want.WriteString("MESSAGE\n")
+	_ = binary.Write(&want, binary.LittleEndian, uint64(len("line one\nline two")))
+	want.WriteString("line one\nline two\n")
+	want.WriteString("PRIORITY=6\n")
+
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("encodeJournalEntry = %q, want %q", got, want.Bytes())
+	}
+}
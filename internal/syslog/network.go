@@ -0,0 +1,426 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transport selects how the native syslog writer reaches the daemon.
+type Transport string
+
+const (
+	// TransportLocal writes datagrams to the local daemon socket (/dev/log and
+	// friends). It needs no external binary and no network access.
+	TransportLocal Transport = "local"
+	// TransportUDP sends one datagram per message to a remote collector.
+	TransportUDP Transport = "udp"
+	// TransportTCP streams messages to a remote collector using RFC 6587 framing.
+	TransportTCP Transport = "tcp"
+	// TransportTLS streams messages to a remote collector over TLS (RFC 5425).
+	TransportTLS Transport = "tls"
+)
+
+// ParseTransport validates a configured transport name.
+func ParseTransport(name string) (Transport, error) {
+	switch t := Transport(strings.ToLower(name)); t {
+	case TransportLocal, TransportUDP, TransportTCP, TransportTLS:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown syslog transport %q: must be local, udp, tcp or tls", name)
+}
+
+// Format selects the syslog message header layout.
+type Format string
+
+const (
+	// FormatRFC5424 is the structured, ISO-timestamped IETF syslog format.
+	FormatRFC5424 Format = "rfc5424"
+	// FormatRFC3164 is the legacy BSD syslog format understood by every local
+	// daemon, including journald's /dev/log listener.
+	FormatRFC3164 Format = "rfc3164"
+)
+
+// ParseFormat validates a configured format name. An empty name resolves to the
+// transport's natural format: RFC 3164 for the local socket, RFC 5424 otherwise.
+func ParseFormat(name string, transport Transport) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case "":
+		if transport == TransportLocal {
+			return FormatRFC3164, nil
+		}
+		return FormatRFC5424, nil
+	case FormatRFC5424, FormatRFC3164:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown syslog format %q: must be rfc5424 or rfc3164", name)
+}
+
+// Facility is a syslog facility code (RFC 5424 section 6.2.1).
+type Facility int
+
+var facilityNames = map[string]Facility{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// DefaultFacility is used when no facility is configured, matching the
+// daemon.* priorities the logger-based writer has always used.
+const DefaultFacility Facility = 3
+
+// ParseFacility resolves a facility name such as "daemon" or "local3". An empty
+// name resolves to DefaultFacility.
+func ParseFacility(name string) (Facility, error) {
+	if name == "" {
+		return DefaultFacility, nil
+	}
+	if f, ok := facilityNames[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+	return 0, fmt.Errorf("unknown syslog facility %q", name)
+}
+
+// Severity is a syslog severity code (RFC 5424 section 6.2.1).
+type Severity int
+
+const (
+	SeverityError   Severity = 3
+	SeverityWarning Severity = 4
+	SeverityInfo    Severity = 6
+	SeverityDebug   Severity = 7
+)
+
+// severityOf maps the level tag hclog writes at the start of every line to a
+// syslog severity. Untagged lines are reported as informational.
+func severityOf(line string) Severity {
+	switch {
+	case strings.Contains(line, "[ERROR]"):
+		return SeverityError
+	case strings.Contains(line, "[WARN]"), strings.Contains(line, "[WARNING]"):
+		return SeverityWarning
+	case strings.Contains(line, "[DEBUG]"), strings.Contains(line, "[TRACE]"):
+		return SeverityDebug
+	default:
+		return SeverityInfo
+	}
+}
+
+const (
+	// DefaultBufferSize is how many formatted messages may wait for the sender
+	// goroutine before new ones are dropped.
+	DefaultBufferSize = 1000
+
+	// networkWriteTimeout bounds a single send so a stalled collector can only
+	// delay the sender goroutine, never the agent's logging call sites.
+	networkWriteTimeout = 5 * time.Second
+	// networkDialTimeout bounds each connection attempt to the collector.
+	networkDialTimeout = 5 * time.Second
+	// networkRedialBackoff is how long the sender waits after a failed dial
+	// before trying again. Messages arriving in the meantime are dropped rather
+	// than queued behind a collector that is down.
+	networkRedialBackoff = 10 * time.Second
+	// networkCloseTimeout bounds how long Close waits for queued messages to
+	// drain before tearing the connection down.
+	networkCloseTimeout = 2 * time.Second
+)
+
+// localSocketPaths are probed in order when the local transport is used
+// without an explicit address.
+var localSocketPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// NetworkOptions configures the native syslog writer.
+type NetworkOptions struct {
+	Transport Transport
+	// Address is host:port for the network transports, or a socket path for
+	// the local transport. An empty local address probes localSocketPaths.
+	Address string
+	Format  Format
+	// Facility is the resolved facility code (see ParseFacility). Note that the
+	// zero value is kern, not DefaultFacility.
+	Facility Facility
+	// AppName is the APP-NAME (RFC 5424) or TAG (RFC 3164) of every message.
+	AppName string
+	// Hostname is reported in the message header. It defaults to os.Hostname.
+	Hostname string
+	// BufferSize bounds the number of messages waiting to be sent. It defaults
+	// to DefaultBufferSize.
+	BufferSize int
+	// TLSConfig overrides the client TLS configuration of the tls transport.
+	TLSConfig *tls.Config
+}
+
+// networkSyslog formats each log line as a syslog message and hands it to a
+// single sender goroutine through a bounded queue. Logging never blocks on the
+// collector: when the queue is full, or the collector is unreachable, messages
+// are dropped and counted instead. Every line is also forwarded unchanged to
+// out so the local log file stays complete regardless of syslog health.
+type networkSyslog struct {
+	out  io.Writer
+	opts NetworkOptions
+	pid  int
+
+	dial func() (net.Conn, error)
+
+	// mu guards closed against the queue being closed underneath a Write.
+	mu     sync.RWMutex
+	closed bool
+	queue  chan []byte
+	done   chan struct{}
+
+	conn       net.Conn
+	nextDialAt time.Time
+
+	dropped atomic.Int64
+}
+
+// NewNetwork returns a Syslog that speaks the syslog protocol natively over the
+// transport described by opts, instead of shelling out to the logger binary.
+func NewNetwork(opts NetworkOptions, out io.Writer) (Syslog, error) {
+	if _, err := ParseTransport(string(opts.Transport)); err != nil {
+		return nil, err
+	}
+	if opts.Transport != TransportLocal && opts.Address == "" {
+		return nil, fmt.Errorf("syslog transport %s requires an address", opts.Transport)
+	}
+	format, err := ParseFormat(string(opts.Format), opts.Transport)
+	if err != nil {
+		return nil, err
+	}
+	opts.Format = format
+	if opts.AppName == "" {
+		opts.AppName = "agent_smith"
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+
+	return newNetworkWithDialer(opts, out, nil), nil
+}
+
+// newNetworkWithDialer starts the writer with an injectable dialer so tests can
+// substitute failing or in-memory connections. A nil dial uses the transport's
+// real dialer. opts must already be resolved by NewNetwork.
+func newNetworkWithDialer(
+	opts NetworkOptions,
+	out io.Writer,
+	dial func() (net.Conn, error),
+) *networkSyslog {
+	s := &networkSyslog{
+		out:   out,
+		opts:  opts,
+		pid:   os.Getpid(),
+		queue: make(chan []byte, opts.BufferSize),
+		done:  make(chan struct{}),
+		dial:  dial,
+	}
+	if s.dial == nil {
+		s.dial = s.defaultDial
+	}
+
+	go s.run()
+
+	return s
+}
+
+func (s *networkSyslog) defaultDial() (net.Conn, error) {
+	switch s.opts.Transport {
+	case TransportLocal:
+		if s.opts.Address != "" {
+			return net.DialTimeout("unixgram", s.opts.Address, networkDialTimeout)
+		}
+		var lastErr error
+		for _, path := range localSocketPaths {
+			conn, err := net.DialTimeout("unixgram", path, networkDialTimeout)
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, fmt.Errorf("no local syslog socket available: %w", lastErr)
+	case TransportUDP:
+		return net.DialTimeout("udp", s.opts.Address, networkDialTimeout)
+	case TransportTCP:
+		return net.DialTimeout("tcp", s.opts.Address, networkDialTimeout)
+	case TransportTLS:
+		config := s.opts.TLSConfig
+		if config == nil {
+			config = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		return tls.DialWithDialer(
+			&net.Dialer{Timeout: networkDialTimeout},
+			"tcp",
+			s.opts.Address,
+			config,
+		)
+	}
+	return nil, fmt.Errorf("unsupported syslog transport %q", s.opts.Transport)
+}
+
+func (s *networkSyslog) Write(data []byte) (int, error) {
+	line := string(data)
+	frame := s.frame(s.format(severityOf(line), strings.TrimSpace(extractMessage(line))))
+
+	s.mu.RLock()
+	if !s.closed {
+		select {
+		case s.queue <- frame:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+	s.mu.RUnlock()
+
+	return s.out.Write(data)
+}
+
+// Dropped returns how many messages were discarded because the queue was full
+// or the collector could not be reached.
+func (s *networkSyslog) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close stops accepting messages, gives the sender a bounded window to flush
+// what is already queued, and closes the connection.
+func (s *networkSyslog) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+	case <-time.After(networkCloseTimeout):
+	}
+	return nil
+}
+
+// run is the single sender goroutine. It owns conn, so no locking is needed.
+func (s *networkSyslog) run() {
+	defer close(s.done)
+	defer func() {
+		if s.conn != nil {
+			_ = s.conn.Close()
+		}
+	}()
+
+	for frame := range s.queue {
+		if err := s.send(frame); err != nil {
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// send writes one frame, reconnecting once if the existing connection turns
+// out to be broken. Failed dials are backed off so an unreachable collector
+// costs one dial per networkRedialBackoff rather than one per message.
+func (s *networkSyslog) send(frame []byte) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if time.Now().Before(s.nextDialAt) {
+				return errors.New("syslog collector unavailable")
+			}
+			conn, err := s.dial()
+			if err != nil {
+				s.nextDialAt = time.Now().Add(networkRedialBackoff)
+				return err
+			}
+			s.conn = conn
+		}
+
+		_ = s.conn.SetWriteDeadline(time.Now().Add(networkWriteTimeout))
+		if _, err := s.conn.Write(frame); err == nil {
+			return nil
+		}
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	return errors.New("syslog write failed")
+}
+
+// format renders the syslog message for the configured header layout.
+func (s *networkSyslog) format(severity Severity, message string) string {
+	pri := int(s.opts.Facility)*8 + int(severity)
+	now := time.Now()
+
+	if s.opts.Format == FormatRFC3164 {
+		// The local daemon stamps its own hostname, and glibc's syslog(3) omits
+		// it on the local socket, so it is only included for remote collectors.
+		host := ""
+		if s.opts.Transport != TransportLocal {
+			host = headerField(s.opts.Hostname) + " "
+		}
+		return fmt.Sprintf(
+			"<%d>%s %s%s[%d]: %s",
+			pri,
+			now.Format(time.Stamp),
+			host,
+			s.opts.AppName,
+			s.pid,
+			message,
+		)
+	}
+
+	return fmt.Sprintf(
+		"<%d>1 %s %s %s %d - - %s",
+		pri,
+		now.Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(s.opts.Hostname),
+		headerField(s.opts.AppName),
+		s.pid,
+		message,
+	)
+}
+
+// frame applies the transport framing. Stream transports use octet counting
+// (RFC 6587 section 3.4.1) for RFC 5424 and newline termination for the legacy
+// format; datagram transports carry exactly one message per packet.
+func (s *networkSyslog) frame(message string) []byte {
+	switch s.opts.Transport {
+	case TransportTCP, TransportTLS:
+		if s.opts.Format == FormatRFC5424 {
+			return []byte(fmt.Sprintf("%d %s", len(message), message))
+		}
+		return []byte(message + "\n")
+	default:
+		return []byte(message)
+	}
+}
+
+// headerField returns value as an RFC 5424 header field: the NILVALUE for an
+// empty value, with any whitespace replaced so the header stays parseable.
+func headerField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strings.Join(strings.Fields(value), "_")
+}
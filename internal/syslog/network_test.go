@@ -0,0 +1,268 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTransport(t *testing.T) {
+	for _, name := range []string{"local", "udp", "tcp", "tls", "TCP"} {
+		if _, err := ParseTransport(name); err != nil {
+			t.Errorf("ParseTransport(%q) returned error: %v", name, err)
+		}
+	}
+	if _, err := ParseTransport("smoke-signal"); err == nil {
+		t.Error("expected error for unknown transport")
+	}
+}
+
+func TestParseFormat_DefaultsByTransport(t *testing.T) {
+	if f, _ := ParseFormat("", TransportLocal); f != FormatRFC3164 {
+		t.Errorf("local default = %q, want %q", f, FormatRFC3164)
+	}
+	if f, _ := ParseFormat("", TransportTCP); f != FormatRFC5424 {
+		t.Errorf("tcp default = %q, want %q", f, FormatRFC5424)
+	}
+	if _, err := ParseFormat("rfc1", TransportUDP); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestParseFacility(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Facility
+		wantErr bool
+	}{
+		{"", DefaultFacility, false},
+		{"daemon", 3, false},
+		{"LOCAL3", 19, false},
+		{"user", 1, false},
+		{"nope", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFacility(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFacility(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseFacility(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSeverityOf(t *testing.T) {
+	tests := []struct {
+		line string
+		want Severity
+	}{
+		{"2026-01-01T00:00:00.000Z [ERROR] agent_smith: boom", SeverityError},
+		{"2026-01-01T00:00:00.000Z [WARN]  agent_smith: hmm", SeverityWarning},
+		{"2026-01-01T00:00:00.000Z [INFO]  agent_smith: ok", SeverityInfo},
+		{"2026-01-01T00:00:00.000Z [DEBUG] agent_smith: detail", SeverityDebug},
+		{"untagged", SeverityInfo},
+	}
+	for _, tt := range tests {
+		if got := severityOf(tt.line); got != tt.want {
+			t.Errorf("severityOf(%q) = %d, want %d", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestNewNetwork_RequiresAddressForRemoteTransports(t *testing.T) {
+	if _, err := NewNetwork(NetworkOptions{Transport: TransportUDP}, &bytes.Buffer{}); err == nil {
+		t.Error("expected error when udp transport has no address")
+	}
+	if _, err := NewNetwork(NetworkOptions{Transport: "pigeon"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for unknown transport")
+	}
+}
+
+var rfc5424Header = regexp.MustCompile(
+	`^<(\d+)>1 \d{4}-\d{2}-\d{2}T\S+ test-host my-app \d+ - - (.*)$`,
+)
+
+func TestNetworkSyslog_UDPDeliversRFC5424(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer pc.Close()
+
+	var out bytes.Buffer
+	s, err := NewNetwork(NetworkOptions{
+		Transport: TransportUDP,
+		Address:   pc.LocalAddr().String(),
+		Facility:  19, // local3
+		AppName:   "my-app",
+		Hostname:  "test-host",
+	}, &out)
+	if err != nil {
+		t.Fatalf("NewNetwork: %v", err)
+	}
+
+	line := "2026-01-01T00:00:00.000Z [WARN]  agent_smith: disk nearly full\n"
+	if _, err := s.Write([]byte(line)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read datagram: %v", err)
+	}
+	_ = s.Close()
+
+	m := rfc5424Header.FindStringSubmatch(string(buf[:n]))
+	if m == nil {
+		t.Fatalf("datagram %q is not an RFC 5424 message", buf[:n])
+	}
+	if m[1] != strconv.Itoa(19*8+int(SeverityWarning)) {
+		t.Errorf("PRI = %s, want %d", m[1], 19*8+int(SeverityWarning))
+	}
+	if m[2] != "agent_smith: disk nearly full" {
+		t.Errorf("MSG = %q", m[2])
+	}
+	if out.String() != line {
+		t.Errorf("expected line forwarded to out, got %q", out.String())
+	}
+}
+
+func TestNetworkSyslog_TCPUsesOctetCounting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		lenField, err := r.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(lenField))
+		msg := make([]byte, n)
+		if _, err := r.Read(msg); err != nil {
+			return
+		}
+		received <- string(msg)
+	}()
+
+	s, err := NewNetwork(NetworkOptions{
+		Transport: TransportTCP,
+		Address:   ln.Addr().String(),
+		Facility:  DefaultFacility,
+		AppName:   "my-app",
+		Hostname:  "test-host",
+	}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("NewNetwork: %v", err)
+	}
+	defer s.Close()
+
+	_, _ = s.Write([]byte("2026-01-01T00:00:00.000Z [ERROR] agent_smith: failed\n"))
+
+	select {
+	case msg := <-received:
+		m := rfc5424Header.FindStringSubmatch(msg)
+		if m == nil {
+			t.Fatalf("frame %q is not an RFC 5424 message", msg)
+		}
+		if m[1] != strconv.Itoa(int(DefaultFacility)*8+int(SeverityError)) {
+			t.Errorf("PRI = %s", m[1])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for framed message")
+	}
+}
+
+func TestNetworkSyslog_RFC3164LocalOmitsHostname(t *testing.T) {
+	s := &networkSyslog{
+		opts: NetworkOptions{
+			Transport: TransportLocal,
+			Format:    FormatRFC3164,
+			Facility:  DefaultFacility,
+			AppName:   "svc",
+			Hostname:  "test-host",
+		},
+		pid: 42,
+	}
+
+	msg := s.format(SeverityInfo, "hello")
+	if !regexp.MustCompile(`^<30>[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2} svc\[42\]: hello$`).
+		MatchString(msg) {
+		t.Errorf("unexpected RFC 3164 local message %q", msg)
+	}
+	if got := string(s.frame(msg)); got != msg {
+		t.Errorf("datagram framing altered message: %q", got)
+	}
+}
+
+func TestNetworkSyslog_DropsWhenQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	dial := func() (net.Conn, error) {
+		<-release
+		return nil, errors.New("collector down")
+	}
+
+	var out bytes.Buffer
+	s := newNetworkWithDialer(NetworkOptions{
+		Transport:  TransportUDP,
+		Address:    "127.0.0.1:1",
+		Format:     FormatRFC5424,
+		BufferSize: 2,
+	}, &out, dial)
+
+	for range 10 {
+		if _, err := s.Write([]byte("[INFO] line\n")); err != nil {
+			t.Fatalf("Write must never fail on syslog backpressure: %v", err)
+		}
+	}
+
+	// The sender is parked on the first message, two more fit in the queue, and
+	// the rest are dropped without blocking the caller.
+	if got := s.Dropped(); got < 7 {
+		t.Errorf("expected at least 7 dropped messages, got %d", got)
+	}
+	if strings.Count(out.String(), "line") != 10 {
+		t.Errorf("every line must still reach out, got %q", out.String())
+	}
+
+	close(release)
+	_ = s.Close()
+}
+
+func TestNetworkSyslog_WriteAfterCloseForwardsOnly(t *testing.T) {
+	var out bytes.Buffer
+	s := newNetworkWithDialer(NetworkOptions{
+		Transport:  TransportUDP,
+		Address:    "127.0.0.1:1",
+		Format:     FormatRFC5424,
+		BufferSize: 1,
+	}, &out, func() (net.Conn, error) { return nil, errors.New("unused") })
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := s.Write([]byte("[INFO] late\n")); err != nil {
+		t.Fatalf("Write after Close: %v", err)
+	}
+	if out.String() != "[INFO] late\n" {
+		t.Errorf("expected late line forwarded to out, got %q", out.String())
+	}
+}
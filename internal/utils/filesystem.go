@@ -8,6 +8,8 @@ const (
 	DefaultFileMod           os.FileMode = 0o644
 	DefaultExecutableFileMod os.FileMode = 0o755
 	DefaultDirMod            os.FileMode = 0o755
+	// SecretFileMod is for files holding credentials, such as config.json.
+	SecretFileMod os.FileMode = 0o600
 )
 
 type FileSystem interface {
@@ -28,8 +30,13 @@ func (*defaultFileSystem) ReadFile(name string) ([]byte, error) {
 	return os.ReadFile(name)
 }
 
+// WriteFile writes data to name and applies perm even when the file already
+// exists, so rewriting a file tightens the mode an older release gave it.
 func (*defaultFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
-	return os.WriteFile(name, data, perm)
+	if err := os.WriteFile(name, data, perm); err != nil {
+		return err
+	}
+	return os.Chmod(name, perm)
 }
 
 func (*defaultFileSystem) MkdirAll(path string) error {
@@ -3,6 +3,7 @@ package utils
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 )
 
@@ -65,6 +66,29 @@ func TestDefaultFileSystem_WriteFile(t *testing.T) {
 	}
 }
 
+func TestDefaultFileSystem_WriteFileAppliesModeToExistingFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mode bits are not enforced on Windows")
+	}
+	fs := NewFileSystem()
+	filePath := filepath.Join(t.TempDir(), "test.txt")
+
+	if err := os.WriteFile(filePath, []byte("old"), DefaultFileMod); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile(filePath, []byte("new"), SecretFileMod); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != SecretFileMod {
+		t.Errorf("expected mode %v, got %v", SecretFileMod, info.Mode().Perm())
+	}
+}
+
 func TestDefaultFileSystem_ReadFile(t *testing.T) {
 	fs := NewFileSystem()
 	filePath := filepath.Join(t.TempDir(), "test.txt")
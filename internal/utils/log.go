@@ -25,3 +25,23 @@ func ConfigureLogger(prefix string, writer io.Writer, level LoggingLevel) hclog.
 		Output: writer,
 	})
 }
+
+// ConfigureLoggerWithSinks behaves like ConfigureLogger but also hands every
+// entry, with its key/value pairs still structured, to each of sinks. Sinks
+// receive entries of every level and are expected to filter on their own.
+func ConfigureLoggerWithSinks(
+	prefix string,
+	writer io.Writer,
+	level LoggingLevel,
+	sinks ...hclog.SinkAdapter,
+) hclog.Logger {
+	logger := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+		Name:   prefix,
+		Level:  hclog.LevelFromString(string(level)),
+		Output: writer,
+	})
+	for _, sink := range sinks {
+		logger.RegisterSink(sink)
+	}
+	return logger
+}
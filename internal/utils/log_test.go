@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+
+	"github.com/hashicorp/go-hclog"
 )
 
 func TestConfigureLogger(t *testing.T) {
@@ -25,3 +27,31 @@ func TestConfigureLogger(t *testing.T) {
 		t.Errorf("expected log message to contain '%s', got %s", message, output)
 	}
 }
+
+type recordingSink struct {
+	messages []string
+	args     [][]interface{}
+}
+
+func (s *recordingSink) Accept(name string, level hclog.Level, msg string, args ...interface{}) {
+	s.messages = append(s.messages, msg)
+	s.args = append(s.args, args)
+}
+
+func TestConfigureLoggerWithSinks(t *testing.T) {
+	buf := bytes.Buffer{}
+	sink := &recordingSink{}
+
+	logger := ConfigureLoggerWithSinks("TEST", &buf, Info, sink)
+	logger.Info("structured", "post_id", "abc")
+
+	if !strings.Contains(buf.String(), "structured") {
+		t.Errorf("expected writer to receive the entry, got %s", buf.String())
+	}
+	if len(sink.messages) != 1 || sink.messages[0] != "structured" {
+		t.Fatalf("expected sink to receive the entry, got %v", sink.messages)
+	}
+	if len(sink.args[0]) != 2 || sink.args[0][0] != "post_id" || sink.args[0][1] != "abc" {
+		t.Errorf("expected structured args, got %v", sink.args[0])
+	}
+}